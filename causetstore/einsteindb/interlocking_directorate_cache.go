@@ -0,0 +1,175 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package einsteindb
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"sync"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/metrics"
+	"github.com/whtcorpsinc/errors"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
+)
+
+// INTERLOCKCache caches the results of the cacheable interlock requests, see
+// solomonkey.Request.Cacheable. A result is cached by the digest of its request and
+// its Region, with the data version of the Region it's read at. The causetstore
+// replies a cache hit instead of the result as long as the Region has had no
+// writes since that version.
+type INTERLOCKCache struct {
+	mu       sync.Mutex
+	capacity int64
+	size     int64
+	lru      *list.List
+	entries  map[string]*list.Element
+}
+
+// INTERLOCKCacheValue is a cached interlock result.
+type INTERLOCKCacheValue struct {
+	key               string
+	Data              []byte
+	RegionID          uint64
+	RegionDataVersion uint64
+}
+
+func (v *INTERLOCKCacheValue) memSize() int64 {
+	return int64(len(v.key) + len(v.Data) + 16)
+}
+
+// NewINTERLOCKCache creates an INTERLOCKCache holding at most capacity bytes of results.
+func NewINTERLOCKCache(capacity int64) *INTERLOCKCache {
+	return &INTERLOCKCache{
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// INTERLOCKCacheKey returns the cache key of an interlock request on a Region. The
+// start ts isn't a part of it, a cached result is reused by later reads.
+func INTERLOCKCacheKey(req *interlock.Request, regionID uint64) string {
+	h := sha256.New()
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(req.Tp))
+	h.Write(buf[:])
+	writeCacheKeyBytes(h, req.Data)
+	for _, ran := range req.Ranges {
+		writeCacheKeyBytes(h, ran.Start)
+		writeCacheKeyBytes(h, ran.End)
+	}
+	binary.BigEndian.PutUint64(buf[:], regionID)
+	return string(h.Sum(buf[:]))
+}
+
+func writeCacheKeyBytes(h hash.Hash, b []byte) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(len(b)))
+	h.Write(buf[:])
+	h.Write(b)
+}
+
+// Get returns the cached value of key, nil if it's not cached.
+func (c *INTERLOCKCache) Get(key string) *INTERLOCKCacheValue {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*INTERLOCKCacheValue)
+}
+
+// Set caches a value under key, the least recently used values are evicted to keep
+// the cache within its capacity. A value larger than the capacity isn't cached.
+func (c *INTERLOCKCache) Set(key string, v *INTERLOCKCacheValue) bool {
+	v.key = key
+	size := v.memSize()
+	if size > c.capacity {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	for c.size+size > c.capacity {
+		c.remove(c.lru.Back())
+		metrics.EinsteinDBINTERLOCKCacheCounter.WithLabelValues(metrics.LblEvicted).Inc()
+	}
+	c.entries[key] = c.lru.PushFront(v)
+	c.size += size
+	metrics.EinsteinDBINTERLOCKCacheMemoryGauge.Set(float64(c.size))
+	return true
+}
+
+func (c *INTERLOCKCache) remove(elem *list.Element) {
+	v := c.lru.Remove(elem).(*INTERLOCKCacheValue)
+	delete(c.entries, v.key)
+	c.size -= v.memSize()
+	metrics.EinsteinDBINTERLOCKCacheMemoryGauge.Set(float64(c.size))
+}
+
+// Len returns the number of the cached values.
+func (c *INTERLOCKCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Size returns the memory used by the cached values.
+func (c *INTERLOCKCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// PrepareRequest enables the cache for req on a Region, the causetstore replies the
+// data version of the Region for a result which can be cached. If the result is
+// already cached, the causetstore is asked to check its version. The returned key and
+// value are passed to HandleResponse.
+func (c *INTERLOCKCache) PrepareRequest(req *interlock.Request, regionID uint64) (string, *INTERLOCKCacheValue) {
+	key := INTERLOCKCacheKey(req, regionID)
+	req.IsCacheEnabled = true
+	cached := c.Get(key)
+	if cached != nil {
+		req.CacheIfMatchVersion = cached.RegionDataVersion
+	}
+	return key, cached
+}
+
+// HandleResponse returns the result data of the response of a request prepared by
+// PrepareRequest. The data is taken from the cache on a cache hit, and the response is
+// cached if the causetstore says it can be.
+func (c *INTERLOCKCache) HandleResponse(key string, regionID uint64, cached *INTERLOCKCacheValue, resp *interlock.Response) ([]byte, error) {
+	if resp.IsCacheHit {
+		if cached == nil {
+			return nil, errors.New("interlock cache hit without a cached value")
+		}
+		metrics.EinsteinDBINTERLOCKCacheCounter.WithLabelValues(metrics.LblHit).Inc()
+		return cached.Data, nil
+	}
+	metrics.EinsteinDBINTERLOCKCacheCounter.WithLabelValues(metrics.LblMiss).Inc()
+	if resp.CanBeCached && resp.RegionError == nil && resp.Locked == nil && resp.OtherError == "" {
+		c.Set(key, &INTERLOCKCacheValue{
+			Data:              resp.Data,
+			RegionID:          regionID,
+			RegionDataVersion: resp.CacheLastVersion,
+		})
+	}
+	return resp.Data, nil
+}
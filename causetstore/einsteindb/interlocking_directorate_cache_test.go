@@ -0,0 +1,88 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package einsteindb
+
+import (
+	"testing"
+
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testINTERLOCKCacheSuite{})
+
+type testINTERLOCKCacheSuite struct{}
+
+func (s *testINTERLOCKCacheSuite) TestINTERLOCKCacheKey(c *C) {
+	req := &interlock.Request{Tp: 103, Data: []byte("dag"), Ranges: []*interlock.KeyRange{{Start: []byte("a"), End: []byte("b")}}}
+	key := INTERLOCKCacheKey(req, 1)
+	c.Assert(INTERLOCKCacheKey(req, 1), Equals, key)
+	c.Assert(INTERLOCKCacheKey(req, 2), Not(Equals), key)
+	// The start ts isn't a part of the key.
+	req.StartTs = 10
+	c.Assert(INTERLOCKCacheKey(req, 1), Equals, key)
+	// The boundaries of the ranges are.
+	req.Ranges = []*interlock.KeyRange{{Start: []byte("ab"), End: []byte("")}}
+	c.Assert(INTERLOCKCacheKey(req, 1), Not(Equals), key)
+}
+
+func (s *testINTERLOCKCacheSuite) TestINTERLOCKCacheEviction(c *C) {
+	value := func() *INTERLOCKCacheValue { return &INTERLOCKCacheValue{Data: make([]byte, 8)} }
+	cache := NewINTERLOCKCache(3 * value().memSize())
+	for _, k := range []string{"a", "b", "c"} {
+		c.Assert(cache.Set(k, value()), IsTrue)
+	}
+	c.Assert(cache.Get("a"), NotNil)
+	c.Assert(cache.Set("d", value()), IsTrue)
+	c.Assert(cache.Len(), Equals, 3)
+	c.Assert(cache.Get("b"), IsNil)
+	c.Assert(cache.Get("a"), NotNil)
+	c.Assert(cache.Set("huge", &INTERLOCKCacheValue{Data: make([]byte, 1024)}), IsFalse)
+	c.Assert(cache.Len(), Equals, 3)
+	c.Assert(cache.Size() <= 3*value().memSize(), IsTrue)
+}
+
+func (s *testINTERLOCKCacheSuite) TestINTERLOCKCacheRequestResponse(c *C) {
+	cache := NewINTERLOCKCache(1 << 20)
+	req := &interlock.Request{Tp: 103, Data: []byte("dag")}
+	key, cached := cache.PrepareRequest(req, 1)
+	c.Assert(cached, IsNil)
+	c.Assert(req.IsCacheEnabled, IsTrue)
+	c.Assert(req.CacheIfMatchVersion, Equals, uint64(0))
+
+	data, err := cache.HandleResponse(key, 1, cached, &interlock.Response{Data: []byte("result"), CanBeCached: true, CacheLastVersion: 5})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "result")
+
+	req = &interlock.Request{Tp: 103, Data: []byte("dag")}
+	key, cached = cache.PrepareRequest(req, 1)
+	c.Assert(cached, NotNil)
+	c.Assert(req.IsCacheEnabled, IsTrue)
+	c.Assert(req.CacheIfMatchVersion, Equals, uint64(5))
+	data, err = cache.HandleResponse(key, 1, cached, &interlock.Response{IsCacheHit: true})
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "result")
+
+	// A response that can't be cached leaves the cache as it is.
+	_, err = cache.HandleResponse(key, 1, nil, &interlock.Response{Data: []byte("new")})
+	c.Assert(err, IsNil)
+	c.Assert(string(cache.Get(key).Data), Equals, "result")
+
+	_, err = cache.HandleResponse(key, 1, nil, &interlock.Response{IsCacheHit: true})
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,86 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package einsteindb
+
+import (
+	"context"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/errors"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+)
+
+// SendINTERLOCKPages sends req on ranges, the ranges of a Region, to the causetstore at
+// addr and passes the responses to handle. A paging request, see
+// solomonkey.Request.Paging, is sent again from where the last page stopped until its
+// ranges are all scanned. The first response with an error is returned as an error.
+func SendINTERLOCKPages(ctx context.Context, client Client, addr string, reqCtx kvrpcpb.Context, req *solomonkey.Request, ranges []solomonkey.KeyRange, handle func(*interlock.Response) error) error {
+	for len(ranges) > 0 {
+		resp, err := client.SendRequest(ctx, addr, einsteindbrpc.NewRequest(einsteindbrpc.CmdINTERLOCK, buildPagingRequest(req, ranges), reqCtx), ReadTimeoutMedium)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		INTERLOCKResp, ok := resp.Resp.(*interlock.Response)
+		if !ok {
+			return errors.Errorf("unexpected interlock response %T", resp.Resp)
+		}
+		switch {
+		case INTERLOCKResp.RegionError != nil:
+			return errors.New(INTERLOCKResp.RegionError.String())
+		case INTERLOCKResp.Locked != nil:
+			return errors.Errorf("key is locked: %v", INTERLOCKResp.Locked)
+		case INTERLOCKResp.OtherError != "":
+			return errors.New(INTERLOCKResp.OtherError)
+		}
+		if err = handle(INTERLOCKResp); err != nil {
+			return errors.Trace(err)
+		}
+		if !req.Paging {
+			return nil
+		}
+		ranges = NextPageRanges(ranges, INTERLOCKResp, req.Desc)
+	}
+	return nil
+}
+
+// buildPagingRequest builds the interlock request of req on ranges. The interlock
+// request has no field for the paging budget, so a paging PosetDag request is sent as
+// a solomonkey.ReqTypePagingPosetDag request carrying it in its data.
+func buildPagingRequest(req *solomonkey.Request, ranges []solomonkey.KeyRange) *interlock.Request {
+	INTERLOCK := &interlock.Request{
+		Tp:      req.Tp,
+		Data:    req.Data,
+		StartTs: req.StartTs,
+		Ranges:  make([]*interlock.KeyRange, 0, len(ranges)),
+	}
+	for _, ran := range ranges {
+		INTERLOCK.Ranges = append(INTERLOCK.Ranges, &interlock.KeyRange{Start: ran.StartKey, End: ran.EndKey})
+	}
+	if req.Paging && req.Tp == solomonkey.ReqTypePosetDag {
+		INTERLOCK.Tp = solomonkey.ReqTypePagingPosetDag
+		INTERLOCK.Data = solomonkey.EncodePagingRequest(req.Data, req.PagingSize, req.PagingBytes)
+	}
+	return INTERLOCK
+}
+
+// NextPageRanges returns the ranges a paging request resumes from after its response
+// resp, nil if the ranges are all scanned.
+func NextPageRanges(ranges []solomonkey.KeyRange, resp *interlock.Response, desc bool) []solomonkey.KeyRange {
+	if resp.Range == nil {
+		return nil
+	}
+	return solomonkey.ResumeKeyRanges(ranges, solomonkey.KeyRange{StartKey: resp.Range.Start, EndKey: resp.Range.End}, desc)
+}
@@ -0,0 +1,64 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package einsteindb
+
+import (
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
+)
+
+var _ = Suite(&testPagingSuite{})
+
+type testPagingSuite struct{}
+
+func (s *testPagingSuite) TestBuildPagingRequest(c *C) {
+	ranges := []solomonkey.KeyRange{{StartKey: solomonkey.Key("a"), EndKey: solomonkey.Key("c")}}
+	req := &solomonkey.Request{Tp: solomonkey.ReqTypePosetDag, Data: []byte("posetdag"), StartTs: 10, PagingSize: 10, PagingBytes: 1024}
+	// The budget is only carried when paging.
+	INTERLOCK := buildPagingRequest(req, ranges)
+	c.Assert(INTERLOCK.Tp, Equals, int64(solomonkey.ReqTypePosetDag))
+	c.Assert(INTERLOCK.Data, DeepEquals, []byte("posetdag"))
+	c.Assert(INTERLOCK.StartTs, Equals, uint64(10))
+	c.Assert(INTERLOCK.Ranges, DeepEquals, []*interlock.KeyRange{{Start: []byte("a"), End: []byte("c")}})
+
+	req.Paging = true
+	INTERLOCK = buildPagingRequest(req, ranges)
+	c.Assert(INTERLOCK.Tp, Equals, int64(solomonkey.ReqTypePagingPosetDag))
+	data, pagingSize, pagingBytes, err := solomonkey.DecodePagingRequest(INTERLOCK.Data)
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, []byte("posetdag"))
+	c.Assert(pagingSize, Equals, uint64(10))
+	c.Assert(pagingBytes, Equals, uint64(1024))
+
+	analyze := &solomonkey.Request{Tp: solomonkey.ReqTypeAnalyze, Data: []byte("analyze"), Paging: true, PagingSize: 10}
+	INTERLOCK = buildPagingRequest(analyze, ranges)
+	c.Assert(INTERLOCK.Tp, Equals, int64(solomonkey.ReqTypeAnalyze))
+	c.Assert(INTERLOCK.Data, DeepEquals, []byte("analyze"))
+}
+
+func (s *testPagingSuite) TestNextPageRanges(c *C) {
+	ranges := []solomonkey.KeyRange{
+		{StartKey: solomonkey.Key("a"), EndKey: solomonkey.Key("c")},
+		{StartKey: solomonkey.Key("e"), EndKey: solomonkey.Key("g")},
+	}
+	c.Assert(NextPageRanges(ranges, &interlock.Response{}, false), IsNil)
+	resp := &interlock.Response{Range: &interlock.KeyRange{Start: []byte("a"), End: []byte("f")}}
+	c.Assert(NextPageRanges(ranges, resp, false), DeepEquals, []solomonkey.KeyRange{{StartKey: solomonkey.Key("f"), EndKey: solomonkey.Key("g")}})
+	resp = &interlock.Response{Range: &interlock.KeyRange{Start: []byte("f"), End: []byte("g")}}
+	c.Assert(NextPageRanges(ranges, resp, true), DeepEquals, []solomonkey.KeyRange{
+		{StartKey: solomonkey.Key("a"), EndKey: solomonkey.Key("c")},
+		{StartKey: solomonkey.Key("e"), EndKey: solomonkey.Key("f")},
+	})
+}
@@ -0,0 +1,31 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package einsteindb
+
+import (
+	"context"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/errors"
+)
+
+// applyRangeTombstones deletes the ranges deleted by the range tombstones of the transaction
+// from the causetstore with delete-range requests. Commit calls it before the prewrite, so the
+// mutations of the transaction are written on top of the deleted ranges.
+func (txn *einsteindbTxn) applyRangeTombstones(ctx context.Context) error {
+	return solomonkey.ApplyRangeTombstones(ctx, txn.GetMemBuffer(), func(ctx context.Context, start, end solomonkey.Key) error {
+		task := NewDeleteRangeTask(txn.causetstore, start, end, 1)
+		return errors.Trace(task.Execute(ctx))
+	})
+}
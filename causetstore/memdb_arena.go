@@ -336,6 +336,17 @@ func (l *memdbVlog) inspectKVInLog(EDB *memdb, head, tail *memdbCheckpoint, f fu
 	}
 }
 
+func (l *memdbVlog) inspectNodesInLog(head, tail *memdbCheckpoint, f func(nodeAddr memdbMemCamAddr)) {
+	cursor := *tail
+	for !head.isSamePosition(&cursor) {
+		hdrOff := cursor.offsetInBlock - memdbVlogHdrSize
+		var hdr memdbVlogHdr
+		hdr.load(l.blocks[cursor.blocks-1].buf[hdrOff:])
+		f(hdr.nodeAddr)
+		l.moveBackCursor(&cursor, &hdr)
+	}
+}
+
 func (l *memdbVlog) moveBackCursor(cursor *memdbCheckpoint, hdr *memdbVlogHdr) {
 	cursor.offsetInBlock -= (memdbVlogHdrSize + int(hdr.valueLen))
 	if cursor.offsetInBlock == 0 {
@@ -0,0 +1,396 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cdc implements a change-data-capture event feed for the mock stores.
+package cdc
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/logutil"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+	"go.uber.org/zap"
+)
+
+// EventType is the type of an Event.
+type EventType int
+
+// EventType values.
+const (
+	EventPrewrite EventType = iota
+	EventCommit
+	EventRollback
+	EventResolvedTS
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventPrewrite:
+		return "Prewrite"
+	case EventCommit:
+		return "Commit"
+	case EventRollback:
+		return "Rollback"
+	case EventResolvedTS:
+		return "ResolvedTS"
+	}
+	return "Unknown"
+}
+
+// Event is a change of a key, or a resolved-TS watermark of the subscribed range.
+type Event struct {
+	Type     EventType
+	Key      []byte
+	Value    []byte
+	Op       kvrpcpb.Op
+	StartTS  uint64
+	CommitTS uint64
+	// ResolvedTS is only set for EventResolvedTS. All the commit events with a commit
+	// ts not greater than it are sent before the watermark.
+	ResolvedTS uint64
+}
+
+// ResolvedTSInterval is the interval of the resolved-TS watermarks.
+var ResolvedTSInterval = time.Second
+
+// MinLockTSFunc returns the minimum start ts of the locks in [startKey, endKey), ok is
+// false if there is no dagger.
+type MinLockTSFunc func(startKey, endKey []byte) (ts uint64, ok bool, err error)
+
+// Feed dispatches the change events of a causetstore to its subscriptions.
+//
+// The resolved ts of a range is the max ts observed by the feed, but less than the
+// minimum start ts of the locks in the range. It assumes the timestamps come from a
+// monotonic oracle like the real cluster does.
+type Feed struct {
+	mu    sync.Mutex
+	subs  map[*Subscription]struct{}
+	maxTS uint64
+	// prewrites are the prewrite events not committed or rolled back yet, indexed by
+	// start ts and key.
+	prewrites map[uint64]map[string]*Event
+	minLockTS MinLockTSFunc
+}
+
+// NewFeed creates a Feed. If minLockTS is nil, the locks are tracked from the
+// prewrite events published to the feed.
+func NewFeed(minLockTS MinLockTSFunc) *Feed {
+	return &Feed{
+		subs:      make(map[*Subscription]struct{}),
+		prewrites: make(map[uint64]map[string]*Event),
+		minLockTS: minLockTS,
+	}
+}
+
+// Subscribe registers a subscription for the changes in [startKey, endKey) after
+// startTS. An empty endKey means no upper bound. The initial events, usually the
+// result of an incremental scan, are sent before any published event.
+func (f *Feed) Subscribe(startKey, endKey []byte, startTS uint64, initial []*Event) *Subscription {
+	s := &Subscription{
+		feed:         f,
+		startKey:     append([]byte{}, startKey...),
+		endKey:       append([]byte{}, endKey...),
+		checkpointTS: startTS,
+		resolvedTS:   startTS,
+		pending:      initial,
+		notify:       make(chan struct{}, 1),
+		advance:      make(chan struct{}, 1),
+		events:       make(chan *Event),
+		closed:       make(chan struct{}),
+	}
+	f.mu.Lock()
+	f.subs[s] = struct{}{}
+	if startTS > f.maxTS {
+		f.maxTS = startTS
+	}
+	f.mu.Unlock()
+	s.wake()
+	go s.run()
+	return s
+}
+
+// Publish publishes the events of a write to the causetstore.
+func (f *Feed) Publish(events ...*Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, e := range events {
+		f.publish(e)
+	}
+}
+
+// CommitKeys publishes the commit events of the keys for the causetstore which can't
+// read the committed values, the values are taken from the prewrite events. The keys
+// without a known prewrite are skipped.
+func (f *Feed) CommitKeys(keys [][]byte, startTS, commitTS uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, key := range keys {
+		f.resolveKey(key, startTS, commitTS)
+	}
+}
+
+// RollbackKeys publishes the rollback events of the keys.
+func (f *Feed) RollbackKeys(keys [][]byte, startTS uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, key := range keys {
+		f.publish(&Event{Type: EventRollback, Key: key, StartTS: startTS})
+	}
+}
+
+// ResolveTxn commits or rolls back all the known prewrites of the transaction, a
+// zero commitTS means rollback.
+func (f *Feed) ResolveTxn(startTS, commitTS uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	keys := make([]string, 0, len(f.prewrites[startTS]))
+	for key := range f.prewrites[startTS] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if commitTS == 0 {
+			f.publish(&Event{Type: EventRollback, Key: []byte(key), StartTS: startTS})
+		} else {
+			f.resolveKey([]byte(key), startTS, commitTS)
+		}
+	}
+}
+
+// Advance raises the max ts of the feed to ts, and makes the subscriptions send their
+// resolved-TS watermarks at once. The caller must guarantee the transactions committed
+// before ts have been published, or are still locked.
+func (f *Feed) Advance(ts uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if ts > f.maxTS {
+		f.maxTS = ts
+	}
+	for s := range f.subs {
+		select {
+		case s.advance <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (f *Feed) resolveKey(key []byte, startTS, commitTS uint64) {
+	p, ok := f.prewrites[startTS][string(key)]
+	if !ok {
+		return
+	}
+	f.publish(&Event{
+		Type:     EventCommit,
+		Key:      key,
+		Value:    p.Value,
+		Op:       p.Op,
+		StartTS:  startTS,
+		CommitTS: commitTS,
+	})
+}
+
+func (f *Feed) publish(e *Event) {
+	switch e.Type {
+	case EventPrewrite:
+		txn, ok := f.prewrites[e.StartTS]
+		if !ok {
+			txn = make(map[string]*Event)
+			f.prewrites[e.StartTS] = txn
+		}
+		txn[string(e.Key)] = e
+	case EventCommit, EventRollback:
+		if txn, ok := f.prewrites[e.StartTS]; ok {
+			delete(txn, string(e.Key))
+			if len(txn) == 0 {
+				delete(f.prewrites, e.StartTS)
+			}
+		}
+	}
+	if e.StartTS > f.maxTS {
+		f.maxTS = e.StartTS
+	}
+	if e.CommitTS > f.maxTS {
+		f.maxTS = e.CommitTS
+	}
+	for s := range f.subs {
+		if !s.contains(e.Key) {
+			continue
+		}
+		if e.Type == EventCommit && e.CommitTS <= s.checkpointTS {
+			continue
+		}
+		s.push(e)
+	}
+}
+
+// ResolvedTS returns the resolved ts of [startKey, endKey), the largest ts below which
+// no dagger can appear in the range. It's the progress of the ts allocation, but less
+// than the minimum start ts of the locks in the range.
+func ResolvedTS(progress func() uint64, minLockTS MinLockTSFunc, startKey, endKey []byte) (uint64, error) {
+	// The progress must be read before the locks, a dagger written after that gets a
+	// commit ts greater than it.
+	resolved := progress()
+	minTS, ok, err := minLockTS(startKey, endKey)
+	if err != nil {
+		return 0, err
+	}
+	if ok && minTS-1 < resolved {
+		resolved = minTS - 1
+	}
+	return resolved, nil
+}
+
+func (f *Feed) resolvedTS(startKey, endKey []byte) (uint64, error) {
+	return ResolvedTS(f.currentMaxTS, f.MinLockTS, startKey, endKey)
+}
+
+func (f *Feed) currentMaxTS() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.maxTS
+}
+
+// MinLockTS returns the minimum start ts of the outstanding locks in [startKey, endKey),
+// ok is false if there is no dagger.
+func (f *Feed) MinLockTS(startKey, endKey []byte) (minLockTS uint64, ok bool, err error) {
+	if f.minLockTS != nil {
+		return f.minLockTS(startKey, endKey)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	minLockTS, ok = f.trackedMinLockTS(startKey, endKey)
+	return minLockTS, ok, nil
+}
+
+func (f *Feed) trackedMinLockTS(startKey, endKey []byte) (uint64, bool) {
+	var (
+		minTS uint64
+		found bool
+	)
+	for startTS, txn := range f.prewrites {
+		if found && startTS >= minTS {
+			continue
+		}
+		for key := range txn {
+			if inRange([]byte(key), startKey, endKey) {
+				minTS, found = startTS, true
+				break
+			}
+		}
+	}
+	return minTS, found
+}
+
+func (f *Feed) unsubscribe(s *Subscription) {
+	f.mu.Lock()
+	delete(f.subs, s)
+	f.mu.Unlock()
+}
+
+// Subscription receives the change events of a key range.
+type Subscription struct {
+	feed         *Feed
+	startKey     []byte
+	endKey       []byte
+	checkpointTS uint64
+	// resolvedTS is only accessed by the run goroutine.
+	resolvedTS uint64
+
+	mu      sync.Mutex
+	pending []*Event
+	notify  chan struct{}
+	// advance triggers a resolved-TS watermark without waiting for the ticker.
+	advance chan struct{}
+
+	events    chan *Event
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Events returns the channel of the events. The events of a key are in the order they
+// are written, and every resolved-TS watermark is greater than the previous one.
+func (s *Subscription) Events() <-chan *Event {
+	return s.events
+}
+
+// Close stops the subscription, the pending events are dropped.
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		s.feed.unsubscribe(s)
+		close(s.closed)
+	})
+}
+
+func (s *Subscription) contains(key []byte) bool {
+	return inRange(key, s.startKey, s.endKey)
+}
+
+func (s *Subscription) push(e *Event) {
+	s.mu.Lock()
+	s.pending = append(s.pending, e)
+	s.mu.Unlock()
+	s.wake()
+}
+
+func (s *Subscription) wake() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Subscription) run() {
+	ticker := time.NewTicker(ResolvedTSInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.notify:
+		case <-ticker.C:
+			s.pushResolvedTS()
+			continue
+		case <-s.advance:
+			s.pushResolvedTS()
+			continue
+		case <-s.closed:
+			return
+		}
+		s.mu.Lock()
+		events := s.pending
+		s.pending = nil
+		s.mu.Unlock()
+		for _, e := range events {
+			select {
+			case s.events <- e:
+			case <-s.closed:
+				return
+			}
+		}
+	}
+}
+
+func (s *Subscription) pushResolvedTS() {
+	resolved, err := s.feed.resolvedTS(s.startKey, s.endKey)
+	if err != nil {
+		logutil.BgLogger().Warn("calculate resolved ts failed", zap.Error(err))
+	} else if resolved > s.resolvedTS {
+		s.resolvedTS = resolved
+		s.push(&Event{Type: EventResolvedTS, ResolvedTS: resolved})
+	}
+}
+
+func inRange(key, startKey, endKey []byte) bool {
+	return bytes.Compare(key, startKey) >= 0 && (len(endKey) == 0 || bytes.Compare(key, endKey) < 0)
+}
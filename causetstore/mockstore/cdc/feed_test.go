@@ -0,0 +1,94 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cdc
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+type testFeedSuite struct{}
+
+var _ = Suite(&testFeedSuite{})
+
+func (s *testFeedSuite) SetUpSuite(c *C) {
+	ResolvedTSInterval = 10 * time.Millisecond
+}
+
+func (s *testFeedSuite) TearDownSuite(c *C) {
+	ResolvedTSInterval = time.Second
+}
+
+func nextEvent(c *C, sub *Subscription) *Event {
+	select {
+	case e := <-sub.Events():
+		return e
+	case <-time.After(5 * time.Second):
+		c.Fatal("wait event timeout")
+	}
+	return nil
+}
+
+// nextChange skips the resolved-TS watermarks.
+func nextChange(c *C, sub *Subscription) *Event {
+	for {
+		if e := nextEvent(c, sub); e.Type != EventResolvedTS {
+			return e
+		}
+	}
+}
+
+func (s *testFeedSuite) TestFeed(c *C) {
+	f := NewFeed(nil)
+	sub := f.Subscribe([]byte("a"), []byte("c"), 10, nil)
+	defer sub.Close()
+
+	f.Publish(
+		&Event{Type: EventPrewrite, Key: []byte("a"), Value: []byte("v1"), Op: kvrpcpb.Op_Put, StartTS: 20},
+		&Event{Type: EventPrewrite, Key: []byte("b"), Op: kvrpcpb.Op_Del, StartTS: 20},
+		&Event{Type: EventPrewrite, Key: []byte("c"), Value: []byte("v2"), Op: kvrpcpb.Op_Put, StartTS: 20},
+	)
+	c.Assert(nextChange(c, sub).Key, BytesEquals, []byte("a"))
+	c.Assert(nextChange(c, sub).Key, BytesEquals, []byte("b"))
+
+	// The dagger of start ts 20 blocks the resolved ts.
+	e := nextEvent(c, sub)
+	c.Assert(e.Type, Equals, EventResolvedTS)
+	c.Assert(e.ResolvedTS, Equals, uint64(19))
+
+	f.CommitKeys([][]byte{[]byte("a")}, 20, 30)
+	f.RollbackKeys([][]byte{[]byte("b")}, 20)
+	e = nextChange(c, sub)
+	c.Assert(e.Type, Equals, EventCommit)
+	c.Assert(e.Value, BytesEquals, []byte("v1"))
+	c.Assert(e.CommitTS, Equals, uint64(30))
+	e = nextChange(c, sub)
+	c.Assert(e.Type, Equals, EventRollback)
+	c.Assert(e.Key, BytesEquals, []byte("b"))
+
+	// The commits before the checkpoint are filtered.
+	f.Publish(&Event{Type: EventCommit, Key: []byte("a"), StartTS: 1, CommitTS: 5})
+	f.ResolveTxn(20, 40)
+	for e = nextEvent(c, sub); e.Type != EventResolvedTS || e.ResolvedTS < 40; e = nextEvent(c, sub) {
+		c.Assert(e.Type, Equals, EventResolvedTS)
+	}
+	c.Assert(e.ResolvedTS, Equals, uint64(40))
+}
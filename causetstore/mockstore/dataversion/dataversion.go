@@ -0,0 +1,121 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dataversion tracks the data versions of the Regions of the mock stores,
+// which are checked by the interlock result cache of the client.
+package dataversion
+
+import (
+	"sync"
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/oracle"
+)
+
+// RegionVersion is the data version of a Region. Version changes on every write to
+// the Region, it starts at 1 as the client asks for version 0 if it has nothing
+// cached. MaxCommitTS is the max commit ts written to the Region, a result read
+// before it can't be cached.
+type RegionVersion struct {
+	Version     uint64
+	MaxCommitTS uint64
+}
+
+// NewRegionVersion returns the data version of a new Region.
+func NewRegionVersion() RegionVersion {
+	return RegionVersion{Version: 1}
+}
+
+// RestoredRegionVersion returns the data version of a Region whose writes are
+// unknown, such as a Region restored from a persisted layout. Its commits are
+// bounded by the current time.
+func RestoredRegionVersion() RegionVersion {
+	return RegionVersion{Version: 1, MaxCommitTS: oracle.ComposeTS(oracle.GetPhysical(time.Now()), 0)}
+}
+
+// Bump records a write to the Region, commitTS is the max commit ts of the write, 0
+// if it commits nothing.
+func (v *RegionVersion) Bump(commitTS uint64) {
+	v.Version++
+	if commitTS > v.MaxCommitTS {
+		v.MaxCommitTS = commitTS
+	}
+}
+
+// Merge bumps the version of the Region merging the Region of other.
+func (v *RegionVersion) Merge(other RegionVersion) {
+	if other.Version > v.Version {
+		v.Version = other.Version
+	}
+	v.Bump(other.MaxCommitTS)
+}
+
+// Tracker tracks the data versions of Regions by their IDs. The Regions it hasn't
+// seen get a RestoredRegionVersion.
+type Tracker struct {
+	mu       sync.Mutex
+	versions map[uint64]*RegionVersion
+}
+
+// NewTracker creates a Tracker.
+func NewTracker() *Tracker {
+	return &Tracker{versions: make(map[uint64]*RegionVersion)}
+}
+
+func (t *Tracker) getLocked(regionID uint64) *RegionVersion {
+	v, ok := t.versions[regionID]
+	if !ok {
+		restored := RestoredRegionVersion()
+		v = &restored
+		t.versions[regionID] = v
+	}
+	return v
+}
+
+// Get returns the data version of the Region.
+func (t *Tracker) Get(regionID uint64) RegionVersion {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return *t.getLocked(regionID)
+}
+
+// Bump records a write to the Region, see RegionVersion.Bump.
+func (t *Tracker) Bump(regionID, commitTS uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.getLocked(regionID).Bump(commitTS)
+}
+
+// WriteCommitTS returns whether req writes data or locks to its Region, and the max
+// commit ts it writes.
+func WriteCommitTS(req *einsteindbrpc.Request) (commitTS uint64, ok bool) {
+	switch req.Type {
+	case einsteindbrpc.CmdCommit:
+		return req.Commit().CommitVersion, true
+	case einsteindbrpc.CmdResolveLock:
+		r := req.ResolveLock()
+		commitTS = r.CommitVersion
+		for _, txn := range r.TxnInfos {
+			if txn.Status > commitTS {
+				commitTS = txn.Status
+			}
+		}
+		return commitTS, true
+	case einsteindbrpc.CmdPrewrite, einsteindbrpc.CmdPessimisticLock, einsteindbrpc.CmdPessimisticRollback,
+		einsteindbrpc.CmdCleanup, einsteindbrpc.CmdCheckTxnStatus, einsteindbrpc.CmdCheckSecondaryLocks,
+		einsteindbrpc.CmdBatchRollback, einsteindbrpc.CmdGC, einsteindbrpc.CmdDeleteRange:
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,66 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dataversion
+
+import (
+	"testing"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+type testDataVersionSuite struct{}
+
+var _ = Suite(&testDataVersionSuite{})
+
+func (s *testDataVersionSuite) TestRegionVersion(c *C) {
+	v := NewRegionVersion()
+	c.Assert(v, Equals, RegionVersion{Version: 1})
+	v.Bump(20)
+	v.Bump(0)
+	c.Assert(v, Equals, RegionVersion{Version: 3, MaxCommitTS: 20})
+
+	other := NewRegionVersion()
+	other.Bump(30)
+	v.Merge(other)
+	c.Assert(v, Equals, RegionVersion{Version: 4, MaxCommitTS: 30})
+
+	t := NewTracker()
+	restored := t.Get(1)
+	c.Assert(restored.Version, Equals, uint64(1))
+	c.Assert(restored.MaxCommitTS, Not(Equals), uint64(0))
+	t.Bump(1, restored.MaxCommitTS+1)
+	c.Assert(t.Get(1), Equals, RegionVersion{Version: 2, MaxCommitTS: restored.MaxCommitTS + 1})
+}
+
+func (s *testDataVersionSuite) TestWriteCommitTS(c *C) {
+	commitTS, ok := WriteCommitTS(einsteindbrpc.NewRequest(einsteindbrpc.CmdCommit, &kvrpcpb.CommitRequest{CommitVersion: 20}, kvrpcpb.Context{}))
+	c.Assert(ok, IsTrue)
+	c.Assert(commitTS, Equals, uint64(20))
+	commitTS, ok = WriteCommitTS(einsteindbrpc.NewRequest(einsteindbrpc.CmdResolveLock, &kvrpcpb.ResolveLockRequest{
+		TxnInfos: []*kvrpcpb.TxnInfo{{Txn: 10, Status: 30}, {Txn: 15, Status: 0}},
+	}, kvrpcpb.Context{}))
+	c.Assert(ok, IsTrue)
+	c.Assert(commitTS, Equals, uint64(30))
+	commitTS, ok = WriteCommitTS(einsteindbrpc.NewRequest(einsteindbrpc.CmdCheckSecondaryLocks, &kvrpcpb.CheckSecondaryLocksRequest{}, kvrpcpb.Context{}))
+	c.Assert(ok, IsTrue)
+	c.Assert(commitTS, Equals, uint64(0))
+	_, ok = WriteCommitTS(einsteindbrpc.NewRequest(einsteindbrpc.CmdGet, &kvrpcpb.GetRequest{}, kvrpcpb.Context{}))
+	c.Assert(ok, IsFalse)
+}
@@ -0,0 +1,128 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entangledstore
+
+import (
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/failpoint"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+	"golang.org/x/net/context"
+)
+
+// lockForWrite locks writeMu for the write request req and returns the unlock function.
+// A prewrite with assertions locks it exclusively, so no other write lands between the
+// check of the assertions and the prewrite.
+func (c *RPCClient) lockForWrite(req *einsteindbrpc.Request) func() {
+	if req.Type == einsteindbrpc.CmdPrewrite && hasAssertions(req.Prewrite()) {
+		c.writeMu.Lock()
+		return c.writeMu.Unlock
+	}
+	c.writeMu.RLock()
+	return c.writeMu.RUnlock
+}
+
+func hasAssertions(req *kvrpcpb.PrewriteRequest) bool {
+	for _, m := range req.Mutations {
+		if m.Assertion != kvrpcpb.Assertion_None {
+			return true
+		}
+	}
+	return false
+}
+
+// prewrite prewrites the mutations of req after checking their key-existence assertions,
+// which entangledstore ignores. The caller must hold writeMu as lockForWrite does.
+func (c *RPCClient) prewrite(ctx context.Context, req *kvrpcpb.PrewriteRequest) (*kvrpcpb.PrewriteResponse, error) {
+	failed, err := c.checkPrewriteAssertions(ctx, req)
+	if failed != nil || err != nil {
+		return failed, err
+	}
+	failpoint.Inject("afterCheckPrewriteAssertions", nil)
+	return c.usSvr.KvPrewrite(ctx, req)
+}
+
+// checkPrewriteAssertions checks the key-existence assertions of the mutations. It
+// returns a non-nil response when the prewrite should fail.
+func (c *RPCClient) checkPrewriteAssertions(ctx context.Context, req *kvrpcpb.PrewriteRequest) (*kvrpcpb.PrewriteResponse, error) {
+	readTS := req.StartVersion
+	if req.ForUFIDelateTs > readTS {
+		readTS = req.ForUFIDelateTs
+	}
+	var keyErrs []*kvrpcpb.KeyError
+	for _, m := range req.Mutations {
+		if m.Assertion == kvrpcpb.Assertion_None {
+			continue
+		}
+		// The dagger is checked first, a key locked by another transaction gets the
+		// dagger, which the client can resolve, rather than a failed assertion.
+		getResp, err := c.usSvr.KvGet(ctx, &kvrpcpb.GetRequest{
+			Context: req.Context,
+			Key:     m.Key,
+			Version: readTS,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if getResp.RegionError != nil {
+			return &kvrpcpb.PrewriteResponse{RegionError: getResp.RegionError}, nil
+		}
+		if locked := getResp.Error.GetLocked(); locked != nil && locked.LockVersion != req.StartVersion {
+			keyErrs = append(keyErrs, getResp.Error)
+			continue
+		}
+		// The value can't tell an empty value from a missing key, the writes of the key can.
+		writesResp, err := c.usSvr.MvccGetByKey(ctx, &kvrpcpb.MvccGetByKeyRequest{
+			Context: req.Context,
+			Key:     m.Key,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if writesResp.RegionError != nil {
+			return &kvrpcpb.PrewriteResponse{RegionError: writesResp.RegionError}, nil
+		}
+		existingCommitTS := latestPutCommitTS(writesResp.Info, readTS)
+		exists := existingCommitTS != 0
+		if (m.Assertion == kvrpcpb.Assertion_Exist && !exists) || (m.Assertion == kvrpcpb.Assertion_NotExist && exists) {
+			// kvrpcpb.Assertion has the same values as solomonkey.AssertionType.
+			keyErrs = append(keyErrs, &kvrpcpb.KeyError{
+				Abort: solomonkey.AssertionFailedAbort(m.Key, solomonkey.AssertionType(m.Assertion), existingCommitTS),
+			})
+		}
+	}
+	if len(keyErrs) > 0 {
+		return &kvrpcpb.PrewriteResponse{Errors: keyErrs}, nil
+	}
+	return nil, nil
+}
+
+// latestPutCommitTS returns the commit ts of the latest write visible at readTS if it
+// is a put, 0 if the key doesn't exist. A put of an empty value exists, the same as
+// in mockeinsteindb.
+func latestPutCommitTS(info *kvrpcpb.MvccInfo, readTS uint64) uint64 {
+	var latest *kvrpcpb.MvccWrite
+	for _, w := range info.GetWrites() {
+		if w.Type == kvrpcpb.Op_Rollback || w.Type == kvrpcpb.Op_Lock || w.CommitTs > readTS {
+			continue
+		}
+		if latest == nil || w.CommitTs > latest.CommitTs {
+			latest = w
+		}
+	}
+	if latest == nil || latest.Type != kvrpcpb.Op_Put {
+		return 0
+	}
+	return latest.CommitTs
+}
@@ -0,0 +1,131 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entangledstore
+
+import (
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/failpoint"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+	"golang.org/x/net/context"
+)
+
+func (ts testSuite) TestPrewriteAssertion(c *C) {
+	client, _, cluster, err := New("")
+	c.Assert(err, IsNil)
+	defer client.Close()
+	_, _, regionID := BootstrapWithSingleStore(cluster)
+	region := cluster.GetRegion(regionID)
+	reqCtx := kvrpcpb.Context{RegionId: regionID, RegionEpoch: region.RegionEpoch, Peer: region.Peers[0]}
+
+	send := func(tp einsteindbrpc.CmdType, req interface{}) *einsteindbrpc.Response {
+		resp, err := client.SendRequest(context.Background(), "", einsteindbrpc.NewRequest(tp, req, reqCtx), time.Second)
+		c.Assert(err, IsNil)
+		return resp
+	}
+	prewrite := func(key, value string, assertion kvrpcpb.Assertion, startTS uint64) []*kvrpcpb.KeyError {
+		resp := send(einsteindbrpc.CmdPrewrite, &kvrpcpb.PrewriteRequest{
+			Mutations: []*kvrpcpb.Mutation{{
+				Op:        kvrpcpb.Op_Put,
+				Key:       []byte(key),
+				Value:     []byte(value),
+				Assertion: assertion,
+			}},
+			PrimaryLock:  []byte(key),
+			StartVersion: startTS,
+			LockTtl:      3000,
+		})
+		return resp.Resp.(*kvrpcpb.PrewriteResponse).Errors
+	}
+	commit := func(key string, startTS, commitTS uint64) {
+		resp := send(einsteindbrpc.CmdCommit, &kvrpcpb.CommitRequest{
+			Keys:          [][]byte{[]byte(key)},
+			StartVersion:  startTS,
+			CommitVersion: commitTS,
+		})
+		c.Assert(resp.Resp.(*kvrpcpb.CommitResponse).Error, IsNil)
+	}
+
+	// An empty value exists, the same as in mockeinsteindb.
+	c.Assert(prewrite("empty", "", kvrpcpb.Assertion_NotExist, 5), HasLen, 0)
+	commit("empty", 5, 10)
+	keyErrs := prewrite("empty", "v", kvrpcpb.Assertion_NotExist, 30)
+	c.Assert(keyErrs, HasLen, 1)
+	e, ok := solomonkey.ExtractAssertionFailedError(nil, keyErrs[0].Abort)
+	c.Assert(ok, IsTrue)
+	c.Assert(e.Key, BytesEquals, []byte("empty"))
+	c.Assert(e.Assertion, Equals, solomonkey.NotExist)
+	c.Assert(e.ExistingCommitTS, Equals, uint64(10))
+
+	keyErrs = prewrite("none", "v", kvrpcpb.Assertion_Exist, 30)
+	c.Assert(keyErrs, HasLen, 1)
+	_, ok = solomonkey.ExtractAssertionFailedError(nil, keyErrs[0].Abort)
+	c.Assert(ok, IsTrue)
+
+	// A key locked by another transaction reports the dagger rather than the assertion.
+	c.Assert(prewrite("empty", "v", kvrpcpb.Assertion_Exist, 40), HasLen, 0)
+	keyErrs = prewrite("empty", "v", kvrpcpb.Assertion_NotExist, 50)
+	c.Assert(keyErrs, HasLen, 1)
+	c.Assert(keyErrs[0].Locked, NotNil)
+	c.Assert(keyErrs[0].Locked.LockVersion, Equals, uint64(40))
+	// The retried prewrite of the transaction holding the dagger passes.
+	c.Assert(prewrite("empty", "v", kvrpcpb.Assertion_Exist, 40), HasLen, 0)
+}
+
+func (ts testSuite) TestPrewriteAssertionAtomic(c *C) {
+	client, _, cluster, err := New("")
+	c.Assert(err, IsNil)
+	defer client.Close()
+	_, _, regionID := BootstrapWithSingleStore(cluster)
+	region := cluster.GetRegion(regionID)
+	reqCtx := kvrpcpb.Context{RegionId: regionID, RegionEpoch: region.RegionEpoch, Peer: region.Peers[0]}
+
+	prewrite := func(assertion kvrpcpb.Assertion, startTS uint64) <-chan []*kvrpcpb.KeyError {
+		ch := make(chan []*kvrpcpb.KeyError, 1)
+		go func() {
+			req := einsteindbrpc.NewRequest(einsteindbrpc.CmdPrewrite, &kvrpcpb.PrewriteRequest{
+				Mutations:    []*kvrpcpb.Mutation{{Op: kvrpcpb.Op_Put, Key: []byte("k"), Value: []byte("v"), Assertion: assertion}},
+				PrimaryLock:  []byte("k"),
+				StartVersion: startTS,
+				LockTtl:      3000,
+			}, reqCtx)
+			resp, err := client.SendRequest(context.Background(), "", req, time.Second)
+			c.Assert(err, IsNil)
+			ch <- resp.Resp.(*kvrpcpb.PrewriteResponse).Errors
+		}()
+		return ch
+	}
+
+	fpName := "github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/entangledstore/afterCheckPrewriteAssertions"
+	c.Assert(failpoint.Enable(fpName, "pause"), IsNil)
+	asserted := prewrite(kvrpcpb.Assertion_NotExist, 20)
+	time.Sleep(50 * time.Millisecond)
+	// The other write can't land between the check of the assertion and the prewrite.
+	other := prewrite(kvrpcpb.Assertion_None, 10)
+	select {
+	case <-other:
+		c.Fatal("the write is not blocked by the prewrite checking assertions")
+	case <-time.After(50 * time.Millisecond):
+	}
+	c.Assert(failpoint.Disable(fpName), IsNil)
+
+	c.Assert(<-asserted, HasLen, 0)
+	keyErrs := <-other
+	c.Assert(keyErrs, HasLen, 1)
+	c.Assert(keyErrs[0].Locked, NotNil)
+	c.Assert(keyErrs[0].Locked.LockVersion, Equals, uint64(20))
+}
@@ -0,0 +1,246 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entangledstore
+
+import (
+	"bytes"
+	"math"
+	"sort"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/cdc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/errors"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+	"golang.org/x/net/context"
+)
+
+// Subscribe subscribes the changes in [startKey, endKey) after startTS. The changes are
+// captured from the transactional requests sent through the client, the values of the
+// commit events come from the prewrites. The changes committed after startTS and the
+// current locks in the range are sent first.
+func (c *RPCClient) Subscribe(startKey, endKey []byte, startTS uint64) (*cdc.Subscription, error) {
+	// No write lands between the scan and the subscription.
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	initial, err := c.incrementalScan(startKey, endKey, startTS)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return c.feed.Subscribe(startKey, endKey, startTS, initial), nil
+}
+
+// incrementalScan returns the changes committed after startTS and the current locks in
+// [startKey, endKey). entangledstore can't scan the writes of a range, the writes are
+// read key by key, for the keys existing at startTS or now and the locked keys. So a key
+// which is both put and deleted after startTS is not scanned.
+func (c *RPCClient) incrementalScan(startKey, endKey []byte, startTS uint64) ([]*cdc.Event, error) {
+	var changes, locks []*cdc.Event
+	for {
+		reqCtx, regionEnd, err := c.regionContext(startKey)
+		if err != nil {
+			return nil, err
+		}
+		end := endKey
+		if len(regionEnd) > 0 && (len(end) == 0 || solomonkey.Key(regionEnd).Cmp(end) < 0) {
+			end = regionEnd
+		}
+		keys, err := c.scanChangedKeys(reqCtx, startKey, end, startTS)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			resp, err := c.usSvr.MvccGetByKey(context.Background(), &kvrpcpb.MvccGetByKeyRequest{Context: reqCtx, Key: key})
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			if resp.RegionError != nil {
+				return nil, errors.New(resp.RegionError.String())
+			}
+			keyChanges, lock := decodeCDCEvents(key, resp.Info, startTS)
+			changes = append(changes, keyChanges...)
+			if lock != nil {
+				locks = append(locks, lock)
+			}
+		}
+		if len(regionEnd) == 0 || (len(endKey) > 0 && solomonkey.Key(regionEnd).Cmp(endKey) >= 0) {
+			break
+		}
+		startKey = regionEnd
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].CommitTS < changes[j].CommitTS
+	})
+	return append(changes, locks...), nil
+}
+
+// scanChangedKeys returns the sorted keys in [startKey, endKey) of the Region which may
+// have changed after startTS: the keys existing at startTS or now, and the locked keys.
+func (c *RPCClient) scanChangedKeys(reqCtx *kvrpcpb.Context, startKey, endKey []byte, startTS uint64) ([][]byte, error) {
+	ctx := context.Background()
+	keys := make(map[string]struct{})
+	for _, ver := range []uint64{startTS, math.MaxUint64} {
+		resp, err := c.usSvr.KvScan(ctx, &kvrpcpb.ScanRequest{
+			Context:  reqCtx,
+			StartKey: startKey,
+			EndKey:   endKey,
+			Version:  ver,
+			Limit:    math.MaxUint32,
+			KeyOnly:  true,
+		})
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if resp.RegionError != nil {
+			return nil, errors.New(resp.RegionError.String())
+		}
+		// The locked keys are scanned below.
+		for _, pair := range resp.Pairs {
+			if pair.Error == nil {
+				keys[string(pair.Key)] = struct{}{}
+			}
+		}
+	}
+	lockResp, err := c.usSvr.KvScanLock(ctx, &kvrpcpb.ScanLockRequest{
+		Context:    reqCtx,
+		StartKey:   startKey,
+		MaxVersion: math.MaxUint64,
+		Limit:      math.MaxUint32,
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if lockResp.RegionError != nil {
+		return nil, errors.New(lockResp.RegionError.String())
+	}
+	if lockResp.Error != nil {
+		return nil, errors.New(lockResp.Error.String())
+	}
+	// The locks are scanned to the end of the Region.
+	for _, dagger := range lockResp.Locks {
+		if len(endKey) == 0 || bytes.Compare(dagger.Key, endKey) < 0 {
+			keys[string(dagger.Key)] = struct{}{}
+		}
+	}
+	sorted := make([][]byte, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, []byte(key))
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+	return sorted, nil
+}
+
+// decodeCDCEvents decodes the writes of the key after startTS to change events, and the
+// dagger of the key to a prewrite event.
+func decodeCDCEvents(key []byte, info *kvrpcpb.MvccInfo, startTS uint64) (changes []*cdc.Event, dagger *cdc.Event) {
+	for _, w := range info.GetWrites() {
+		switch {
+		case (w.Type == kvrpcpb.Op_Put || w.Type == kvrpcpb.Op_Del) && w.CommitTs > startTS:
+			changes = append(changes, &cdc.Event{
+				Type:     cdc.EventCommit,
+				Key:      key,
+				Value:    w.ShortValue,
+				Op:       w.Type,
+				StartTS:  w.StartTs,
+				CommitTS: w.CommitTs,
+			})
+		case w.Type == kvrpcpb.Op_Rollback && w.StartTs > startTS:
+			changes = append(changes, &cdc.Event{Type: cdc.EventRollback, Key: key, StartTS: w.StartTs})
+		}
+	}
+	if l := info.GetLock(); l != nil && (l.Type == kvrpcpb.Op_Put || l.Type == kvrpcpb.Op_Del) {
+		dagger = &cdc.Event{
+			Type:    cdc.EventPrewrite,
+			Key:     key,
+			Value:   l.ShortValue,
+			Op:      l.Type,
+			StartTS: l.StartTs,
+		}
+	}
+	return changes, dagger
+}
+
+// publishChanges publishes the changes made by a transactional request to the CDC feed.
+// The keys removed by a DeleteRange request aren't published, the request deletes the
+// data of the range physically without a commit.
+func (c *RPCClient) publishChanges(req *einsteindbrpc.Request, resp *einsteindbrpc.Response) {
+	switch req.Type {
+	case einsteindbrpc.CmdPrewrite:
+		res, ok := resp.Resp.(*kvrpcpb.PrewriteResponse)
+		if !ok || res.RegionError != nil || len(res.Errors) > 0 {
+			return
+		}
+		r := req.Prewrite()
+		events := make([]*cdc.Event, 0, len(r.Mutations))
+		for _, m := range r.Mutations {
+			if m.Op != kvrpcpb.Op_Put && m.Op != kvrpcpb.Op_Del {
+				continue
+			}
+			events = append(events, &cdc.Event{
+				Type:    cdc.EventPrewrite,
+				Key:     m.Key,
+				Value:   m.Value,
+				Op:      m.Op,
+				StartTS: r.StartVersion,
+			})
+		}
+		c.feed.Publish(events...)
+	case einsteindbrpc.CmdCommit:
+		res, ok := resp.Resp.(*kvrpcpb.CommitResponse)
+		if !ok || res.RegionError != nil || res.Error != nil {
+			return
+		}
+		r := req.Commit()
+		c.feed.CommitKeys(r.Keys, r.StartVersion, r.CommitVersion)
+	case einsteindbrpc.CmdBatchRollback:
+		res, ok := resp.Resp.(*kvrpcpb.BatchRollbackResponse)
+		if !ok || res.RegionError != nil || res.Error != nil {
+			return
+		}
+		r := req.BatchRollback()
+		c.feed.RollbackKeys(r.Keys, r.StartVersion)
+	case einsteindbrpc.CmdCleanup:
+		res, ok := resp.Resp.(*kvrpcpb.CleanupResponse)
+		if !ok || res.RegionError != nil || res.Error != nil || res.CommitVersion != 0 {
+			return
+		}
+		r := req.Cleanup()
+		c.feed.RollbackKeys([][]byte{r.Key}, r.StartVersion)
+	case einsteindbrpc.CmdCheckTxnStatus:
+		res, ok := resp.Resp.(*kvrpcpb.CheckTxnStatusResponse)
+		if !ok || res.RegionError != nil || res.Error != nil {
+			return
+		}
+		if res.CausetAction == kvrpcpb.CausetAction_TTLExpireRollback || res.CausetAction == kvrpcpb.CausetAction_LockNotExistRollback {
+			r := req.CheckTxnStatus()
+			c.feed.RollbackKeys([][]byte{r.PrimaryKey}, r.LockTs)
+		}
+	case einsteindbrpc.CmdResolveLock:
+		res, ok := resp.Resp.(*kvrpcpb.ResolveLockResponse)
+		if !ok || res.RegionError != nil || res.Error != nil {
+			return
+		}
+		r := req.ResolveLock()
+		if len(r.TxnInfos) > 0 {
+			for _, txn := range r.TxnInfos {
+				c.feed.ResolveTxn(txn.Txn, txn.Status)
+			}
+			return
+		}
+		c.feed.ResolveTxn(r.StartVersion, r.CommitVersion)
+	}
+}
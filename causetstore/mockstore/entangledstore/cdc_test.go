@@ -0,0 +1,127 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entangledstore
+
+import (
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/oracle"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/cdc"
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+	"golang.org/x/net/context"
+)
+
+func nextCDCChange(c *C, sub *cdc.Subscription) *cdc.Event {
+	for {
+		select {
+		case e := <-sub.Events():
+			if e.Type != cdc.EventResolvedTS {
+				return e
+			}
+		case <-time.After(5 * time.Second):
+			c.Fatal("wait cdc event timeout")
+		}
+	}
+}
+
+func (ts testSuite) TestCDCFeed(c *C) {
+	client, fidelCli, cluster, err := New("")
+	c.Assert(err, IsNil)
+	defer client.Close()
+	_, _, regionID := BootstrapWithSingleStore(cluster)
+	region := cluster.GetRegion(regionID)
+	reqCtx := kvrpcpb.Context{RegionId: regionID, RegionEpoch: region.RegionEpoch, Peer: region.Peers[0]}
+	getTS := func() uint64 {
+		physical, logical, err := fidelCli.GetTS(context.Background())
+		c.Assert(err, IsNil)
+		return oracle.ComposeTS(physical, logical)
+	}
+	send := func(tp einsteindbrpc.CmdType, req interface{}) *einsteindbrpc.Response {
+		resp, err := client.SendRequest(context.Background(), "", einsteindbrpc.NewRequest(tp, req, reqCtx), time.Second)
+		c.Assert(err, IsNil)
+		return resp
+	}
+	prewrite := func(startTS uint64, op kvrpcpb.Op, key, value string) {
+		req := &kvrpcpb.PrewriteRequest{
+			Mutations:    []*kvrpcpb.Mutation{{Op: op, Key: []byte(key), Value: []byte(value)}},
+			PrimaryLock:  []byte(key),
+			StartVersion: startTS,
+			LockTtl:      3000,
+		}
+		c.Assert(send(einsteindbrpc.CmdPrewrite, req).Resp.(*kvrpcpb.PrewriteResponse).Errors, HasLen, 0)
+	}
+	commit := func(startTS, commitTS uint64, key string) {
+		resp := send(einsteindbrpc.CmdCommit, &kvrpcpb.CommitRequest{
+			Keys:          [][]byte{[]byte(key)},
+			StartVersion:  startTS,
+			CommitVersion: commitTS,
+		})
+		c.Assert(resp.Resp.(*kvrpcpb.CommitResponse).Error, IsNil)
+	}
+
+	ts1 := getTS()
+	prewrite(ts1, kvrpcpb.Op_Put, "a", "v1")
+	commit(ts1, getTS(), "a")
+	ts2 := getTS()
+	prewrite(ts2, kvrpcpb.Op_Put, "a", "v2")
+	commitTS2 := getTS()
+	commit(ts2, commitTS2, "a")
+	ts3 := getTS()
+	prewrite(ts3, kvrpcpb.Op_Del, "a", "")
+	commitTS3 := getTS()
+	commit(ts3, commitTS3, "a")
+	ts4 := getTS()
+	prewrite(ts4, kvrpcpb.Op_Put, "b", "v3")
+
+	sub, err := client.Subscribe([]byte("a"), []byte("z"), ts2-1)
+	c.Assert(err, IsNil)
+	defer sub.Close()
+
+	// The incremental scan sends the commits after the start ts and the locks, the
+	// deleted key is scanned as it exists at the start ts.
+	e := nextCDCChange(c, sub)
+	c.Assert(e.Type, Equals, cdc.EventCommit)
+	c.Assert(e.Key, BytesEquals, []byte("a"))
+	c.Assert(e.Value, BytesEquals, []byte("v2"))
+	c.Assert(e.CommitTS, Equals, commitTS2)
+	e = nextCDCChange(c, sub)
+	c.Assert(e.Type, Equals, cdc.EventCommit)
+	c.Assert(e.Op, Equals, kvrpcpb.Op_Del)
+	c.Assert(e.CommitTS, Equals, commitTS3)
+	e = nextCDCChange(c, sub)
+	c.Assert(e.Type, Equals, cdc.EventPrewrite)
+	c.Assert(e.Key, BytesEquals, []byte("b"))
+	c.Assert(e.Value, BytesEquals, []byte("v3"))
+	c.Assert(e.StartTS, Equals, ts4)
+
+	// The changes after the subscription are captured from the requests.
+	commitTS4 := getTS()
+	commit(ts4, commitTS4, "b")
+	e = nextCDCChange(c, sub)
+	c.Assert(e.Type, Equals, cdc.EventCommit)
+	c.Assert(e.Key, BytesEquals, []byte("b"))
+	c.Assert(e.Value, BytesEquals, []byte("v3"))
+	c.Assert(e.CommitTS, Equals, commitTS4)
+
+	ts5 := getTS()
+	prewrite(ts5, kvrpcpb.Op_Put, "c", "v4")
+	c.Assert(nextCDCChange(c, sub).Type, Equals, cdc.EventPrewrite)
+	resp := send(einsteindbrpc.CmdBatchRollback, &kvrpcpb.BatchRollbackRequest{Keys: [][]byte{[]byte("c")}, StartVersion: ts5})
+	c.Assert(resp.Resp.(*kvrpcpb.BatchRollbackResponse).Error, IsNil)
+	e = nextCDCChange(c, sub)
+	c.Assert(e.Type, Equals, cdc.EventRollback)
+	c.Assert(e.StartTS, Equals, ts5)
+}
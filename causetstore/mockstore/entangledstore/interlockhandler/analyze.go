@@ -21,20 +21,18 @@ import (
 	"github.com/juju/errors"
 	"github.com/ngaut/entangledstore/einsteindb/dbreader"
 	"github.com/whtcorpsinc/MilevaDB-Prod/blockcodec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/sampling"
 	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
 	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/chunk"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
 	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/collate"
 	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/rowcodec"
 	"github.com/whtcorpsinc/MilevaDB-Prod/statistics"
 	"github.com/whtcorpsinc/MilevaDB-Prod/types"
 	"github.com/whtcorpsinc/badger/y"
 	"github.com/whtcorpsinc/berolinaAllegroSQL/allegrosql"
-	"github.com/whtcorpsinc/berolinaAllegroSQL/ast"
-	"github.com/whtcorpsinc/berolinaAllegroSQL/charset"
-	"github.com/whtcorpsinc/berolinaAllegroSQL/perceptron"
 	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
 	"github.com/whtcorpsinc/fidelpb/go-fidelpb"
-	"golang.org/x/net/context"
 )
 
 // handleINTERLOCKAnalyzeRequest handles interlock analyze request.
@@ -79,7 +77,7 @@ func handleAnalyzeIndexReq(dbReader *dbreader.DBReader, rans []solomonkey.KeyRan
 		statsBuilder: statistics.NewSortedBuilder(flagsToStatementContext(analyzeReq.Flags), analyzeReq.IdxReq.BucketSize, 0, types.NewFieldType(allegrosql.TypeBlob)),
 	}
 	if analyzeReq.IdxReq.CmsketchDepth != nil && analyzeReq.IdxReq.CmsketchWidth != nil {
-		processor.cms = statistics.NewCMSketch(*analyzeReq.IdxReq.CmsketchDepth, *analyzeReq.IdxReq.CmsketchWidth)
+		processor.cms = sampling.NewSketchBuilder(*analyzeReq.IdxReq.CmsketchDepth, *analyzeReq.IdxReq.CmsketchWidth, int(analyzeReq.IdxReq.GetTopNSize()))
 	}
 	for _, ran := range rans {
 		err := dbReader.Scan(ran.StartKey, ran.EndKey, math.MaxInt64, startTS, processor)
@@ -90,7 +88,7 @@ func handleAnalyzeIndexReq(dbReader *dbreader.DBReader, rans []solomonkey.KeyRan
 	hg := statistics.HistogramToProto(processor.statsBuilder.Hist())
 	var cm *fidelpb.CMSketch
 	if processor.cms != nil {
-		cm = statistics.CMSketchToProto(processor.cms)
+		cm = processor.cms.ToProto()
 	}
 	data, err := proto.Marshal(&fidelpb.AnalyzeIndexResp{Hist: hg, Cms: cm})
 	if err != nil {
@@ -105,7 +103,7 @@ func handleAnalyzeCommonHandleReq(dbReader *dbreader.DBReader, rans []solomonkey
 		statsBuilder: statistics.NewSortedBuilder(flagsToStatementContext(analyzeReq.Flags), analyzeReq.IdxReq.BucketSize, 0, types.NewFieldType(allegrosql.TypeBlob)),
 	}
 	if analyzeReq.IdxReq.CmsketchDepth != nil && analyzeReq.IdxReq.CmsketchWidth != nil {
-		processor.cms = statistics.NewCMSketch(*analyzeReq.IdxReq.CmsketchDepth, *analyzeReq.IdxReq.CmsketchWidth)
+		processor.cms = sampling.NewSketchBuilder(*analyzeReq.IdxReq.CmsketchDepth, *analyzeReq.IdxReq.CmsketchWidth, int(analyzeReq.IdxReq.GetTopNSize()))
 	}
 	for _, ran := range rans {
 		err := dbReader.Scan(ran.StartKey, ran.EndKey, math.MaxInt64, startTS, processor)
@@ -116,7 +114,7 @@ func handleAnalyzeCommonHandleReq(dbReader *dbreader.DBReader, rans []solomonkey
 	hg := statistics.HistogramToProto(processor.statsBuilder.Hist())
 	var cm *fidelpb.CMSketch
 	if processor.cms != nil {
-		cm = statistics.CMSketchToProto(processor.cms)
+		cm = processor.cms.ToProto()
 	}
 	data, err := proto.Marshal(&fidelpb.AnalyzeIndexResp{Hist: hg, Cms: cm})
 	if err != nil {
@@ -130,7 +128,7 @@ type analyzeIndexProcessor struct {
 
 	colLen       int
 	statsBuilder *statistics.SortedBuilder
-	cms          *statistics.CMSketch
+	cms          *sampling.SketchBuilder
 	rowBuf       []byte
 }
 
@@ -143,7 +141,7 @@ func (p *analyzeIndexProcessor) Process(key, value []byte) error {
 	for _, val := range values {
 		p.rowBuf = append(p.rowBuf, val...)
 		if p.cms != nil {
-			p.cms.InsertBytes(p.rowBuf)
+			p.cms.Insert(p.rowBuf)
 		}
 	}
 	rowData := safeINTERLOCKy(p.rowBuf)
@@ -159,7 +157,7 @@ type analyzeCommonHandleProcessor struct {
 
 	colLen       int
 	statsBuilder *statistics.SortedBuilder
-	cms          *statistics.CMSketch
+	cms          *sampling.SketchBuilder
 	rowBuf       []byte
 }
 
@@ -172,7 +170,7 @@ func (p *analyzeCommonHandleProcessor) Process(key, value []byte) error {
 	for _, val := range values {
 		p.rowBuf = append(p.rowBuf, val...)
 		if p.cms != nil {
-			p.cms.InsertBytes(p.rowBuf)
+			p.cms.Insert(p.rowBuf)
 		}
 	}
 	rowData := safeINTERLOCKy(p.rowBuf)
@@ -183,20 +181,15 @@ func (p *analyzeCommonHandleProcessor) Process(key, value []byte) error {
 	return nil
 }
 
-type analyzeDeferredCausetsExec struct {
+type analyzeDeferredCausetsProcessor struct {
 	skipVal
-	reader  *dbreader.DBReader
-	ranges  []solomonkey.KeyRange
-	curRan  int
-	seekKey []byte
-	endKey  []byte
-	startTS uint64
 
-	chk     *chunk.Chunk
-	decoder *rowcodec.ChunkDecoder
-	req     *chunk.Chunk
-	evalCtx *evalContext
-	fields  []*ast.ResultField
+	chk       *chunk.Chunk
+	decoder   *rowcodec.ChunkDecoder
+	evalCtx   *evalContext
+	pkBuilder *statistics.SortedBuilder
+	builder   *sampling.Builder
+	values    [][]byte
 }
 
 func handleAnalyzeDeferredCausetsReq(dbReader *dbreader.DBReader, rans []solomonkey.KeyRange, analyzeReq *fidelpb.AnalyzeReq, startTS uint64) (*interlock.Response, error) {
@@ -212,35 +205,16 @@ func handleAnalyzeDeferredCausetsReq(dbReader *dbreader.DBReader, rans []solomon
 	if err != nil {
 		return nil, err
 	}
-	e := &analyzeDeferredCausetsExec{
-		reader:  dbReader,
-		seekKey: rans[0].StartKey,
-		endKey:  rans[0].EndKey,
-		ranges:  rans,
-		curRan:  0,
-		startTS: startTS,
-		chk:     chunk.NewChunkWithCapacity(evalCtx.fieldTps, 1),
-		decoder: decoder,
-		evalCtx: evalCtx,
-	}
-	e.fields = make([]*ast.ResultField, len(columns))
-	for i := range e.fields {
-		rf := new(ast.ResultField)
-		rf.DeferredCauset = new(perceptron.DeferredCausetInfo)
-		rf.DeferredCauset.FieldType = types.FieldType{Tp: allegrosql.TypeBlob, Flen: allegrosql.MaxBlobWidth, Charset: charset.CharsetUTF8, DefCauslate: charset.DefCauslationUTF8}
-		e.fields[i] = rf
-	}
 
 	pkID := int64(-1)
-	numDefCauss := len(columns)
+	analyzed := columns
 	if columns[0].GetPkHandle() {
 		pkID = columns[0].DeferredCausetId
-		columns = columns[1:]
-		numDefCauss--
+		analyzed = columns[1:]
 	}
-	collators := make([]collate.DefCauslator, numDefCauss)
-	fts := make([]*types.FieldType, numDefCauss)
-	for i, col := range columns {
+	collators := make([]collate.DefCauslator, len(analyzed))
+	fts := make([]*types.FieldType, len(analyzed))
+	for i, col := range analyzed {
 		ft := fieldTypeFromPBDeferredCauset(col)
 		fts[i] = ft
 		if ft.EvalType() == types.ETString {
@@ -248,33 +222,25 @@ func handleAnalyzeDeferredCausetsReq(dbReader *dbreader.DBReader, rans []solomon
 		}
 	}
 	colReq := analyzeReq.DefCausReq
-	builder := statistics.SampleBuilder{
-		Sc:                sc,
-		RecordSet:         e,
-		DefCausLen:        numDefCauss,
-		MaxBucketSize:     colReq.BucketSize,
-		MaxFMSketchSize:   colReq.SketchSize,
-		MaxSampleSize:     colReq.SampleSize,
-		DefCauslators:     collators,
-		DefCaussFieldType: fts,
+	processor := &analyzeDeferredCausetsProcessor{
+		chk:     chunk.NewChunkWithCapacity(evalCtx.fieldTps, 1),
+		decoder: decoder,
+		evalCtx: evalCtx,
+		builder: sampling.NewBuilder(sc, colReq, fts, collators, int64(startTS)),
+		values:  make([][]byte, len(columns)),
 	}
 	if pkID != -1 {
-		builder.PkBuilder = statistics.NewSortedBuilder(sc, builder.MaxBucketSize, pkID, types.NewFieldType(allegrosql.TypeBlob))
+		processor.pkBuilder = statistics.NewSortedBuilder(sc, colReq.BucketSize, pkID, types.NewFieldType(allegrosql.TypeBlob))
 	}
-	if colReq.CmsketchWidth != nil && colReq.CmsketchDepth != nil {
-		builder.CMSketchWidth = *colReq.CmsketchWidth
-		builder.CMSketchDepth = *colReq.CmsketchDepth
-	}
-	collectors, pkBuilder, err := builder.DefCauslectDeferredCausetStats()
-	if err != nil {
-		return nil, errors.Trace(err)
-	}
-	colResp := &fidelpb.AnalyzeDeferredCausetsResp{}
-	if pkID != -1 {
-		colResp.PkHist = statistics.HistogramToProto(pkBuilder.Hist())
+	for _, ran := range rans {
+		err = dbReader.Scan(ran.StartKey, ran.EndKey, math.MaxInt64, startTS, processor)
+		if err != nil {
+			return nil, err
+		}
 	}
-	for _, c := range collectors {
-		colResp.DefCauslectors = append(colResp.DefCauslectors, statistics.SampleDefCauslectorToProto(c))
+	colResp := &fidelpb.AnalyzeDeferredCausetsResp{DefCauslectors: processor.builder.DefCauslectors()}
+	if processor.pkBuilder != nil {
+		colResp.PkHist = statistics.HistogramToProto(processor.pkBuilder.Hist())
 	}
 	data, err := proto.Marshal(colResp)
 	if err != nil {
@@ -283,70 +249,33 @@ func handleAnalyzeDeferredCausetsReq(dbReader *dbreader.DBReader, rans []solomon
 	return &interlock.Response{Data: data}, nil
 }
 
-// Fields implements the sqlexec.RecordSet Fields interface.
-func (e *analyzeDeferredCausetsExec) Fields() []*ast.ResultField {
-	return e.fields
-}
-
-func (e *analyzeDeferredCausetsExec) Next(ctx context.Context, req *chunk.Chunk) error {
-	req.Reset()
-	e.req = req
-	err := e.reader.Scan(e.seekKey, e.endKey, math.MaxInt64, e.startTS, e)
-	if err != nil {
-		return err
-	}
-	if req.NumRows() < req.Capacity() {
-		if e.curRan == len(e.ranges)-1 {
-			e.seekKey = e.endKey
-		} else {
-			e.curRan++
-			e.seekKey = e.ranges[e.curRan].StartKey
-			e.endKey = e.ranges[e.curRan].EndKey
-		}
-	}
-	return nil
-}
-
-func (e *analyzeDeferredCausetsExec) Process(key, value []byte) error {
+func (p *analyzeDeferredCausetsProcessor) Process(key, value []byte) error {
 	handle, err := blockcodec.DecodeRowKey(key)
 	if err != nil {
 		return errors.Trace(err)
 	}
-	err = e.decoder.DecodeToChunk(value, handle, e.chk)
+	err = p.decoder.DecodeToChunk(value, handle, p.chk)
 	if err != nil {
 		return errors.Trace(err)
 	}
-	event := e.chk.GetRow(0)
-	for i, tp := range e.evalCtx.fieldTps {
+	event := p.chk.GetRow(0)
+	for i, tp := range p.evalCtx.fieldTps {
 		d := event.GetCauset(i, tp)
 		if d.IsNull() {
-			e.req.AppendNull(i)
+			p.values[i] = []byte{codec.NilFlag}
 			continue
 		}
-
-		value, err := blockcodec.EncodeValue(e.evalCtx.sc, nil, d)
+		p.values[i], err = blockcodec.EncodeValue(p.evalCtx.sc, p.values[i][:0], d)
 		if err != nil {
 			return err
 		}
-		e.req.AppendBytes(i, value)
-	}
-	e.chk.Reset()
-	if e.req.NumRows() == e.req.Capacity() {
-		e.seekKey = solomonkey.Key(key).PrefixNext()
-		return dbreader.ScanBreak
 	}
-	return nil
-}
-
-func (e *analyzeDeferredCausetsExec) NewChunk() *chunk.Chunk {
-	fields := make([]*types.FieldType, 0, len(e.fields))
-	for _, field := range e.fields {
-		fields = append(fields, &field.DeferredCauset.FieldType)
+	p.chk.Reset()
+	if p.pkBuilder != nil {
+		err = p.pkBuilder.Iterate(types.NewBytesCauset(safeINTERLOCKy(p.values[0])))
+		if err != nil {
+			return err
+		}
 	}
-	return chunk.NewChunkWithCapacity(fields, 1024)
-}
-
-// Close implements the sqlexec.RecordSet Close interface.
-func (e *analyzeDeferredCausetsExec) Close() error {
-	return nil
+	return p.builder.Collect(key, p.values)
 }
@@ -88,6 +88,7 @@ func buildClosureExecutor(posetPosetDagCtx *posetPosetDagContext, posetPosetDagR
 	if err != nil {
 		return nil, err
 	}
+	ce.initPaging()
 	return ce, nil
 }
 
@@ -293,6 +294,7 @@ type closureExecutor struct {
 	rowCount int
 	unique   bool
 	limit    int
+	paging   *pagingCtx
 
 	oldChunks []fidelpb.Chunk
 	oldRowBuf []byte
@@ -325,6 +327,19 @@ type idxScanCtx struct {
 	primaryDeferredCausetIds []int64
 }
 
+// pagingCtx tracks the page of a paging request.
+type pagingCtx struct {
+	maxRows  uint64
+	maxBytes uint64
+	rows     uint64
+	bytes    uint64
+	lastKey  []byte
+}
+
+func (p *pagingCtx) full() bool {
+	return (p.maxRows > 0 && p.rows >= p.maxRows) || (p.maxBytes > 0 && p.bytes >= p.maxBytes)
+}
+
 type aggCtx struct {
 	col *fidelpb.DeferredCausetInfo
 }
@@ -376,7 +391,7 @@ func (e *closureExecutor) execute() ([]fidelpb.Chunk, error) {
 				return nil, errors.Trace(err)
 			}
 		}
-		if e.rowCount == e.limit {
+		if e.rowCount == e.limit || e.pageFull() {
 			break
 		}
 	}
@@ -384,6 +399,47 @@ func (e *closureExecutor) execute() ([]fidelpb.Chunk, error) {
 	return e.oldChunks, err
 }
 
+// initPaging enables paging if the request asks for it. Only the plans that produce
+// rows as they scan can be paged, the aggregations and topN need the whole range.
+func (e *closureExecutor) initPaging() {
+	if e.pagingSize == 0 && e.pagingBytes == 0 {
+		return
+	}
+	switch e.processor.(type) {
+	case *blockScanProcessor, *indexScanProcessor, *selectionProcessor:
+		e.paging = &pagingCtx{maxRows: e.pagingSize, maxBytes: e.pagingBytes}
+	}
+}
+
+func (e *closureExecutor) pageFull() bool {
+	return e.paging != nil && e.paging.full()
+}
+
+// pageRow counts a produced event of key in the page.
+func (e *closureExecutor) pageRow(key []byte) error {
+	if e.paging == nil {
+		return nil
+	}
+	e.paging.rows++
+	e.paging.lastKey = safeINTERLOCKy(key)
+	if e.paging.maxBytes > 0 {
+		// Encode the event at once to know the size of the page.
+		return e.chunkToOldChunk(e.scanCtx.chk)
+	}
+	return nil
+}
+
+// pageRange returns the range scanned by a full page, or nil if the scan is done.
+func (e *closureExecutor) pageRange() *interlock.KeyRange {
+	if !e.pageFull() || e.rowCount == e.limit {
+		return nil
+	}
+	if e.scanCtx.desc {
+		return &interlock.KeyRange{Start: e.paging.lastKey, End: e.kvRanges[len(e.kvRanges)-1].EndKey}
+	}
+	return &interlock.KeyRange{Start: e.kvRanges[0].StartKey, End: solomonkey.Key(e.paging.lastKey).PrefixNext()}
+}
+
 func (e *closureExecutor) isPointGetRange(ran solomonkey.KeyRange) bool {
 	if len(e.primaryDefCauss) > 0 {
 		return false
@@ -394,7 +450,7 @@ func (e *closureExecutor) isPointGetRange(ran solomonkey.KeyRange) bool {
 func (e *closureExecutor) checkRangeLock() error {
 	if !e.ignoreLock && !e.lockChecked {
 		for _, ran := range e.kvRanges {
-			err := e.checkRangeLockForRange(ran)
+			err := checkRangeLockForRange(e.lockStore, ran, e.startTS, e.resolvedLocks)
 			if err != nil {
 				return err
 			}
@@ -404,14 +460,16 @@ func (e *closureExecutor) checkRangeLock() error {
 	return nil
 }
 
-func (e *closureExecutor) checkRangeLockForRange(ran solomonkey.KeyRange) error {
-	it := e.lockStore.NewIterator()
+// checkRangeLockForRange returns ErrLocked if a dagger in the range blocks the read at
+// startTS.
+func checkRangeLockForRange(lockStore *lockstore.MemStore, ran solomonkey.KeyRange, startTS uint64, resolvedLocks []uint64) error {
+	it := lockStore.NewIterator()
 	for it.Seek(ran.StartKey); it.Valid(); it.Next() {
 		if exceedEndKey(it.Key(), ran.EndKey) {
 			break
 		}
 		dagger := mvsr-ooc.DecodeLock(it.Value())
-		err := checkLock(dagger, it.Key(), e.startTS, e.resolvedLocks)
+		err := checkLock(dagger, it.Key(), startTS, resolvedLocks)
 		if err != nil {
 			return err
 		}
@@ -488,11 +546,17 @@ type blockScanProcessor struct {
 }
 
 func (e *blockScanProcessor) Process(key, value []byte) error {
-	if e.rowCount == e.limit {
+	if e.rowCount == e.limit || e.pageFull() {
 		return dbreader.ScanBreak
 	}
 	e.rowCount++
 	err := e.blockScanProcessCore(key, value)
+	if err != nil {
+		return err
+	}
+	if err = e.pageRow(key); err != nil {
+		return err
+	}
 	if e.scanCtx.chk.NumRows() == chunkMaxRows {
 		err = e.chunkToOldChunk(e.scanCtx.chk)
 	}
@@ -588,11 +652,17 @@ type indexScanProcessor struct {
 }
 
 func (e *indexScanProcessor) Process(key, value []byte) error {
-	if e.rowCount == e.limit {
+	if e.rowCount == e.limit || e.pageFull() {
 		return dbreader.ScanBreak
 	}
 	e.rowCount++
 	err := e.indexScanProcessCore(key, value)
+	if err != nil {
+		return err
+	}
+	if err = e.pageRow(key); err != nil {
+		return err
+	}
 	if e.scanCtx.chk.NumRows() == chunkMaxRows {
 		err = e.chunkToOldChunk(e.scanCtx.chk)
 	}
@@ -642,6 +712,9 @@ func (e *closureExecutor) chunkToOldChunk(chk *chunk.Chunk) error {
 			return errors.Trace(err)
 		}
 		e.oldChunks = appendRow(e.oldChunks, e.oldRowBuf, i)
+		if e.paging != nil {
+			e.paging.bytes += uint64(len(e.oldRowBuf))
+		}
 	}
 	chk.Reset()
 	return nil
@@ -653,7 +726,7 @@ type selectionProcessor struct {
 }
 
 func (e *selectionProcessor) Process(key, value []byte) error {
-	if e.rowCount == e.limit {
+	if e.rowCount == e.limit || e.pageFull() {
 		return dbreader.ScanBreak
 	}
 	err := e.processCore(key, value)
@@ -666,6 +739,9 @@ func (e *selectionProcessor) Process(key, value []byte) error {
 	}
 	if gotRow {
 		e.rowCount++
+		if err = e.pageRow(key); err != nil {
+			return err
+		}
 		if e.scanCtx.chk.NumRows() == chunkMaxRows {
 			err = e.chunkToOldChunk(e.scanCtx.chk)
 		}
@@ -823,6 +899,9 @@ func (e *hashAggProcessor) Finish() error {
 		}
 		e.oldRowBuf = append(e.oldRowBuf, gk...)
 		e.oldChunks = appendRow(e.oldChunks, e.oldRowBuf, i)
+		if e.paging != nil {
+			e.paging.bytes += uint64(len(e.oldRowBuf))
+		}
 	}
 	return nil
 }
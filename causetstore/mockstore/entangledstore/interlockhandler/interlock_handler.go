@@ -16,6 +16,8 @@ package INTERLOCKhandler
 import (
 	"bytes"
 	"fmt"
+	"hash/crc64"
+	"math"
 	"time"
 
 	"github.com/golang/protobuf/proto"
@@ -43,12 +45,12 @@ import (
 // HandleINTERLOCKRequest handles interlock request.
 func HandleINTERLOCKRequest(dbReader *dbreader.DBReader, lockStore *lockstore.MemStore, req *interlock.Request) *interlock.Response {
 	switch req.Tp {
-	case solomonkey.ReqTypePosetDag:
+	case solomonkey.ReqTypePosetDag, solomonkey.ReqTypePagingPosetDag:
 		return handleCoFIDelAGRequest(dbReader, lockStore, req)
 	case solomonkey.ReqTypeAnalyze:
 		return handleINTERLOCKAnalyzeRequest(dbReader, req)
 	case solomonkey.ReqTypeChecksum:
-		return handleINTERLOCKChecksumRequest(dbReader, req)
+		return handleINTERLOCKChecksumRequest(dbReader, lockStore, req)
 	}
 	return &interlock.Response{OtherError: fmt.Sprintf("unsupported request type %d", req.GetTp())}
 }
@@ -61,6 +63,8 @@ type posetPosetDagContext struct {
 	posetPosetDagReq *fidelpb.PosetDagRequest
 	keyRanges        []*interlock.KeyRange
 	startTS          uint64
+	pagingSize       uint64
+	pagingBytes      uint64
 }
 
 // handleCoFIDelAGRequest handles interlock PosetDag request.
@@ -77,19 +81,33 @@ func handleCoFIDelAGRequest(dbReader *dbreader.DBReader, lockStore *lockstore.Me
 		return buildResp(nil, nil, posetPosetDagReq, err, posetPosetDagCtx.sc.GetWarnings(), time.Since(startTime))
 	}
 	chunks, err := closureExec.execute()
-	return buildResp(chunks, closureExec.counts, posetPosetDagReq, err, posetPosetDagCtx.sc.GetWarnings(), time.Since(startTime))
+	resp = buildResp(chunks, closureExec.counts, posetPosetDagReq, err, posetPosetDagCtx.sc.GetWarnings(), time.Since(startTime))
+	if err == nil {
+		resp.Range = closureExec.pageRange()
+	}
+	return resp
 }
 
 func buildPosetDag(reader *dbreader.DBReader, lockStore *lockstore.MemStore, req *interlock.Request) (*posetPosetDagContext, *fidelpb.PosetDagRequest, error) {
 	if len(req.Ranges) == 0 {
 		return nil, nil, errors.New("request range is null")
 	}
-	if req.GetTp() != solomonkey.ReqTypePosetDag {
+	data := req.Data
+	var pagingSize, pagingBytes uint64
+	switch req.GetTp() {
+	case solomonkey.ReqTypePosetDag:
+	case solomonkey.ReqTypePagingPosetDag:
+		var err error
+		data, pagingSize, pagingBytes, err = solomonkey.DecodePagingRequest(req.Data)
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+	default:
 		return nil, nil, errors.Errorf("unsupported request type %d", req.GetTp())
 	}
 
 	posetPosetDagReq := new(fidelpb.PosetDagRequest)
-	err := proto.Unmarshal(req.Data, posetPosetDagReq)
+	err := proto.Unmarshal(data, posetPosetDagReq)
 	if err != nil {
 		return nil, nil, errors.Trace(err)
 	}
@@ -103,6 +121,8 @@ func buildPosetDag(reader *dbreader.DBReader, lockStore *lockstore.MemStore, req
 		keyRanges:        req.Ranges,
 		startTS:          req.StartTs,
 		resolvedLocks:    req.Context.ResolvedLocks,
+		pagingSize:       pagingSize,
+		pagingBytes:      pagingBytes,
 	}
 	scanExec := posetPosetDagReq.Executors[0]
 	if scanExec.Tp == fidelpb.ExecType_TypeTableScan {
@@ -403,16 +423,62 @@ func fieldTypeFromPBDeferredCauset(col *fidelpb.DeferredCausetInfo) *types.Field
 	}
 }
 
-// handleINTERLOCKChecksumRequest handles interlock check sum request.
-func handleINTERLOCKChecksumRequest(dbReader *dbreader.DBReader, req *interlock.Request) *interlock.Response {
-	resp := &fidelpb.ChecksumResponse{
-		Checksum:   1,
-		TotalKvs:   1,
-		TotalBytes: 1,
+// handleINTERLOCKChecksumRequest handles interlock check sum request. It computes the
+// CRC64-XOR checksum of the KVs visible at the start ts in the request ranges, each KV
+// contributes the CRC64 of its raw key followed by its value. A dagger in the ranges
+// which blocks the read is returned in Locked, like a PosetDag request does.
+func handleINTERLOCKChecksumRequest(dbReader *dbreader.DBReader, lockStore *lockstore.MemStore, req *interlock.Request) *interlock.Response {
+	checksumReq := new(fidelpb.ChecksumRequest)
+	if err := proto.Unmarshal(req.Data, checksumReq); err != nil {
+		return &interlock.Response{OtherError: fmt.Sprintf("unmarshal checksum request error: %v", err)}
+	}
+	if checksumReq.Algorithm != fidelpb.ChecksumAlgorithm_Crc64_Xor {
+		return &interlock.Response{OtherError: fmt.Sprintf("unsupported checksum algorithm %v", checksumReq.Algorithm)}
+	}
+	ranges, err := extractKVRanges(dbReader.StartKey, dbReader.EndKey, req.Ranges, false)
+	if err != nil {
+		return &interlock.Response{OtherError: err.Error()}
+	}
+	for _, ran := range ranges {
+		if err = checkRangeLockForRange(lockStore, ran, req.StartTs, req.Context.ResolvedLocks); err != nil {
+			if locked, ok := errors.Cause(err).(*ErrLocked); ok {
+				return &interlock.Response{Locked: &kvrpcpb.LockInfo{
+					Key:         locked.Key,
+					PrimaryLock: locked.Primary,
+					LockVersion: locked.StartTS,
+					LockTtl:     locked.TTL,
+				}}
+			}
+			return &interlock.Response{OtherError: err.Error()}
+		}
+	}
+	processor := &checksumProcessor{}
+	for _, ran := range ranges {
+		if err = dbReader.Scan(ran.StartKey, ran.EndKey, math.MaxInt64, req.StartTs, processor); err != nil {
+			return &interlock.Response{OtherError: err.Error()}
+		}
 	}
-	data, err := resp.Marshal()
+	data, err := processor.resp.Marshal()
 	if err != nil {
 		return &interlock.Response{OtherError: fmt.Sprintf("marshal checksum response error: %v", err)}
 	}
 	return &interlock.Response{Data: data}
 }
+
+var crc64Block = crc64.MakeTable(crc64.ECMA)
+
+type checksumProcessor struct {
+	skipVal
+
+	resp fidelpb.ChecksumResponse
+}
+
+func (p *checksumProcessor) Process(key, value []byte) error {
+	digest := crc64.New(crc64Block)
+	digest.Write(key)
+	digest.Write(value)
+	p.resp.Checksum ^= digest.Sum64()
+	p.resp.TotalKvs++
+	p.resp.TotalBytes += uint64(len(key) + len(value))
+	return nil
+}
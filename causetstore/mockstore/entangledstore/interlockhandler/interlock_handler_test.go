@@ -16,6 +16,7 @@ package MilevaDB
 import (
 	"errors"
 	"fmt"
+	"hash/crc64"
 	"io/ioutil"
 	"math"
 	"os"
@@ -26,6 +27,7 @@ import (
 	"github.com/ngaut/entangledstore/einsteindb/mvsr-ooc"
 	"github.com/ngaut/entangledstore/lockstore"
 	"github.com/whtcorpsinc/MilevaDB-Prod/blockcodec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/sampling"
 	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
 	"github.com/whtcorpsinc/MilevaDB-Prod/expression"
 	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
@@ -378,6 +380,266 @@ func (ts testSuite) TestClosureExecutor(c *C) {
 	c.Assert(rowCount, Equals, 0)
 }
 
+func (ts testSuite) TestClosureExecutorPaging(c *C) {
+	data := prepareTestTableData(c, keyNumber, blockID)
+	causetstore, err := newTestStore("INTERLOCK_handler_paging_test_db", "INTERLOCK_handler_paging_test_log")
+	defer cleanTestStore(causetstore)
+	c.Assert(err, IsNil)
+	errors := initTestData(causetstore, data.encodedTestKVDatas)
+	c.Assert(errors, IsNil)
+
+	// A range for each event.
+	var allRanges []solomonkey.KeyRange
+	for i := 0; i < keyNumber; i++ {
+		allRanges = append(allRanges, getTestPointRange(blockID, int64(i)))
+	}
+	for _, desc := range []bool{false, true} {
+		posetPosetDagRequest := newPosetPosetDagBuilder().
+			setStartTs(posetPosetDagRequestStartTs).
+			addTableScan(data.colInfos, blockID).
+			setOutputOffsets([]uint32{0}).
+			build()
+		posetPosetDagRequest.Executors[0].TblScan.Desc = desc
+		reqData, err := posetPosetDagRequest.Marshal()
+		c.Assert(err, IsNil)
+		reqData = solomonkey.EncodePagingRequest(reqData, 2, 0)
+		var handles []int64
+		var pages int
+		for ranges := allRanges; len(ranges) > 0; pages++ {
+			req := &interlock.Request{Tp: solomonkey.ReqTypePagingPosetDag, Data: reqData, StartTs: posetPosetDagRequestStartTs}
+			for _, ran := range ranges {
+				req.Ranges = append(req.Ranges, &interlock.KeyRange{Start: ran.StartKey, End: ran.EndKey})
+			}
+			dbReader := dbreader.NewDBReader(nil, []byte{255}, causetstore.EDB.NewTransaction(false))
+			resp := HandleINTERLOCKRequest(dbReader, causetstore.locks, req)
+			c.Assert(resp.OtherError, Equals, "")
+			var selResp fidelpb.SelectResponse
+			c.Assert(selResp.Unmarshal(resp.Data), IsNil)
+			for _, chk := range selResp.Chunks {
+				values, err := codec.Decode(chk.RowsData, 2)
+				c.Assert(err, IsNil)
+				for _, v := range values {
+					handles = append(handles, v.GetInt64())
+				}
+			}
+			if resp.Range == nil {
+				break
+			}
+			// The page covers the part of the ranges it scanned.
+			if desc {
+				c.Assert(resp.Range.End, DeepEquals, []byte(ranges[len(ranges)-1].EndKey))
+			} else {
+				c.Assert(resp.Range.Start, DeepEquals, []byte(ranges[0].StartKey))
+			}
+			ranges = solomonkey.ResumeKeyRanges(ranges, solomonkey.KeyRange{StartKey: resp.Range.Start, EndKey: resp.Range.End}, desc)
+		}
+		c.Assert(pages, Equals, 2)
+		if desc {
+			c.Assert(handles, DeepEquals, []int64{2, 1, 0})
+		} else {
+			c.Assert(handles, DeepEquals, []int64{0, 1, 2})
+		}
+	}
+}
+
+func (ts testSuite) TestChecksumLock(c *C) {
+	data := prepareTestTableData(c, keyNumber, blockID)
+	causetstore, err := newTestStore("INTERLOCK_handler_checksum_test_db", "INTERLOCK_handler_checksum_test_log")
+	defer cleanTestStore(causetstore)
+	c.Assert(err, IsNil)
+	errors := initTestData(causetstore, data.encodedTestKVDatas)
+	c.Assert(errors, IsNil)
+
+	checksumReq := &fidelpb.ChecksumRequest{Algorithm: fidelpb.ChecksumAlgorithm_Crc64_Xor}
+	reqData, err := checksumReq.Marshal()
+	c.Assert(err, IsNil)
+	prefix := blockcodec.GenTableRecordPrefix(blockID)
+	checksumRange := func(start, end []byte) *interlock.Response {
+		dbReader := dbreader.NewDBReader(nil, []byte{255}, causetstore.EDB.NewTransaction(false))
+		return HandleINTERLOCKRequest(dbReader, causetstore.locks, &interlock.Request{
+			Tp:      solomonkey.ReqTypeChecksum,
+			Data:    reqData,
+			StartTs: posetPosetDagRequestStartTs,
+			Ranges:  []*interlock.KeyRange{{Start: start, End: end}},
+		})
+	}
+	checksum := func() *interlock.Response {
+		return checksumRange(prefix, prefix.PrefixNext())
+	}
+	mustChecksum := func(start, end []byte) *fidelpb.ChecksumResponse {
+		resp := checksumRange(start, end)
+		c.Assert(resp.Locked, IsNil)
+		c.Assert(resp.OtherError, Equals, "")
+		checksumResp := &fidelpb.ChecksumResponse{}
+		c.Assert(checksumResp.Unmarshal(resp.Data), IsNil)
+		return checksumResp
+	}
+
+	// The checksum is the XOR of the CRC64 of each record key followed by its value.
+	expected := &fidelpb.ChecksumResponse{}
+	crcBlock := crc64.MakeTable(crc64.ECMA)
+	for _, kv := range data.encodedTestKVDatas {
+		expected.Checksum ^= crc64.Checksum(append(append([]byte{}, kv.encodedRowKey...), kv.encodedRowValue...), crcBlock)
+		expected.TotalKvs++
+		expected.TotalBytes += uint64(len(kv.encodedRowKey) + len(kv.encodedRowValue))
+	}
+	c.Assert(mustChecksum(prefix, prefix.PrefixNext()), DeepEquals, expected)
+
+	// The checksums of the regions split from the causet add up to the checksum of the causet.
+	splitKey := data.encodedTestKVDatas[keyNumber/2].encodedRowKey
+	left := mustChecksum(prefix, splitKey)
+	right := mustChecksum(splitKey, prefix.PrefixNext())
+	c.Assert(left.TotalKvs, Equals, uint64(keyNumber/2))
+	c.Assert(left.Checksum, Not(Equals), expected.Checksum)
+	c.Assert(&fidelpb.ChecksumResponse{
+		Checksum:   left.Checksum ^ right.Checksum,
+		TotalKvs:   left.TotalKvs + right.TotalKvs,
+		TotalBytes: left.TotalBytes + right.TotalBytes,
+	}, DeepEquals, expected)
+
+	// A dagger after the start ts doesn't block the checksum.
+	key := data.encodedTestKVDatas[1].encodedRowKey
+	causetstore.prewrite(&kvrpcpb.PrewriteRequest{
+		Mutations:    []*kvrpcpb.Mutation{makeATestMutaion(kvrpcpb.Op_Put, key, []byte("v"))},
+		PrimaryLock:  key,
+		StartVersion: posetPosetDagRequestStartTs + 1,
+		LockTtl:      ttl,
+	})
+	c.Assert(checksum().Locked, IsNil)
+	causetstore.locks.Delete(key)
+
+	// A dagger before the start ts is returned to the client to resolve.
+	causetstore.prewrite(&kvrpcpb.PrewriteRequest{
+		Mutations:    []*kvrpcpb.Mutation{makeATestMutaion(kvrpcpb.Op_Del, key, nil)},
+		PrimaryLock:  key,
+		StartVersion: posetPosetDagRequestStartTs - 1,
+		LockTtl:      ttl,
+	})
+	resp = checksum()
+	c.Assert(resp.Locked, NotNil)
+	c.Assert(resp.Locked.Key, DeepEquals, key)
+	c.Assert(resp.Locked.LockVersion, Equals, uint64(posetPosetDagRequestStartTs-1))
+	c.Assert(resp.Data, IsNil)
+}
+
+func (ts testSuite) TestAnalyzeDeferredCausets(c *C) {
+	const rows = 100
+	causetstore, err := newTestStore("INTERLOCK_handler_analyze_test_db", "INTERLOCK_handler_analyze_test_log")
+	defer cleanTestStore(causetstore)
+	c.Assert(err, IsNil)
+	sc := new(stmtctx.StatementContext)
+	encodeInt := func(v int64) []byte {
+		b, err := codec.EncodeValue(sc, nil, types.NewIntCauset(v))
+		c.Assert(err, IsNil)
+		return b
+	}
+	// col_2 is 0 for the first 60 rows, then distinct.
+	valueOf := func(handle int64) int64 {
+		if handle < 60 {
+			return 0
+		}
+		return handle
+	}
+	var keys [][]byte
+	kvDatas := make([]*encodedTestKVData, 0, rows)
+	for i := int64(0); i < rows; i++ {
+		value, err := blockcodec.EncodeRow(sc, types.MakeCausets(valueOf(i)), []int64{2}, nil, nil, &rowcodec.Encoder{Enable: true})
+		c.Assert(err, IsNil)
+		key := blockcodec.EncodeRowKeyWithHandle(blockID, solomonkey.IntHandle(i))
+		keys = append(keys, key)
+		kvDatas = append(kvDatas, &encodedTestKVData{encodedRowKey: key, encodedRowValue: value})
+	}
+	c.Assert(initTestData(causetstore, kvDatas), IsNil)
+
+	// The causet is analyzed as two regions split at the handle 50.
+	prefix := blockcodec.GenTableRecordPrefix(blockID)
+	regionRanges := [][]*interlock.KeyRange{
+		{{Start: prefix, End: keys[rows/2]}},
+		{{Start: keys[rows/2], End: prefix.PrefixNext()}},
+	}
+	columns := []*fidelpb.DeferredCausetInfo{
+		{DeferredCausetId: 1, Tp: int32(allegrosql.TypeLonglong), PkHandle: true},
+		{DeferredCausetId: 2, Tp: int32(allegrosql.TypeLonglong)},
+	}
+	analyze := func(colReq *fidelpb.AnalyzeDeferredCausetsReq) ([]*fidelpb.AnalyzeDeferredCausetsResp, string) {
+		colReq.DeferredCausetsInfo = columns
+		reqData, err := (&fidelpb.AnalyzeReq{Tp: fidelpb.AnalyzeType_TypeDeferredCauset, DefCausReq: colReq}).Marshal()
+		c.Assert(err, IsNil)
+		var resps []*fidelpb.AnalyzeDeferredCausetsResp
+		for _, ranges := range regionRanges {
+			dbReader := dbreader.NewDBReader(nil, []byte{255}, causetstore.EDB.NewTransaction(false))
+			resp := HandleINTERLOCKRequest(dbReader, causetstore.locks, &interlock.Request{
+				Tp:      solomonkey.ReqTypeAnalyze,
+				Data:    reqData,
+				StartTs: posetPosetDagRequestStartTs + 2*rows,
+				Ranges:  ranges,
+			})
+			if resp.OtherError != "" {
+				return nil, resp.OtherError
+			}
+			colResp := new(fidelpb.AnalyzeDeferredCausetsResp)
+			c.Assert(colResp.Unmarshal(resp.Data), IsNil)
+			resps = append(resps, colResp)
+		}
+		return resps, ""
+	}
+
+	// The rows sampled by rate don't depend on the split of the causet.
+	rate := 0.3
+	resps, otherErr := analyze(&fidelpb.AnalyzeDeferredCausetsReq{SampleSize: 5, SketchSize: 100, SampleRate: &rate})
+	c.Assert(otherErr, Equals, "")
+	var expected, sampled int
+	for _, key := range keys {
+		if sampling.SampledByRate(key, rate) {
+			expected++
+		}
+	}
+	var count int64
+	for _, resp := range resps {
+		c.Assert(resp.PkHist, NotNil)
+		c.Assert(resp.DefCauslectors, HasLen, 1)
+		count += resp.DefCauslectors[0].Count
+		sampled += len(resp.DefCauslectors[0].Samples)
+	}
+	c.Assert(count, Equals, int64(rows))
+	c.Assert(sampled, Equals, expected)
+
+	// The most frequent value is kept exactly in the TopN of the CM sketch.
+	depth, width, topNSize := int32(4), int32(256), int32(1)
+	resps, otherErr = analyze(&fidelpb.AnalyzeDeferredCausetsReq{SampleSize: rows, CmsketchDepth: &depth, CmsketchWidth: &width, TopNSize: &topNSize})
+	c.Assert(otherErr, Equals, "")
+	for i, resp := range resps {
+		topN := resp.DefCauslectors[0].CmSketch.TopN
+		c.Assert(topN, HasLen, 1)
+		c.Assert(topN[0].Data, DeepEquals, encodeInt(0))
+		c.Assert(topN[0].Count, Equals, []uint64{50, 10}[i])
+	}
+
+	// The offsets of a column group index the columns of the request, the
+	// integer primary key handle at offset 0.
+	resps, otherErr = analyze(&fidelpb.AnalyzeDeferredCausetsReq{
+		SampleSize:           rows,
+		DeferredCausetGroups: []*fidelpb.AnalyzeDeferredCausetGroup{{DeferredCausetOffsets: []int64{0, 1}}, {DeferredCausetOffsets: []int64{1}}},
+	})
+	c.Assert(otherErr, Equals, "")
+	var groupSamples [][]byte
+	for _, resp := range resps {
+		c.Assert(resp.DefCauslectors, HasLen, 3)
+		c.Assert(resp.DefCauslectors[2].Samples, DeepEquals, resp.DefCauslectors[0].Samples)
+		groupSamples = append(groupSamples, resp.DefCauslectors[1].Samples...)
+	}
+	c.Assert(groupSamples, HasLen, rows)
+	for i, sample := range groupSamples {
+		// The samples of a region are in the order of the rows.
+		c.Assert(sample, DeepEquals, append(encodeInt(int64(i)), encodeInt(valueOf(int64(i)))...))
+	}
+	_, otherErr = analyze(&fidelpb.AnalyzeDeferredCausetsReq{
+		SampleSize:           rows,
+		DeferredCausetGroups: []*fidelpb.AnalyzeDeferredCausetGroup{{DeferredCausetOffsets: []int64{2}}},
+	})
+	c.Assert(otherErr, Matches, ".*column group offset 2 out of range.*")
+}
+
 func buildEQIntExpr(colID, val int64) *fidelpb.Expr {
 	return &fidelpb.Expr{
 		Tp:        fidelpb.ExprType_ScalarFunc,
@@ -0,0 +1,70 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package entangledstore
+
+import (
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
+	"golang.org/x/net/context"
+)
+
+// handleINTERLOCK handles an interlock request. The PosetDag requests with the cache
+// enabled are checked for the interlock result cache of the client.
+//
+// A result can be cached with the data version of the Region if no key in the Region
+// is locked and the result is read after the last commit. The cached result is valid
+// as long as the version doesn't change, a request carrying it gets a cache hit
+// without being executed.
+func (c *RPCClient) handleINTERLOCK(ctx context.Context, req *interlock.Request) (*interlock.Response, error) {
+	if req.Tp != solomonkey.ReqTypePosetDag || !req.IsCacheEnabled {
+		return c.usSvr.interlocking_directorate(ctx, req)
+	}
+	region := c.cluster.GetRegion(req.Context.GetRegionId())
+	if region == nil {
+		return c.usSvr.interlocking_directorate(ctx, req)
+	}
+	var start, end []byte
+	var err error
+	if len(region.StartKey) > 0 {
+		if _, start, err = codec.DecodeBytes(region.StartKey, nil); err != nil {
+			return nil, err
+		}
+	}
+	if len(region.EndKey) > 0 {
+		if _, end, err = codec.DecodeBytes(region.EndKey, nil); err != nil {
+			return nil, err
+		}
+	}
+	// The version is read before the request is executed, a write during the execution
+	// changes it so the result won't be reused.
+	dataVersion := c.dataVersions.Get(region.Id)
+	_, locked, err := c.feed.MinLockTS(start, end)
+	if err != nil {
+		return nil, err
+	}
+	cacheable := !locked && req.StartTs >= dataVersion.MaxCommitTS
+	if cacheable && req.CacheIfMatchVersion == dataVersion.Version {
+		return &interlock.Response{IsCacheHit: true, CacheLastVersion: dataVersion.Version}, nil
+	}
+	resp, err := c.usSvr.interlocking_directorate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	// A paging response only holds a part of the result.
+	if cacheable && resp.RegionError == nil && resp.Locked == nil && resp.OtherError == "" && resp.Range == nil {
+		resp.CanBeCached = true
+		resp.CacheLastVersion = dataVersion.Version
+	}
+	return resp, nil
+}
@@ -0,0 +1,136 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package entangledstore
+
+import (
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/blockcodec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/oracle"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/cdc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/berolinaAllegroSQL/allegrosql"
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/fidelpb/go-fidelpb"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+	"golang.org/x/net/context"
+)
+
+func (ts testSuite) TestINTERLOCKCacheDataVersion(c *C) {
+	client, fidelCli, cluster, err := New("")
+	c.Assert(err, IsNil)
+	defer client.Close()
+	_, _, regionID := BootstrapWithSingleStore(cluster)
+	region := cluster.GetRegion(regionID)
+	reqCtx := kvrpcpb.Context{RegionId: regionID, RegionEpoch: region.RegionEpoch, Peer: region.Peers[0]}
+	getTS := func() uint64 {
+		physical, logical, err := fidelCli.GetTS(context.Background())
+		c.Assert(err, IsNil)
+		return oracle.ComposeTS(physical, logical)
+	}
+	send := func(tp einsteindbrpc.CmdType, req interface{}) interface{} {
+		resp, err := client.SendRequest(context.Background(), "", einsteindbrpc.NewRequest(tp, req, reqCtx), time.Second)
+		c.Assert(err, IsNil)
+		return resp.Resp
+	}
+
+	const blockID = int64(1)
+	data, err := (&fidelpb.PosetDagRequest{
+		Executors: []*fidelpb.Executor{{
+			Tp: fidelpb.ExecType_TypeTableScan,
+			TblScan: &fidelpb.TableScan{TableId: blockID, DeferredCausets: []*fidelpb.DeferredCausetInfo{
+				{DeferredCausetId: 1, Tp: int32(allegrosql.TypeLonglong), PkHandle: true},
+			}},
+		}},
+		OutputOffsets: []uint32{0},
+	}).Marshal()
+	c.Assert(err, IsNil)
+	start, end := blockcodec.GenTableRecordPrefix(blockID), blockcodec.GenTableRecordPrefix(blockID).PrefixNext()
+	posetDag := func(startTS uint64, cacheEnabled bool, version uint64) *interlock.Response {
+		return send(einsteindbrpc.CmdINTERLOCK, &interlock.Request{
+			Tp:                  solomonkey.ReqTypePosetDag,
+			Data:                data,
+			StartTs:             startTS,
+			Ranges:              []*interlock.KeyRange{{Start: start, End: end}},
+			IsCacheEnabled:      cacheEnabled,
+			CacheIfMatchVersion: version,
+		}).(*interlock.Response)
+	}
+	prewrite := func(startTS uint64, key []byte) {
+		resp := send(einsteindbrpc.CmdPrewrite, &kvrpcpb.PrewriteRequest{
+			Mutations:    []*kvrpcpb.Mutation{{Op: kvrpcpb.Op_Put, Key: key, Value: []byte("v")}},
+			PrimaryLock:  key,
+			StartVersion: startTS,
+			LockTtl:      3000,
+		})
+		c.Assert(resp.(*kvrpcpb.PrewriteResponse).Errors, HasLen, 0)
+	}
+
+	key := blockcodec.EncodeRowKeyWithHandle(blockID, solomonkey.IntHandle(1))
+	startTS := getTS()
+	prewrite(startTS, key)
+	// A locked Region can't be cached.
+	resp := posetDag(getTS(), true, 0)
+	c.Assert(resp.CanBeCached, IsFalse)
+	readTS := getTS()
+	send(einsteindbrpc.CmdCommit, &kvrpcpb.CommitRequest{Keys: [][]byte{key}, StartVersion: startTS, CommitVersion: getTS()})
+
+	// A result read before the last commit can't be cached.
+	resp = posetDag(readTS, true, 0)
+	c.Assert(resp.CanBeCached, IsFalse)
+	resp = posetDag(getTS(), true, 0)
+	c.Assert(resp.CanBeCached, IsTrue)
+	version := resp.CacheLastVersion
+	c.Assert(version, Not(Equals), uint64(0))
+	resp = posetDag(getTS(), true, version)
+	c.Assert(resp.IsCacheHit, IsTrue)
+	// The requests without the cache enabled aren't checked.
+	resp = posetDag(getTS(), false, 0)
+	c.Assert(resp.CanBeCached, IsFalse)
+	c.Assert(resp.CacheLastVersion, Equals, uint64(0))
+
+	// Resolving a batch of transactions changes the version, and publishes the commits.
+	sub, err := client.Subscribe(start, end, getTS())
+	c.Assert(err, IsNil)
+	defer sub.Close()
+	key = blockcodec.EncodeRowKeyWithHandle(blockID, solomonkey.IntHandle(2))
+	startTS = getTS()
+	prewrite(startTS, key)
+	commitTS := getTS()
+	send(einsteindbrpc.CmdResolveLock, &kvrpcpb.ResolveLockRequest{TxnInfos: []*kvrpcpb.TxnInfo{{Txn: startTS, Status: commitTS}}})
+	for committed := false; !committed; {
+		select {
+		case e := <-sub.Events():
+			if e.Type == cdc.EventCommit {
+				c.Assert(e.Key, BytesEquals, []byte(key))
+				c.Assert(e.CommitTS, Equals, commitTS)
+				committed = true
+			}
+		case <-time.After(5 * time.Second):
+			c.Fatal("wait commit event timeout")
+		}
+	}
+	resp = posetDag(getTS(), true, version)
+	c.Assert(resp.IsCacheHit, IsFalse)
+	c.Assert(resp.CanBeCached, IsTrue)
+	c.Assert(resp.CacheLastVersion > version, IsTrue)
+
+	// So does deleting a range.
+	version = resp.CacheLastVersion
+	send(einsteindbrpc.CmdDeleteRange, &kvrpcpb.DeleteRangeRequest{StartKey: start, EndKey: end})
+	resp = posetDag(getTS(), true, version)
+	c.Assert(resp.IsCacheHit, IsFalse)
+	c.Assert(resp.CacheLastVersion > version, IsTrue)
+}
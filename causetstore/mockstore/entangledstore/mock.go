@@ -20,6 +20,9 @@ import (
 	fidel "github.com/einsteindb/fidel/client"
 	usconf "github.com/ngaut/entangledstore/config"
 	ussvr "github.com/ngaut/entangledstore/server"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/cdc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/dataversion"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/rpctrace"
 	"github.com/whtcorpsinc/errors"
 )
 
@@ -59,11 +62,14 @@ func New(path string) (*RPCClient, fidel.Client, *Cluster, error) {
 
 	cluster := newCluster(rm)
 	client := &RPCClient{
-		usSvr:      srv,
-		cluster:    cluster,
-		path:       path,
-		persistent: persistent,
-		rawHandler: newRawHandler(),
+		usSvr:        srv,
+		cluster:      cluster,
+		path:         path,
+		persistent:   persistent,
+		rawHandler:   newRawHandler(),
+		feed:         cdc.NewFeed(nil),
+		dataVersions: dataversion.NewTracker(),
+		tracer:       rpctrace.NewTracer(),
 	}
 	FIDelClient := newFIDelClient(fidel)
 
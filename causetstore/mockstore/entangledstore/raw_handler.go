@@ -17,26 +17,147 @@ import (
 	"bytes"
 	"context"
 	"sync"
+	"time"
 
 	"github.com/ngaut/entangledstore/lockstore"
 	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
 )
 
-type rawHandler struct {
-	mu          sync.RWMutex
+const defaultRawCF = "default"
+
+// rawNow returns the current time used by the raw KV TTL, tests can change it.
+var rawNow = time.Now
+
+// rawCF is a column family of the raw KV. The keys with TTL have their expire time
+// in unix seconds recorded in expireAt. The reads skip the expired keys, an expired
+// key is removed by the next write of it.
+type rawCF struct {
 	causetstore *lockstore.MemStore
+	expireAt    map[string]uint64
+}
+
+func newRawCF() *rawCF {
+	return &rawCF{
+		causetstore: lockstore.NewMemStore(4096),
+		expireAt:    make(map[string]uint64),
+	}
+}
+
+// get returns the value of the key, cf can be nil if the column family doesn't exist.
+func (cf *rawCF) get(key []byte) []byte {
+	if cf == nil || cf.isExpired(key) {
+		return nil
+	}
+	return cf.causetstore.Get(key, nil)
+}
+
+func (cf *rawCF) put(key, value []byte, ttl uint64) {
+	cf.causetstore.Put(key, value)
+	if ttl == 0 {
+		delete(cf.expireAt, string(key))
+		return
+	}
+	cf.expireAt[string(key)] = uint64(rawNow().Unix()) + ttl
+}
+
+func (cf *rawCF) delete(key []byte) {
+	cf.causetstore.Delete(key)
+	delete(cf.expireAt, string(key))
+}
+
+func (cf *rawCF) scan(startKey, endKey []byte, limit int) []*kvrpcpb.KvPair {
+	if cf == nil {
+		return nil
+	}
+	var pairs []*kvrpcpb.KvPair
+	it := cf.causetstore.NewIterator()
+	for it.Seek(startKey); it.Valid(); it.Next() {
+		if len(pairs) >= limit {
+			break
+		}
+		if len(endKey) > 0 && bytes.Compare(it.Key(), endKey) >= 0 {
+			break
+		}
+		if cf.isExpired(it.Key()) {
+			continue
+		}
+		pairs = appendPair(pairs, it)
+	}
+	return pairs
+}
+
+func (cf *rawCF) reverseScan(startKey, endKey []byte, limit int) []*kvrpcpb.KvPair {
+	if cf == nil {
+		return nil
+	}
+	var pairs []*kvrpcpb.KvPair
+	it := cf.causetstore.NewIterator()
+	for it.SeekForPrev(startKey); it.Valid(); it.Prev() {
+		if bytes.Equal(it.Key(), startKey) {
+			continue
+		}
+		if len(pairs) >= limit {
+			break
+		}
+		if bytes.Compare(it.Key(), endKey) < 0 {
+			break
+		}
+		if cf.isExpired(it.Key()) {
+			continue
+		}
+		pairs = appendPair(pairs, it)
+	}
+	return pairs
+}
+
+func (cf *rawCF) isExpired(key []byte) bool {
+	expireAt, ok := cf.expireAt[string(key)]
+	return ok && uint64(rawNow().Unix()) >= expireAt
+}
+
+func (cf *rawCF) deleteKeys(keys [][]byte) {
+	for _, key := range keys {
+		cf.delete(key)
+	}
+}
+
+type rawHandler struct {
+	mu  sync.RWMutex
+	cfs map[string]*rawCF
 }
 
 func newRawHandler() *rawHandler {
 	return &rawHandler{
-		causetstore: lockstore.NewMemStore(4096),
+		cfs: map[string]*rawCF{defaultRawCF: newRawCF()},
+	}
+}
+
+// lookupCF returns the column family for reads, it's nil if the column family doesn't
+// exist.
+func (h *rawHandler) lookupCF(name string) *rawCF {
+	if name == "" {
+		name = defaultRawCF
 	}
+	return h.cfs[name]
+}
+
+// getCF returns the column family for writes, it's created on first use.
+func (h *rawHandler) getCF(name string) *rawCF {
+	if name == "" {
+		name = defaultRawCF
+	}
+	cf, ok := h.cfs[name]
+	if !ok {
+		cf = newRawCF()
+		h.cfs[name] = cf
+	}
+	return cf
 }
 
 func (h *rawHandler) RawGet(_ context.Context, req *kvrpcpb.RawGetRequest) (*kvrpcpb.RawGetResponse, error) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	val := h.causetstore.Get(req.Key, nil)
+	val := h.lookupCF(req.Cf).get(req.Key)
 	return &kvrpcpb.RawGetResponse{
 		Value:    val,
 		NotFound: len(val) == 0,
@@ -46,44 +167,40 @@ func (h *rawHandler) RawGet(_ context.Context, req *kvrpcpb.RawGetRequest) (*kvr
 func (h *rawHandler) RawBatchGet(_ context.Context, req *kvrpcpb.RawBatchGetRequest) (*kvrpcpb.RawBatchGetResponse, error) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
+	cf := h.lookupCF(req.Cf)
 	pairs := make([]*kvrpcpb.KvPair, len(req.Keys))
 	for i, key := range req.Keys {
 		pairs[i] = &kvrpcpb.KvPair{
 			Key:   key,
-			Value: h.causetstore.Get(key, nil),
+			Value: cf.get(key),
 		}
 	}
 	return &kvrpcpb.RawBatchGetResponse{Pairs: pairs}, nil
 }
 
 func (h *rawHandler) RawPut(_ context.Context, req *kvrpcpb.RawPutRequest) (*kvrpcpb.RawPutResponse, error) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	h.causetstore.Put(req.Key, req.Value)
+	h.RawPutWithTTL(req.Cf, req.Key, req.Value, 0)
 	return &kvrpcpb.RawPutResponse{}, nil
 }
 
 func (h *rawHandler) RawBatchPut(_ context.Context, req *kvrpcpb.RawBatchPutRequest) (*kvrpcpb.RawBatchPutResponse, error) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	for _, pair := range req.Pairs {
-		h.causetstore.Put(pair.Key, pair.Value)
-	}
+	h.RawBatchPutWithTTL(req.Cf, req.Pairs, 0)
 	return &kvrpcpb.RawBatchPutResponse{}, nil
 }
 
 func (h *rawHandler) RawDelete(_ context.Context, req *kvrpcpb.RawDeleteRequest) (*kvrpcpb.RawDeleteResponse, error) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	h.causetstore.Delete(req.Key)
+	h.getCF(req.Cf).delete(req.Key)
 	return &kvrpcpb.RawDeleteResponse{}, nil
 }
 
 func (h *rawHandler) RawBatchDelete(_ context.Context, req *kvrpcpb.RawBatchDeleteRequest) (*kvrpcpb.RawBatchDeleteResponse, error) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	cf := h.getCF(req.Cf)
 	for _, key := range req.Keys {
-		h.causetstore.Delete(key)
+		cf.delete(key)
 	}
 	return &kvrpcpb.RawBatchDeleteResponse{}, nil
 }
@@ -91,7 +208,8 @@ func (h *rawHandler) RawBatchDelete(_ context.Context, req *kvrpcpb.RawBatchDele
 func (h *rawHandler) RawDeleteRange(_ context.Context, req *kvrpcpb.RawDeleteRangeRequest) (*kvrpcpb.RawDeleteRangeResponse, error) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	it := h.causetstore.NewIterator()
+	cf := h.getCF(req.Cf)
+	it := cf.causetstore.NewIterator()
 	var keys [][]byte
 	for it.Seek(req.StartKey); it.Valid(); it.Next() {
 		if bytes.Compare(it.Key(), req.EndKey) >= 0 {
@@ -99,45 +217,89 @@ func (h *rawHandler) RawDeleteRange(_ context.Context, req *kvrpcpb.RawDeleteRan
 		}
 		keys = append(keys, safeINTERLOCKy(it.Key()))
 	}
-	for _, key := range keys {
-		h.causetstore.Delete(key)
-	}
+	cf.deleteKeys(keys)
 	return &kvrpcpb.RawDeleteRangeResponse{}, nil
 }
 
 func (h *rawHandler) RawScan(_ context.Context, req *kvrpcpb.RawScanRequest) (*kvrpcpb.RawScanResponse, error) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	it := h.causetstore.NewIterator()
+	cf := h.lookupCF(req.Cf)
 	var pairs []*kvrpcpb.KvPair
 	if !req.Reverse {
-		for it.Seek(req.StartKey); it.Valid(); it.Next() {
-			if len(pairs) >= int(req.Limit) {
-				break
-			}
-			if len(req.EndKey) > 0 && bytes.Compare(it.Key(), req.EndKey) >= 0 {
-				break
-			}
-			pairs = h.appendPair(pairs, it)
-		}
+		pairs = cf.scan(req.StartKey, req.EndKey, int(req.Limit))
 	} else {
-		for it.SeekForPrev(req.StartKey); it.Valid(); it.Prev() {
-			if bytes.Equal(it.Key(), req.StartKey) {
-				continue
-			}
-			if len(pairs) >= int(req.Limit) {
-				break
-			}
-			if bytes.Compare(it.Key(), req.EndKey) < 0 {
-				break
-			}
-			pairs = h.appendPair(pairs, it)
-		}
+		pairs = cf.reverseScan(req.StartKey, req.EndKey, int(req.Limit))
 	}
 	return &kvrpcpb.RawScanResponse{Kvs: pairs}, nil
 }
 
-func (h *rawHandler) appendPair(pairs []*kvrpcpb.KvPair, it *lockstore.Iterator) []*kvrpcpb.KvPair {
+// RawPutWithTTL puts the key into the column family, the key expires after ttl seconds.
+// A zero ttl means the key never expires.
+func (h *rawHandler) RawPutWithTTL(cf string, key, value []byte, ttl uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.getCF(cf).put(key, value, ttl)
+}
+
+// RawBatchPutWithTTL puts the pairs into the column family with the same ttl.
+func (h *rawHandler) RawBatchPutWithTTL(cf string, pairs []*kvrpcpb.KvPair, ttl uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := h.getCF(cf)
+	for _, pair := range pairs {
+		c.put(pair.Key, pair.Value, ttl)
+	}
+}
+
+// RawGetKeyTTL returns the remaining TTL of the key in seconds, it's 0 if the key never
+// expires. found is false if the key doesn't exist or is expired.
+func (h *rawHandler) RawGetKeyTTL(cf string, key []byte) (ttl uint64, found bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	c := h.lookupCF(cf)
+	if len(c.get(key)) == 0 {
+		return 0, false
+	}
+	expireAt, ok := c.expireAt[string(key)]
+	if !ok {
+		return 0, true
+	}
+	return expireAt - uint64(rawNow().Unix()), true
+}
+
+// RawCompareAndSwap sets the key to value if its current value equals expected, a nil
+// expected means the key must not exist. It returns the previous value and whether the
+// value is swapped.
+func (h *rawHandler) RawCompareAndSwap(cf string, key, expected, value []byte, ttl uint64) (previous []byte, swapped bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := h.getCF(cf)
+	previous = c.get(key)
+	if len(previous) == 0 {
+		previous = nil
+	}
+	if (previous == nil) != (expected == nil) || !bytes.Equal(previous, expected) {
+		return previous, false
+	}
+	c.put(key, value, ttl)
+	return previous, true
+}
+
+// RawBatchScan scans each range of the column family with eachLimit and returns the
+// concatenated result.
+func (h *rawHandler) RawBatchScan(cf string, ranges []*kvrpcpb.KeyRange, eachLimit int) []*kvrpcpb.KvPair {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	c := h.lookupCF(cf)
+	var pairs []*kvrpcpb.KvPair
+	for _, r := range ranges {
+		pairs = append(pairs, c.scan(r.StartKey, r.EndKey, eachLimit)...)
+	}
+	return pairs
+}
+
+func appendPair(pairs []*kvrpcpb.KvPair, it *lockstore.Iterator) []*kvrpcpb.KvPair {
 	pair := &kvrpcpb.KvPair{
 		Key:   safeINTERLOCKy(it.Key()),
 		Value: safeINTERLOCKy(it.Value()),
@@ -16,6 +16,7 @@ package entangledstore
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	. "github.com/whtcorpsinc/check"
 	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
@@ -82,3 +83,77 @@ func (ts testSuite) TestRawHandler(c *C) {
 	scanResp, _ = h.RawScan(nil, scanReq)
 	c.Assert(scanResp.Kvs, HasLen, 0)
 }
+
+func (ts testSuite) TestRawHandlerExt(c *C) {
+	now := time.Unix(1000, 0)
+	rawNow = func() time.Time { return now }
+	defer func() { rawNow = time.Now }()
+
+	h := newRawHandler()
+	h.RawPut(nil, &kvrpcpb.RawPutRequest{Key: []byte("a"), Value: []byte("v0")})
+	h.RawPut(nil, &kvrpcpb.RawPutRequest{Key: []byte("a"), Value: []byte("v1"), Cf: "lock"})
+	getResp, _ := h.RawGet(nil, &kvrpcpb.RawGetRequest{Key: []byte("a"), Cf: "lock"})
+	c.Assert(getResp.Value, BytesEquals, []byte("v1"))
+	getResp, _ = h.RawGet(nil, &kvrpcpb.RawGetRequest{Key: []byte("a"), Cf: "write"})
+	c.Assert(getResp.NotFound, IsTrue)
+
+	h.RawPutWithTTL("", []byte("t"), []byte("v2"), 10)
+	ttl, found := h.RawGetKeyTTL("", []byte("t"))
+	c.Assert(found, IsTrue)
+	c.Assert(ttl, Equals, uint64(10))
+	now = now.Add(10 * time.Second)
+	getResp, _ = h.RawGet(nil, &kvrpcpb.RawGetRequest{Key: []byte("t")})
+	c.Assert(getResp.NotFound, IsTrue)
+	scanResp, _ := h.RawScan(nil, &kvrpcpb.RawScanRequest{StartKey: []byte("a"), Limit: 10})
+	c.Assert(scanResp.Kvs, HasLen, 1)
+
+	prev, swapped := h.RawCompareAndSwap("", []byte("c"), nil, []byte("v3"), 0)
+	c.Assert(swapped, IsTrue)
+	c.Assert(prev, IsNil)
+	prev, swapped = h.RawCompareAndSwap("", []byte("c"), []byte("v0"), []byte("v4"), 0)
+	c.Assert(swapped, IsFalse)
+	c.Assert(prev, BytesEquals, []byte("v3"))
+
+	// A key with an empty value doesn't exist.
+	h.RawPut(nil, &kvrpcpb.RawPutRequest{Key: []byte("0"), Value: []byte{}})
+	_, found = h.RawGetKeyTTL("", []byte("0"))
+	c.Assert(found, IsFalse)
+	prev, swapped = h.RawCompareAndSwap("", []byte("0"), nil, []byte("v5"), 0)
+	c.Assert(swapped, IsTrue)
+	c.Assert(prev, IsNil)
+
+	pairs := h.RawBatchScan("", []*kvrpcpb.KeyRange{
+		{StartKey: []byte("a"), EndKey: []byte("b")},
+		{StartKey: []byte("b")},
+	}, 10)
+	c.Assert(pairs, HasLen, 2)
+	c.Assert(pairs[0].Key, BytesEquals, []byte("a"))
+	c.Assert(pairs[1].Key, BytesEquals, []byte("c"))
+}
+
+func (ts testSuite) TestRawHandlerReadMissingCF(c *C) {
+	h := newRawHandler()
+	getResp, _ := h.RawGet(nil, &kvrpcpb.RawGetRequest{Cf: "lock", Key: []byte("a")})
+	c.Assert(getResp.NotFound, IsTrue)
+	batchGetResp, _ := h.RawBatchGet(nil, &kvrpcpb.RawBatchGetRequest{Cf: "lock", Keys: [][]byte{[]byte("a")}})
+	c.Assert(batchGetResp.Pairs[0].Value, HasLen, 0)
+	scanResp, _ := h.RawScan(nil, &kvrpcpb.RawScanRequest{Cf: "lock", Limit: 10})
+	c.Assert(scanResp.Kvs, HasLen, 0)
+	_, found := h.RawGetKeyTTL("lock", []byte("a"))
+	c.Assert(found, IsFalse)
+	c.Assert(h.RawBatchScan("lock", []*kvrpcpb.KeyRange{{}}, 10), HasLen, 0)
+	// The reads don't create the column family.
+	c.Assert(h.cfs, HasLen, 1)
+
+	// An expired key is skipped by the reads and removed by the next write.
+	now := time.Unix(1000, 0)
+	rawNow = func() time.Time { return now }
+	defer func() { rawNow = time.Now }()
+	h.RawPutWithTTL("lock", []byte("a"), []byte("v"), 10)
+	now = now.Add(10 * time.Second)
+	getResp, _ = h.RawGet(nil, &kvrpcpb.RawGetRequest{Cf: "lock", Key: []byte("a")})
+	c.Assert(getResp.NotFound, IsTrue)
+	c.Assert(h.cfs["lock"].expireAt, HasLen, 1)
+	h.RawPutWithTTL("lock", []byte("a"), []byte("v"), 0)
+	c.Assert(h.cfs["lock"].expireAt, HasLen, 0)
+}
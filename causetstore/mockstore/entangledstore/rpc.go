@@ -25,6 +25,9 @@ import (
 	"github.com/golang/protobuf/proto"
 	us "github.com/ngaut/entangledstore/einsteindb"
 	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/cdc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/dataversion"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/rpctrace"
 	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
 	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
 	"github.com/whtcorpsinc/berolinaAllegroSQL/terror"
@@ -49,6 +52,13 @@ type RPCClient struct {
 	cluster    *Cluster
 	path       string
 	rawHandler *rawHandler
+	feed       *cdc.Feed
+	// dataVersions are the data versions of the Regions for the interlock result cache.
+	dataVersions *dataversion.Tracker
+	tracer       *rpctrace.Tracer
+	// writeMu makes a prewrite with assertions atomic with the check of the assertions:
+	// the prewrite holds it exclusively, the other writes hold it shared.
+	writeMu    sync.RWMutex
 	persistent bool
 	closed     int32
 
@@ -59,8 +69,21 @@ type RPCClient struct {
 	rpcCli Client
 }
 
+// SetTraceHook sets the hook called with the trace Span of every request attempt,
+// nil removes it.
+func (c *RPCClient) SetTraceHook(hook rpctrace.Hook) {
+	c.tracer.SetHook(hook)
+}
+
 // SendRequest sends a request to mock cluster.
 func (c *RPCClient) SendRequest(ctx context.Context, addr string, req *einsteindbrpc.Request, timeout time.Duration) (*einsteindbrpc.Response, error) {
+	ctx, span := c.tracer.Start(ctx, addr, req)
+	resp, err := c.sendRequest(ctx, addr, req, timeout)
+	c.tracer.Finish(span, resp, err)
+	return resp, err
+}
+
+func (c *RPCClient) sendRequest(ctx context.Context, addr string, req *einsteindbrpc.Request, timeout time.Duration) (*einsteindbrpc.Response, error) {
 	failpoint.Inject("rpcServerBusy", func(val failpoint.Value) {
 		if val.(bool) {
 			failpoint.Return(einsteindbrpc.GenRegionErrorResp(req, &errorpb.Error{ServerIsBusy: &errorpb.ServerIsBusy{}}))
@@ -82,6 +105,13 @@ func (c *RPCClient) SendRequest(ctx context.Context, addr string, req *einsteind
 		return nil, context.Canceled
 	}
 
+	if commitTS, ok := dataversion.WriteCommitTS(req); ok {
+		unlock := c.lockForWrite(req)
+		defer unlock()
+		// The version is bumped after the write, a result read before the write can't
+		// be cached with the new version.
+		defer c.dataVersions.Bump(req.Context.GetRegionId(), commitTS)
+	}
 	resp := &einsteindbrpc.Response{}
 	var err error
 	switch req.Type {
@@ -101,7 +131,7 @@ func (c *RPCClient) SendRequest(ctx context.Context, addr string, req *einsteind
 
 		r := req.Prewrite()
 		c.cluster.handleDelay(r.StartVersion, r.Context.RegionId)
-		resp.Resp, err = c.usSvr.KvPrewrite(ctx, r)
+		resp.Resp, err = c.prewrite(ctx, r)
 	case einsteindbrpc.CmdPessimisticLock:
 		r := req.PessimisticLock()
 		c.cluster.handleDelay(r.StartVersion, r.Context.RegionId)
@@ -168,7 +198,7 @@ func (c *RPCClient) SendRequest(ctx context.Context, addr string, req *einsteind
 	case einsteindbrpc.CmdRawScan:
 		resp.Resp, err = c.rawHandler.RawScan(ctx, req.RawScan())
 	case einsteindbrpc.CmdINTERLOCK:
-		resp.Resp, err = c.usSvr.interlocking_directorate(ctx, req.Causet())
+		resp.Resp, err = c.handleINTERLOCK(ctx, req.Causet())
 	case einsteindbrpc.CmdINTERLOCKStream:
 		resp.Resp, err = c.handleINTERLOCKStream(ctx, req.Causet())
 	case einsteindbrpc.CmdMvccGetByKey:
@@ -186,6 +216,7 @@ func (c *RPCClient) SendRequest(ctx context.Context, addr string, req *einsteind
 	if err != nil {
 		return nil, err
 	}
+	c.publishChanges(req, resp)
 	regErr, err := resp.GetRegionError()
 	if err != nil {
 		return nil, err
@@ -0,0 +1,243 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entangledstore
+
+import (
+	"math"
+	"time"
+
+	fidel "github.com/einsteindb/fidel/client"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/oracle"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/cdc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/errors"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+	"golang.org/x/net/context"
+)
+
+// snapshot is a solomonkey.Snapshot reading the entangledstore at a version. With the
+// StaleRead option, it reads at the ts resolved from the safe ts of the causetstore, and
+// fails fast on locks instead of resolving them.
+type snapshot struct {
+	client   *RPCClient
+	fidelCli fidel.Client
+	version  uint64
+	ts       uint64
+	// err is the error of resolving the stale read ts, it's returned by the reads.
+	err error
+}
+
+// NewSnapshot returns a snapshot of the entangledstore at the version, the fidelCli is
+// used to get the TSO and the GC safe point for the stale reads.
+func (c *RPCClient) NewSnapshot(fidelCli fidel.Client, ver uint64) solomonkey.Snapshot {
+	return &snapshot{client: c, fidelCli: fidelCli, version: ver, ts: ver}
+}
+
+// SetOption implements the solomonkey.Snapshot interface. The entangledstore has only
+// one replica, the ReplicaRead option is ignored.
+func (s *snapshot) SetOption(opt solomonkey.Option, val interface{}) {
+	if opt == solomonkey.StaleRead {
+		s.ts, s.err = s.resolveStaleReadTS(val.(solomonkey.StaleReadOption))
+	}
+}
+
+// DelOption implements the solomonkey.Snapshot interface.
+func (s *snapshot) DelOption(opt solomonkey.Option) {
+	if opt == solomonkey.StaleRead {
+		s.ts, s.err = s.version, nil
+	}
+}
+
+// resolveStaleReadTS resolves the ts of the stale read. The entangledstore has only one
+// replica, its safe ts is the resolved ts of the whole key space.
+func (s *snapshot) resolveStaleReadTS(opt solomonkey.StaleReadOption) (uint64, error) {
+	ctx := context.Background()
+	physical, logical, err := s.fidelCli.GetTS(ctx)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	progress := func() uint64 { return oracle.ComposeTS(physical, logical) }
+	safeTS, err := cdc.ResolvedTS(progress, s.client.feed.MinLockTS, nil, nil)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	gcSafePoint, err := s.fidelCli.UFIDelateGCSafePoint(ctx, 0)
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+	return opt.ResolveTS(time.Now(), safeTS, gcSafePoint)
+}
+
+// regionContext returns the request context of the Region containing the key, and the
+// raw end key of the Region.
+func (c *RPCClient) regionContext(key []byte) (*kvrpcpb.Context, []byte, error) {
+	region, peer := c.cluster.GetRegionByKey(codec.EncodeBytes(nil, key))
+	if region == nil {
+		return nil, nil, errors.Errorf("region not found for key %q", key)
+	}
+	var end []byte
+	if len(region.EndKey) > 0 {
+		var err error
+		if _, end, err = codec.DecodeBytes(region.EndKey, nil); err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+	}
+	return &kvrpcpb.Context{
+		RegionId:    region.Id,
+		RegionEpoch: region.RegionEpoch,
+		Peer:        peer,
+	}, end, nil
+}
+
+// keyError converts a KeyError returned by entangledstore to an error.
+func keyError(keyErr *kvrpcpb.KeyError) error {
+	if keyErr.Locked != nil {
+		return errors.Errorf("key is locked, key: %q, primary: %q, txnStartTS: %v",
+			keyErr.Locked.Key, keyErr.Locked.PrimaryLock, keyErr.Locked.LockVersion)
+	}
+	return errors.New(keyErr.String())
+}
+
+// Get implements the solomonkey.Snapshot interface.
+func (s *snapshot) Get(ctx context.Context, k solomonkey.Key) ([]byte, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	reqCtx, _, err := s.client.regionContext(k)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.usSvr.KvGet(ctx, &kvrpcpb.GetRequest{
+		Context: reqCtx,
+		Key:     k,
+		Version: s.ts,
+	})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if resp.RegionError != nil {
+		return nil, errors.New(resp.RegionError.String())
+	}
+	if resp.Error != nil {
+		return nil, keyError(resp.Error)
+	}
+	if len(resp.Value) == 0 {
+		return nil, solomonkey.ErrNotExist
+	}
+	return resp.Value, nil
+}
+
+// BatchGet implements the solomonkey.Snapshot interface.
+func (s *snapshot) BatchGet(ctx context.Context, keys []solomonkey.Key) (map[string][]byte, error) {
+	m := make(map[string][]byte, len(keys))
+	for _, k := range keys {
+		val, err := s.Get(ctx, k)
+		if solomonkey.IsErrNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[string(k)] = val
+	}
+	return m, nil
+}
+
+// scan scans the pairs in [startKey, endKey) Region by Region.
+func (s *snapshot) scan(startKey, endKey []byte) ([]*kvrpcpb.KvPair, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	var pairs []*kvrpcpb.KvPair
+	for {
+		reqCtx, regionEnd, err := s.client.regionContext(startKey)
+		if err != nil {
+			return nil, err
+		}
+		end := endKey
+		if len(regionEnd) > 0 && (len(end) == 0 || solomonkey.Key(regionEnd).Cmp(end) < 0) {
+			end = regionEnd
+		}
+		resp, err := s.client.usSvr.KvScan(context.Background(), &kvrpcpb.ScanRequest{
+			Context:  reqCtx,
+			StartKey: startKey,
+			EndKey:   end,
+			Version:  s.ts,
+			Limit:    math.MaxUint32,
+		})
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if resp.RegionError != nil {
+			return nil, errors.New(resp.RegionError.String())
+		}
+		for _, pair := range resp.Pairs {
+			if pair.Error != nil {
+				return nil, keyError(pair.Error)
+			}
+			pairs = append(pairs, pair)
+		}
+		if len(regionEnd) == 0 || (len(endKey) > 0 && solomonkey.Key(regionEnd).Cmp(endKey) >= 0) {
+			return pairs, nil
+		}
+		startKey = regionEnd
+	}
+}
+
+// Iter implements the solomonkey.Snapshot interface.
+func (s *snapshot) Iter(k solomonkey.Key, upperBound solomonkey.Key) (solomonkey.Iterator, error) {
+	pairs, err := s.scan(k, upperBound)
+	if err != nil {
+		return nil, err
+	}
+	return &pairsIterator{pairs: pairs}, nil
+}
+
+// IterReverse implements the solomonkey.Snapshot interface.
+func (s *snapshot) IterReverse(k solomonkey.Key) (solomonkey.Iterator, error) {
+	pairs, err := s.scan(nil, k)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(pairs)-1; i < j; i, j = i+1, j-1 {
+		pairs[i], pairs[j] = pairs[j], pairs[i]
+	}
+	return &pairsIterator{pairs: pairs}, nil
+}
+
+// pairsIterator iterates the pairs returned by a scan.
+type pairsIterator struct {
+	pairs []*kvrpcpb.KvPair
+	idx   int
+}
+
+func (it *pairsIterator) Valid() bool {
+	return it.idx < len(it.pairs)
+}
+
+func (it *pairsIterator) Key() solomonkey.Key {
+	return it.pairs[it.idx].Key
+}
+
+func (it *pairsIterator) Value() []byte {
+	return it.pairs[it.idx].Value
+}
+
+func (it *pairsIterator) Next() error {
+	it.idx++
+	return nil
+}
+
+func (it *pairsIterator) Close() {}
@@ -0,0 +1,107 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package entangledstore
+
+import (
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/oracle"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+	"golang.org/x/net/context"
+)
+
+func (ts testSuite) TestStaleReadSnapshot(c *C) {
+	client, fidelCli, cluster, err := New("")
+	c.Assert(err, IsNil)
+	defer client.Close()
+	_, _, regionID := BootstrapWithSingleStore(cluster)
+	region := cluster.GetRegion(regionID)
+	reqCtx := kvrpcpb.Context{RegionId: regionID, RegionEpoch: region.RegionEpoch, Peer: region.Peers[0]}
+	getTS := func() uint64 {
+		physical, logical, err := fidelCli.GetTS(context.Background())
+		c.Assert(err, IsNil)
+		return oracle.ComposeTS(physical, logical)
+	}
+	send := func(tp einsteindbrpc.CmdType, req interface{}) *einsteindbrpc.Response {
+		resp, err := client.SendRequest(context.Background(), "", einsteindbrpc.NewRequest(tp, req, reqCtx), time.Second)
+		c.Assert(err, IsNil)
+		return resp
+	}
+	prewrite := func(startTS uint64, keys ...string) {
+		req := &kvrpcpb.PrewriteRequest{PrimaryLock: []byte(keys[0]), StartVersion: startTS, LockTtl: 3000}
+		for _, key := range keys {
+			req.Mutations = append(req.Mutations, &kvrpcpb.Mutation{Op: kvrpcpb.Op_Put, Key: []byte(key), Value: []byte(key + "1")})
+		}
+		c.Assert(send(einsteindbrpc.CmdPrewrite, req).Resp.(*kvrpcpb.PrewriteResponse).Errors, HasLen, 0)
+	}
+
+	ts1 := getTS()
+	prewrite(ts1, "a", "b")
+	ts2 := getTS()
+	resp := send(einsteindbrpc.CmdCommit, &kvrpcpb.CommitRequest{
+		Keys:          [][]byte{[]byte("a"), []byte("b")},
+		StartVersion:  ts1,
+		CommitVersion: ts2,
+	})
+	c.Assert(resp.Resp.(*kvrpcpb.CommitResponse).Error, IsNil)
+	ts3 := getTS()
+	prewrite(ts3, "c")
+
+	// The snapshot reads at the stale read ts instead of its version.
+	snap := client.NewSnapshot(fidelCli, getTS())
+	snap.SetOption(solomonkey.StaleRead, solomonkey.StaleReadOption{ReadTS: ts3 - 1})
+	val, err := snap.Get(context.Background(), solomonkey.Key("a"))
+	c.Assert(err, IsNil)
+	c.Assert(string(val), Equals, "a1")
+	m, err := snap.BatchGet(context.Background(), []solomonkey.Key{solomonkey.Key("a"), solomonkey.Key("b"), solomonkey.Key("c")})
+	c.Assert(err, IsNil)
+	c.Assert(m, HasLen, 2)
+	it, err := snap.IterReverse(nil)
+	c.Assert(err, IsNil)
+	var keys []string
+	for ; it.Valid(); c.Assert(it.Next(), IsNil) {
+		keys = append(keys, string(it.Key()))
+	}
+	it.Close()
+	c.Assert(keys, DeepEquals, []string{"b", "a"})
+
+	// The outstanding dagger holds the safe ts, a read ts after it is rejected.
+	snap.SetOption(solomonkey.StaleRead, solomonkey.StaleReadOption{ReadTS: ts3})
+	_, err = snap.Get(context.Background(), solomonkey.Key("a"))
+	c.Assert(solomonkey.ErrStaleReadTSTooNew.Equal(err), IsTrue)
+
+	// Max staleness reads at the safe ts.
+	snap.SetOption(solomonkey.StaleRead, solomonkey.StaleReadOption{MaxStaleness: time.Hour})
+	val, err = snap.Get(context.Background(), solomonkey.Key("b"))
+	c.Assert(err, IsNil)
+	c.Assert(string(val), Equals, "b1")
+
+	// A read ts before the gc safe point is rejected.
+	_, err = fidelCli.UFIDelateGCSafePoint(context.Background(), ts2)
+	c.Assert(err, IsNil)
+	snap.SetOption(solomonkey.StaleRead, solomonkey.StaleReadOption{ReadTS: ts1})
+	_, err = snap.Get(context.Background(), solomonkey.Key("a"))
+	c.Assert(solomonkey.ErrGCTooEarly.Equal(err), IsTrue)
+
+	// Deleting the option reads at the version of the snapshot, the dagger of c blocks it.
+	snap.DelOption(solomonkey.StaleRead)
+	val, err = snap.Get(context.Background(), solomonkey.Key("b"))
+	c.Assert(err, IsNil)
+	c.Assert(string(val), Equals, "b1")
+	_, err = snap.Get(context.Background(), solomonkey.Key("c"))
+	c.Assert(err, ErrorMatches, ".*key is locked.*")
+}
@@ -18,16 +18,13 @@ import (
 
 	"github.com/golang/protobuf/proto"
 	"github.com/whtcorpsinc/MilevaDB-Prod/blockcodec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/sampling"
 	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
-	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/chunk"
-	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
 	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/collate"
 	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/rowcodec"
 	"github.com/whtcorpsinc/MilevaDB-Prod/statistics"
 	"github.com/whtcorpsinc/MilevaDB-Prod/types"
 	"github.com/whtcorpsinc/berolinaAllegroSQL/allegrosql"
-	"github.com/whtcorpsinc/berolinaAllegroSQL/ast"
-	"github.com/whtcorpsinc/berolinaAllegroSQL/perceptron"
 	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
 	"github.com/whtcorpsinc/errors"
 	"github.com/whtcorpsinc/fidelpb/go-fidelpb"
@@ -82,9 +79,9 @@ func (h *rpcHandler) handleAnalyzeIndexReq(req *interlock.Request, analyzeReq *f
 		hdStatus:       blockcodec.HandleNotNeeded,
 	}
 	statsBuilder := statistics.NewSortedBuilder(flagsToStatementContext(analyzeReq.Flags), analyzeReq.IdxReq.BucketSize, 0, types.NewFieldType(allegrosql.TypeBlob))
-	var cms *statistics.CMSketch
+	var cms *sampling.SketchBuilder
 	if analyzeReq.IdxReq.CmsketchDepth != nil && analyzeReq.IdxReq.CmsketchWidth != nil {
-		cms = statistics.NewCMSketch(*analyzeReq.IdxReq.CmsketchDepth, *analyzeReq.IdxReq.CmsketchWidth)
+		cms = sampling.NewSketchBuilder(*analyzeReq.IdxReq.CmsketchDepth, *analyzeReq.IdxReq.CmsketchWidth, int(analyzeReq.IdxReq.GetTopNSize()))
 	}
 	ctx := context.TODO()
 	var values [][]byte
@@ -100,7 +97,7 @@ func (h *rpcHandler) handleAnalyzeIndexReq(req *interlock.Request, analyzeReq *f
 		for _, val := range values {
 			value = append(value, val...)
 			if cms != nil {
-				cms.InsertBytes(value)
+				cms.Insert(value)
 			}
 		}
 		err = statsBuilder.Iterate(types.NewBytesCauset(value))
@@ -111,7 +108,7 @@ func (h *rpcHandler) handleAnalyzeIndexReq(req *interlock.Request, analyzeReq *f
 	hg := statistics.HistogramToProto(statsBuilder.Hist())
 	var cm *fidelpb.CMSketch
 	if cms != nil {
-		cm = statistics.CMSketchToProto(cms)
+		cm = cms.ToProto()
 	}
 	data, err := proto.Marshal(&fidelpb.AnalyzeIndexResp{Hist: hg, Cms: cm})
 	if err != nil {
@@ -120,10 +117,9 @@ func (h *rpcHandler) handleAnalyzeIndexReq(req *interlock.Request, analyzeReq *f
 	return &interlock.Response{Data: data}, nil
 }
 
-type analyzeDeferredCausetsExec struct {
-	tblExec *blockScanExec
-	fields  []*ast.ResultField
-}
+// analyzeScanBatch is the number of rows read from the MVCC store at a time
+// when analyzing columns.
+const analyzeScanBatch = 1024
 
 func (h *rpcHandler) handleAnalyzeDeferredCausetsReq(req *interlock.Request, analyzeReq *fidelpb.AnalyzeReq) (_ *interlock.Response, err error) {
 	sc := flagsToStatementContext(analyzeReq.Flags)
@@ -143,57 +139,17 @@ func (h *rpcHandler) handleAnalyzeDeferredCausetsReq(req *interlock.Request, ana
 	if startTS == 0 {
 		startTS = analyzeReq.GetStartTsFallback()
 	}
-	colInfos := make([]rowcodec.DefCausInfo, len(columns))
-	for i := range columns {
-		col := columns[i]
-		colInfos[i] = rowcodec.DefCausInfo{
-			ID:         col.DeferredCausetId,
-			Ft:         evalCtx.fieldTps[i],
-			IsPKHandle: col.GetPkHandle(),
-		}
-	}
-	defVal := func(i int) ([]byte, error) {
-		col := columns[i]
-		if col.DefaultVal == nil {
-			return nil, nil
-		}
-		// col.DefaultVal always be  varint `[flag]+[value]`.
-		if len(col.DefaultVal) < 1 {
-			panic("invalid default value")
-		}
-		return col.DefaultVal, nil
-	}
-	rd := rowcodec.NewByteDecoder(colInfos, []int64{-1}, defVal, nil)
-	e := &analyzeDeferredCausetsExec{
-		tblExec: &blockScanExec{
-			TableScan:      &fidelpb.TableScan{DeferredCausets: columns},
-			kvRanges:       ranges,
-			colIDs:         evalCtx.colIDs,
-			startTS:        startTS,
-			isolationLevel: h.isolationLevel,
-			mvsr-oocStore:      h.mvsr-oocStore,
-			execDetail:     new(execDetail),
-			rd:             rd,
-		},
-	}
-	e.fields = make([]*ast.ResultField, len(columns))
-	for i := range e.fields {
-		rf := new(ast.ResultField)
-		rf.DeferredCauset = new(perceptron.DeferredCausetInfo)
-		rf.DeferredCauset.FieldType = types.FieldType{Tp: allegrosql.TypeBlob, Flen: allegrosql.MaxBlobWidth, Charset: allegrosql.DefaultCharset, DefCauslate: allegrosql.DefaultDefCauslationName}
-		e.fields[i] = rf
-	}
+	rd := newRowBytesDecoder(columns, evalCtx)
 
 	pkID := int64(-1)
-	numDefCauss := len(columns)
+	analyzed := columns
 	if columns[0].GetPkHandle() {
 		pkID = columns[0].DeferredCausetId
-		columns = columns[1:]
-		numDefCauss--
+		analyzed = columns[1:]
 	}
-	collators := make([]collate.DefCauslator, numDefCauss)
-	fts := make([]*types.FieldType, numDefCauss)
-	for i, col := range columns {
+	collators := make([]collate.DefCauslator, len(analyzed))
+	fts := make([]*types.FieldType, len(analyzed))
+	for i, col := range analyzed {
 		ft := fieldTypeFromPBDeferredCauset(col)
 		fts[i] = ft
 		if ft.EvalType() == types.ETString {
@@ -201,34 +157,26 @@ func (h *rpcHandler) handleAnalyzeDeferredCausetsReq(req *interlock.Request, ana
 		}
 	}
 	colReq := analyzeReq.DefCausReq
-	builder := statistics.SampleBuilder{
-		Sc:                sc,
-		RecordSet:         e,
-		DefCausLen:        numDefCauss,
-		MaxBucketSize:     colReq.BucketSize,
-		MaxFMSketchSize:   colReq.SketchSize,
-		MaxSampleSize:     colReq.SampleSize,
-		DefCauslators:     collators,
-		DefCaussFieldType: fts,
-	}
+	var pkBuilder *statistics.SortedBuilder
 	if pkID != -1 {
-		builder.PkBuilder = statistics.NewSortedBuilder(sc, builder.MaxBucketSize, pkID, types.NewFieldType(allegrosql.TypeBlob))
-	}
-	if colReq.CmsketchWidth != nil && colReq.CmsketchDepth != nil {
-		builder.CMSketchWidth = *colReq.CmsketchWidth
-		builder.CMSketchDepth = *colReq.CmsketchDepth
+		pkBuilder = statistics.NewSortedBuilder(sc, colReq.BucketSize, pkID, types.NewFieldType(allegrosql.TypeBlob))
 	}
-	collectors, pkBuilder, err := builder.DefCauslectDeferredCausetStats()
+	builder := sampling.NewBuilder(sc, colReq, fts, collators, int64(startTS))
+	err = h.scanAnalyzeRows(ranges, startTS, columns, evalCtx.colIDs, rd, func(key []byte, values [][]byte) error {
+		if pkBuilder != nil {
+			if err := pkBuilder.Iterate(types.NewBytesCauset(values[0])); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		return builder.Collect(key, values)
+	})
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
-	colResp := &fidelpb.AnalyzeDeferredCausetsResp{}
-	if pkID != -1 {
+	colResp := &fidelpb.AnalyzeDeferredCausetsResp{DefCauslectors: builder.DefCauslectors()}
+	if pkBuilder != nil {
 		colResp.PkHist = statistics.HistogramToProto(pkBuilder.Hist())
 	}
-	for _, c := range collectors {
-		colResp.DefCauslectors = append(colResp.DefCauslectors, statistics.SampleDefCauslectorToProto(c))
-	}
 	data, err := proto.Marshal(colResp)
 	if err != nil {
 		return nil, errors.Trace(err)
@@ -236,51 +184,35 @@ func (h *rpcHandler) handleAnalyzeDeferredCausetsReq(req *interlock.Request, ana
 	return &interlock.Response{Data: data}, nil
 }
 
-// Fields implements the sqlexec.RecordSet Fields interface.
-func (e *analyzeDeferredCausetsExec) Fields() []*ast.ResultField {
-	return e.fields
-}
-
-func (e *analyzeDeferredCausetsExec) getNext(ctx context.Context) ([]types.Causet, error) {
-	values, err := e.tblExec.Next(ctx)
-	if err != nil {
-		return nil, errors.Trace(err)
-	}
-	if values == nil {
-		return nil, nil
-	}
-	datumRow := make([]types.Causet, 0, len(values))
-	for _, val := range values {
-		d := types.NewBytesCauset(val)
-		if len(val) == 1 && val[0] == codec.NilFlag {
-			d.SetNull()
+// scanAnalyzeRows calls fn with the key and the encoded column values of each
+// event visible at startTS in ranges. The ranges are already clipped to the
+// region, so a block split across regions is analyzed once per region.
+func (h *rpcHandler) scanAnalyzeRows(ranges []solomonkey.KeyRange, startTS uint64, columns []*fidelpb.DeferredCausetInfo, colIDs map[int64]int, rd *rowcodec.BytesDecoder, fn func(key []byte, values [][]byte) error) error {
+	for _, ran := range ranges {
+		seekKey := ran.StartKey
+		for {
+			pairs := h.mvsr-oocStore.Scan(seekKey, ran.EndKey, analyzeScanBatch, startTS, h.isolationLevel, h.resolvedLocks)
+			for _, pair := range pairs {
+				if pair.Err != nil {
+					return errors.Trace(pair.Err)
+				}
+				handle, err := blockcodec.DecodeRowKey(pair.Key)
+				if err != nil {
+					return errors.Trace(err)
+				}
+				values, err := getRowData(columns, colIDs, handle.IntValue(), pair.Value, rd)
+				if err != nil {
+					return errors.Trace(err)
+				}
+				if err = fn(pair.Key, values); err != nil {
+					return errors.Trace(err)
+				}
+			}
+			if len(pairs) < analyzeScanBatch {
+				break
+			}
+			seekKey = solomonkey.Key(pairs[len(pairs)-1].Key).PrefixNext()
 		}
-		datumRow = append(datumRow, d)
-	}
-	return datumRow, nil
-}
-
-func (e *analyzeDeferredCausetsExec) Next(ctx context.Context, req *chunk.Chunk) error {
-	req.Reset()
-	event, err := e.getNext(ctx)
-	if event == nil || err != nil {
-		return errors.Trace(err)
-	}
-	for i := 0; i < len(event); i++ {
-		req.AppendCauset(i, &event[i])
-	}
-	return nil
-}
-
-func (e *analyzeDeferredCausetsExec) NewChunk() *chunk.Chunk {
-	fields := make([]*types.FieldType, 0, len(e.fields))
-	for _, field := range e.fields {
-		fields = append(fields, &field.DeferredCauset.FieldType)
 	}
-	return chunk.NewChunkWithCapacity(fields, 1)
-}
-
-// Close implements the sqlexec.RecordSet Close interface.
-func (e *analyzeDeferredCausetsExec) Close() error {
 	return nil
 }
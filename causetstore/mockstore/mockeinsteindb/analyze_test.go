@@ -0,0 +1,159 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/whtcorpsinc/MilevaDB-Prod/blockcodec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/sampling"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/rowcodec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/MilevaDB-Prod/stochastikctx/stmtctx"
+	"github.com/whtcorpsinc/MilevaDB-Prod/types"
+	"github.com/whtcorpsinc/berolinaAllegroSQL/allegrosql"
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/fidelpb/go-fidelpb"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+)
+
+func (s *testRPCHandlerSuite) TestAnalyzeDeferredCausets(c *C) {
+	const blockID, rows = int64(1), 100
+	causetstore := MustNewMVCCStore()
+	cluster := NewCluster(causetstore)
+	// The causet is split into two regions.
+	storeID, regionIDs, _ := BootstrapWithMultiRegions(cluster, blockcodec.EncodeRowKeyWithHandle(blockID, solomonkey.IntHandle(rows/2)))
+
+	sc := &stmtctx.StatementContext{TimeZone: time.UTC}
+	// col_2 is 0 for the first 60 rows, then distinct.
+	valueOf := func(handle int64) int64 {
+		if handle < 60 {
+			return 0
+		}
+		return handle
+	}
+	var keys [][]byte
+	var muts []*kvrpcpb.Mutation
+	for i := int64(0); i < rows; i++ {
+		key := blockcodec.EncodeRowKeyWithHandle(blockID, solomonkey.IntHandle(i))
+		value, err := blockcodec.EncodeRow(sc, []types.Causet{types.NewIntCauset(valueOf(i))}, []int64{2}, nil, nil, &rowcodec.Encoder{Enable: true})
+		c.Assert(err, IsNil)
+		keys = append(keys, key)
+		muts = append(muts, &kvrpcpb.Mutation{Op: kvrpcpb.Op_Put, Key: key, Value: value})
+	}
+	MustPrewriteOK(c, causetstore, muts, string(keys[0]), 10, 0)
+	c.Assert(causetstore.Commit(keys, 10, 20), IsNil)
+
+	columns := []*fidelpb.DeferredCausetInfo{
+		{DeferredCausetId: 1, Tp: int32(allegrosql.TypeLonglong), PkHandle: true},
+		{DeferredCausetId: 2, Tp: int32(allegrosql.TypeLonglong)},
+	}
+	analyze := func(colReq *fidelpb.AnalyzeDeferredCausetsReq) ([]*fidelpb.AnalyzeDeferredCausetsResp, string) {
+		colReq.DeferredCausetsInfo = columns
+		data, err := proto.Marshal(&fidelpb.AnalyzeReq{Tp: fidelpb.AnalyzeType_TypeDeferredCauset, DefCausReq: colReq})
+		c.Assert(err, IsNil)
+		var resps []*fidelpb.AnalyzeDeferredCausetsResp
+		for _, regionID := range regionIDs {
+			region, _ := cluster.GetRegion(regionID)
+			reqCtx := &kvrpcpb.Context{RegionId: regionID, RegionEpoch: region.RegionEpoch}
+			h := &rpcHandler{cluster: cluster, mvsr-oocStore: causetstore, storeID: storeID}
+			c.Assert(h.checkRequestContext(reqCtx), IsNil)
+			h.rawStartKey = MvccKey(h.startKey).Raw()
+			h.rawEndKey = MvccKey(h.endKey).Raw()
+			resp := h.handleINTERLOCKAnalyzeRequest(&interlock.Request{
+				Tp:      solomonkey.ReqTypeAnalyze,
+				Data:    data,
+				StartTs: 30,
+				Context: reqCtx,
+				Ranges: []*interlock.KeyRange{{
+					Start: blockcodec.GenTableRecordPrefix(blockID),
+					End:   blockcodec.GenTableRecordPrefix(blockID).PrefixNext(),
+				}},
+			})
+			if resp.OtherError != "" {
+				return nil, resp.OtherError
+			}
+			colResp := new(fidelpb.AnalyzeDeferredCausetsResp)
+			c.Assert(proto.Unmarshal(resp.Data, colResp), IsNil)
+			resps = append(resps, colResp)
+		}
+		return resps, ""
+	}
+	encodeInt := func(v int64) []byte {
+		b, err := codec.EncodeValue(sc, nil, types.NewIntCauset(v))
+		c.Assert(err, IsNil)
+		return b
+	}
+
+	// The rows sampled by rate don't depend on the split of the causet.
+	resps, otherErr := analyze(&fidelpb.AnalyzeDeferredCausetsReq{SampleSize: 5, SketchSize: 100, SampleRate: proto.Float64(0.3)})
+	c.Assert(otherErr, Equals, "")
+	var expected, sampled int
+	for _, key := range keys {
+		if sampling.SampledByRate(key, 0.3) {
+			expected++
+		}
+	}
+	var count int64
+	for _, resp := range resps {
+		c.Assert(resp.PkHist, NotNil)
+		c.Assert(resp.DefCauslectors, HasLen, 1)
+		count += resp.DefCauslectors[0].Count
+		sampled += len(resp.DefCauslectors[0].Samples)
+	}
+	c.Assert(count, Equals, int64(rows))
+	c.Assert(sampled, Equals, expected)
+
+	// The most frequent value is kept exactly in the TopN of the CM sketch.
+	resps, otherErr = analyze(&fidelpb.AnalyzeDeferredCausetsReq{
+		SampleSize:    rows,
+		CmsketchDepth: proto.Int32(4),
+		CmsketchWidth: proto.Int32(256),
+		TopNSize:      proto.Int32(1),
+	})
+	c.Assert(otherErr, Equals, "")
+	for i, resp := range resps {
+		topN := resp.DefCauslectors[0].CmSketch.TopN
+		c.Assert(topN, HasLen, 1)
+		c.Assert(topN[0].Data, DeepEquals, encodeInt(0))
+		c.Assert(topN[0].Count, Equals, []uint64{50, 10}[i])
+	}
+
+	// The offsets of a column group index the columns of the request, the
+	// integer primary key handle at offset 0.
+	resps, otherErr = analyze(&fidelpb.AnalyzeDeferredCausetsReq{
+		SampleSize:           rows,
+		DeferredCausetGroups: []*fidelpb.AnalyzeDeferredCausetGroup{{DeferredCausetOffsets: []int64{0, 1}}, {DeferredCausetOffsets: []int64{1}}},
+	})
+	c.Assert(otherErr, Equals, "")
+	var groupSamples [][]byte
+	for _, resp := range resps {
+		c.Assert(resp.DefCauslectors, HasLen, 3)
+		c.Assert(resp.DefCauslectors[2].Samples, DeepEquals, resp.DefCauslectors[0].Samples)
+		groupSamples = append(groupSamples, resp.DefCauslectors[1].Samples...)
+	}
+	c.Assert(groupSamples, HasLen, rows)
+	for i, sample := range groupSamples {
+		// The samples of a region are in the order of the rows.
+		c.Assert(sample, DeepEquals, append(encodeInt(int64(i)), encodeInt(valueOf(int64(i)))...))
+	}
+	_, otherErr = analyze(&fidelpb.AnalyzeDeferredCausetsReq{
+		SampleSize:           rows,
+		DeferredCausetGroups: []*fidelpb.AnalyzeDeferredCausetGroup{{DeferredCausetOffsets: []int64{2}}},
+	})
+	c.Assert(otherErr, Matches, ".*column group offset 2 out of range.*")
+}
@@ -0,0 +1,189 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"math"
+	"sort"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/cdc"
+	"github.com/whtcorpsinc/berolinaAllegroSQL/terror"
+	"github.com/whtcorpsinc/errors"
+	"github.com/whtcorpsinc/goleveldb/leveldb"
+	"github.com/whtcorpsinc/goleveldb/leveldb/soliton"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+)
+
+// Subscribe subscribes the changes in [startKey, endKey) after startTS. The changes
+// committed after startTS and the current locks in the range are sent first.
+func (mvsr-ooc *MVCCLevelDB) Subscribe(startKey, endKey []byte, startTS uint64) (*cdc.Subscription, error) {
+	mvsr-ooc.mu.RLock()
+	defer mvsr-ooc.mu.RUnlock()
+
+	if mvsr-ooc.feed == nil {
+		return nil, errors.New("the causetstore doesn't support CDC")
+	}
+	initial, err := mvsr-ooc.incrementalScan(startKey, endKey, startTS)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return mvsr-ooc.feed.Subscribe(startKey, endKey, startTS, initial), nil
+}
+
+func (mvsr-ooc *MVCCLevelDB) incrementalScan(startKey, endKey []byte, startTS uint64) ([]*cdc.Event, error) {
+	r := &soliton.Range{Start: mvsr-oocEncode(startKey, lockVer)}
+	if len(endKey) > 0 {
+		r.Limit = mvsr-oocEncode(endKey, lockVer)
+	}
+	iter := newIterator(mvsr-ooc.EDB, r)
+	defer iter.Release()
+
+	var changes, locks []*cdc.Event
+	for ; iter.Valid(); iter.Next() {
+		e, err := decodeCDCEvent(iter.Key(), iter.Value())
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		switch {
+		case e == nil:
+		case e.Type == cdc.EventPrewrite:
+			locks = append(locks, e)
+		case e.Type == cdc.EventCommit && e.CommitTS > startTS,
+			e.Type == cdc.EventRollback && e.StartTS > startTS:
+			changes = append(changes, e)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].CommitTS < changes[j].CommitTS
+	})
+	return append(changes, locks...), errors.Trace(iter.Error())
+}
+
+// decodeCDCEvent decodes a dagger or a write record to a change event, nil is returned
+// for the records which don't change data.
+func decodeCDCEvent(encodedKey, value []byte) (*cdc.Event, error) {
+	key, ver, err := mvsr-oocDecode(encodedKey)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if ver == lockVer {
+		var dagger mvsr-oocLock
+		if err = dagger.UnmarshalBinary(value); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if dagger.op != kvrpcpb.Op_Put && dagger.op != kvrpcpb.Op_Del {
+			return nil, nil
+		}
+		return &cdc.Event{
+			Type:    cdc.EventPrewrite,
+			Key:     key,
+			Value:   dagger.value,
+			Op:      dagger.op,
+			StartTS: dagger.startTS,
+		}, nil
+	}
+	var v mvsr-oocValue
+	if err = v.UnmarshalBinary(value); err != nil {
+		return nil, errors.Trace(err)
+	}
+	e := &cdc.Event{Key: key, StartTS: v.startTS}
+	switch v.valueType {
+	case typePut:
+		e.Type, e.Op, e.Value, e.CommitTS = cdc.EventCommit, kvrpcpb.Op_Put, v.value, v.commitTS
+	case typeDelete:
+		e.Type, e.Op, e.CommitTS = cdc.EventCommit, kvrpcpb.Op_Del, v.commitTS
+	case typeRollback:
+		e.Type = cdc.EventRollback
+	default:
+		return nil, nil
+	}
+	return e, nil
+}
+
+// writeTxnBatch writes the batch of a transactional command and publishes the changes
+// in it to the CDC feed. The changes are collected before the write, so a dagger which
+// is only rewritten, e.g. by TxnHeartBeat or CheckTxnStatus, is not published again.
+func (mvsr-ooc *MVCCLevelDB) writeTxnBatch(batch *leveldb.Batch) error {
+	var events []*cdc.Event
+	if mvsr-ooc.feed != nil {
+		r := &cdcBatchReplay{EDB: mvsr-ooc.EDB}
+		terror.Log(batch.Replay(r))
+		events = r.events
+	}
+	if err := mvsr-ooc.EDB.Write(batch, nil); err != nil {
+		return err
+	}
+	if mvsr-ooc.feed != nil {
+		mvsr-ooc.feed.Publish(events...)
+	}
+	return nil
+}
+
+// cdcBatchReplay collects the change events of a leveldb.Batch.
+type cdcBatchReplay struct {
+	EDB    *leveldb.EDB
+	events []*cdc.Event
+}
+
+func (r *cdcBatchReplay) Put(key, value []byte) {
+	e, err := decodeCDCEvent(key, value)
+	if err != nil {
+		terror.Log(err)
+		return
+	}
+	if e == nil || (e.Type == cdc.EventPrewrite && r.published(key, e)) {
+		return
+	}
+	r.events = append(r.events, e)
+}
+
+// published checks whether the prewrite of the dagger is published already, i.e. the
+// dagger is in the causetstore with the same start ts.
+func (r *cdcBatchReplay) published(key []byte, e *cdc.Event) bool {
+	val, err := r.EDB.Get(key, nil)
+	if err != nil {
+		if err != leveldb.ErrNotFound {
+			terror.Log(err)
+		}
+		return false
+	}
+	old, err := decodeCDCEvent(key, val)
+	if err != nil {
+		terror.Log(err)
+		return false
+	}
+	return old != nil && old.StartTS == e.StartTS
+}
+
+func (r *cdcBatchReplay) Delete(key []byte) {}
+
+// minLockTS implements the cdc.MinLockTSFunc.
+func (mvsr-ooc *MVCCLevelDB) minLockTS(startKey, endKey []byte) (uint64, bool, error) {
+	return storeMinLockTS(mvsr-ooc, startKey, endKey)
+}
+
+// storeMinLockTS returns the minimum start ts of the locks of the causetstore in
+// [startKey, endKey), ok is false if there is no dagger.
+func storeMinLockTS(causetstore MVCCStore, startKey, endKey []byte) (minTS uint64, ok bool, err error) {
+	locks, err := causetstore.ScanLock(startKey, endKey, math.MaxUint64)
+	if err != nil {
+		return 0, false, errors.Trace(err)
+	}
+	for i, dagger := range locks {
+		if i == 0 || dagger.LockVersion < minTS {
+			minTS = dagger.LockVersion
+		}
+	}
+	return minTS, len(locks) > 0, nil
+}
@@ -0,0 +1,98 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/cdc"
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+)
+
+func nextCDCChange(c *C, sub *cdc.Subscription) *cdc.Event {
+	for {
+		select {
+		case e := <-sub.Events():
+			if e.Type != cdc.EventResolvedTS {
+				return e
+			}
+		case <-time.After(5 * time.Second):
+			c.Fatal("wait cdc event timeout")
+		}
+	}
+}
+
+func (s *testMVCCLevelDB) TestCDCFeed(c *C) {
+	cdc.ResolvedTSInterval = 10 * time.Millisecond
+	defer func() { cdc.ResolvedTSInterval = time.Second }()
+
+	s.mustPutOK(c, "a", "v1", 5, 10)
+	s.mustPutOK(c, "a", "v2", 15, 20)
+	s.mustPrewriteOK(c, putMutations("b", "v3"), "b", 25)
+
+	causetstore := s.causetstore.(*MVCCLevelDB)
+	sub, err := causetstore.Subscribe([]byte("a"), []byte("z"), 10)
+	c.Assert(err, IsNil)
+	defer sub.Close()
+
+	// The incremental scan sends the commits after the start ts and the locks.
+	e := nextCDCChange(c, sub)
+	c.Assert(e.Type, Equals, cdc.EventCommit)
+	c.Assert(e.Value, BytesEquals, []byte("v2"))
+	c.Assert(e.CommitTS, Equals, uint64(20))
+	e = nextCDCChange(c, sub)
+	c.Assert(e.Type, Equals, cdc.EventPrewrite)
+	c.Assert(e.Key, BytesEquals, []byte("b"))
+	c.Assert(e.StartTS, Equals, uint64(25))
+
+	s.mustCommitOK(c, [][]byte{[]byte("b")}, 25, 30)
+	e = nextCDCChange(c, sub)
+	c.Assert(e.Type, Equals, cdc.EventCommit)
+	c.Assert(e.Key, BytesEquals, []byte("b"))
+	c.Assert(e.Value, BytesEquals, []byte("v3"))
+	c.Assert(e.Op, Equals, kvrpcpb.Op_Put)
+
+	s.mustPrewriteOK(c, putMutations("c", "v4"), "c", 35)
+	s.mustRollbackOK(c, [][]byte{[]byte("c")}, 35)
+	c.Assert(nextCDCChange(c, sub).Type, Equals, cdc.EventPrewrite)
+	e = nextCDCChange(c, sub)
+	c.Assert(e.Type, Equals, cdc.EventRollback)
+	c.Assert(e.StartTS, Equals, uint64(35))
+
+	// The dagger of start ts 40 holds the resolved ts at 39.
+	s.mustPrewriteOK(c, putMutations("d", "v5"), "d", 40)
+	e = nextCDCChange(c, sub)
+	c.Assert(e.Type, Equals, cdc.EventPrewrite)
+	c.Assert(e.Key, BytesEquals, []byte("d"))
+	// Rewriting the dagger doesn't publish the prewrite again.
+	_, err = causetstore.TxnHeartBeat([]byte("d"), 40, 10000)
+	c.Assert(err, IsNil)
+	s.mustPutOK(c, "e", "v6", 45, 50)
+	e = nextCDCChange(c, sub)
+	c.Assert(e.Type, Equals, cdc.EventPrewrite)
+	c.Assert(e.Key, BytesEquals, []byte("e"))
+	var resolved uint64
+	for resolved < 39 {
+		select {
+		case e = <-sub.Events():
+			if e.Type == cdc.EventResolvedTS {
+				resolved = e.ResolvedTS
+			}
+		case <-time.After(5 * time.Second):
+			c.Fatal("wait resolved ts timeout")
+		}
+	}
+	c.Assert(resolved, Equals, uint64(39))
+}
@@ -15,16 +15,55 @@ package mockeinsteindb
 
 import (
 	"fmt"
+	"hash/crc64"
+	"math"
 
-	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
+	"github.com/golang/protobuf/proto"
+	"github.com/whtcorpsinc/errors"
 	"github.com/whtcorpsinc/fidelpb/go-fidelpb"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
 )
 
+var crc64Block = crc64.MakeTable(crc64.ECMA)
+
+// handleINTERLOCKChecksumRequest computes the CRC64-XOR checksum of the KVs visible at
+// the start ts in the request ranges of the region, like EinsteinDB does: each KV
+// contributes the CRC64 of its raw key followed by its value.
 func (h *rpcHandler) handleINTERLOCKChecksumRequest(req *interlock.Request) *interlock.Response {
-	resp := &fidelpb.ChecksumResponse{
-		Checksum:   1,
-		TotalKvs:   1,
-		TotalBytes: 1,
+	checksumReq := new(fidelpb.ChecksumRequest)
+	if err := proto.Unmarshal(req.Data, checksumReq); err != nil {
+		return &interlock.Response{OtherError: fmt.Sprintf("unmarshal checksum request error: %v", err)}
+	}
+	if checksumReq.Algorithm != fidelpb.ChecksumAlgorithm_Crc64_Xor {
+		return &interlock.Response{OtherError: fmt.Sprintf("unsupported checksum algorithm %v", checksumReq.Algorithm)}
+	}
+	ranges, err := h.extractKVRanges(req.Ranges, false)
+	if err != nil {
+		return &interlock.Response{OtherError: err.Error()}
+	}
+	resp := &fidelpb.ChecksumResponse{}
+	for _, ran := range ranges {
+		pairs := h.mvsr-oocStore.Scan(ran.StartKey, ran.EndKey, math.MaxInt64, req.StartTs, h.isolationLevel, h.resolvedLocks)
+		for _, pair := range pairs {
+			if pair.Err != nil {
+				if locked, ok := errors.Cause(pair.Err).(*ErrLocked); ok {
+					return &interlock.Response{Locked: &kvrpcpb.LockInfo{
+						Key:         locked.Key,
+						PrimaryLock: locked.Primary,
+						LockVersion: locked.StartTS,
+						LockTtl:     locked.TTL,
+					}}
+				}
+				return &interlock.Response{OtherError: pair.Err.Error()}
+			}
+			digest := crc64.New(crc64Block)
+			digest.Write(pair.Key)
+			digest.Write(pair.Value)
+			resp.Checksum ^= digest.Sum64()
+			resp.TotalKvs++
+			resp.TotalBytes += uint64(len(pair.Key) + len(pair.Value))
+		}
 	}
 	data, err := resp.Marshal()
 	if err != nil {
@@ -0,0 +1,103 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"hash/crc64"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/whtcorpsinc/MilevaDB-Prod/blockcodec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/rowcodec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/MilevaDB-Prod/stochastikctx/stmtctx"
+	"github.com/whtcorpsinc/MilevaDB-Prod/types"
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/fidelpb/go-fidelpb"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+)
+
+func (s *testRPCHandlerSuite) TestChecksum(c *C) {
+	const blockID, indexID, rows = int64(1), int64(1), 6
+	causetstore := MustNewMVCCStore()
+	cluster := NewCluster(causetstore)
+	// The causet is split into two regions, the index keys sort before the records
+	// and are in the first one.
+	storeID, regionIDs, _ := BootstrapWithMultiRegions(cluster, blockcodec.EncodeRowKeyWithHandle(blockID, solomonkey.IntHandle(rows/2)))
+
+	sc := &stmtctx.StatementContext{TimeZone: time.UTC}
+	var (
+		expected fidelpb.ChecksumResponse
+		keys     [][]byte
+		muts     []*kvrpcpb.Mutation
+	)
+	put := func(key, value []byte) {
+		keys = append(keys, key)
+		muts = append(muts, &kvrpcpb.Mutation{Op: kvrpcpb.Op_Put, Key: key, Value: value})
+		expected.Checksum ^= crc64.Checksum(append(append([]byte{}, key...), value...), crc64.MakeTable(crc64.ECMA))
+		expected.TotalKvs++
+		expected.TotalBytes += uint64(len(key) + len(value))
+	}
+	for i := int64(0); i < rows; i++ {
+		defCausValue := types.NewIntCauset(i * 10)
+		rowKey := blockcodec.EncodeRowKeyWithHandle(blockID, solomonkey.IntHandle(i))
+		rowValue, err := blockcodec.EncodeRow(sc, []types.Causet{defCausValue}, []int64{2}, nil, nil, &rowcodec.Encoder{Enable: true})
+		c.Assert(err, IsNil)
+		put(rowKey, rowValue)
+		encodedIndexValue, err := codec.EncodeKey(sc, nil, defCausValue, types.NewIntCauset(i))
+		c.Assert(err, IsNil)
+		put(blockcodec.EncodeIndexSeekKey(blockID, indexID, encodedIndexValue), []byte{'0'})
+	}
+	MustPrewriteOK(c, causetstore, muts, string(keys[0]), 10, 0)
+	c.Assert(causetstore.Commit(keys, 10, 20), IsNil)
+	// The version committed after the start ts is not counted.
+	firstRow := blockcodec.EncodeRowKeyWithHandle(blockID, solomonkey.IntHandle(0))
+	MustPrewriteOK(c, causetstore, putMutations(string(firstRow), "new"), string(firstRow), 30, 0)
+	c.Assert(causetstore.Commit([][]byte{firstRow}, 30, 40), IsNil)
+
+	data, err := proto.Marshal(&fidelpb.ChecksumRequest{Algorithm: fidelpb.ChecksumAlgorithm_Crc64_Xor})
+	c.Assert(err, IsNil)
+	// The range covers both the index and the records of the causet.
+	start, end := blockcodec.EncodeTableIndexPrefix(blockID, indexID), blockcodec.GenTableRecordPrefix(blockID).PrefixNext()
+	checksum := func(regionID, startTS uint64) *interlock.Response {
+		region, _ := cluster.GetRegion(regionID)
+		h := &rpcHandler{cluster: cluster, mvsr-oocStore: causetstore, storeID: storeID}
+		c.Assert(h.checkRequestContext(&kvrpcpb.Context{RegionId: regionID, RegionEpoch: region.RegionEpoch}), IsNil)
+		h.rawStartKey = MvccKey(h.startKey).Raw()
+		h.rawEndKey = MvccKey(h.endKey).Raw()
+		return h.handleINTERLOCKChecksumRequest(&interlock.Request{
+			Data:    data,
+			StartTs: startTS,
+			Ranges:  []*interlock.KeyRange{{Start: start, End: end}},
+		})
+	}
+
+	var got fidelpb.ChecksumResponse
+	for _, regionID := range regionIDs {
+		resp := checksum(regionID, 30)
+		c.Assert(resp.OtherError, Equals, "")
+		var regionResp fidelpb.ChecksumResponse
+		c.Assert(regionResp.Unmarshal(resp.Data), IsNil)
+		c.Assert(regionResp.TotalKvs, Greater, uint64(0))
+		got.Checksum ^= regionResp.Checksum
+		got.TotalKvs += regionResp.TotalKvs
+		got.TotalBytes += regionResp.TotalBytes
+	}
+	c.Assert(got, DeepEquals, expected)
+
+	MustPrewriteOK(c, causetstore, putMutations(string(firstRow), "locked"), string(firstRow), 50, 0)
+	c.Assert(checksum(regionIDs[0], 60).Locked, NotNil)
+}
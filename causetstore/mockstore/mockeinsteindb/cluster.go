@@ -24,6 +24,7 @@ import (
 	fidel "github.com/einsteindb/fidel/client"
 	"github.com/golang/protobuf/proto"
 	"github.com/whtcorpsinc/MilevaDB-Prod/blockcodec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/dataversion"
 	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
 	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
 	"github.com/whtcorpsinc/solomonkeyproto/pkg/metapb"
@@ -48,6 +49,23 @@ type Cluster struct {
 
 	mvsr-oocStore MVCCStore
 
+	placementRule *PlacementRule
+
+	// peerLags and followerReadWait simulate the replication lag of followers.
+	peerLags         map[uint64]time.Duration
+	followerReadWait time.Duration
+
+	// layoutPath is the file the topology is persisted to after each change, the
+	// topology is only kept in memory if it's empty.
+	layoutPath string
+	restored   bool
+
+	// resolvedTSs keeps the resolved ts of each Region to make it monotonic.
+	resolvedTSs map[uint64]uint64
+
+	// columnarReplicas are the columnar replicas on the TiFlash stores.
+	columnarReplicas map[uint64]*columnarReplica
+
 	// delayEvents is used to control the execution sequence of rpc requests for test.
 	delayEvents map[delayKey]time.Duration
 	delayMu     sync.Mutex
@@ -131,6 +149,7 @@ func (c *Cluster) GetAllStores() []*metapb.CausetStore {
 func (c *Cluster) StopStore(storeID uint64) {
 	c.Lock()
 	defer c.Unlock()
+	defer c.persistLayout()
 
 	if causetstore := c.stores[storeID]; causetstore != nil {
 		causetstore.meta.State = metapb.StoreState_Offline
@@ -141,6 +160,7 @@ func (c *Cluster) StopStore(storeID uint64) {
 func (c *Cluster) StartStore(storeID uint64) {
 	c.Lock()
 	defer c.Unlock()
+	defer c.persistLayout()
 
 	if causetstore := c.stores[storeID]; causetstore != nil {
 		causetstore.meta.State = metapb.StoreState_Up
@@ -201,6 +221,7 @@ func (c *Cluster) GetAndCheckStoreByAddr(addr string) (*metapb.CausetStore, erro
 func (c *Cluster) AddStore(storeID uint64, addr string) {
 	c.Lock()
 	defer c.Unlock()
+	defer c.persistLayout()
 
 	c.stores[storeID] = newStore(storeID, addr)
 }
@@ -209,6 +230,7 @@ func (c *Cluster) AddStore(storeID uint64, addr string) {
 func (c *Cluster) RemoveStore(storeID uint64) {
 	c.Lock()
 	defer c.Unlock()
+	defer c.persistLayout()
 
 	delete(c.stores, storeID)
 }
@@ -217,6 +239,7 @@ func (c *Cluster) RemoveStore(storeID uint64) {
 func (c *Cluster) UFIDelateStoreAddr(storeID uint64, addr string, labels ...*metapb.StoreLabel) {
 	c.Lock()
 	defer c.Unlock()
+	defer c.persistLayout()
 	c.stores[storeID] = newStore(storeID, addr, labels...)
 }
 
@@ -332,6 +355,7 @@ func (c *Cluster) ScanRegions(startKey, endKey []byte, limit int) []*fidel.Regio
 func (c *Cluster) Bootstrap(regionID uint64, storeIDs, peerIDs []uint64, leaderPeerID uint64) {
 	c.Lock()
 	defer c.Unlock()
+	defer c.persistLayout()
 
 	if len(storeIDs) != len(peerIDs) {
 		panic("len(storeIDs) != len(peerIDs)")
@@ -339,12 +363,28 @@ func (c *Cluster) Bootstrap(regionID uint64, storeIDs, peerIDs []uint64, leaderP
 	c.regions[regionID] = newRegion(regionID, storeIDs, peerIDs, leaderPeerID)
 }
 
-// AddPeer adds a new Peer for the Region on the CausetStore.
+// AddPeer adds a new Peer for the Region on the CausetStore. It panics if the
+// placement rule of the cluster doesn't allow the Peer, it's for the tests which
+// set up the cluster, use TryAddPeer to get the error instead.
 func (c *Cluster) AddPeer(regionID, storeID, peerID uint64) {
+	if err := c.TryAddPeer(regionID, storeID, peerID); err != nil {
+		panic(err)
+	}
+}
+
+// TryAddPeer adds a new Peer for the Region on the CausetStore. It returns an
+// error if the placement rule of the cluster doesn't allow the Peer.
+func (c *Cluster) TryAddPeer(regionID, storeID, peerID uint64) error {
 	c.Lock()
 	defer c.Unlock()
 
-	c.regions[regionID].addPeer(peerID, storeID)
+	r := c.regions[regionID]
+	if err := c.checkAddPeer(r, storeID); err != nil {
+		return err
+	}
+	defer c.persistLayout()
+	r.addPeer(peerID, storeID)
+	return nil
 }
 
 // RemovePeer removes the Peer from the Region. Note that if the Peer is leader,
@@ -352,17 +392,35 @@ func (c *Cluster) AddPeer(regionID, storeID, peerID uint64) {
 func (c *Cluster) RemovePeer(regionID, storeID uint64) {
 	c.Lock()
 	defer c.Unlock()
+	defer c.persistLayout()
 
 	c.regions[regionID].removePeer(storeID)
 }
 
 // ChangeLeader sets the Region's leader Peer. Caller should guarantee the Peer
-// exists.
+// exists. It panics if the placement rule of the cluster prefers another Peer,
+// it's for the tests which set up the cluster, use TryChangeLeader to get the
+// error instead.
 func (c *Cluster) ChangeLeader(regionID, leaderPeerID uint64) {
+	if err := c.TryChangeLeader(regionID, leaderPeerID); err != nil {
+		panic(err)
+	}
+}
+
+// TryChangeLeader sets the Region's leader Peer. Caller should guarantee the Peer
+// exists. It returns an error if the placement rule of the cluster prefers another
+// Peer.
+func (c *Cluster) TryChangeLeader(regionID, leaderPeerID uint64) error {
 	c.Lock()
 	defer c.Unlock()
 
-	c.regions[regionID].changeLeader(leaderPeerID)
+	r := c.regions[regionID]
+	if err := c.checkLeader(r, leaderPeerID); err != nil {
+		return err
+	}
+	defer c.persistLayout()
+	r.changeLeader(leaderPeerID)
+	return nil
 }
 
 // GiveUpLeader sets the Region's leader to 0. The Region will have no leader
@@ -380,6 +438,7 @@ func (c *Cluster) Split(regionID, newRegionID uint64, key []byte, peerIDs []uint
 func (c *Cluster) SplitRaw(regionID, newRegionID uint64, rawKey []byte, peerIDs []uint64, leaderPeerID uint64) *metapb.Region {
 	c.Lock()
 	defer c.Unlock()
+	defer c.persistLayout()
 
 	newRegion := c.regions[regionID].split(newRegionID, rawKey, peerIDs, leaderPeerID)
 	c.regions[newRegionID] = newRegion
@@ -392,8 +451,10 @@ func (c *Cluster) SplitRaw(regionID, newRegionID uint64, rawKey []byte, peerIDs
 func (c *Cluster) Merge(regionID1, regionID2 uint64) {
 	c.Lock()
 	defer c.Unlock()
+	defer c.persistLayout()
 
 	c.regions[regionID1].merge(c.regions[regionID2].Meta.GetEndKey())
+	c.regions[regionID1].dataVersion.Merge(c.regions[regionID2].dataVersion)
 	delete(c.regions, regionID2)
 }
 
@@ -442,6 +503,7 @@ func (c *Cluster) handleDelay(startTS, regionID uint64) {
 func (c *Cluster) splitRange(mvsr-oocStore MVCCStore, start, end MvccKey, count int) {
 	c.Lock()
 	defer c.Unlock()
+	defer c.persistLayout()
 	c.evacuateOldRegionRanges(start, end)
 	regionPairs := c.getEntriesGroupByRegions(mvsr-oocStore, start, end, count)
 	c.createNewRegions(regionPairs, start, end)
@@ -545,8 +607,9 @@ func (c *Cluster) getRegionsCoverRange(start, end MvccKey) []*Region {
 
 // Region is the Region meta data.
 type Region struct {
-	Meta   *metapb.Region
-	leader uint64
+	Meta        *metapb.Region
+	leader      uint64
+	dataVersion dataversion.RegionVersion
 }
 
 func newPeerMeta(peerID, storeID uint64) *metapb.Peer {
@@ -569,8 +632,9 @@ func newRegion(regionID uint64, storeIDs, peerIDs []uint64, leaderPeerID uint64)
 		Peers: peers,
 	}
 	return &Region{
-		Meta:   meta,
-		leader: leaderPeerID,
+		Meta:        meta,
+		leader:      leaderPeerID,
+		dataVersion: dataversion.NewRegionVersion(),
 	}
 }
 
@@ -614,6 +678,7 @@ func (r *Region) split(newRegionID uint64, key MvccKey, peerIDs []uint64, leader
 		storeIDs = append(storeIDs, peer.GetStoreId())
 	}
 	region := newRegion(newRegionID, storeIDs, peerIDs, leaderPeerID)
+	region.dataVersion = r.dataVersion
 	region.uFIDelateKeyRange(key, r.Meta.EndKey)
 	r.uFIDelateKeyRange(r.Meta.StartKey, key)
 	return region
@@ -0,0 +1,173 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/cznic/mathutil"
+	"github.com/golang/protobuf/proto"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/dataversion"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/logutil"
+	"github.com/whtcorpsinc/errors"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/metapb"
+	"go.uber.org/zap"
+)
+
+// ClusterLayoutFile is the name of the file which keeps the cluster layout in the
+// directory of the MVCCLevelDB.
+const ClusterLayoutFile = "cluster_layout.json"
+
+// ClusterLayout is the topology of a Cluster which can be saved and loaded. It
+// includes the stores with their labels, the regions with their epochs, peers and
+// leaders, the ID allocator and the placement rule.
+type ClusterLayout struct {
+	// ID is the last ID allocated by the cluster.
+	ID            uint64                `json:"id"`
+	Stores        []*metapb.CausetStore `json:"stores"`
+	Regions       []*RegionLayout       `json:"regions"`
+	PlacementRule *PlacementRule        `json:"placement_rule,omitempty"`
+}
+
+// RegionLayout is a Region in ClusterLayout.
+type RegionLayout struct {
+	Meta   *metapb.Region `json:"meta"`
+	Leader uint64         `json:"leader"`
+}
+
+// Layout returns a snapshot of the topology of the cluster, the stores are sorted
+// by ID and the regions are sorted by start key.
+func (c *Cluster) Layout() *ClusterLayout {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.layout()
+}
+
+func (c *Cluster) layout() *ClusterLayout {
+	layout := &ClusterLayout{ID: c.id, PlacementRule: c.placementRule}
+	for _, s := range c.stores {
+		layout.Stores = append(layout.Stores, proto.Clone(s.meta).(*metapb.CausetStore))
+	}
+	sort.Slice(layout.Stores, func(i, j int) bool {
+		return layout.Stores[i].Id < layout.Stores[j].Id
+	})
+	for _, r := range c.regions {
+		layout.Regions = append(layout.Regions, &RegionLayout{
+			Meta:   proto.Clone(r.Meta).(*metapb.Region),
+			Leader: r.leader,
+		})
+	}
+	sort.Slice(layout.Regions, func(i, j int) bool {
+		return bytes.Compare(layout.Regions[i].Meta.StartKey, layout.Regions[j].Meta.StartKey) < 0
+	})
+	return layout
+}
+
+// SaveLayout writes the topology of the cluster to the file.
+func (c *Cluster) SaveLayout(path string) error {
+	return writeLayout(path, c.Layout())
+}
+
+// writeLayout writes the layout to a temporary file and renames it to path, so a
+// crash never leaves a partially written layout.
+func writeLayout(path string, layout *ClusterLayout) error {
+	data, err := json.MarshalIndent(layout, "", "  ")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	tmpPath := path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, data, 0644); err != nil {
+		return errors.Trace(err)
+	}
+	return errors.Trace(os.Rename(tmpPath, path))
+}
+
+// PersistLayout makes the cluster persist its topology to the file after each change
+// of the stores, regions or placement rule.
+// If the file exists, the topology in it replaces the current one of the cluster and
+// Restored returns true, so a cluster reopened on the same path sees the stores,
+// regions and IDs allocated before.
+func (c *Cluster) PersistLayout(path string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	layout, err := LoadClusterLayout(path)
+	switch {
+	case err == nil:
+		c.restoreLayout(layout)
+	case !os.IsNotExist(errors.Cause(err)):
+		return errors.Trace(err)
+	}
+	c.layoutPath = path
+	return errors.Trace(writeLayout(path, c.layout()))
+}
+
+// Restored returns whether the topology of the cluster is restored from a persisted
+// layout. A restored cluster should not be bootstrapped again.
+func (c *Cluster) Restored() bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.restored
+}
+
+func (c *Cluster) restoreLayout(layout *ClusterLayout) {
+	// IDs allocated after the last topology change are not persisted, so the
+	// allocator restarts from the largest ID in use if it's ahead of layout.ID.
+	c.id = layout.ID
+	c.stores = make(map[uint64]*CausetStore, len(layout.Stores))
+	for _, meta := range layout.Stores {
+		c.stores[meta.Id] = &CausetStore{meta: meta}
+		c.id = mathutil.MaxUint64(c.id, meta.Id)
+	}
+	c.regions = make(map[uint64]*Region, len(layout.Regions))
+	for _, r := range layout.Regions {
+		c.regions[r.Meta.Id] = &Region{Meta: r.Meta, leader: r.Leader, dataVersion: dataversion.RestoredRegionVersion()}
+		c.id = mathutil.MaxUint64(c.id, r.Meta.Id)
+		for _, p := range r.Meta.Peers {
+			c.id = mathutil.MaxUint64(c.id, p.Id)
+		}
+	}
+	c.placementRule = layout.PlacementRule
+	c.restored = true
+}
+
+// persistLayout writes the topology to the layout file if the persistence is enabled.
+// It should be called with the cluster locked.
+func (c *Cluster) persistLayout() {
+	if c.layoutPath == "" {
+		return
+	}
+	if err := writeLayout(c.layoutPath, c.layout()); err != nil {
+		logutil.BgLogger().Warn("persist cluster layout failed", zap.String("path", c.layoutPath), zap.Error(err))
+	}
+}
+
+// LoadClusterLayout reads a ClusterLayout saved by Cluster.SaveLayout.
+func LoadClusterLayout(path string) (*ClusterLayout, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	layout := &ClusterLayout{}
+	if err = json.Unmarshal(data, layout); err != nil {
+		return nil, errors.Annotatef(err, "invalid cluster layout %s", path)
+	}
+	return layout, nil
+}
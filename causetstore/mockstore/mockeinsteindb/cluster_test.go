@@ -17,6 +17,7 @@ import (
 	"bytes"
 	"context"
 	"math"
+	"path/filepath"
 	"strconv"
 	"time"
 
@@ -29,7 +30,9 @@ import (
 	"github.com/whtcorpsinc/MilevaDB-Prod/stochastikctx/stmtctx"
 	"github.com/whtcorpsinc/MilevaDB-Prod/types"
 	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/errors"
 	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/metapb"
 )
 
 var _ = Suite(&testClusterSuite{})
@@ -120,3 +123,136 @@ func (s *testClusterSuite) TestClusterSplit(c *C) {
 	}
 	c.Assert(allIndexMap, HasLen, 1000)
 }
+
+func (s *testClusterSuite) TestClusterLayout(c *C) {
+	cluster := mockeinsteindb.NewCluster(mockeinsteindb.MustNewMVCCStore())
+	storeIDs, _, regionID, _ := mockeinsteindb.BootstrapWithMultiStores(cluster, 2)
+	newRegionID, newPeerIDs := cluster.AllocID(), cluster.AllocIDs(2)
+	cluster.Split(regionID, newRegionID, []byte("m"), newPeerIDs, newPeerIDs[1])
+
+	path := filepath.Join(c.MkDir(), mockeinsteindb.ClusterLayoutFile)
+	c.Assert(cluster.SaveLayout(path), IsNil)
+	layout, err := mockeinsteindb.LoadClusterLayout(path)
+	c.Assert(err, IsNil)
+	c.Assert(layout.ID, Equals, newPeerIDs[1])
+	c.Assert(layout.Stores, HasLen, 2)
+	c.Assert(layout.Stores[0].Id, Equals, storeIDs[0])
+	c.Assert(layout.Regions, HasLen, 2)
+	c.Assert(layout.Regions[0].Meta.Id, Equals, regionID)
+	c.Assert(layout.Regions[1].Meta.Id, Equals, newRegionID)
+	c.Assert(layout.Regions[1].Leader, Equals, newPeerIDs[1])
+	c.Assert(layout.Regions[1].Meta.StartKey, DeepEquals, []byte(mockeinsteindb.NewMvccKey([]byte("m"))))
+	c.Assert(layout.Regions[1].Meta.RegionEpoch.Version, Equals, uint64(1))
+}
+
+func (s *testClusterSuite) TestClusterLayoutPersistence(c *C) {
+	dir := c.MkDir()
+	rpcClient, cluster, _, err := mockeinsteindb.NewEinsteinDBAndFIDelClient(dir)
+	c.Assert(err, IsNil)
+	c.Assert(cluster.Restored(), IsFalse)
+	storeIDs, _, regionID, _ := mockeinsteindb.BootstrapWithMultiStores(cluster, 2)
+	label := &metapb.StoreLabel{Key: "zone", Value: "z1"}
+	cluster.UFIDelateStoreAddr(storeIDs[1], "causetstore-z1", label)
+	newRegionID, newPeerIDs := cluster.AllocID(), cluster.AllocIDs(2)
+	cluster.Split(regionID, newRegionID, []byte("m"), newPeerIDs, newPeerIDs[1])
+	// An ID allocated without changing the topology is not persisted.
+	cluster.AllocID()
+	c.Assert(rpcClient.Close(), IsNil)
+
+	rpcClient, cluster, _, err = mockeinsteindb.NewEinsteinDBAndFIDelClient(dir)
+	c.Assert(err, IsNil)
+	defer rpcClient.Close()
+	c.Assert(cluster.Restored(), IsTrue)
+	c.Assert(cluster.AllocID(), Equals, newPeerIDs[1]+1)
+	c.Assert(cluster.GetAllStores(), HasLen, 2)
+	c.Assert(cluster.GetStore(storeIDs[1]).Labels, DeepEquals, []*metapb.StoreLabel{label})
+	c.Assert(cluster.GetAllRegions(), HasLen, 2)
+	region, leader := cluster.GetRegionByKey(mockeinsteindb.NewMvccKey([]byte("z")))
+	c.Assert(region.Id, Equals, newRegionID)
+	c.Assert(region.RegionEpoch.Version, Equals, uint64(1))
+	c.Assert(leader.Id, Equals, newPeerIDs[1])
+}
+
+func (s *testClusterSuite) TestPlacementRule(c *C) {
+	cluster := mockeinsteindb.NewCluster(mockeinsteindb.MustNewMVCCStore())
+	storeIDs := cluster.AllocIDs(4)
+	for i, zone := range []string{"z1", "z1", "z2", "z3"} {
+		cluster.UFIDelateStoreAddr(storeIDs[i], "causetstore"+strconv.Itoa(i),
+			&metapb.StoreLabel{Key: "zone", Value: zone},
+			&metapb.StoreLabel{Key: "host", Value: "h" + strconv.Itoa(i)})
+	}
+	regionID, peerID := cluster.AllocID(), cluster.AllocID()
+	cluster.Bootstrap(regionID, storeIDs[:1], []uint64{peerID}, peerID)
+	regionStores := func() []uint64 {
+		region, _ := cluster.GetRegion(regionID)
+		var ids []uint64
+		for _, p := range region.Peers {
+			ids = append(ids, p.StoreId)
+		}
+		return ids
+	}
+
+	cluster.SetPlacementRule(&mockeinsteindb.PlacementRule{
+		Count:          3,
+		LocationLabels: []string{"zone", "host"},
+		LeaderLabels:   []*metapb.StoreLabel{{Key: "zone", Value: "z2"}},
+	})
+	c.Assert(mockeinsteindb.NewFIDelClient(cluster).ScatterRegion(context.Background(), regionID), IsNil)
+	// The replicas are isolated by zone, and the leader is in z2.
+	c.Assert(regionStores(), DeepEquals, []uint64{storeIDs[0], storeIDs[2], storeIDs[3]})
+	region, leader := cluster.GetRegionByID(regionID)
+	c.Assert(region.Peers[0].Id, Equals, peerID)
+	c.Assert(leader.StoreId, Equals, storeIDs[2])
+
+	follower := cluster.GetReplicaForRead(regionID, solomonkey.ReplicaReadFollower, []*metapb.StoreLabel{{Key: "zone", Value: "z3"}})
+	c.Assert(follower.StoreId, Equals, storeIDs[3])
+	follower = cluster.GetReplicaForRead(regionID, solomonkey.ReplicaReadFollower, nil)
+	c.Assert(follower.StoreId, Equals, storeIDs[0])
+	replica := cluster.GetReplicaForRead(regionID, solomonkey.ReplicaReadMixed, nil)
+	c.Assert(replica.StoreId, Equals, storeIDs[2])
+	replica = cluster.GetReplicaForRead(regionID, solomonkey.ReplicaReadLeader, []*metapb.StoreLabel{{Key: "zone", Value: "z3"}})
+	c.Assert(replica.StoreId, Equals, storeIDs[2])
+
+	// The region already has the 3 replicas of the rule.
+	_, _, err := cluster.AddPeerByRule(regionID)
+	c.Assert(errors.Cause(err), Equals, mockeinsteindb.ErrReplicaCountReached)
+	err = cluster.TryAddPeer(regionID, storeIDs[1], cluster.AllocID())
+	c.Assert(errors.Cause(err), Equals, mockeinsteindb.ErrReplicaCountReached)
+	c.Assert(func() { cluster.AddPeer(regionID, storeIDs[1], cluster.AllocID()) }, PanicMatches, ".*replicas of the placement rule.*")
+
+	cluster.SetPlacementRule(&mockeinsteindb.PlacementRule{Count: 5, LocationLabels: []string{"zone", "host"}})
+	storeID, _, err := cluster.AddPeerByRule(regionID)
+	c.Assert(err, IsNil)
+	c.Assert(storeID, Equals, storeIDs[1])
+	_, _, err = cluster.AddPeerByRule(regionID)
+	c.Assert(errors.Cause(err), Equals, mockeinsteindb.ErrNoStoreForPlacement)
+
+	cluster.SetPlacementRule(&mockeinsteindb.PlacementRule{
+		Count:       2,
+		Constraints: []*metapb.StoreLabel{{Key: "zone", Value: "z1"}},
+	})
+	c.Assert(cluster.ScatterRegion(regionID), IsNil)
+	c.Assert(regionStores(), DeepEquals, []uint64{storeIDs[0], storeIDs[1]})
+	_, leader = cluster.GetRegionByID(regionID)
+	c.Assert(leader.StoreId, Equals, storeIDs[0])
+	err = cluster.TryAddPeer(regionID, storeIDs[2], cluster.AllocID())
+	c.Assert(errors.Cause(err), Equals, mockeinsteindb.ErrReplicaCountReached)
+	cluster.SetPlacementRule(&mockeinsteindb.PlacementRule{Count: 3, Constraints: []*metapb.StoreLabel{{Key: "zone", Value: "z1"}}})
+	err = cluster.TryAddPeer(regionID, storeIDs[2], cluster.AllocID())
+	c.Assert(errors.Cause(err), Equals, mockeinsteindb.ErrNoStoreForPlacement)
+	c.Assert(regionStores(), DeepEquals, []uint64{storeIDs[0], storeIDs[1]})
+	cluster.SetPlacementRule(&mockeinsteindb.PlacementRule{Count: 2, LeaderLabels: []*metapb.StoreLabel{{Key: "host", Value: "h1"}}})
+	leaderID, err := cluster.ChangeLeaderByRule(regionID)
+	c.Assert(err, IsNil)
+	_, leader = cluster.GetRegionByID(regionID)
+	c.Assert(leader.Id, Equals, leaderID)
+	c.Assert(leader.StoreId, Equals, storeIDs[1])
+	region, _ = cluster.GetRegionByID(regionID)
+	c.Assert(region.Peers[0].StoreId, Equals, storeIDs[0])
+	c.Assert(cluster.TryChangeLeader(regionID, region.Peers[0].Id), ErrorMatches, ".*leader labels.*")
+	_, leader = cluster.GetRegionByID(regionID)
+	c.Assert(leader.Id, Equals, leaderID)
+	c.Assert(func() { cluster.ChangeLeader(regionID, region.Peers[0].Id) }, PanicMatches, ".*leader labels.*")
+	cluster.GiveUpLeader(regionID)
+	c.Assert(cluster.TryChangeLeader(regionID, leaderID), IsNil)
+}
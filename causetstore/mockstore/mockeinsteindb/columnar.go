@@ -0,0 +1,360 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/blockcodec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/oracle"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/cdc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/errors"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+)
+
+// columnarVersion is a committed version of a event in the columnar replica, a nil
+// value means the event is deleted.
+type columnarVersion struct {
+	commitTS uint64
+	value    []byte
+}
+
+// columnarRow is a event visible to a scan of the columnar replica.
+type columnarRow struct {
+	key   []byte
+	value []byte
+}
+
+// columnarBlock is the columnar replica of a causet on a TiFlash CausetStore. It's fed
+// asynchronously by a CDC subscription on the record keys of the causet. Like the
+// delta layer of TiFlash, the rows are kept in the event format, the scans decode them
+// to column chunks.
+type columnarBlock struct {
+	blockID int64
+	sub     *cdc.Subscription
+	// syncTS is the ts the replica is added at, the replica is available once the
+	// changes before it are applied.
+	syncTS uint64
+	closed chan struct{}
+
+	mu sync.RWMutex
+	// keys are the sorted record keys, versions are sorted by commit ts.
+	keys       []string
+	versions   map[string][]columnarVersion
+	resolvedTS uint64
+}
+
+// columnarReplica is the columnar replicas on a TiFlash CausetStore.
+type columnarReplica struct {
+	sync.RWMutex
+	blocks map[int64]*columnarBlock
+	// lag simulates the replication lag of the CausetStore, the changes are applied
+	// but not readable until the lag passes.
+	lag time.Duration
+}
+
+// AddColumnarReplica adds the columnar replica of a causet on a TiFlash CausetStore, like
+// `ALTER TABLE SET TIFLASH REPLICA` does. The replica begins with the data committed
+// before it's added, and is fed by the committed writes asynchronously. The Regions
+// of the causet are only available on the CausetStore once they have a Peer on it.
+func (c *Cluster) AddColumnarReplica(storeID uint64, blockID int64) error {
+	db, ok := c.mvsr-oocStore.(*MVCCLevelDB)
+	if !ok {
+		return errors.New("the causetstore doesn't support columnar replicas")
+	}
+	c.Lock()
+	defer c.Unlock()
+
+	s := c.stores[storeID]
+	if s == nil || !isTiFlashStore(s.meta) {
+		return errors.Errorf("causetstore %d is not a TiFlash causetstore", storeID)
+	}
+	if c.columnarReplicas == nil {
+		c.columnarReplicas = make(map[uint64]*columnarReplica)
+	}
+	r := c.columnarReplicas[storeID]
+	if r == nil {
+		r = &columnarReplica{blocks: make(map[int64]*columnarBlock)}
+		c.columnarReplicas[storeID] = r
+	}
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.blocks[blockID]; ok {
+		return nil
+	}
+	start := blockcodec.GenTableRecordPrefix(blockID)
+	sub, err := db.Subscribe(start, start.PrefixNext(), 0)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	b := &columnarBlock{
+		blockID:  blockID,
+		sub:      sub,
+		syncTS:   tsoProgress(),
+		closed:   make(chan struct{}),
+		versions: make(map[string][]columnarVersion),
+	}
+	r.blocks[blockID] = b
+	go b.run()
+	// The replica is synced once the resolved ts reaches syncTS.
+	db.feed.Advance(b.syncTS)
+	return nil
+}
+
+// RemoveColumnarReplica removes the columnar replica of a causet on a CausetStore.
+func (c *Cluster) RemoveColumnarReplica(storeID uint64, blockID int64) {
+	r := c.getColumnarReplica(storeID)
+	if r == nil {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	if b := r.blocks[blockID]; b != nil {
+		b.close()
+		delete(r.blocks, blockID)
+	}
+}
+
+// SetColumnarReplicaLag sets the replication lag of the columnar replicas on a
+// CausetStore. A batch INTERLOCK request waits the follower read wait at most for the
+// replica to catch up with its start ts, and returns its Regions to retry otherwise.
+func (c *Cluster) SetColumnarReplicaLag(storeID uint64, lag time.Duration) {
+	if r := c.getColumnarReplica(storeID); r != nil {
+		r.Lock()
+		r.lag = lag
+		r.Unlock()
+	}
+}
+
+// GetTiFlashReplicaProgress returns the PROGRESS of the causet in TIFLASH_REPLICA, the
+// fraction of the Regions of the causet available on the columnar replicas. A Region is
+// available if it has a Peer on a TiFlash CausetStore, whose replica of the causet has
+// applied the changes before the replica was added. The causet is AVAILABLE if the
+// progress is 1.
+func (c *Cluster) GetTiFlashReplicaProgress(blockID int64) float64 {
+	start := NewMvccKey(blockcodec.GenTableRecordPrefix(blockID))
+	end := NewMvccKey(blockcodec.GenTableRecordPrefix(blockID).PrefixNext())
+
+	c.RLock()
+	defer c.RUnlock()
+	var total, available int
+	for _, r := range c.regions {
+		regionStart, regionEnd := r.Meta.GetStartKey(), r.Meta.GetEndKey()
+		if (len(regionEnd) > 0 && bytes.Compare(regionEnd, start) <= 0) || bytes.Compare(regionStart, end) >= 0 {
+			continue
+		}
+		total++
+		for storeID, replica := range c.columnarReplicas {
+			if regionPeerOnStore(r.Meta, storeID) == nil {
+				continue
+			}
+			if b := replica.getBlock(blockID); b != nil && b.synced() {
+				available++
+				break
+			}
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(available) / float64(total)
+}
+
+// gcColumnarReplicas prunes the versions of the columnar replicas which are invisible
+// to the reads at or after the GC safe point, like the compaction of TiFlash does.
+func (c *Cluster) gcColumnarReplicas(safePoint uint64) {
+	c.RLock()
+	replicas := make([]*columnarReplica, 0, len(c.columnarReplicas))
+	for _, r := range c.columnarReplicas {
+		replicas = append(replicas, r)
+	}
+	c.RUnlock()
+
+	for _, r := range replicas {
+		r.RLock()
+		for _, b := range r.blocks {
+			b.gc(safePoint)
+		}
+		r.RUnlock()
+	}
+}
+
+func (c *Cluster) getColumnarReplica(storeID uint64) *columnarReplica {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.columnarReplicas[storeID]
+}
+
+// getColumnarBlock returns the columnar replica of a causet on a CausetStore, nil if
+// there isn't one.
+func (c *Cluster) getColumnarBlock(storeID uint64, blockID int64) (*columnarBlock, time.Duration) {
+	r := c.getColumnarReplica(storeID)
+	if r == nil {
+		return nil, 0
+	}
+	r.RLock()
+	defer r.RUnlock()
+
+	return r.blocks[blockID], r.lag
+}
+
+func (r *columnarReplica) getBlock(blockID int64) *columnarBlock {
+	r.RLock()
+	defer r.RUnlock()
+
+	return r.blocks[blockID]
+}
+
+// waitColumnarBlock simulates the learner read of TiFlash. It waits for the replica to
+// apply the changes before startTS, or returns false if the replica lags too much, so
+// the client can retry the Regions later.
+func (h *rpcHandler) waitColumnarBlock(b *columnarBlock, lag time.Duration, startTS uint64) bool {
+	deadline := time.Now().Add(h.cluster.getFollowerReadWait())
+	for {
+		// All the transactions committed before the TSO progress are published to the
+		// feed, or are still locked.
+		if db, ok := h.cluster.mvsr-oocStore.(*MVCCLevelDB); ok && db.feed != nil {
+			db.feed.Advance(tsoProgress())
+		}
+		if b.appliedTS(lag) >= startTS {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (b *columnarBlock) run() {
+	for {
+		select {
+		case e := <-b.sub.Events():
+			b.apply(e)
+		case <-b.closed:
+			return
+		}
+	}
+}
+
+func (b *columnarBlock) close() {
+	b.sub.Close()
+	close(b.closed)
+}
+
+func (b *columnarBlock) apply(e *cdc.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch e.Type {
+	case cdc.EventCommit:
+		key := string(e.Key)
+		versions, ok := b.versions[key]
+		if !ok {
+			i := sort.SearchStrings(b.keys, key)
+			b.keys = append(b.keys, "")
+			INTERLOCKy(b.keys[i+1:], b.keys[i:])
+			b.keys[i] = key
+		}
+		v := columnarVersion{commitTS: e.CommitTS}
+		if e.Op == kvrpcpb.Op_Put {
+			v.value = e.Value
+		}
+		i := sort.Search(len(versions), func(i int) bool { return versions[i].commitTS > e.CommitTS })
+		versions = append(versions, columnarVersion{})
+		INTERLOCKy(versions[i+1:], versions[i:])
+		versions[i] = v
+		b.versions[key] = versions
+	case cdc.EventResolvedTS:
+		if e.ResolvedTS > b.resolvedTS {
+			b.resolvedTS = e.ResolvedTS
+		}
+	}
+}
+
+// appliedTS returns the ts below which the changes are readable. The changes committed
+// in the last lag are not readable yet.
+func (b *columnarBlock) appliedTS(lag time.Duration) uint64 {
+	b.mu.RLock()
+	appliedTS := b.resolvedTS
+	b.mu.RUnlock()
+	if lag > 0 {
+		lagTS := oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(-lag)), 0)
+		if lagTS < appliedTS {
+			appliedTS = lagTS
+		}
+	}
+	return appliedTS
+}
+
+// gc keeps the version of each event visible at the safe point and the versions after
+// it, a event deleted at the safe point is removed.
+func (b *columnarBlock) gc(safePoint uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	keys := b.keys[:0]
+	for _, key := range b.keys {
+		versions := b.versions[key]
+		i := sort.Search(len(versions), func(i int) bool { return versions[i].commitTS > safePoint })
+		if i > 0 && versions[i-1].value != nil {
+			i--
+		}
+		if i == len(versions) {
+			delete(b.versions, key)
+			continue
+		}
+		if i > 0 {
+			b.versions[key] = append([]columnarVersion(nil), versions[i:]...)
+		}
+		keys = append(keys, key)
+	}
+	b.keys = keys
+}
+
+func (b *columnarBlock) synced() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.resolvedTS >= b.syncTS
+}
+
+// scan returns the rows in the ranges visible at startTS, in the order of the ranges.
+func (b *columnarBlock) scan(ranges []solomonkey.KeyRange, startTS uint64) []columnarRow {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var rows []columnarRow
+	for _, ran := range ranges {
+		i := sort.SearchStrings(b.keys, string(ran.StartKey))
+		for ; i < len(b.keys); i++ {
+			key := b.keys[i]
+			if len(ran.EndKey) > 0 && key >= string(ran.EndKey) {
+				break
+			}
+			versions := b.versions[key]
+			j := sort.Search(len(versions), func(j int) bool { return versions[j].commitTS > startTS })
+			if j == 0 || versions[j-1].value == nil {
+				continue
+			}
+			rows = append(rows, columnarRow{key: []byte(key), value: versions[j-1].value})
+		}
+	}
+	return rows
+}
@@ -0,0 +1,398 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/whtcorpsinc/MilevaDB-Prod/blockcodec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/expression"
+	"github.com/whtcorpsinc/MilevaDB-Prod/expression/aggregation"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/chunk"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/rowcodec"
+	"github.com/whtcorpsinc/errors"
+	"github.com/whtcorpsinc/fidelpb/go-fidelpb"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/einsteindbpb"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/metapb"
+)
+
+// columnarChunkSize is the max number of rows in a chunk of the columnar executors.
+const columnarChunkSize = 1024
+
+// columnarExec is a vectorized executor over the columnar replica, it processes a
+// chunk of rows at a time.
+type columnarExec interface {
+	// next returns the next chunk, nil if there are no more rows.
+	next() (*chunk.Chunk, error)
+}
+
+type columnarScanExec struct {
+	evalCtx *evalContext
+	columns []*fidelpb.DeferredCausetInfo
+	rd      *rowcodec.BytesDecoder
+	rows    []columnarRow
+	pos     int
+}
+
+func (e *columnarScanExec) next() (*chunk.Chunk, error) {
+	if e.pos >= len(e.rows) {
+		return nil, nil
+	}
+	chk := chunk.NewChunkWithCapacity(e.evalCtx.fieldTps, columnarChunkSize)
+	decoder := codec.NewDecoder(chk, e.evalCtx.sc.TimeZone)
+	for ; e.pos < len(e.rows) && chk.NumRows() < columnarChunkSize; e.pos++ {
+		event := e.rows[e.pos]
+		handle, err := blockcodec.DecodeRowKey(event.key)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		values, err := getRowData(e.columns, e.evalCtx.colIDs, handle.IntValue(), event.value, e.rd)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		for i, val := range values {
+			if _, err = decoder.DecodeOne(val, i, e.evalCtx.fieldTps[i]); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+	}
+	return chk, nil
+}
+
+type columnarSelectionExec struct {
+	src        columnarExec
+	evalCtx    *evalContext
+	conditions []expression.Expression
+}
+
+func (e *columnarSelectionExec) next() (*chunk.Chunk, error) {
+	for {
+		chk, err := e.src.next()
+		if err != nil || chk == nil {
+			return nil, err
+		}
+		selected := make([]bool, chk.NumRows())
+		for i := range selected {
+			selected[i] = true
+		}
+		// The conditions are evaluated one by one over the whole chunk.
+		for _, cond := range e.conditions {
+			for i := range selected {
+				if !selected[i] {
+					continue
+				}
+				d, err := cond.Eval(chk.GetRow(i))
+				if err != nil {
+					return nil, errors.Trace(err)
+				}
+				if d.IsNull() {
+					selected[i] = false
+					continue
+				}
+				isBool, err := d.ToBool(e.evalCtx.sc)
+				isBool, err = expression.HandleOverflowOnSelection(e.evalCtx.sc, isBool, err)
+				if err != nil {
+					return nil, errors.Trace(err)
+				}
+				selected[i] = isBool != 0
+			}
+		}
+		result := chunk.NewChunkWithCapacity(e.evalCtx.fieldTps, chk.NumRows())
+		for i, ok := range selected {
+			if ok {
+				result.AppendRow(chk.GetRow(i))
+			}
+		}
+		if result.NumRows() > 0 {
+			return result, nil
+		}
+	}
+}
+
+type columnarLimitExec struct {
+	src   columnarExec
+	limit uint64
+	count uint64
+}
+
+func (e *columnarLimitExec) next() (*chunk.Chunk, error) {
+	if e.count >= e.limit {
+		return nil, nil
+	}
+	chk, err := e.src.next()
+	if err != nil || chk == nil {
+		return nil, err
+	}
+	if left := e.limit - e.count; uint64(chk.NumRows()) > left {
+		chk.TruncateTo(int(left))
+	}
+	e.count += uint64(chk.NumRows())
+	return chk, nil
+}
+
+// columnarAggExec is the partial hash aggregation over the chunks.
+type columnarAggExec struct {
+	src          columnarExec
+	evalCtx      *evalContext
+	aggExprs     []aggregation.Aggregation
+	groupByExprs []expression.Expression
+}
+
+// rows returns a event for each group, the partial results followed by the group-by
+// values, in the order the groups are met.
+func (e *columnarAggExec) rows() ([][][]byte, error) {
+	aggCtxsMap := make(aggCtxsMapper)
+	var (
+		groupKeys [][]byte
+		groupRows [][][]byte
+	)
+	for {
+		chk, err := e.src.next()
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if chk == nil {
+			break
+		}
+		for i := 0; i < chk.NumRows(); i++ {
+			event := chk.GetRow(i)
+			gk, gkRow, err := e.getGroupKey(event)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			aggCtxs, ok := aggCtxsMap[string(gk)]
+			if !ok {
+				aggCtxs = make([]*aggregation.AggEvaluateContext, 0, len(e.aggExprs))
+				for _, agg := range e.aggExprs {
+					aggCtxs = append(aggCtxs, agg.CreateContext(e.evalCtx.sc))
+				}
+				aggCtxsMap[string(gk)] = aggCtxs
+				groupKeys = append(groupKeys, gk)
+				groupRows = append(groupRows, gkRow)
+			}
+			for j, agg := range e.aggExprs {
+				if err = agg.UFIDelate(aggCtxs[j], e.evalCtx.sc, event); err != nil {
+					return nil, errors.Trace(err)
+				}
+			}
+		}
+	}
+
+	rows := make([][][]byte, 0, len(groupKeys))
+	for i, gk := range groupKeys {
+		aggCtxs := aggCtxsMap[string(gk)]
+		value := make([][]byte, 0, 2*len(e.aggExprs)+len(e.groupByExprs))
+		for j, agg := range e.aggExprs {
+			for _, result := range agg.GetPartialResult(aggCtxs[j]) {
+				data, err := codec.EncodeValue(e.evalCtx.sc, nil, result)
+				if err != nil {
+					return nil, errors.Trace(err)
+				}
+				value = append(value, data)
+			}
+		}
+		rows = append(rows, append(value, groupRows[i]...))
+	}
+	return rows, nil
+}
+
+func (e *columnarAggExec) getGroupKey(event chunk.Row) ([]byte, [][]byte, error) {
+	if len(e.groupByExprs) == 0 {
+		return nil, nil, nil
+	}
+	var key []byte
+	values := make([][]byte, 0, len(e.groupByExprs))
+	for _, item := range e.groupByExprs {
+		v, err := item.Eval(event)
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		b, err := codec.EncodeValue(e.evalCtx.sc, nil, v)
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		key = append(key, b...)
+		values = append(values, b)
+	}
+	return key, values, nil
+}
+
+// columnarBlockOf returns the columnar replica on the CausetStore of the causet scanned
+// by the request, nil if there isn't one.
+func (h *rpcHandler) columnarBlockOf(req *interlock.BatchRequest) (*columnarBlock, []*fidelpb.Executor, *fidelpb.PosetDagRequest, error) {
+	posetPosetDagReq := new(fidelpb.PosetDagRequest)
+	if err := proto.Unmarshal(req.Data, posetPosetDagReq); err != nil {
+		return nil, nil, nil, errors.Trace(err)
+	}
+	executors := posetPosetDagReq.Executors
+	if len(executors) == 0 {
+		// Flatten the executor tree to the executors from the scan.
+		for curr := posetPosetDagReq.RootExecutor; curr != nil; {
+			executors = append([]*fidelpb.Executor{curr}, executors...)
+			switch curr.GetTp() {
+			case fidelpb.ExecType_TypeSelection:
+				curr = curr.Selection.Child
+			case fidelpb.ExecType_TypeAggregation, fidelpb.ExecType_TypeStreamAgg:
+				curr = curr.Aggregation.Child
+			case fidelpb.ExecType_TypeTopN:
+				curr = curr.TopN.Child
+			case fidelpb.ExecType_TypeLimit:
+				curr = curr.Limit.Child
+			default:
+				curr = nil
+			}
+		}
+	}
+	if !columnarSupported(executors) {
+		return nil, nil, nil, nil
+	}
+	b, _ := h.cluster.getColumnarBlock(h.storeID, executors[0].TblScan.TableId)
+	return b, executors, posetPosetDagReq, nil
+}
+
+// columnarSupported reports whether the executors can run on the columnar replica:
+// a causet scan followed by selections and limits, optionally ended by an aggregation.
+// The other plans are served by the event-based executors.
+func columnarSupported(executors []*fidelpb.Executor) bool {
+	if len(executors) == 0 || executors[0].GetTp() != fidelpb.ExecType_TypeTableScan {
+		return false
+	}
+	for i, curr := range executors[1:] {
+		switch curr.GetTp() {
+		case fidelpb.ExecType_TypeSelection, fidelpb.ExecType_TypeLimit:
+		case fidelpb.ExecType_TypeAggregation, fidelpb.ExecType_TypeStreamAgg:
+			if i != len(executors)-2 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// handleColumnarBatchINTERLOCK serves the batch INTERLOCK request by the columnar replica
+// of the scanned causet on the CausetStore. It returns nil if there isn't one, and the
+// request is served by the event-based executors.
+func (h *rpcHandler) handleColumnarBatchINTERLOCK(req *interlock.BatchRequest) (einsteindbpb.EinsteinDB_Batchinterlocking_directorateClient, error) {
+	b, executors, posetPosetDagReq, err := h.columnarBlockOf(req)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	_, lag := h.cluster.getColumnarBlock(h.storeID, b.blockID)
+	if !h.waitColumnarBlock(b, lag, req.StartTs) {
+		return &mockBatchINTERLOCKRetryClient{regions: batchRegions(req.Regions)}, nil
+	}
+	client := &mockBatchCoFIDelataClient{}
+	for _, ri := range req.Regions {
+		region, _ := h.cluster.GetRegion(ri.RegionId)
+		if region == nil || regionPeerOnStore(region, h.storeID) == nil {
+			return &mockBatchINTERLOCKRetryClient{regions: batchRegions([]*interlock.RegionInfo{ri})}, nil
+		}
+		// The ranges are clipped by the Region.
+		rh := *h
+		rh.rawStartKey = MvccKey(region.StartKey).Raw()
+		rh.rawEndKey = MvccKey(region.EndKey).Raw()
+		chunk, err := rh.execColumnar(b, executors, posetPosetDagReq, req.StartTs, ri.Ranges)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		client.chunks = append(client.chunks, chunk)
+	}
+	return client, nil
+}
+
+// batchRegions returns the Regions of the batch INTERLOCK request to retry.
+func batchRegions(infos []*interlock.RegionInfo) []*metapb.Region {
+	regions := make([]*metapb.Region, 0, len(infos))
+	for _, ri := range infos {
+		regions = append(regions, &metapb.Region{Id: ri.RegionId, RegionEpoch: ri.RegionEpoch})
+	}
+	return regions
+}
+
+// execColumnar executes the executors over the columnar replica in the ranges.
+func (h *rpcHandler) execColumnar(b *columnarBlock, executors []*fidelpb.Executor, posetPosetDagReq *fidelpb.PosetDagRequest, startTS uint64, keyRanges []*interlock.KeyRange) (fidelpb.Chunk, error) {
+	var chunk fidelpb.Chunk
+	sc := flagsToStatementContext(posetPosetDagReq.Flags)
+	var err error
+	sc.TimeZone, err = constructTimeZone(posetPosetDagReq.TimeZoneName, int(posetPosetDagReq.TimeZoneOffset))
+	if err != nil {
+		return chunk, errors.Trace(err)
+	}
+	evalCtx := &evalContext{sc: sc}
+	scan := executors[0].TblScan
+	evalCtx.setDeferredCausetInfo(scan.DeferredCausets)
+	ranges, err := h.extractKVRanges(keyRanges, false)
+	if err != nil {
+		return chunk, errors.Trace(err)
+	}
+	var src columnarExec = &columnarScanExec{
+		evalCtx: evalCtx,
+		columns: scan.DeferredCausets,
+		rd:      newRowBytesDecoder(scan.DeferredCausets, evalCtx),
+		rows:    b.scan(ranges, startTS),
+	}
+	for _, curr := range executors[1:] {
+		switch curr.GetTp() {
+		case fidelpb.ExecType_TypeSelection:
+			conds, err := convertToExprs(sc, evalCtx.fieldTps, curr.Selection.Conditions)
+			if err != nil {
+				return chunk, errors.Trace(err)
+			}
+			src = &columnarSelectionExec{src: src, evalCtx: evalCtx, conditions: conds}
+		case fidelpb.ExecType_TypeLimit:
+			src = &columnarLimitExec{src: src, limit: curr.Limit.GetLimit()}
+		case fidelpb.ExecType_TypeAggregation, fidelpb.ExecType_TypeStreamAgg:
+			aggs, groupBys, _, err := h.getAggInfo(&posetPosetDagContext{evalCtx: evalCtx}, curr)
+			if err != nil {
+				return chunk, errors.Trace(err)
+			}
+			agg := &columnarAggExec{src: src, evalCtx: evalCtx, aggExprs: aggs, groupByExprs: groupBys}
+			rows, err := agg.rows()
+			if err != nil {
+				return chunk, errors.Trace(err)
+			}
+			for _, event := range rows {
+				for _, offset := range posetPosetDagReq.OutputOffsets {
+					chunk.RowsData = append(chunk.RowsData, event[offset]...)
+				}
+			}
+			// The aggregation must be the last executor.
+			return chunk, nil
+		default:
+			return chunk, errors.Errorf("the columnar replica doesn't support the exec type %v", curr.GetTp())
+		}
+	}
+
+	for {
+		chk, err := src.next()
+		if err != nil {
+			return chunk, errors.Trace(err)
+		}
+		if chk == nil {
+			return chunk, nil
+		}
+		for i := 0; i < chk.NumRows(); i++ {
+			event := chk.GetRow(i)
+			for _, offset := range posetPosetDagReq.OutputOffsets {
+				chunk.RowsData, err = codec.EncodeValue(sc, chunk.RowsData, event.GetCauset(int(offset), evalCtx.fieldTps[offset]))
+				if err != nil {
+					return chunk, errors.Trace(err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"context"
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/blockcodec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/oracle"
+	"github.com/whtcorpsinc/MilevaDB-Prod/expression"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/rowcodec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/MilevaDB-Prod/stochastikctx/stmtctx"
+	"github.com/whtcorpsinc/MilevaDB-Prod/types"
+	"github.com/whtcorpsinc/berolinaAllegroSQL/allegrosql"
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/fidelpb/go-fidelpb"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/metapb"
+)
+
+func (s *testRPCHandlerSuite) TestColumnarReplica(c *C) {
+	causetstore := MustNewMVCCStore()
+	cluster := NewCluster(causetstore)
+	storeID, _, regionID := BootstrapWithSingleStore(cluster)
+	ids := cluster.AllocIDs(2)
+	tiflashStoreID, tiflashPeerID := ids[0], ids[1]
+	cluster.UFIDelateStoreAddr(tiflashStoreID, "tiflash", &metapb.StoreLabel{Key: "engine", Value: "tiflash"})
+	fidelCli := NewFIDelClient(cluster).(*FIDelClient)
+
+	const blockID = int64(1)
+	intTp := types.NewFieldType(allegrosql.TypeLonglong)
+	sc := &stmtctx.StatementContext{TimeZone: time.UTC}
+	putRows := func(from, to int64) {
+		physical, logical, err := fidelCli.GetTS(context.Background())
+		c.Assert(err, IsNil)
+		startTS := oracle.ComposeTS(physical, logical)
+		var keys [][]byte
+		var muts []*kvrpcpb.Mutation
+		for i := from; i < to; i++ {
+			key := blockcodec.EncodeRowKeyWithHandle(blockID, solomonkey.IntHandle(i))
+			value, err := blockcodec.EncodeRow(sc, []types.Causet{types.NewIntCauset(i)}, []int64{2}, nil, nil, &rowcodec.Encoder{Enable: true})
+			c.Assert(err, IsNil)
+			keys = append(keys, key)
+			muts = append(muts, &kvrpcpb.Mutation{Op: kvrpcpb.Op_Put, Key: key, Value: value})
+		}
+		MustPrewriteOK(c, causetstore, muts, string(keys[0]), startTS, 3000)
+		physical, logical, err = fidelCli.GetTS(context.Background())
+		c.Assert(err, IsNil)
+		c.Assert(causetstore.Commit(keys, startTS, oracle.ComposeTS(physical, logical)), IsNil)
+	}
+	putRows(0, 10)
+
+	c.Assert(cluster.AddColumnarReplica(tiflashStoreID, blockID), IsNil)
+	c.Assert(cluster.AddColumnarReplica(storeID, blockID), NotNil)
+	// The Region isn't available until it has a Peer on the TiFlash causetstore.
+	time.Sleep(50 * time.Millisecond)
+	c.Assert(cluster.GetTiFlashReplicaProgress(blockID), Equals, float64(0))
+	cluster.AddPeer(regionID, tiflashStoreID, tiflashPeerID)
+	for i := 0; i < 100 && cluster.GetTiFlashReplicaProgress(blockID) < 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	progress, err := fidelCli.GetTiFlashReplicaProgress(context.Background(), blockID)
+	c.Assert(err, IsNil)
+	c.Assert(progress, Equals, float64(1))
+
+	// The writes after the replica is added are replicated asynchronously.
+	putRows(10, 20)
+
+	columns := []*fidelpb.DeferredCausetInfo{
+		{DeferredCausetId: 1, Tp: int32(allegrosql.TypeLonglong), PkHandle: true},
+		{DeferredCausetId: 2, Tp: int32(allegrosql.TypeLonglong)},
+	}
+	scan := &fidelpb.Executor{
+		Tp:      fidelpb.ExecType_TypeTableScan,
+		TblScan: &fidelpb.TableScan{TableId: blockID, DeferredCausets: columns},
+	}
+	// col_2 > 4
+	sel := &fidelpb.Executor{
+		Tp: fidelpb.ExecType_TypeSelection,
+		Selection: &fidelpb.Selection{Conditions: []*fidelpb.Expr{{
+			Tp:        fidelpb.ExprType_ScalarFunc,
+			Sig:       fidelpb.ScalarFuncSig_GTInt,
+			FieldType: expression.ToPBFieldType(intTp),
+			Children: []*fidelpb.Expr{
+				{Tp: fidelpb.ExprType_DeferredCausetRef, Val: codec.EncodeInt(nil, 1), FieldType: expression.ToPBFieldType(intTp)},
+				{Tp: fidelpb.ExprType_Int64, Val: codec.EncodeInt(nil, 4), FieldType: expression.ToPBFieldType(intTp)},
+			},
+		}}},
+	}
+	agg := &fidelpb.Executor{
+		Tp: fidelpb.ExecType_TypeAggregation,
+		Aggregation: &fidelpb.Aggregation{AggFunc: []*fidelpb.Expr{{
+			Tp:        fidelpb.ExprType_Count,
+			FieldType: expression.ToPBFieldType(intTp),
+			Children: []*fidelpb.Expr{
+				{Tp: fidelpb.ExprType_DeferredCausetRef, Val: codec.EncodeInt(nil, 1), FieldType: expression.ToPBFieldType(intTp)},
+			},
+		}}},
+	}
+	region, _ := cluster.GetRegion(regionID)
+	h := &rpcHandler{cluster: cluster, mvsr-oocStore: causetstore, storeID: tiflashStoreID}
+	getTS := func() uint64 {
+		physical, logical, err := fidelCli.GetTS(context.Background())
+		c.Assert(err, IsNil)
+		return oracle.ComposeTS(physical, logical)
+	}
+	// batchINTERLOCK returns the values of the output column, or the Regions to retry.
+	batchINTERLOCK := func(executors []*fidelpb.Executor, outputs int, startTS uint64) ([]types.Causet, []*metapb.Region) {
+		data, err := (&fidelpb.PosetDagRequest{Executors: executors, OutputOffsets: []uint32{0}}).Marshal()
+		c.Assert(err, IsNil)
+		client, err := h.handleBatchINTERLOCKRequest(context.Background(), &interlock.BatchRequest{
+			Data:    data,
+			StartTs: startTS,
+			Regions: []*interlock.RegionInfo{{
+				RegionId:    regionID,
+				RegionEpoch: region.RegionEpoch,
+				Ranges: []*interlock.KeyRange{{
+					Start: blockcodec.GenTableRecordPrefix(blockID),
+					End:   blockcodec.GenTableRecordPrefix(blockID).PrefixNext(),
+				}},
+			}},
+		})
+		c.Assert(err, IsNil)
+		resp, err := client.Recv()
+		c.Assert(err, IsNil)
+		c.Assert(resp.OtherError, Equals, "")
+		if len(resp.RetryRegions) > 0 {
+			return nil, resp.RetryRegions
+		}
+		var selResp fidelpb.SelectResponse
+		c.Assert(selResp.Unmarshal(resp.Data), IsNil)
+		values, err := codec.Decode(selResp.Chunks[0].RowsData, outputs)
+		c.Assert(err, IsNil)
+		return values, nil
+	}
+
+	// The request waits for the replica to catch up.
+	values, retry := batchINTERLOCK([]*fidelpb.Executor{scan, sel}, 15, getTS())
+	c.Assert(retry, HasLen, 0)
+	c.Assert(values, HasLen, 15)
+	c.Assert(values[0].GetInt64(), Equals, int64(5))
+	values, retry = batchINTERLOCK([]*fidelpb.Executor{scan, sel, agg}, 1, getTS())
+	c.Assert(retry, HasLen, 0)
+	c.Assert(values[0].GetInt64(), Equals, int64(15))
+	values, retry = batchINTERLOCK([]*fidelpb.Executor{scan, {Tp: fidelpb.ExecType_TypeLimit, Limit: &fidelpb.Limit{Limit: 3}}}, 3, getTS())
+	c.Assert(retry, HasLen, 0)
+	c.Assert(values[2].GetInt64(), Equals, int64(2))
+
+	// A lagging replica can't serve the fresh reads, the Regions are returned to retry,
+	// and the retry succeeds once the replica catches up.
+	cluster.SetColumnarReplicaLag(tiflashStoreID, time.Hour)
+	startTS := getTS()
+	_, retry = batchINTERLOCK([]*fidelpb.Executor{scan}, 20, startTS)
+	c.Assert(retry, HasLen, 1)
+	c.Assert(retry[0].GetId(), Equals, regionID)
+	c.Assert(retry[0].GetRegionEpoch(), DeepEquals, region.RegionEpoch)
+	cluster.SetColumnarReplicaLag(tiflashStoreID, 0)
+	values, retry = batchINTERLOCK([]*fidelpb.Executor{scan}, 20, startTS)
+	c.Assert(retry, HasLen, 0)
+	c.Assert(values, HasLen, 20)
+	// The plans the columnar replica doesn't support fall back to the event-based executors.
+	topN := &fidelpb.Executor{Tp: fidelpb.ExecType_TypeTopN, TopN: &fidelpb.TopN{Limit: 3}}
+	for _, executors := range [][]*fidelpb.Executor{{scan, topN}, {scan, agg, sel}} {
+		data, err := (&fidelpb.PosetDagRequest{Executors: executors, OutputOffsets: []uint32{0}}).Marshal()
+		c.Assert(err, IsNil)
+		client, err := h.handleColumnarBatchINTERLOCK(&interlock.BatchRequest{Data: data, Regions: []*interlock.RegionInfo{{RegionId: regionID}}})
+		c.Assert(err, IsNil)
+		c.Assert(client, IsNil)
+	}
+
+	// The GC safe point prunes the versions of the columnar replica invisible after it.
+	putRows(0, 5)
+	startTS = getTS()
+	key := blockcodec.EncodeRowKeyWithHandle(blockID, solomonkey.IntHandle(19))
+	MustPrewriteOK(c, causetstore, []*kvrpcpb.Mutation{{Op: kvrpcpb.Op_Del, Key: key}}, string(key), startTS, 3000)
+	c.Assert(causetstore.Commit([][]byte{key}, startTS, getTS()), IsNil)
+	values, retry = batchINTERLOCK([]*fidelpb.Executor{scan}, 19, getTS())
+	c.Assert(retry, HasLen, 0)
+	c.Assert(values, HasLen, 19)
+	b, _ := cluster.getColumnarBlock(tiflashStoreID, blockID)
+	c.Assert(b.versions[string(blockcodec.EncodeRowKeyWithHandle(blockID, solomonkey.IntHandle(0)))], HasLen, 2)
+	_, err = fidelCli.UFIDelateGCSafePoint(context.Background(), getTS())
+	c.Assert(err, IsNil)
+	c.Assert(b.keys, HasLen, 19)
+	for _, versions := range b.versions {
+		c.Assert(versions, HasLen, 1)
+	}
+	values, retry = batchINTERLOCK([]*fidelpb.Executor{scan}, 19, getTS())
+	c.Assert(retry, HasLen, 0)
+	c.Assert(values, HasLen, 19)
+
+	cluster.RemoveColumnarReplica(tiflashStoreID, blockID)
+	c.Assert(cluster.GetTiFlashReplicaProgress(blockID), Equals, float64(0))
+}
@@ -0,0 +1,62 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/keydecoder"
+	"github.com/whtcorpsinc/errors"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+)
+
+// DumpMvccByKey writes the MVCC information of the key in a readable form to w.
+func DumpMvccByKey(w io.Writer, debugger MVCCDebugger, key []byte) error {
+	return dumpMvccInfo(w, key, debugger.MvccGetByKey(key))
+}
+
+// DumpMvccByStartTS writes the MVCC information of the key written by the transaction
+// startTS in a readable form to w.
+func DumpMvccByStartTS(w io.Writer, debugger MVCCDebugger, startTS uint64) error {
+	info, key := debugger.MvccGetByStartTS(startTS)
+	if key == nil {
+		_, err := fmt.Fprintf(w, "no key is written by txn %d\n", startTS)
+		return errors.Trace(err)
+	}
+	return dumpMvccInfo(w, key, info)
+}
+
+func dumpMvccInfo(w io.Writer, key []byte, info *kvrpcpb.MvccInfo) error {
+	lines := []string{fmt.Sprintf("key: %s", keydecoder.Key(key))}
+	if info != nil {
+		if l := info.Lock; l != nil {
+			lines = append(lines, fmt.Sprintf("  lock: type=%s start_ts=%d primary=%s value=%q",
+				l.Type, l.StartTs, keydecoder.Key(l.Primary), l.ShortValue))
+		}
+		for _, wr := range info.Writes {
+			lines = append(lines, fmt.Sprintf("  write: type=%s start_ts=%d commit_ts=%d value=%q",
+				wr.Type, wr.StartTs, wr.CommitTs, wr.ShortValue))
+		}
+		for _, v := range info.Values {
+			lines = append(lines, fmt.Sprintf("  value: start_ts=%d value=%q", v.StartTs, v.Value))
+		}
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
@@ -14,9 +14,9 @@ MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, J
 package mockeinsteindb
 
 import (
-	"encoding/hex"
 	"fmt"
 
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/keydecoder"
 	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
 )
 
@@ -34,8 +34,8 @@ type ErrLocked struct {
 
 // Error formats the dagger to a string.
 func (e *ErrLocked) Error() string {
-	return fmt.Sprintf("key is locked, key: %q, primary: %q, txnStartTS: %v, forUFIDelateTs: %v, LockType: %v",
-		e.Key, e.Primary, e.StartTS, e.ForUFIDelateTS, e.LockType)
+	return fmt.Sprintf("key is locked, key: %s, primary: %s, txnStartTS: %v, forUFIDelateTs: %v, LockType: %v",
+		keydecoder.Key(e.Key.Raw()), keydecoder.Key(e.Primary), e.StartTS, e.ForUFIDelateTS, e.LockType)
 }
 
 // ErrKeyAlreadyExist is returned when key exists but this key has a constraint that
@@ -45,7 +45,21 @@ type ErrKeyAlreadyExist struct {
 }
 
 func (e *ErrKeyAlreadyExist) Error() string {
-	return fmt.Sprintf("key already exist, key: %q", e.Key)
+	return fmt.Sprintf("key already exist, key: %s", keydecoder.Key(e.Key))
+}
+
+// ErrAssertionFailed is returned when the existence of a key doesn't match the
+// assertion carried by the prewrite mutation.
+type ErrAssertionFailed struct {
+	Key              []byte
+	Assertion        kvrpcpb.Assertion
+	StartTS          uint64
+	ExistingCommitTS uint64
+}
+
+func (e *ErrAssertionFailed) Error() string {
+	return fmt.Sprintf("assertion failed, key: %s, assertion: %v, txnStartTS: %v, existingCommitTS: %v",
+		keydecoder.Key(e.Key), e.Assertion, e.StartTS, e.ExistingCommitTS)
 }
 
 // ErrRetryable suggests that client may restart the txn.
@@ -77,7 +91,7 @@ type ErrAlreadyRollbacked struct {
 }
 
 func (e *ErrAlreadyRollbacked) Error() string {
-	return fmt.Sprintf("txn=%v on key=%s is already rolled back", e.startTS, hex.EncodeToString(e.key))
+	return fmt.Sprintf("txn=%v on key=%s is already rolled back", e.startTS, keydecoder.Key(e.key))
 }
 
 // ErrConflict is returned when the commitTS of key in the EDB is greater than startTS.
@@ -127,6 +127,8 @@ func (c *FIDelClient) UFIDelateGCSafePoint(ctx context.Context, safePoint uint64
 
 	if safePoint > c.gcSafePoint {
 		c.gcSafePoint = safePoint
+		// The columnar replicas are compacted by the GC safe point.
+		c.cluster.gcColumnarReplicas(safePoint)
 	}
 	return c.gcSafePoint, nil
 }
@@ -164,11 +166,27 @@ func (c *FIDelClient) Close() {
 }
 
 func (c *FIDelClient) ScatterRegion(ctx context.Context, regionID uint64) error {
-	return nil
+	return c.cluster.ScatterRegion(regionID)
 }
 
 func (c *FIDelClient) ScatterRegionWithOption(ctx context.Context, regionID uint64, opts ...fidel.ScatterRegionOption) error {
-	return nil
+	return c.cluster.ScatterRegion(regionID)
+}
+
+// GetRegionResolvedTS returns the resolved ts of a Region.
+func (c *FIDelClient) GetRegionResolvedTS(ctx context.Context, regionID uint64) (uint64, error) {
+	return c.cluster.GetRegionResolvedTS(regionID)
+}
+
+// GetStoreSafeTS returns the minimum safe ts of the Peers on a CausetStore.
+func (c *FIDelClient) GetStoreSafeTS(ctx context.Context, storeID uint64) (uint64, error) {
+	return c.cluster.GetStoreSafeTS(storeID)
+}
+
+// GetTiFlashReplicaProgress returns the progress of the TiFlash replica of a causet,
+// which is the PROGRESS of TIFLASH_REPLICA.
+func (c *FIDelClient) GetTiFlashReplicaProgress(ctx context.Context, blockID int64) (float64, error) {
+	return c.cluster.GetTiFlashReplicaProgress(blockID), nil
 }
 
 func (c *FIDelClient) GetOperator(ctx context.Context, regionID uint64) (*FIDelpb.GetOperatorResponse, error) {
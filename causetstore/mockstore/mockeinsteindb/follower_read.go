@@ -0,0 +1,111 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/oracle"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/errorpb"
+)
+
+// DefaultFollowerReadWait is the default max time a learner read of a columnar
+// replica waits for the replica to catch up with the leader.
+const DefaultFollowerReadWait = 100 * time.Millisecond
+
+// SetPeerLag sets the replication lag of a Peer. The Peer has only applied the logs
+// committed before the lag, so a replica read or a stale read served by it fails with
+// a retryable error if the read ts is after that.
+func (c *Cluster) SetPeerLag(peerID uint64, lag time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.peerLags == nil {
+		c.peerLags = make(map[uint64]time.Duration)
+	}
+	if lag <= 0 {
+		delete(c.peerLags, peerID)
+		return
+	}
+	c.peerLags[peerID] = lag
+}
+
+// GetPeerLag returns the replication lag of a Peer.
+func (c *Cluster) GetPeerLag(peerID uint64) time.Duration {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.peerLags[peerID]
+}
+
+// SetFollowerReadWait sets the max time a learner read of a columnar replica waits for
+// the replica to catch up with the leader, 0 restores DefaultFollowerReadWait.
+func (c *Cluster) SetFollowerReadWait(wait time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.followerReadWait = wait
+}
+
+func (c *Cluster) getFollowerReadWait() time.Duration {
+	c.RLock()
+	defer c.RUnlock()
+
+	if c.followerReadWait <= 0 {
+		return DefaultFollowerReadWait
+	}
+	return c.followerReadWait
+}
+
+// GetPeerAppliedTS returns the ts before which the Peer has applied all the committed
+// logs. It's the TSO progress, a lagging Peer falls behind by its replication lag.
+func (c *Cluster) GetPeerAppliedTS(peerID uint64) uint64 {
+	appliedTS := tsoProgress()
+	if lag := c.GetPeerLag(peerID); lag > 0 {
+		if lagTS := oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(-lag)), 0); lagTS < appliedTS {
+			appliedTS = lagTS
+		}
+	}
+	return appliedTS
+}
+
+// replicaReadTS returns the read ts of a replica read request, ok is false if the
+// request isn't one. Only the read commands can be served by a follower, the replica
+// read flag of the other commands is ignored.
+func replicaReadTS(req *einsteindbrpc.Request) (ts uint64, ok bool) {
+	if !req.Context.GetReplicaRead() {
+		return 0, false
+	}
+	return readTS(req)
+}
+
+// checkFollowerRead simulates the read index of a replica read served by the Peer.
+// It returns ServerIsBusy if the follower hasn't applied the logs before the read ts,
+// so the client can back off and retry another replica or the leader.
+func (h *rpcHandler) checkFollowerRead(peerID uint64) *errorpb.Error {
+	appliedTS := h.cluster.GetPeerAppliedTS(peerID)
+	if h.replicaReadTS <= appliedTS {
+		return nil
+	}
+	return &errorpb.Error{
+		Message: *proto.String("read index timeout"),
+		ServerIsBusy: &errorpb.ServerIsBusy{
+			Reason:    fmt.Sprintf("replica read ts %d exceeds applied ts %d", h.replicaReadTS, appliedTS),
+			BackoffMs: uint64(h.cluster.GetPeerLag(peerID).Milliseconds()),
+		},
+	}
+}
@@ -0,0 +1,62 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"context"
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/oracle"
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+)
+
+func (s *testRPCHandlerSuite) TestFollowerRead(c *C) {
+	cluster := NewCluster(MustNewMVCCStore())
+	storeIDs, peerIDs, regionID, _ := BootstrapWithMultiStores(cluster, 2)
+	region, _ := cluster.GetRegion(regionID)
+	physical, logical, err := NewFIDelClient(cluster).GetTS(context.Background())
+	c.Assert(err, IsNil)
+	readTS := oracle.ComposeTS(physical, logical)
+	reqCtx := kvrpcpb.Context{
+		RegionId:    regionID,
+		RegionEpoch: region.RegionEpoch,
+		Peer:        region.Peers[1],
+	}
+	h := &rpcHandler{cluster: cluster, storeID: storeIDs[1]}
+	c.Assert(h.checkRequestContext(&reqCtx).GetNotLeader(), NotNil)
+
+	// Only the read commands are replica reads.
+	reqCtx.ReplicaRead = true
+	get := einsteindbrpc.NewRequest(einsteindbrpc.CmdGet, &kvrpcpb.GetRequest{Key: []byte("a"), Version: readTS}, reqCtx)
+	prewrite := einsteindbrpc.NewRequest(einsteindbrpc.CmdPrewrite, &kvrpcpb.PrewriteRequest{StartVersion: readTS}, reqCtx)
+	_, ok := replicaReadTS(prewrite)
+	c.Assert(ok, IsFalse)
+	h.replicaReadTS, h.replicaRead = replicaReadTS(get)
+	c.Assert(h.replicaRead, IsTrue)
+	c.Assert(h.replicaReadTS, Equals, readTS)
+	c.Assert(h.checkRequestContext(&reqCtx), IsNil)
+
+	// A lagging follower serves the reads before its applied ts.
+	cluster.SetPeerLag(peerIDs[1], time.Hour)
+	c.Assert(cluster.GetPeerAppliedTS(peerIDs[1]) < readTS, IsTrue)
+	c.Assert(h.checkRequestContext(&reqCtx).GetServerIsBusy(), NotNil)
+	h.replicaReadTS = oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(-2*time.Hour)), 0)
+	c.Assert(h.checkRequestContext(&reqCtx), IsNil)
+
+	cluster.SetPeerLag(peerIDs[1], 0)
+	h.replicaReadTS = readTS
+	c.Assert(h.checkRequestContext(&reqCtx), IsNil)
+}
@@ -0,0 +1,75 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/dataversion"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
+)
+
+// BumpRegionDataVersion records a write to the Region, commitTS is the max commit ts
+// of the write, 0 if it commits nothing.
+func (c *Cluster) BumpRegionDataVersion(regionID, commitTS uint64) {
+	c.Lock()
+	defer c.Unlock()
+
+	if r := c.regions[regionID]; r != nil {
+		r.dataVersion.Bump(commitTS)
+	}
+}
+
+func (c *Cluster) getRegionDataVersion(regionID uint64) (dataversion.RegionVersion, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	r := c.regions[regionID]
+	if r == nil {
+		return dataversion.RegionVersion{}, false
+	}
+	return r.dataVersion, true
+}
+
+// handleCacheablePosetDagRequest handles a PosetDag request for the interlock result
+// cache of the client. Only the requests with the cache enabled are checked.
+//
+// A result can be cached with the data version of the Region if no key in the Region
+// is locked and the result is read after the last commit. The cached result is valid
+// as long as the version doesn't change, a request carrying it gets a cache hit
+// without being executed.
+func (h *rpcHandler) handleCacheablePosetDagRequest(req *interlock.Request) *interlock.Response {
+	if !req.IsCacheEnabled {
+		return h.handleCoFIDelAGRequest(req)
+	}
+	// The version is read before the request is executed, a write during the execution
+	// changes it so the result won't be reused.
+	dataVersion, ok := h.cluster.getRegionDataVersion(req.GetContext().GetRegionId())
+	if !ok {
+		return h.handleCoFIDelAGRequest(req)
+	}
+	_, locked, err := storeMinLockTS(h.mvsr-oocStore, h.rawStartKey, h.rawEndKey)
+	if err != nil {
+		return &interlock.Response{OtherError: err.Error()}
+	}
+	cacheable := !locked && req.StartTs >= dataVersion.MaxCommitTS
+	if cacheable && req.CacheIfMatchVersion == dataVersion.Version {
+		return &interlock.Response{IsCacheHit: true, CacheLastVersion: dataVersion.Version}
+	}
+	resp := h.handleCoFIDelAGRequest(req)
+	// A paging response only holds a part of the result.
+	if cacheable && resp.RegionError == nil && resp.Locked == nil && resp.OtherError == "" && resp.Range == nil {
+		resp.CanBeCached = true
+		resp.CacheLastVersion = dataVersion.Version
+	}
+	return resp
+}
@@ -0,0 +1,117 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package mockeinsteindb
+
+import (
+	"context"
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/blockcodec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/berolinaAllegroSQL/allegrosql"
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/fidelpb/go-fidelpb"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+)
+
+func (s *testRPCHandlerSuite) TestINTERLOCKCacheDataVersion(c *C) {
+	causetstore := MustNewMVCCStore()
+	cluster := NewCluster(causetstore)
+	storeID, _, regionID := BootstrapWithSingleStore(cluster)
+	region, _ := cluster.GetRegion(regionID)
+	client := NewRPCClient(cluster, causetstore)
+	defer client.Close()
+	addr := cluster.GetStore(storeID).GetAddress()
+	reqCtx := kvrpcpb.Context{RegionId: regionID, RegionEpoch: region.RegionEpoch, Peer: region.Peers[0]}
+	send := func(tp einsteindbrpc.CmdType, req interface{}) interface{} {
+		resp, err := client.SendRequest(context.Background(), addr, einsteindbrpc.NewRequest(tp, req, reqCtx), time.Second)
+		c.Assert(err, IsNil)
+		return resp.Resp
+	}
+
+	const blockID = int64(1)
+	data, err := (&fidelpb.PosetDagRequest{
+		Executors: []*fidelpb.Executor{{
+			Tp: fidelpb.ExecType_TypeTableScan,
+			TblScan: &fidelpb.TableScan{TableId: blockID, DeferredCausets: []*fidelpb.DeferredCausetInfo{
+				{DeferredCausetId: 1, Tp: int32(allegrosql.TypeLonglong), PkHandle: true},
+			}},
+		}},
+		OutputOffsets: []uint32{0},
+	}).Marshal()
+	c.Assert(err, IsNil)
+	start, end := blockcodec.GenTableRecordPrefix(blockID), blockcodec.GenTableRecordPrefix(blockID).PrefixNext()
+	posetDag := func(startTS uint64, cacheEnabled bool, version uint64) *interlock.Response {
+		return send(einsteindbrpc.CmdINTERLOCK, &interlock.Request{
+			Tp:                  solomonkey.ReqTypePosetDag,
+			Data:                data,
+			StartTs:             startTS,
+			Ranges:              []*interlock.KeyRange{{Start: start, End: end}},
+			IsCacheEnabled:      cacheEnabled,
+			CacheIfMatchVersion: version,
+		}).(*interlock.Response)
+	}
+
+	key := blockcodec.EncodeRowKeyWithHandle(blockID, solomonkey.IntHandle(1))
+	send(einsteindbrpc.CmdPrewrite, &kvrpcpb.PrewriteRequest{
+		Mutations:    []*kvrpcpb.Mutation{{Op: kvrpcpb.Op_Put, Key: key, Value: []byte("v")}},
+		PrimaryLock:  key,
+		StartVersion: 10,
+		LockTtl:      3000,
+	})
+	// A locked Region can't be cached.
+	resp := posetDag(15, true, 0)
+	c.Assert(resp.CanBeCached, IsFalse)
+	send(einsteindbrpc.CmdCommit, &kvrpcpb.CommitRequest{Keys: [][]byte{key}, StartVersion: 10, CommitVersion: 20})
+
+	// A result read before the last commit can't be cached.
+	resp = posetDag(15, true, 0)
+	c.Assert(resp.CanBeCached, IsFalse)
+	resp = posetDag(25, true, 0)
+	c.Assert(resp.CanBeCached, IsTrue)
+	version := resp.CacheLastVersion
+	c.Assert(version, Not(Equals), uint64(0))
+	resp = posetDag(30, true, version)
+	c.Assert(resp.IsCacheHit, IsTrue)
+	// The requests without the cache enabled aren't checked.
+	resp = posetDag(30, false, 0)
+	c.Assert(resp.CanBeCached, IsFalse)
+	c.Assert(resp.CacheLastVersion, Equals, uint64(0))
+
+	// Deleting a range changes the version.
+	send(einsteindbrpc.CmdDeleteRange, &kvrpcpb.DeleteRangeRequest{StartKey: start, EndKey: end})
+	resp = posetDag(35, true, version)
+	c.Assert(resp.IsCacheHit, IsFalse)
+	c.Assert(resp.CanBeCached, IsTrue)
+	c.Assert(resp.CacheLastVersion > version, IsTrue)
+
+	// So does resolving a batch of transactions, a result read before their commit
+	// can't be cached.
+	version = resp.CacheLastVersion
+	key = blockcodec.EncodeRowKeyWithHandle(blockID, solomonkey.IntHandle(2))
+	send(einsteindbrpc.CmdPrewrite, &kvrpcpb.PrewriteRequest{
+		Mutations:    []*kvrpcpb.Mutation{{Op: kvrpcpb.Op_Put, Key: key, Value: []byte("v")}},
+		PrimaryLock:  key,
+		StartVersion: 40,
+		LockTtl:      3000,
+	})
+	send(einsteindbrpc.CmdResolveLock, &kvrpcpb.ResolveLockRequest{TxnInfos: []*kvrpcpb.TxnInfo{{Txn: 40, Status: 50}}})
+	resp = posetDag(45, true, version)
+	c.Assert(resp.IsCacheHit, IsFalse)
+	c.Assert(resp.CanBeCached, IsFalse)
+	resp = posetDag(55, true, version)
+	c.Assert(resp.CanBeCached, IsTrue)
+	c.Assert(resp.CacheLastVersion > version, IsTrue)
+}
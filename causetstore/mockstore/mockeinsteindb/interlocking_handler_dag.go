@@ -39,6 +39,7 @@ import (
 	"github.com/whtcorpsinc/solomonkeyproto/pkg/errorpb"
 	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
 	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/metapb"
 	"github.com/whtcorpsinc/errors"
 	"github.com/whtcorpsinc/fidelpb/go-fidelpb"
 	"google.golang.org/grpc"
@@ -52,6 +53,8 @@ type posetPosetDagContext struct {
 	keyRanges        []*interlock.KeyRange
 	startTS          uint64
 	evalCtx          *evalContext
+	pagingSize       uint64
+	pagingBytes      uint64
 }
 
 func (h *rpcHandler) handleCoFIDelAGRequest(req *interlock.Request) *interlock.Response {
@@ -64,7 +67,11 @@ func (h *rpcHandler) handleCoFIDelAGRequest(req *interlock.Request) *interlock.R
 
 	var rows [][][]byte
 	ctx := context.TODO()
-	for {
+	page := newPagingBudget(posetPosetDagCtx, e)
+	var ran interlock.KeyRange
+	var desc bool
+	ran.Start, desc = e.Cursor()
+	for !page.full() {
 		var event [][]byte
 		event, err = e.Next(ctx)
 		if err != nil {
@@ -74,6 +81,7 @@ func (h *rpcHandler) handleCoFIDelAGRequest(req *interlock.Request) *interlock.R
 			break
 		}
 		rows = append(rows, event)
+		page.add(event, posetPosetDagReq.OutputOffsets)
 	}
 
 	var execDetails []*execDetail
@@ -85,19 +93,78 @@ func (h *rpcHandler) handleCoFIDelAGRequest(req *interlock.Request) *interlock.R
 	if err == nil {
 		err = h.fillUFIDelata4SelectResponse(selResp, posetPosetDagReq, posetPosetDagCtx, rows)
 	}
-	return buildResp(selResp, execDetails, err)
+	resp = buildResp(selResp, execDetails, err)
+	if err == nil && page.full() {
+		// The page is full, return the range it scanned for the client to resume after it.
+		ran.End, _ = e.Cursor()
+		if desc {
+			ran.Start, ran.End = ran.End, ran.Start
+		}
+		resp.Range = &ran
+	}
+	return resp
+}
+
+// pagingBudget tracks the rows and bytes of a page of a paging request.
+type pagingBudget struct {
+	maxRows  uint64
+	maxBytes uint64
+	rows     uint64
+	bytes    uint64
+}
+
+// newPagingBudget returns the budget of the request of ctx, or nil if it's not
+// paged. Only the plans that produce rows as they scan can be paged, the
+// aggregations and topN need the whole range.
+func newPagingBudget(ctx *posetPosetDagContext, e executor) *pagingBudget {
+	if ctx.pagingSize == 0 && ctx.pagingBytes == 0 {
+		return nil
+	}
+	switch e.(type) {
+	case *blockScanExec, *indexScanExec, *selectionExec, *limitExec:
+	default:
+		return nil
+	}
+	return &pagingBudget{maxRows: ctx.pagingSize, maxBytes: ctx.pagingBytes}
+}
+
+func (p *pagingBudget) add(event [][]byte, outputOffsets []uint32) {
+	if p == nil {
+		return
+	}
+	p.rows++
+	for _, offset := range outputOffsets {
+		p.bytes += uint64(len(event[offset]))
+	}
+}
+
+func (p *pagingBudget) full() bool {
+	if p == nil {
+		return false
+	}
+	return (p.maxRows > 0 && p.rows >= p.maxRows) || (p.maxBytes > 0 && p.bytes >= p.maxBytes)
 }
 
 func (h *rpcHandler) buildPosetDagExecutor(req *interlock.Request) (*posetPosetDagContext, executor, *fidelpb.PosetDagRequest, error) {
 	if len(req.Ranges) == 0 {
 		return nil, nil, nil, errors.New("request range is null")
 	}
-	if req.GetTp() != solomonkey.ReqTypePosetDag {
+	data := req.Data
+	var pagingSize, pagingBytes uint64
+	switch req.GetTp() {
+	case solomonkey.ReqTypePosetDag:
+	case solomonkey.ReqTypePagingPosetDag:
+		var err error
+		data, pagingSize, pagingBytes, err = solomonkey.DecodePagingRequest(req.Data)
+		if err != nil {
+			return nil, nil, nil, errors.Trace(err)
+		}
+	default:
 		return nil, nil, nil, errors.Errorf("unsupported request type %d", req.GetTp())
 	}
 
 	posetPosetDagReq := new(fidelpb.PosetDagRequest)
-	err := proto.Unmarshal(req.Data, posetPosetDagReq)
+	err := proto.Unmarshal(data, posetPosetDagReq)
 	if err != nil {
 		return nil, nil, nil, errors.Trace(err)
 	}
@@ -113,6 +180,8 @@ func (h *rpcHandler) buildPosetDagExecutor(req *interlock.Request) (*posetPosetD
 		keyRanges:        req.Ranges,
 		startTS:          req.StartTs,
 		evalCtx:          &evalContext{sc: sc},
+		pagingSize:       pagingSize,
+		pagingBytes:      pagingBytes,
 	}
 	var e executor
 	if len(posetPosetDagReq.Executors) == 0 {
@@ -219,12 +288,32 @@ func (h *rpcHandler) buildTableScan(ctx *posetPosetDagContext, executor *fidelpb
 	if startTS == 0 {
 		startTS = ctx.posetPosetDagReq.GetStartTsFallback()
 	}
+	e := &blockScanExec{
+		TableScan:      executor.TblScan,
+		kvRanges:       ranges,
+		colIDs:         ctx.evalCtx.colIDs,
+		startTS:        startTS,
+		isolationLevel: h.isolationLevel,
+		resolvedLocks:  h.resolvedLocks,
+		mvsr-oocStore:      h.mvsr-oocStore,
+		execDetail:     new(execDetail),
+		rd:             newRowBytesDecoder(columns, ctx.evalCtx),
+	}
+
+	if ctx.posetPosetDagReq.DefCauslectRangeCounts != nil && *ctx.posetPosetDagReq.DefCauslectRangeCounts {
+		e.counts = make([]int64, len(ranges))
+	}
+	return e, nil
+}
+
+// newRowBytesDecoder creates the decoder of the event values for the scanned columns.
+func newRowBytesDecoder(columns []*fidelpb.DeferredCausetInfo, evalCtx *evalContext) *rowcodec.BytesDecoder {
 	colInfos := make([]rowcodec.DefCausInfo, len(columns))
 	for i := range colInfos {
 		col := columns[i]
 		colInfos[i] = rowcodec.DefCausInfo{
 			ID:         col.DeferredCausetId,
-			Ft:         ctx.evalCtx.fieldTps[i],
+			Ft:         evalCtx.fieldTps[i],
 			IsPKHandle: col.GetPkHandle(),
 		}
 	}
@@ -239,23 +328,7 @@ func (h *rpcHandler) buildTableScan(ctx *posetPosetDagContext, executor *fidelpb
 		}
 		return col.DefaultVal, nil
 	}
-	rd := rowcodec.NewByteDecoder(colInfos, []int64{-1}, defVal, nil)
-	e := &blockScanExec{
-		TableScan:      executor.TblScan,
-		kvRanges:       ranges,
-		colIDs:         ctx.evalCtx.colIDs,
-		startTS:        startTS,
-		isolationLevel: h.isolationLevel,
-		resolvedLocks:  h.resolvedLocks,
-		mvsr-oocStore:      h.mvsr-oocStore,
-		execDetail:     new(execDetail),
-		rd:             rd,
-	}
-
-	if ctx.posetPosetDagReq.DefCauslectRangeCounts != nil && *ctx.posetPosetDagReq.DefCauslectRangeCounts {
-		e.counts = make([]int64, len(ranges))
-	}
-	return e, nil
+	return rowcodec.NewByteDecoder(colInfos, []int64{-1}, defVal, nil)
 }
 
 func (h *rpcHandler) buildIndexScan(ctx *posetPosetDagContext, executor *fidelpb.Executor) (*indexScanExec, error) {
@@ -536,6 +609,20 @@ func (mock *mockBathINTERLOCKErrClient) Recv() (*interlock.BatchResponse, error)
 	}, nil
 }
 
+// mockBatchINTERLOCKRetryClient returns the Regions the causetstore can't serve now, the
+// client retries them.
+type mockBatchINTERLOCKRetryClient struct {
+	mockClientStream
+
+	regions []*metapb.Region
+}
+
+func (mock *mockBatchINTERLOCKRetryClient) Recv() (*interlock.BatchResponse, error) {
+	return &interlock.BatchResponse{
+		RetryRegions: mock.regions,
+	}, nil
+}
+
 type mockBatchCoFIDelataClient struct {
 	mockClientStream
 
@@ -14,17 +14,27 @@ MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, J
 package mockeinsteindb
 
 import (
+	"path/filepath"
+
 	fidel "github.com/einsteindb/fidel/client"
 	"github.com/whtcorpsinc/errors"
 )
 
 // NewEinsteinDBAndFIDelClient creates a EinsteinDB client and FIDel client from options.
+// If path is not empty, the topology of the cluster is persisted next to the data and
+// restored when the path is opened again, see Cluster.Restored.
 func NewEinsteinDBAndFIDelClient(path string) (*RPCClient, *Cluster, fidel.Client, error) {
 	mvsr-oocStore, err := NewMVCCLevelDB(path)
 	if err != nil {
 		return nil, nil, nil, errors.Trace(err)
 	}
 	cluster := NewCluster(mvsr-oocStore)
+	if path != "" {
+		if err = cluster.PersistLayout(filepath.Join(path, ClusterLayoutFile)); err != nil {
+			mvsr-oocStore.Close()
+			return nil, nil, nil, errors.Trace(err)
+		}
+	}
 
 	return NewRPCClient(cluster, mvsr-oocStore), cluster, NewFIDelClient(cluster), nil
 }
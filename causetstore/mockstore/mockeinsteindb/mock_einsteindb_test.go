@@ -17,6 +17,7 @@ import (
 	"math"
 	"testing"
 
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
 	. "github.com/whtcorpsinc/check"
 	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
 	"github.com/whtcorpsinc/errors"
@@ -679,7 +680,9 @@ func (s testMarshal) TestMarshalmvsr-oocValue(c *C) {
 }
 
 func (s *testMVCCLevelDB) TestErrors(c *C) {
-	c.Assert((&ErrKeyAlreadyExist{}).Error(), Equals, `key already exist, key: ""`)
+	c.Assert((&ErrKeyAlreadyExist{}).Error(), Equals, `key already exist, key: `)
+	c.Assert((&ErrKeyAlreadyExist{Key: []byte("t\x80\x00\x00\x00\x00\x00\x00\x01_r\x80\x00\x00\x00\x00\x00\x00\x02")}).Error(), Equals,
+		`key already exist, key: record{causet_id=1 handle=2}(7480000000000000015F728000000000000002)`)
 	c.Assert(ErrAbort("txn").Error(), Equals, "abort: txn")
 	c.Assert(ErrAlreadyCommitted(0).Error(), Equals, "txn already committed")
 	c.Assert((&ErrConflict{}).Error(), Equals, "write conflict")
@@ -795,3 +798,110 @@ func (s *testMVCCLevelDB) TestTxnHeartBeat(c *C) {
 	_, err = s.causetstore.TxnHeartBeat([]byte("pk"), 5, 1000)
 	c.Assert(err, NotNil)
 }
+
+func (s *testMockEinsteinDBSuite) TestPrewriteAssertion(c *C) {
+	s.mustPutOK(c, "exist", "v", 5, 10)
+	s.mustPutOK(c, "deleted", "v", 5, 10)
+	s.mustDeleteOK(c, "deleted", 15, 20)
+
+	prewrite := func(key string, assertion kvrpcpb.Assertion, startTS uint64) error {
+		req := &kvrpcpb.PrewriteRequest{
+			Mutations: []*kvrpcpb.Mutation{{
+				Op:        kvrpcpb.Op_Put,
+				Key:       []byte(key),
+				Value:     []byte("new"),
+				Assertion: assertion,
+			}},
+			PrimaryLock:  []byte(key),
+			StartVersion: startTS,
+		}
+		errs := s.causetstore.Prewrite(req)
+		c.Assert(errs, HasLen, 1)
+		return errs[0]
+	}
+
+	err := prewrite("exist", kvrpcpb.Assertion_NotExist, 30)
+	c.Assert(err, NotNil)
+	assertionErr, ok := err.(*ErrAssertionFailed)
+	c.Assert(ok, IsTrue)
+	c.Assert(assertionErr.ExistingCommitTS, Equals, uint64(10))
+	err = prewrite("deleted", kvrpcpb.Assertion_Exist, 30)
+	_, ok = err.(*ErrAssertionFailed)
+	c.Assert(ok, IsTrue)
+	err = prewrite("none", kvrpcpb.Assertion_Exist, 30)
+	_, ok = err.(*ErrAssertionFailed)
+	c.Assert(ok, IsTrue)
+
+	c.Assert(prewrite("exist", kvrpcpb.Assertion_Exist, 30), IsNil)
+	c.Assert(prewrite("deleted", kvrpcpb.Assertion_NotExist, 30), IsNil)
+	c.Assert(prewrite("none", kvrpcpb.Assertion_NotExist, 30), IsNil)
+
+	// A key locked by another transaction reports the dagger rather than the assertion.
+	err = prewrite("exist", kvrpcpb.Assertion_NotExist, 40)
+	_, ok = err.(*ErrLocked)
+	c.Assert(ok, IsTrue, Commentf("%v", err))
+
+	// An empty value exists.
+	s.mustPutOK(c, "empty", "", 5, 10)
+	err = prewrite("empty", kvrpcpb.Assertion_NotExist, 30)
+	_, ok = err.(*ErrAssertionFailed)
+	c.Assert(ok, IsTrue)
+
+	// The failed assertion reaches the client as a structured error.
+	keyErr := convertToKeyError(err)
+	e, ok := solomonkey.ExtractAssertionFailedError(nil, keyErr.Abort)
+	c.Assert(ok, IsTrue)
+	c.Assert(e.Key, BytesEquals, []byte("empty"))
+	c.Assert(e.Assertion, Equals, solomonkey.NotExist)
+	c.Assert(e.ExistingCommitTS, Equals, uint64(10))
+}
+
+func (s *testMVCCLevelDB) TestInspectReadOnly(c *C) {
+	dir := c.MkDir()
+	causetstore, err := NewMVCCLevelDB(dir)
+	c.Assert(err, IsNil)
+	s.causetstore = causetstore
+	s.mustPutOK(c, "a", "v1", 5, 10)
+	s.mustPutOK(c, "b", "v2", 15, 20)
+	s.mustPrewriteOK(c, putMutations("c", "v3"), "c", 25)
+	s.mustRollbackOK(c, [][]byte{[]byte("d")}, 30)
+	c.Assert(causetstore.Close(), IsNil)
+
+	ro, err := OpenMVCCLevelDBReadOnly(dir)
+	c.Assert(err, IsNil)
+	defer ro.Close()
+	c.Assert(ro.EDB.Put([]byte("x"), []byte("y"), nil), NotNil)
+
+	keys, err := ro.ScanMvccKeys(nil, nil, 0)
+	c.Assert(err, IsNil)
+	c.Assert(keys, DeepEquals, [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")})
+	keys, err = ro.ScanMvccKeys([]byte("b"), []byte("d"), 0)
+	c.Assert(err, IsNil)
+	c.Assert(keys, DeepEquals, [][]byte{[]byte("b"), []byte("c")})
+	keys, err = ro.ScanMvccKeys(nil, nil, 1)
+	c.Assert(err, IsNil)
+	c.Assert(keys, DeepEquals, [][]byte{[]byte("a")})
+
+	info, err := ro.GetTxnInfo(5)
+	c.Assert(err, IsNil)
+	c.Assert(info.State, Equals, TxnStateCommitted)
+	c.Assert(info.CommitTS, Equals, uint64(10))
+	c.Assert(info.WrittenKeys, DeepEquals, [][]byte{[]byte("a")})
+	info, err = ro.GetTxnInfo(25)
+	c.Assert(err, IsNil)
+	c.Assert(info.State, Equals, TxnStateLocked)
+	c.Assert(info.Primary, DeepEquals, []byte("c"))
+	info, err = ro.GetTxnInfo(30)
+	c.Assert(err, IsNil)
+	c.Assert(info.State, Equals, TxnStateRolledBack)
+	info, err = ro.GetTxnInfo(99)
+	c.Assert(err, IsNil)
+	c.Assert(info.State, Equals, TxnStateNotFound)
+
+	exported, err := ro.ExportRange([]byte("a"), []byte("b"), 0)
+	c.Assert(err, IsNil)
+	c.Assert(exported, DeepEquals, []*ExportedKey{{
+		Key:      "61",
+		Versions: []ExportedVersion{{Type: "Put", StartTS: 5, CommitTS: 10, Value: "7631"}},
+	}})
+}
@@ -20,6 +20,7 @@ import (
 	"math"
 
 	"github.com/google/btree"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
 	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
 	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
 	"github.com/whtcorpsinc/errors"
@@ -286,6 +287,33 @@ type RawKV interface {
 	RawDeleteRange(startKey, endKey []byte)
 }
 
+// RawKVExt extends RawKV with column families, per-key TTL, compare-and-swap and batch
+// scan. The methods of RawKV work on the default column family. A TTL is in seconds and
+// 0 means the key never expires. An expired key is invisible, and it's removed by the
+// next write of it.
+type RawKVExt interface {
+	RawKV
+	RawGetCF(cf string, key []byte) []byte
+	RawBatchGetCF(cf string, keys [][]byte) [][]byte
+	RawScanCF(cf string, startKey, endKey []byte, limit int) []Pair        // Scan the range of [startKey, endKey)
+	RawReverseScanCF(cf string, startKey, endKey []byte, limit int) []Pair // Scan the range of [endKey, startKey)
+	// RawBatchScanCF scans at most eachLimit pairs from each range.
+	RawBatchScanCF(cf string, ranges []solomonkey.KeyRange, eachLimit int) []Pair
+	RawPutCF(cf string, key, value []byte, ttl uint64)
+	RawBatchPutCF(cf string, keys, values [][]byte, ttl uint64)
+	RawDeleteCF(cf string, key []byte)
+	RawBatchDeleteCF(cf string, keys [][]byte)
+	RawDeleteRangeCF(cf string, startKey, endKey []byte)
+	// RawGetKeyTTL returns the remaining TTL of the key, found is false if the key
+	// doesn't exist. A key with an empty value doesn't exist, like in RawGet.
+	RawGetKeyTTL(cf string, key []byte) (ttl uint64, found bool)
+	// RawCompareAndSwap sets the key to value if its current value equals to expected,
+	// a nil expected means the key should not exist. It returns the value before the
+	// swap and whether the swap happened, the previous value is nil if the key doesn't
+	// exist or has an empty value.
+	RawCompareAndSwap(cf string, key, expected, value []byte, ttl uint64) (previous []byte, swapped bool)
+}
+
 // MVCCDebugger is for debugging.
 type MVCCDebugger interface {
 	MvccGetByStartTS(starTS uint64) (*kvrpcpb.MvccInfo, []byte)
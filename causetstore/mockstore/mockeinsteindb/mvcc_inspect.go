@@ -0,0 +1,225 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+
+	"github.com/whtcorpsinc/errors"
+	"github.com/whtcorpsinc/goleveldb/leveldb"
+	"github.com/whtcorpsinc/goleveldb/leveldb/opt"
+	"github.com/whtcorpsinc/goleveldb/leveldb/soliton"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+)
+
+// OpenMVCCLevelDBReadOnly opens the MVCCLevelDB persisted in path in read-only mode,
+// it's used to inspect the data left by a test. Any write to the returned store fails.
+func OpenMVCCLevelDBReadOnly(path string) (*MVCCLevelDB, error) {
+	d, err := leveldb.OpenFile(path, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &MVCCLevelDB{EDB: d}, nil
+}
+
+// ScanMvccKeys returns at most limit distinct keys in [startKey, endKey) which have
+// a dagger or any version, a key which only has rollback records is returned too.
+// An empty endKey means no upper bound, a non-positive limit means no limit.
+func (mvsr-ooc *MVCCLevelDB) ScanMvccKeys(startKey, endKey []byte, limit int) ([][]byte, error) {
+	mvsr-ooc.mu.RLock()
+	defer mvsr-ooc.mu.RUnlock()
+
+	r := &soliton.Range{Start: mvsr-oocEncode(startKey, lockVer)}
+	if len(endKey) > 0 {
+		r.Limit = mvsr-oocEncode(endKey, lockVer)
+	}
+	iter := newIterator(mvsr-ooc.EDB, r)
+	defer iter.Release()
+
+	var keys [][]byte
+	for ; iter.Valid() && (limit <= 0 || len(keys) < limit); iter.Next() {
+		key, _, err := mvsr-oocDecode(iter.Key())
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if len(keys) > 0 && bytes.Equal(keys[len(keys)-1], key) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, errors.Trace(iter.Error())
+}
+
+// TxnState is the state of a transaction found in the MVCCLevelDB.
+type TxnState int
+
+// TxnState values.
+const (
+	TxnStateNotFound TxnState = iota
+	TxnStateLocked
+	TxnStateCommitted
+	TxnStateRolledBack
+)
+
+// String implements fmt.Stringer interface.
+func (s TxnState) String() string {
+	switch s {
+	case TxnStateLocked:
+		return "locked"
+	case TxnStateCommitted:
+		return "committed"
+	case TxnStateRolledBack:
+		return "rolled back"
+	}
+	return "not found"
+}
+
+// TxnInfo describes the keys written by a transaction and its state.
+type TxnInfo struct {
+	StartTS  uint64
+	State    TxnState
+	CommitTS uint64
+	// Primary is only known when the transaction still holds a dagger.
+	Primary []byte
+	// LockedKeys are the keys still locked by the transaction.
+	LockedKeys [][]byte
+	// WrittenKeys are the keys which have a committed version or a rollback record of
+	// the transaction.
+	WrittenKeys [][]byte
+}
+
+// GetTxnInfo scans the whole MVCCLevelDB for the locks and versions written by the
+// transaction startTS. A transaction which has both locks and committed keys is in
+// the middle of committing secondaries, its state is TxnStateCommitted.
+func (mvsr-ooc *MVCCLevelDB) GetTxnInfo(startTS uint64) (*TxnInfo, error) {
+	mvsr-ooc.mu.RLock()
+	defer mvsr-ooc.mu.RUnlock()
+
+	iter := newIterator(mvsr-ooc.EDB, nil)
+	defer iter.Release()
+
+	info := &TxnInfo{StartTS: startTS}
+	var rolledBack bool
+	for ; iter.Valid(); iter.Next() {
+		key, ver, err := mvsr-oocDecode(iter.Key())
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if ver == lockVer {
+			var dagger mvsr-oocLock
+			if err = dagger.UnmarshalBinary(iter.Value()); err != nil {
+				return nil, errors.Trace(err)
+			}
+			if dagger.startTS == startTS {
+				info.Primary = dagger.primary
+				info.LockedKeys = append(info.LockedKeys, key)
+			}
+			continue
+		}
+		var value mvsr-oocValue
+		if err = value.UnmarshalBinary(iter.Value()); err != nil {
+			return nil, errors.Trace(err)
+		}
+		if value.startTS != startTS {
+			continue
+		}
+		info.WrittenKeys = append(info.WrittenKeys, key)
+		if value.valueType == typeRollback {
+			rolledBack = true
+		} else {
+			info.CommitTS = value.commitTS
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	switch {
+	case info.CommitTS != 0:
+		info.State = TxnStateCommitted
+	case len(info.LockedKeys) > 0:
+		info.State = TxnStateLocked
+	case rolledBack:
+		info.State = TxnStateRolledBack
+	}
+	return info, nil
+}
+
+// ExportedVersion is a version of a key in ExportedKey.
+type ExportedVersion struct {
+	Type     string `json:"type"`
+	StartTS  uint64 `json:"start_ts"`
+	CommitTS uint64 `json:"commit_ts"`
+	Value    string `json:"value,omitempty"`
+}
+
+// ExportedLock is the dagger of a key in ExportedKey.
+type ExportedLock struct {
+	Type    string `json:"type"`
+	StartTS uint64 `json:"start_ts"`
+	Primary string `json:"primary"`
+	Value   string `json:"value,omitempty"`
+}
+
+// ExportedKey is the JSON friendly form of the MVCC information of a key, the keys
+// and the values are in upper case hex.
+type ExportedKey struct {
+	Key      string            `json:"key"`
+	Lock     *ExportedLock     `json:"lock,omitempty"`
+	Versions []ExportedVersion `json:"versions,omitempty"`
+}
+
+// ExportRange returns the MVCC information of at most limit keys in [startKey, endKey).
+func (mvsr-ooc *MVCCLevelDB) ExportRange(startKey, endKey []byte, limit int) ([]*ExportedKey, error) {
+	keys, err := mvsr-ooc.ScanMvccKeys(startKey, endKey, limit)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	exported := make([]*ExportedKey, 0, len(keys))
+	for _, key := range keys {
+		info := mvsr-ooc.MvccGetByKey(key)
+		if info == nil {
+			return nil, errors.Errorf("failed to read the MVCC information of key %q", key)
+		}
+		exported = append(exported, exportMvccInfo(key, info))
+	}
+	return exported, nil
+}
+
+func exportMvccInfo(key []byte, info *kvrpcpb.MvccInfo) *ExportedKey {
+	e := &ExportedKey{Key: upperHex(key)}
+	if l := info.Lock; l != nil {
+		e.Lock = &ExportedLock{
+			Type:    l.Type.String(),
+			StartTS: l.StartTs,
+			Primary: upperHex(l.Primary),
+			Value:   upperHex(l.ShortValue),
+		}
+	}
+	for i, w := range info.Writes {
+		// MvccGetByKey only keeps the short values in Writes, the full values are in Values.
+		e.Versions = append(e.Versions, ExportedVersion{
+			Type:     w.Type.String(),
+			StartTS:  w.StartTs,
+			CommitTS: w.CommitTs,
+			Value:    upperHex(info.Values[i].Value),
+		})
+	}
+	return e
+}
+
+func upperHex(b []byte) string {
+	return strings.ToUpper(hex.EncodeToString(b))
+}
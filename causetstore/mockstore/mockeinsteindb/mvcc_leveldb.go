@@ -20,6 +20,7 @@ import (
 
 	"github.com/dgryski/go-farm"
 	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/oracle"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/cdc"
 	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
 	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
 	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/deadlock"
@@ -60,11 +61,16 @@ type MVCCLevelDB struct {
 
 	// EDB represents leveldb
 	EDB *leveldb.EDB
+	// rawDB keeps the raw keys of the non-default column families and the expire time
+	// of the raw keys, see RawKVExt.
+	rawDB *leveldb.EDB
 	// mu used for dagger
 	// leveldb can not guarantee multiple operations to be atomic, for example, read
 	// then write, another write may happen during it, so this dagger is necessory.
 	mu               sync.RWMutex
 	deadlockDetector *deadlock.Detector
+	// feed publishes the changes of the transactional commands.
+	feed *cdc.Feed
 }
 
 const lockVer uint64 = math.MaxUint64
@@ -124,8 +130,18 @@ func NewMVCCLevelDB(path string) (*MVCCLevelDB, error) {
 	} else {
 		d, err = leveldb.OpenFile(path, &opt.Options{BlockCacheCapacity: 600 * 1024 * 1024})
 	}
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	rawDB, err := openRawDB(path)
+	if err != nil {
+		terror.Log(d.Close())
+		return nil, errors.Trace(err)
+	}
 
-	return &MVCCLevelDB{EDB: d, deadlockDetector: deadlock.NewDetector()}, errors.Trace(err)
+	mvsr-ooc := &MVCCLevelDB{EDB: d, rawDB: rawDB, deadlockDetector: deadlock.NewDetector()}
+	mvsr-ooc.feed = cdc.NewFeed(mvsr-ooc.minLockTS)
+	return mvsr-ooc, nil
 }
 
 // Iterator wraps iterator.Iterator to provide Valid() method.
@@ -516,7 +532,7 @@ func (mvsr-ooc *MVCCLevelDB) PessimisticLock(req *kvrpcpb.PessimisticLockRequest
 		resp.Errors = convertToKeyErrors(errs)
 		return resp
 	}
-	if err := mvsr-ooc.EDB.Write(batch, nil); err != nil {
+	if err := mvsr-ooc.writeTxnBatch(batch); err != nil {
 		resp.Errors = convertToKeyErrors([]error{err})
 		return resp
 	}
@@ -603,7 +619,7 @@ func (mvsr-ooc *MVCCLevelDB) PessimisticRollback(keys [][]byte, startTS, forUFID
 	if anyError {
 		return errs
 	}
-	if err := mvsr-ooc.EDB.Write(batch, nil); err != nil {
+	if err := mvsr-ooc.writeTxnBatch(batch); err != nil {
 		return []error{err}
 	}
 	return errs
@@ -673,6 +689,11 @@ func (mvsr-ooc *MVCCLevelDB) Prewrite(req *kvrpcpb.PrewriteRequest) []error {
 		}
 		isPessimisticLock := len(req.IsPessimisticLock) > 0 && req.IsPessimisticLock[i]
 		err = prewriteMutation(mvsr-ooc.EDB, batch, m, startTS, primary, ttl, txnSize, isPessimisticLock, minCommitTS)
+		if err == nil {
+			// The assertion is checked after the dagger, a key locked by another transaction
+			// gets ErrLocked, which the client can resolve.
+			err = mvsr-ooc.checkAssertion(m, startTS, forUFIDelateTS)
+		}
 		errs = append(errs, err)
 		if err != nil {
 			anyError = true
@@ -681,13 +702,65 @@ func (mvsr-ooc *MVCCLevelDB) Prewrite(req *kvrpcpb.PrewriteRequest) []error {
 	if anyError {
 		return errs
 	}
-	if err := mvsr-ooc.EDB.Write(batch, nil); err != nil {
+	if err := mvsr-ooc.writeTxnBatch(batch); err != nil {
 		return []error{err}
 	}
 
 	return errs
 }
 
+// checkAssertion checks the existence of the key against the assertion of the mutation.
+// Only the committed values are considered, the locks are checked by prewriteMutation
+// before it. A key exists if its latest write is a put, even an empty value.
+func (mvsr-ooc *MVCCLevelDB) checkAssertion(m *kvrpcpb.Mutation, startTS, forUFIDelateTS uint64) error {
+	if m.Assertion == kvrpcpb.Assertion_None {
+		return nil
+	}
+	readTS := startTS
+	if forUFIDelateTS > readTS {
+		readTS = forUFIDelateTS
+	}
+	iter := newIterator(mvsr-ooc.EDB, &soliton.Range{
+		Start: mvsr-oocEncode(m.Key, lockVer),
+	})
+	defer iter.Release()
+
+	// Skip the dagger, it is checked by prewriteMutation.
+	dec1 := lockDecoder{expectKey: m.Key}
+	if _, err := dec1.Decode(iter); err != nil {
+		return errors.Trace(err)
+	}
+	var existingCommitTS uint64
+	dec2 := valueDecoder{expectKey: m.Key}
+	for iter.Valid() {
+		ok, err := dec2.Decode(iter)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if !ok {
+			break
+		}
+		value := &dec2.value
+		if value.valueType == typeRollback || value.valueType == typeLock || value.commitTS > readTS {
+			continue
+		}
+		if value.valueType == typePut {
+			existingCommitTS = value.commitTS
+		}
+		break
+	}
+	exists := existingCommitTS != 0
+	if (m.Assertion == kvrpcpb.Assertion_Exist && !exists) || (m.Assertion == kvrpcpb.Assertion_NotExist && exists) {
+		return &ErrAssertionFailed{
+			Key:              m.Key,
+			Assertion:        m.Assertion,
+			StartTS:          startTS,
+			ExistingCommitTS: existingCommitTS,
+		}
+	}
+	return nil
+}
+
 func checkConflictValue(iter *Iterator, m *kvrpcpb.Mutation, forUFIDelateTS uint64, startTS uint64, getVal bool) ([]byte, error) {
 	dec := &valueDecoder{
 		expectKey: m.Key,
@@ -856,7 +929,7 @@ func (mvsr-ooc *MVCCLevelDB) Commit(keys [][]byte, startTS, commitTS uint64) err
 			return errors.Trace(err)
 		}
 	}
-	return mvsr-ooc.EDB.Write(batch, nil)
+	return mvsr-ooc.writeTxnBatch(batch)
 }
 
 func commitKey(EDB *leveldb.EDB, batch *leveldb.Batch, key []byte, startTS, commitTS uint64) error {
@@ -943,7 +1016,7 @@ func (mvsr-ooc *MVCCLevelDB) Rollback(keys [][]byte, startTS uint64) error {
 			return errors.Trace(err)
 		}
 	}
-	return mvsr-ooc.EDB.Write(batch, nil)
+	return mvsr-ooc.writeTxnBatch(batch)
 }
 
 func rollbackKey(EDB *leveldb.EDB, batch *leveldb.Batch, key []byte, startTS uint64) error {
@@ -1072,7 +1145,7 @@ func (mvsr-ooc *MVCCLevelDB) Cleanup(key []byte, startTS, currentTS uint64) erro
 				if err = rollbackLock(batch, key, startTS); err != nil {
 					return err
 				}
-				return mvsr-ooc.EDB.Write(batch, nil)
+				return mvsr-ooc.writeTxnBatch(batch)
 			}
 
 			// Otherwise, return a locked error with the TTL information.
@@ -1155,7 +1228,7 @@ func (mvsr-ooc *MVCCLevelDB) CheckTxnStatus(primaryKey []byte, lockTS, callerSta
 					err = errors.Trace(err)
 					return
 				}
-				if err = mvsr-ooc.EDB.Write(batch, nil); err != nil {
+				if err = mvsr-ooc.writeTxnBatch(batch); err != nil {
 					err = errors.Trace(err)
 					return
 				}
@@ -1190,7 +1263,7 @@ func (mvsr-ooc *MVCCLevelDB) CheckTxnStatus(primaryKey []byte, lockTS, callerSta
 						return
 					}
 					batch.Put(writeKey, writeValue)
-					if err1 = mvsr-ooc.EDB.Write(batch, nil); err1 != nil {
+					if err1 = mvsr-ooc.writeTxnBatch(batch); err1 != nil {
 						err = errors.Trace(err1)
 						return
 					}
@@ -1234,7 +1307,7 @@ func (mvsr-ooc *MVCCLevelDB) CheckTxnStatus(primaryKey []byte, lockTS, callerSta
 			err = errors.Trace(err1)
 			return
 		}
-		if err1 := mvsr-ooc.EDB.Write(batch, nil); err1 != nil {
+		if err1 := mvsr-ooc.writeTxnBatch(batch); err1 != nil {
 			err = errors.Trace(err1)
 			return
 		}
@@ -1282,7 +1355,7 @@ func (mvsr-ooc *MVCCLevelDB) TxnHeartBeat(key []byte, startTS uint64, adviseTTL
 					return 0, errors.Trace(err)
 				}
 				batch.Put(writeKey, writeValue)
-				if err = mvsr-ooc.EDB.Write(batch, nil); err != nil {
+				if err = mvsr-ooc.writeTxnBatch(batch); err != nil {
 					return 0, errors.Trace(err)
 				}
 			}
@@ -1364,7 +1437,7 @@ func (mvsr-ooc *MVCCLevelDB) ResolveLock(startKey, endKey []byte, startTS, commi
 		}
 		currKey = skip.currKey
 	}
-	return mvsr-ooc.EDB.Write(batch, nil)
+	return mvsr-ooc.writeTxnBatch(batch)
 }
 
 // BatchResolveLock implements the MVCCStore interface.
@@ -1405,7 +1478,7 @@ func (mvsr-ooc *MVCCLevelDB) BatchResolveLock(startKey, endKey []byte, txnInfos
 		}
 		currKey = skip.currKey
 	}
-	return mvsr-ooc.EDB.Write(batch, nil)
+	return mvsr-ooc.writeTxnBatch(batch)
 }
 
 // GC implements the MVCCStore interface
@@ -1481,140 +1554,58 @@ func (mvsr-ooc *MVCCLevelDB) DeleteRange(startKey, endKey []byte) error {
 
 // Close calls leveldb's Close to free resources.
 func (mvsr-ooc *MVCCLevelDB) Close() error {
+	if err := mvsr-ooc.rawDB.Close(); err != nil {
+		terror.Log(mvsr-ooc.EDB.Close())
+		return err
+	}
 	return mvsr-ooc.EDB.Close()
 }
 
 // RawPut implements the RawKV interface.
 func (mvsr-ooc *MVCCLevelDB) RawPut(key, value []byte) {
-	mvsr-ooc.mu.Lock()
-	defer mvsr-ooc.mu.Unlock()
-
-	if value == nil {
-		value = []byte{}
-	}
-	terror.Log(mvsr-ooc.EDB.Put(key, value, nil))
+	mvsr-ooc.RawPutCF(defaultRawCF, key, value, 0)
 }
 
 // RawBatchPut implements the RawKV interface
 func (mvsr-ooc *MVCCLevelDB) RawBatchPut(keys, values [][]byte) {
-	mvsr-ooc.mu.Lock()
-	defer mvsr-ooc.mu.Unlock()
-
-	batch := &leveldb.Batch{}
-	for i, key := range keys {
-		value := values[i]
-		if value == nil {
-			value = []byte{}
-		}
-		batch.Put(key, value)
-	}
-	terror.Log(mvsr-ooc.EDB.Write(batch, nil))
+	mvsr-ooc.RawBatchPutCF(defaultRawCF, keys, values, 0)
 }
 
 // RawGet implements the RawKV interface.
 func (mvsr-ooc *MVCCLevelDB) RawGet(key []byte) []byte {
-	mvsr-ooc.mu.Lock()
-	defer mvsr-ooc.mu.Unlock()
-
-	ret, err := mvsr-ooc.EDB.Get(key, nil)
-	terror.Log(err)
-	return ret
+	return mvsr-ooc.RawGetCF(defaultRawCF, key)
 }
 
 // RawBatchGet implements the RawKV interface.
 func (mvsr-ooc *MVCCLevelDB) RawBatchGet(keys [][]byte) [][]byte {
-	mvsr-ooc.mu.Lock()
-	defer mvsr-ooc.mu.Unlock()
-
-	values := make([][]byte, 0, len(keys))
-	for _, key := range keys {
-		value, err := mvsr-ooc.EDB.Get(key, nil)
-		terror.Log(err)
-		values = append(values, value)
-	}
-	return values
+	return mvsr-ooc.RawBatchGetCF(defaultRawCF, keys)
 }
 
 // RawDelete implements the RawKV interface.
 func (mvsr-ooc *MVCCLevelDB) RawDelete(key []byte) {
-	mvsr-ooc.mu.Lock()
-	defer mvsr-ooc.mu.Unlock()
-
-	terror.Log(mvsr-ooc.EDB.Delete(key, nil))
+	mvsr-ooc.RawDeleteCF(defaultRawCF, key)
 }
 
 // RawBatchDelete implements the RawKV interface.
 func (mvsr-ooc *MVCCLevelDB) RawBatchDelete(keys [][]byte) {
-	mvsr-ooc.mu.Lock()
-	defer mvsr-ooc.mu.Unlock()
-
-	batch := &leveldb.Batch{}
-	for _, key := range keys {
-		batch.Delete(key)
-	}
-	terror.Log(mvsr-ooc.EDB.Write(batch, nil))
+	mvsr-ooc.RawBatchDeleteCF(defaultRawCF, keys)
 }
 
 // RawScan implements the RawKV interface.
 func (mvsr-ooc *MVCCLevelDB) RawScan(startKey, endKey []byte, limit int) []Pair {
-	mvsr-ooc.mu.Lock()
-	defer mvsr-ooc.mu.Unlock()
-
-	iter := mvsr-ooc.EDB.NewIterator(&soliton.Range{
-		Start: startKey,
-	}, nil)
-
-	var pairs []Pair
-	for iter.Next() && len(pairs) < limit {
-		key := iter.Key()
-		value := iter.Value()
-		err := iter.Error()
-		if len(endKey) > 0 && bytes.Compare(key, endKey) >= 0 {
-			break
-		}
-		pairs = append(pairs, Pair{
-			Key:   append([]byte{}, key...),
-			Value: append([]byte{}, value...),
-			Err:   err,
-		})
-	}
-	return pairs
+	return mvsr-ooc.RawScanCF(defaultRawCF, startKey, endKey, limit)
 }
 
 // RawReverseScan implements the RawKV interface.
 // Scan the range of [endKey, startKey)
 // It doesn't support Scanning from "", because locating the last Region is not yet implemented.
 func (mvsr-ooc *MVCCLevelDB) RawReverseScan(startKey, endKey []byte, limit int) []Pair {
-	mvsr-ooc.mu.Lock()
-	defer mvsr-ooc.mu.Unlock()
-
-	iter := mvsr-ooc.EDB.NewIterator(&soliton.Range{
-		Limit: startKey,
-	}, nil)
-
-	success := iter.Last()
-
-	var pairs []Pair
-	for success && len(pairs) < limit {
-		key := iter.Key()
-		value := iter.Value()
-		err := iter.Error()
-		if bytes.Compare(key, endKey) < 0 {
-			break
-		}
-		pairs = append(pairs, Pair{
-			Key:   append([]byte{}, key...),
-			Value: append([]byte{}, value...),
-			Err:   err,
-		})
-		success = iter.Prev()
-	}
-	return pairs
+	return mvsr-ooc.RawReverseScanCF(defaultRawCF, startKey, endKey, limit)
 }
 
 // RawDeleteRange implements the RawKV interface.
 func (mvsr-ooc *MVCCLevelDB) RawDeleteRange(startKey, endKey []byte) {
-	terror.Log(mvsr-ooc.doRawDeleteRange(startKey, endKey))
+	mvsr-ooc.RawDeleteRangeCF(defaultRawCF, startKey, endKey)
 }
 
 // doRawDeleteRange deletes all keys in a range and return the error if any.
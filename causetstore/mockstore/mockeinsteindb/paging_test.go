@@ -0,0 +1,98 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb_test
+
+import (
+	"context"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/blockcodec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/mockeinsteindb"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/berolinaAllegroSQL/allegrosql"
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/fidelpb/go-fidelpb"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+)
+
+var _ = Suite(&testPagingSuite{})
+
+type testPagingSuite struct{}
+
+func (s *testPagingSuite) TestSendINTERLOCKPages(c *C) {
+	causetstore := mockeinsteindb.MustNewMVCCStore()
+	cluster := mockeinsteindb.NewCluster(causetstore)
+	storeID, _, regionID := mockeinsteindb.BootstrapWithSingleStore(cluster)
+	region, _ := cluster.GetRegion(regionID)
+	client := mockeinsteindb.NewRPCClient(cluster, causetstore)
+	defer client.Close()
+	addr := cluster.GetStore(storeID).GetAddress()
+	reqCtx := kvrpcpb.Context{RegionId: regionID, RegionEpoch: region.RegionEpoch, Peer: region.Peers[0]}
+
+	const blockID = int64(1)
+	var mutations []*kvrpcpb.Mutation
+	for i := int64(1); i <= 5; i++ {
+		key := blockcodec.EncodeRowKeyWithHandle(blockID, solomonkey.IntHandle(i))
+		mutations = append(mutations, &kvrpcpb.Mutation{Op: kvrpcpb.Op_Put, Key: key, Value: []byte("v")})
+	}
+	for _, err := range causetstore.Prewrite(&kvrpcpb.PrewriteRequest{Mutations: mutations, PrimaryLock: mutations[0].Key, StartVersion: 10, LockTtl: 3000}) {
+		c.Assert(err, IsNil)
+	}
+	keys := make([][]byte, 0, len(mutations))
+	for _, m := range mutations {
+		keys = append(keys, m.Key)
+	}
+	c.Assert(causetstore.Commit(keys, 10, 20), IsNil)
+
+	data, err := (&fidelpb.PosetDagRequest{
+		Executors: []*fidelpb.Executor{{
+			Tp: fidelpb.ExecType_TypeTableScan,
+			TblScan: &fidelpb.TableScan{TableId: blockID, DeferredCausets: []*fidelpb.DeferredCausetInfo{
+				{DeferredCausetId: 1, Tp: int32(allegrosql.TypeLonglong), PkHandle: true},
+			}},
+		}},
+		OutputOffsets: []uint32{0},
+	}).Marshal()
+	c.Assert(err, IsNil)
+	ranges := []solomonkey.KeyRange{{StartKey: blockcodec.GenTableRecordPrefix(blockID), EndKey: blockcodec.GenTableRecordPrefix(blockID).PrefixNext()}}
+	send := func(req *solomonkey.Request) (handles []int64, pages int) {
+		err := einsteindb.SendINTERLOCKPages(context.Background(), client, addr, reqCtx, req, ranges, func(resp *interlock.Response) error {
+			pages++
+			var selResp fidelpb.SelectResponse
+			c.Assert(selResp.Unmarshal(resp.Data), IsNil)
+			for _, chk := range selResp.Chunks {
+				values, err := codec.Decode(chk.RowsData, 1)
+				c.Assert(err, IsNil)
+				for _, v := range values {
+					handles = append(handles, v.GetInt64())
+				}
+			}
+			return nil
+		})
+		c.Assert(err, IsNil)
+		return handles, pages
+	}
+
+	req := &solomonkey.Request{Tp: solomonkey.ReqTypePosetDag, Data: data, StartTs: 30, PagingSize: 2}
+	handles, pages := send(req)
+	c.Assert(handles, DeepEquals, []int64{1, 2, 3, 4, 5})
+	c.Assert(pages, Equals, 1)
+	// The budget reaches the causetstore, which stops every page at 2 rows.
+	req.Paging = true
+	handles, pages = send(req)
+	c.Assert(handles, DeepEquals, []int64{1, 2, 3, 4, 5})
+	c.Assert(pages, Equals, 3)
+}
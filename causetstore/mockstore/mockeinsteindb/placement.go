@@ -0,0 +1,429 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"sort"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/errors"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/metapb"
+)
+
+// PlacementRule describes how the replicas of the regions are placed on the stores.
+// The Cluster honours it when a peer is added, the leader is changed and a region is
+// scattered. TiFlash stores are never chosen by the rule, and their peers are not
+// counted as replicas.
+type PlacementRule struct {
+	// Count is the number of the replicas of a region.
+	Count int `json:"count"`
+	// Constraints are the labels a causetstore must have to hold a replica.
+	Constraints []*metapb.StoreLabel `json:"constraints,omitempty"`
+	// LocationLabels are the label keys of the topology from the top level to the
+	// bottom level, e.g. "zone", "host". The replicas are isolated at the highest
+	// level as possible.
+	LocationLabels []string `json:"location_labels,omitempty"`
+	// LeaderLabels are the labels the causetstore of the leader prefers.
+	LeaderLabels []*metapb.StoreLabel `json:"leader_labels,omitempty"`
+}
+
+// ErrNoStoreForPlacement is returned when no causetstore can hold a new replica under the
+// placement rule.
+var ErrNoStoreForPlacement = errors.New("no causetstore matches the placement rule")
+
+// ErrReplicaCountReached is returned when a region already has as many replicas as the
+// placement rule requires.
+var ErrReplicaCountReached = errors.New("region already has the replicas of the placement rule")
+
+// SetPlacementRule sets the placement rule of the cluster, nil removes the rule. The
+// existing regions are not moved until they are scattered.
+func (c *Cluster) SetPlacementRule(rule *PlacementRule) {
+	c.Lock()
+	defer c.Unlock()
+	defer c.persistLayout()
+
+	c.placementRule = rule
+}
+
+// GetPlacementRule returns the placement rule of the cluster.
+func (c *Cluster) GetPlacementRule() *PlacementRule {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.placementRule
+}
+
+// AddPeerByRule adds a new Peer for the Region on the causetstore chosen by the placement
+// rule. Without a rule, any causetstore which doesn't hold the Region can be chosen.
+func (c *Cluster) AddPeerByRule(regionID uint64) (storeID, peerID uint64, err error) {
+	c.Lock()
+	defer c.Unlock()
+	defer c.persistLayout()
+
+	r := c.regions[regionID]
+	if r == nil {
+		return 0, 0, errors.Errorf("region %d not found", regionID)
+	}
+	rule := c.placementRule
+	if rule == nil {
+		rule = &PlacementRule{}
+	}
+	if err = c.checkReplicaCount(r, rule); err != nil {
+		return 0, 0, err
+	}
+	s := pickStore(rule, c.ruleStores(rule), c.regionStores(r), c.storePeerCounts(nil))
+	if s == nil {
+		return 0, 0, errors.Trace(ErrNoStoreForPlacement)
+	}
+	peerID = c.allocID()
+	r.addPeer(peerID, s.Id)
+	return s.Id, peerID, nil
+}
+
+// ChangeLeaderByRule transfers the leader of the Region to the Peer preferred by the
+// placement rule and returns the new leader Peer ID.
+func (c *Cluster) ChangeLeaderByRule(regionID uint64) (uint64, error) {
+	c.Lock()
+	defer c.Unlock()
+	defer c.persistLayout()
+
+	r := c.regions[regionID]
+	if r == nil {
+		return 0, errors.Errorf("region %d not found", regionID)
+	}
+	r.changeLeader(c.pickLeader(r, c.placementRule))
+	return r.leader, nil
+}
+
+// ScatterRegion moves the replicas of the Region to the stores chosen by the placement
+// rule, the Peers already on the chosen stores are kept. It does nothing if the cluster
+// has no placement rule.
+func (c *Cluster) ScatterRegion(regionID uint64) error {
+	c.Lock()
+	defer c.Unlock()
+	defer c.persistLayout()
+
+	r := c.regions[regionID]
+	if r == nil {
+		return errors.Errorf("region %d not found", regionID)
+	}
+	rule := c.placementRule
+	if rule == nil {
+		return nil
+	}
+	candidates := c.ruleStores(rule)
+	peerCounts := c.storePeerCounts(r)
+	chosen := make([]*metapb.CausetStore, 0, rule.Count)
+	for len(chosen) < rule.Count {
+		s := pickStore(rule, candidates, chosen, peerCounts)
+		if s == nil {
+			return errors.Annotatef(ErrNoStoreForPlacement, "region %d needs %d replicas", regionID, rule.Count)
+		}
+		chosen = append(chosen, s)
+	}
+
+	peers := make([]*metapb.Peer, 0, len(chosen))
+	kept := 0
+	for _, s := range chosen {
+		if p := regionPeerOnStore(r.Meta, s.Id); p != nil {
+			peers = append(peers, p)
+			kept++
+		} else {
+			peers = append(peers, newPeerMeta(c.allocID(), s.Id))
+		}
+	}
+	// The TiFlash replicas are not managed by the rule.
+	for _, p := range r.Meta.Peers {
+		if s := c.stores[p.GetStoreId()]; s != nil && isTiFlashStore(s.meta) {
+			peers = append(peers, p)
+			kept++
+		}
+	}
+	if kept != len(r.Meta.Peers) || len(peers) != len(r.Meta.Peers) {
+		r.Meta.Peers = peers
+		r.incConfVer()
+	}
+	r.changeLeader(c.pickLeader(r, rule))
+	return nil
+}
+
+// GetReplicaForRead returns the Peer of the Region which serves a read with the
+// replicaRead type. The followers are tried in the order of their causetstore IDs, and a
+// Peer on a causetstore matching labels is preferred, so the choice is deterministic.
+func (c *Cluster) GetReplicaForRead(regionID uint64, replicaRead solomonkey.ReplicaReadType, labels []*metapb.StoreLabel) *metapb.Peer {
+	c.RLock()
+	defer c.RUnlock()
+
+	r := c.regions[regionID]
+	if r == nil {
+		return nil
+	}
+	leader := r.leaderPeer()
+	if !replicaRead.IsFollowerRead() {
+		return leader
+	}
+	var replicas []*metapb.Peer
+	if replicaRead == solomonkey.ReplicaReadMixed && leader != nil {
+		replicas = append(replicas, leader)
+	}
+	followers := make([]*metapb.Peer, 0, len(r.Meta.Peers))
+	for _, p := range r.Meta.Peers {
+		s := c.stores[p.GetStoreId()]
+		if p.GetId() == r.leader || s == nil || isTiFlashStore(s.meta) {
+			continue
+		}
+		followers = append(followers, p)
+	}
+	sort.Slice(followers, func(i, j int) bool {
+		return followers[i].GetStoreId() < followers[j].GetStoreId()
+	})
+	replicas = append(replicas, followers...)
+	for _, p := range replicas {
+		if storeMatchLabels(c.stores[p.GetStoreId()].meta, labels) {
+			return p
+		}
+	}
+	if len(followers) > 0 {
+		return followers[0]
+	}
+	return leader
+}
+
+// checkAddPeer checks whether the placement rule allows a new Peer of the Region on
+// the causetstore. Peers on TiFlash stores are always allowed.
+func (c *Cluster) checkAddPeer(r *Region, storeID uint64) error {
+	rule := c.placementRule
+	if rule == nil {
+		return nil
+	}
+	var meta *metapb.CausetStore
+	if s := c.stores[storeID]; s != nil {
+		meta = s.meta
+	}
+	if isTiFlashStore(meta) {
+		return nil
+	}
+	if err := c.checkReplicaCount(r, rule); err != nil {
+		return err
+	}
+	if !storeMatchLabels(meta, rule.Constraints) {
+		return errors.Annotatef(ErrNoStoreForPlacement, "causetstore %d", storeID)
+	}
+	return nil
+}
+
+// checkReplicaCount returns ErrReplicaCountReached if the Region has Count replicas
+// of the rule already.
+func (c *Cluster) checkReplicaCount(r *Region, rule *PlacementRule) error {
+	if rule.Count <= 0 {
+		return nil
+	}
+	replicas := 0
+	for _, p := range r.Meta.Peers {
+		if s := c.stores[p.GetStoreId()]; s == nil || !isTiFlashStore(s.meta) {
+			replicas++
+		}
+	}
+	if replicas >= rule.Count {
+		return errors.Annotatef(ErrReplicaCountReached, "region %d has %d replicas", r.Meta.Id, replicas)
+	}
+	return nil
+}
+
+// checkLeader checks whether the placement rule allows the Peer to be the leader of the
+// Region. A Peer which doesn't match the leader labels is only allowed if no Peer of the
+// Region does.
+func (c *Cluster) checkLeader(r *Region, peerID uint64) error {
+	rule := c.placementRule
+	if peerID == 0 || rule == nil || len(rule.LeaderLabels) == 0 {
+		return nil
+	}
+	if c.matchLeaderLabels(regionPeerByID(r.Meta, peerID), rule) {
+		return nil
+	}
+	for _, p := range r.Meta.Peers {
+		if c.matchLeaderLabels(p, rule) {
+			return errors.Errorf("peer %d of region %d doesn't match the leader labels of the placement rule", peerID, r.Meta.Id)
+		}
+	}
+	return nil
+}
+
+// matchLeaderLabels returns whether the Peer is on a TiKV causetstore matching the
+// leader labels of the rule.
+func (c *Cluster) matchLeaderLabels(p *metapb.Peer, rule *PlacementRule) bool {
+	if p == nil {
+		return false
+	}
+	s := c.stores[p.GetStoreId()]
+	return s != nil && !isTiFlashStore(s.meta) && storeMatchLabels(s.meta, rule.LeaderLabels)
+}
+
+// ruleStores returns the stores which are up and satisfy the constraints of the
+// rule, sorted by ID.
+func (c *Cluster) ruleStores(rule *PlacementRule) []*metapb.CausetStore {
+	stores := make([]*metapb.CausetStore, 0, len(c.stores))
+	for _, s := range c.stores {
+		if s.meta.GetState() != metapb.StoreState_Up || isTiFlashStore(s.meta) || !storeMatchLabels(s.meta, rule.Constraints) {
+			continue
+		}
+		stores = append(stores, s.meta)
+	}
+	sort.Slice(stores, func(i, j int) bool {
+		return stores[i].Id < stores[j].Id
+	})
+	return stores
+}
+
+// regionStores returns the stores holding the Peers of the Region.
+func (c *Cluster) regionStores(r *Region) []*metapb.CausetStore {
+	stores := make([]*metapb.CausetStore, 0, len(r.Meta.Peers))
+	for _, p := range r.Meta.Peers {
+		if s := c.stores[p.GetStoreId()]; s != nil {
+			stores = append(stores, s.meta)
+		}
+	}
+	return stores
+}
+
+// storePeerCounts returns the number of Peers on each causetstore, the Peers of the
+// excluded Region are not counted.
+func (c *Cluster) storePeerCounts(excluded *Region) map[uint64]int {
+	counts := make(map[uint64]int, len(c.stores))
+	for _, r := range c.regions {
+		if r == excluded {
+			continue
+		}
+		for _, p := range r.Meta.Peers {
+			counts[p.GetStoreId()]++
+		}
+	}
+	return counts
+}
+
+// pickLeader returns the ID of the Peer which should be the leader of the Region. The
+// current leader is kept if the rule doesn't prefer another Peer.
+func (c *Cluster) pickLeader(r *Region, rule *PlacementRule) uint64 {
+	peers := make([]*metapb.Peer, 0, len(r.Meta.Peers))
+	for _, p := range r.Meta.Peers {
+		if s := c.stores[p.GetStoreId()]; s != nil && !isTiFlashStore(s.meta) {
+			peers = append(peers, p)
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].GetStoreId() < peers[j].GetStoreId()
+	})
+	if rule != nil && len(rule.LeaderLabels) > 0 {
+		if leader := r.leaderPeer(); leader != nil && storeMatchLabels(c.stores[leader.GetStoreId()].meta, rule.LeaderLabels) {
+			return leader.GetId()
+		}
+		for _, p := range peers {
+			if storeMatchLabels(c.stores[p.GetStoreId()].meta, rule.LeaderLabels) {
+				return p.GetId()
+			}
+		}
+	}
+	if leader := r.leaderPeer(); leader != nil {
+		return leader.GetId()
+	}
+	if len(peers) > 0 {
+		return peers[0].GetId()
+	}
+	return 0
+}
+
+// pickStore picks the causetstore for a new replica from the candidates which are not
+// chosen yet. The causetstore sharing the fewest location levels with the chosen stores
+// wins, then the one with the fewest Peers, then the one with the smallest ID.
+func pickStore(rule *PlacementRule, candidates, chosen []*metapb.CausetStore, peerCounts map[uint64]int) *metapb.CausetStore {
+	var (
+		best          *metapb.CausetStore
+		bestShared    int
+		bestPeerCount int
+	)
+	for _, s := range candidates {
+		if containsStore(chosen, s.Id) {
+			continue
+		}
+		shared := sharedLocationLevels(rule.LocationLabels, s, chosen)
+		if best == nil || shared < bestShared || (shared == bestShared && peerCounts[s.Id] < bestPeerCount) {
+			best, bestShared, bestPeerCount = s, shared, peerCounts[s.Id]
+		}
+	}
+	return best
+}
+
+// sharedLocationLevels returns the max number of the leading location labels the causetstore
+// shares with any of the stores.
+func sharedLocationLevels(locationLabels []string, s *metapb.CausetStore, stores []*metapb.CausetStore) int {
+	max := 0
+	for _, t := range stores {
+		n := 0
+		for _, key := range locationLabels {
+			if getStoreLabel(s, key) != getStoreLabel(t, key) {
+				break
+			}
+			n++
+		}
+		if n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+func containsStore(stores []*metapb.CausetStore, storeID uint64) bool {
+	for _, s := range stores {
+		if s.Id == storeID {
+			return true
+		}
+	}
+	return false
+}
+
+func regionPeerByID(r *metapb.Region, peerID uint64) *metapb.Peer {
+	for _, p := range r.Peers {
+		if p.GetId() == peerID {
+			return p
+		}
+	}
+	return nil
+}
+
+func regionPeerOnStore(r *metapb.Region, storeID uint64) *metapb.Peer {
+	for _, p := range r.Peers {
+		if p.GetStoreId() == storeID {
+			return p
+		}
+	}
+	return nil
+}
+
+func getStoreLabel(s *metapb.CausetStore, key string) string {
+	for _, l := range s.GetLabels() {
+		if l.GetKey() == key {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+func storeMatchLabels(s *metapb.CausetStore, labels []*metapb.StoreLabel) bool {
+	for _, l := range labels {
+		if getStoreLabel(s, l.GetKey()) != l.GetValue() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,358 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"path/filepath"
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/berolinaAllegroSQL/terror"
+	"github.com/whtcorpsinc/goleveldb/leveldb"
+	"github.com/whtcorpsinc/goleveldb/leveldb/soliton"
+	"github.com/whtcorpsinc/goleveldb/leveldb/storage"
+)
+
+const defaultRawCF = "default"
+
+// The raw keys of the default column family are stored in the EDB of the MVCC keys as they
+// are for compatibility. The keys of the other column families and the expire time of the
+// keys with TTL are stored in rawDB, a separate leveldb, so they never mix with the MVCC
+// keys or the raw keys of the default column family. In rawDB, the key of a column family
+// is prefixed by the name of the column family and a 0, the expire time is stored under
+// rawTTLPrefix, which no column family name starts with.
+var rawTTLPrefix = []byte("\x00ttl\x00")
+
+// rawKVNow returns the current time used by the raw KV TTL, tests can change it.
+var rawKVNow = time.Now
+
+// openRawDB opens the rawDB of the MVCCLevelDB at path, it's in memory if path is empty.
+func openRawDB(path string) (*leveldb.EDB, error) {
+	if path == "" {
+		return leveldb.Open(storage.NewMemStorage(), nil)
+	}
+	return leveldb.OpenFile(filepath.Join(path, "rawcf"), nil)
+}
+
+func isDefaultRawCF(cf string) bool {
+	return cf == "" || cf == defaultRawCF
+}
+
+// rawDataDB returns the EDB the raw keys of the column family are stored in.
+func (mvsr-ooc *MVCCLevelDB) rawDataDB(cf string) *leveldb.EDB {
+	if isDefaultRawCF(cf) {
+		return mvsr-ooc.EDB
+	}
+	return mvsr-ooc.rawDB
+}
+
+// rawDataKey returns the key the value of the raw key in the column family is stored in.
+func rawDataKey(cf string, key []byte) []byte {
+	if isDefaultRawCF(cf) {
+		return key
+	}
+	return append(rawCFKeyPrefix(cf), key...)
+}
+
+func rawCFKeyPrefix(cf string) []byte {
+	prefix := make([]byte, 0, len(cf)+1)
+	prefix = append(prefix, cf...)
+	return append(prefix, 0)
+}
+
+// rawTTLKey returns the key in rawDB the expire time of the raw key in the column family
+// is stored in.
+func rawTTLKey(cf string, key []byte) []byte {
+	if isDefaultRawCF(cf) {
+		cf = defaultRawCF
+	}
+	ttlKey := make([]byte, 0, len(rawTTLPrefix)+len(cf)+1+len(key))
+	ttlKey = append(ttlKey, rawTTLPrefix...)
+	ttlKey = append(ttlKey, cf...)
+	ttlKey = append(ttlKey, 0)
+	return append(ttlKey, key...)
+}
+
+// rawDataRange returns the range of the stored keys for the raw keys in [startKey, endKey)
+// of the column family. An empty endKey means the end of the column family.
+func rawDataRange(cf string, startKey, endKey []byte) *soliton.Range {
+	if isDefaultRawCF(cf) {
+		r := &soliton.Range{Start: startKey}
+		if len(endKey) > 0 {
+			r.Limit = endKey
+		}
+		return r
+	}
+	r := &soliton.Range{Start: rawDataKey(cf, startKey)}
+	if len(endKey) > 0 {
+		r.Limit = rawDataKey(cf, endKey)
+	} else {
+		r.Limit = solomonkey.Key(rawCFKeyPrefix(cf)).PrefixNext()
+	}
+	return r
+}
+
+// rawUserKey returns the raw key of a key stored in the range of the column family.
+func rawUserKey(cf string, dataKey []byte) []byte {
+	if isDefaultRawCF(cf) {
+		return dataKey
+	}
+	return dataKey[len(rawCFKeyPrefix(cf)):]
+}
+
+// rawWriteBatch holds the writes of a raw KV request, the data of the default column
+// family is written to the EDB of the MVCC keys, the others are written to rawDB.
+type rawWriteBatch struct {
+	data leveldb.Batch
+	raw  leveldb.Batch
+}
+
+func (b *rawWriteBatch) dataBatch(cf string) *leveldb.Batch {
+	if isDefaultRawCF(cf) {
+		return &b.data
+	}
+	return &b.raw
+}
+
+func (b *rawWriteBatch) put(cf string, key, value []byte, ttl uint64) {
+	if value == nil {
+		value = []byte{}
+	}
+	b.dataBatch(cf).Put(rawDataKey(cf, key), value)
+	if ttl == 0 {
+		b.raw.Delete(rawTTLKey(cf, key))
+		return
+	}
+	var expireAt [8]byte
+	binary.BigEndian.PutUint64(expireAt[:], uint64(rawKVNow().Unix())+ttl)
+	b.raw.Put(rawTTLKey(cf, key), expireAt[:])
+}
+
+func (b *rawWriteBatch) delete(cf string, key []byte) {
+	b.dataBatch(cf).Delete(rawDataKey(cf, key))
+	b.raw.Delete(rawTTLKey(cf, key))
+}
+
+func (mvsr-ooc *MVCCLevelDB) writeRawBatch(b *rawWriteBatch) {
+	if b.raw.Len() > 0 {
+		terror.Log(mvsr-ooc.rawDB.Write(&b.raw, nil))
+	}
+	if b.data.Len() > 0 {
+		terror.Log(mvsr-ooc.EDB.Write(&b.data, nil))
+	}
+}
+
+// rawExpired checks whether the raw key is expired. The reads only skip the expired keys,
+// an expired key is removed by the next write of it.
+func (mvsr-ooc *MVCCLevelDB) rawExpired(cf string, key []byte) bool {
+	expireAt, ok := mvsr-ooc.rawExpireAt(cf, key)
+	return ok && uint64(rawKVNow().Unix()) >= expireAt
+}
+
+func (mvsr-ooc *MVCCLevelDB) rawExpireAt(cf string, key []byte) (uint64, bool) {
+	val, err := mvsr-ooc.rawDB.Get(rawTTLKey(cf, key), nil)
+	if err != nil {
+		if err != leveldb.ErrNotFound {
+			terror.Log(err)
+		}
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(val), true
+}
+
+func (mvsr-ooc *MVCCLevelDB) rawGet(cf string, key []byte) []byte {
+	value, err := mvsr-ooc.rawDataDB(cf).Get(rawDataKey(cf, key), nil)
+	if err != nil {
+		if err != leveldb.ErrNotFound {
+			terror.Log(err)
+		}
+		return nil
+	}
+	if mvsr-ooc.rawExpired(cf, key) {
+		return nil
+	}
+	return value
+}
+
+// RawGetCF implements the RawKVExt interface.
+func (mvsr-ooc *MVCCLevelDB) RawGetCF(cf string, key []byte) []byte {
+	mvsr-ooc.mu.RLock()
+	defer mvsr-ooc.mu.RUnlock()
+
+	return mvsr-ooc.rawGet(cf, key)
+}
+
+// RawBatchGetCF implements the RawKVExt interface.
+func (mvsr-ooc *MVCCLevelDB) RawBatchGetCF(cf string, keys [][]byte) [][]byte {
+	mvsr-ooc.mu.RLock()
+	defer mvsr-ooc.mu.RUnlock()
+
+	values := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, mvsr-ooc.rawGet(cf, key))
+	}
+	return values
+}
+
+// RawPutCF implements the RawKVExt interface.
+func (mvsr-ooc *MVCCLevelDB) RawPutCF(cf string, key, value []byte, ttl uint64) {
+	mvsr-ooc.mu.Lock()
+	defer mvsr-ooc.mu.Unlock()
+
+	batch := &rawWriteBatch{}
+	batch.put(cf, key, value, ttl)
+	mvsr-ooc.writeRawBatch(batch)
+}
+
+// RawBatchPutCF implements the RawKVExt interface.
+func (mvsr-ooc *MVCCLevelDB) RawBatchPutCF(cf string, keys, values [][]byte, ttl uint64) {
+	mvsr-ooc.mu.Lock()
+	defer mvsr-ooc.mu.Unlock()
+
+	batch := &rawWriteBatch{}
+	for i, key := range keys {
+		batch.put(cf, key, values[i], ttl)
+	}
+	mvsr-ooc.writeRawBatch(batch)
+}
+
+// RawDeleteCF implements the RawKVExt interface.
+func (mvsr-ooc *MVCCLevelDB) RawDeleteCF(cf string, key []byte) {
+	mvsr-ooc.RawBatchDeleteCF(cf, [][]byte{key})
+}
+
+// RawBatchDeleteCF implements the RawKVExt interface.
+func (mvsr-ooc *MVCCLevelDB) RawBatchDeleteCF(cf string, keys [][]byte) {
+	mvsr-ooc.mu.Lock()
+	defer mvsr-ooc.mu.Unlock()
+
+	batch := &rawWriteBatch{}
+	for _, key := range keys {
+		batch.delete(cf, key)
+	}
+	mvsr-ooc.writeRawBatch(batch)
+}
+
+// RawDeleteRangeCF implements the RawKVExt interface.
+func (mvsr-ooc *MVCCLevelDB) RawDeleteRangeCF(cf string, startKey, endKey []byte) {
+	mvsr-ooc.mu.Lock()
+	defer mvsr-ooc.mu.Unlock()
+
+	batch := &rawWriteBatch{}
+	iter := mvsr-ooc.rawDataDB(cf).NewIterator(rawDataRange(cf, startKey, endKey), nil)
+	for iter.Next() {
+		batch.delete(cf, rawUserKey(cf, iter.Key()))
+	}
+	terror.Log(iter.Error())
+	iter.Release()
+	mvsr-ooc.writeRawBatch(batch)
+}
+
+// RawScanCF implements the RawKVExt interface.
+func (mvsr-ooc *MVCCLevelDB) RawScanCF(cf string, startKey, endKey []byte, limit int) []Pair {
+	mvsr-ooc.mu.RLock()
+	defer mvsr-ooc.mu.RUnlock()
+
+	return mvsr-ooc.rawScan(cf, startKey, endKey, limit)
+}
+
+func (mvsr-ooc *MVCCLevelDB) rawScan(cf string, startKey, endKey []byte, limit int) []Pair {
+	iter := mvsr-ooc.rawDataDB(cf).NewIterator(rawDataRange(cf, startKey, endKey), nil)
+	defer iter.Release()
+
+	var pairs []Pair
+	for iter.Next() && len(pairs) < limit {
+		key := rawUserKey(cf, iter.Key())
+		if mvsr-ooc.rawExpired(cf, key) {
+			continue
+		}
+		pairs = append(pairs, Pair{
+			Key:   append([]byte{}, key...),
+			Value: append([]byte{}, iter.Value()...),
+			Err:   iter.Error(),
+		})
+	}
+	return pairs
+}
+
+// RawReverseScanCF implements the RawKVExt interface.
+func (mvsr-ooc *MVCCLevelDB) RawReverseScanCF(cf string, startKey, endKey []byte, limit int) []Pair {
+	mvsr-ooc.mu.RLock()
+	defer mvsr-ooc.mu.RUnlock()
+
+	r := rawDataRange(cf, endKey, startKey)
+	iter := mvsr-ooc.rawDataDB(cf).NewIterator(r, nil)
+	defer iter.Release()
+
+	var pairs []Pair
+	for success := iter.Last(); success && len(pairs) < limit; success = iter.Prev() {
+		key := rawUserKey(cf, iter.Key())
+		if mvsr-ooc.rawExpired(cf, key) {
+			continue
+		}
+		pairs = append(pairs, Pair{
+			Key:   append([]byte{}, key...),
+			Value: append([]byte{}, iter.Value()...),
+			Err:   iter.Error(),
+		})
+	}
+	return pairs
+}
+
+// RawBatchScanCF implements the RawKVExt interface.
+func (mvsr-ooc *MVCCLevelDB) RawBatchScanCF(cf string, ranges []solomonkey.KeyRange, eachLimit int) []Pair {
+	mvsr-ooc.mu.RLock()
+	defer mvsr-ooc.mu.RUnlock()
+
+	var pairs []Pair
+	for _, r := range ranges {
+		pairs = append(pairs, mvsr-ooc.rawScan(cf, r.StartKey, r.EndKey, eachLimit)...)
+	}
+	return pairs
+}
+
+// RawGetKeyTTL implements the RawKVExt interface.
+func (mvsr-ooc *MVCCLevelDB) RawGetKeyTTL(cf string, key []byte) (uint64, bool) {
+	mvsr-ooc.mu.RLock()
+	defer mvsr-ooc.mu.RUnlock()
+
+	if len(mvsr-ooc.rawGet(cf, key)) == 0 {
+		return 0, false
+	}
+	expireAt, ok := mvsr-ooc.rawExpireAt(cf, key)
+	if !ok {
+		return 0, true
+	}
+	return expireAt - uint64(rawKVNow().Unix()), true
+}
+
+// RawCompareAndSwap implements the RawKVExt interface.
+func (mvsr-ooc *MVCCLevelDB) RawCompareAndSwap(cf string, key, expected, value []byte, ttl uint64) ([]byte, bool) {
+	mvsr-ooc.mu.Lock()
+	defer mvsr-ooc.mu.Unlock()
+
+	previous := mvsr-ooc.rawGet(cf, key)
+	if len(previous) == 0 {
+		previous = nil
+	}
+	if (previous == nil) != (expected == nil) || !bytes.Equal(previous, expected) {
+		return previous, false
+	}
+	batch := &rawWriteBatch{}
+	batch.put(cf, key, value, ttl)
+	mvsr-ooc.writeRawBatch(batch)
+	return previous, true
+}
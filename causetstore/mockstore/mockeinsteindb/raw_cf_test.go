@@ -0,0 +1,121 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"math"
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	. "github.com/whtcorpsinc/check"
+)
+
+func (s *testMVCCLevelDB) TestRawKVExt(c *C) {
+	now := time.Unix(1000, 0)
+	rawKVNow = func() time.Time { return now }
+	defer func() { rawKVNow = time.Now }()
+
+	causetstore, err := NewMVCCLevelDB("")
+	c.Assert(err, IsNil)
+	var rawKV RawKVExt = causetstore
+
+	// Column families are isolated from each other.
+	rawKV.RawPut([]byte("a"), []byte("v0"))
+	rawKV.RawPutCF("lock", []byte("a"), []byte("v1"), 0)
+	rawKV.RawPutCF("write", []byte("b"), []byte("v2"), 0)
+	c.Assert(rawKV.RawGetCF("", []byte("a")), BytesEquals, []byte("v0"))
+	c.Assert(rawKV.RawGetCF("lock", []byte("a")), BytesEquals, []byte("v1"))
+	c.Assert(rawKV.RawGetCF("write", []byte("a")), IsNil)
+	c.Assert(rawKV.RawScan(nil, nil, 10), HasLen, 1)
+	pairs := rawKV.RawScanCF("write", nil, nil, 10)
+	c.Assert(pairs, HasLen, 1)
+	c.Assert(pairs[0].Key, BytesEquals, []byte("b"))
+	pairs = rawKV.RawReverseScanCF("lock", nil, nil, 10)
+	c.Assert(pairs, HasLen, 1)
+	c.Assert(pairs[0].Key, BytesEquals, []byte("a"))
+	rawKV.RawDeleteRangeCF("lock", nil, nil)
+	c.Assert(rawKV.RawGetCF("lock", []byte("a")), IsNil)
+	c.Assert(rawKV.RawGet([]byte("a")), BytesEquals, []byte("v0"))
+
+	// Keys with TTL expire lazily.
+	rawKV.RawPutCF("", []byte("t"), []byte("v3"), 10)
+	ttl, found := rawKV.RawGetKeyTTL("", []byte("t"))
+	c.Assert(found, IsTrue)
+	c.Assert(ttl, Equals, uint64(10))
+	ttl, found = rawKV.RawGetKeyTTL("", []byte("a"))
+	c.Assert(found, IsTrue)
+	c.Assert(ttl, Equals, uint64(0))
+	now = now.Add(10 * time.Second)
+	c.Assert(rawKV.RawGet([]byte("t")), IsNil)
+	_, found = rawKV.RawGetKeyTTL("", []byte("t"))
+	c.Assert(found, IsFalse)
+	rawKV.RawBatchPutCF("", [][]byte{[]byte("t1"), []byte("t2")}, [][]byte{[]byte("v4"), []byte("v5")}, 5)
+	c.Assert(rawKV.RawScan([]byte("t"), nil, 10), HasLen, 2)
+	now = now.Add(5 * time.Second)
+	c.Assert(rawKV.RawScan([]byte("t"), nil, 10), HasLen, 0)
+
+	// Compare and swap.
+	prev, swapped := rawKV.RawCompareAndSwap("", []byte("c"), nil, []byte("v6"), 0)
+	c.Assert(swapped, IsTrue)
+	c.Assert(prev, IsNil)
+	prev, swapped = rawKV.RawCompareAndSwap("", []byte("c"), nil, []byte("v7"), 0)
+	c.Assert(swapped, IsFalse)
+	c.Assert(prev, BytesEquals, []byte("v6"))
+	prev, swapped = rawKV.RawCompareAndSwap("", []byte("c"), []byte("v6"), []byte("v7"), 0)
+	c.Assert(swapped, IsTrue)
+	c.Assert(prev, BytesEquals, []byte("v6"))
+	c.Assert(rawKV.RawGet([]byte("c")), BytesEquals, []byte("v7"))
+
+	// A key with an empty value doesn't exist.
+	rawKV.RawPutCF("", []byte("e"), nil, 0)
+	_, found = rawKV.RawGetKeyTTL("", []byte("e"))
+	c.Assert(found, IsFalse)
+	prev, swapped = rawKV.RawCompareAndSwap("", []byte("e"), nil, []byte("v8"), 0)
+	c.Assert(swapped, IsTrue)
+	c.Assert(prev, IsNil)
+
+	// Batch scan.
+	rawKV.RawBatchPutCF("write", [][]byte{[]byte("c"), []byte("d"), []byte("e")}, [][]byte{[]byte("1"), []byte("2"), []byte("3")}, 0)
+	pairs = rawKV.RawBatchScanCF("write", []solomonkey.KeyRange{
+		{StartKey: []byte("a"), EndKey: []byte("d")},
+		{StartKey: []byte("d")},
+	}, 1)
+	c.Assert(pairs, HasLen, 2)
+	c.Assert(pairs[0].Key, BytesEquals, []byte("b"))
+	c.Assert(pairs[1].Key, BytesEquals, []byte("d"))
+}
+
+func (s *testMVCCLevelDB) TestRawCFKeyspace(c *C) {
+	causetstore, err := NewMVCCLevelDB("")
+	c.Assert(err, IsNil)
+	defer causetstore.Close()
+
+	// The column families and the TTLs are kept out of the MVCC keys, a scan of the
+	// locks from the empty key doesn't meet them.
+	causetstore.RawPutCF("lock", []byte("a"), []byte("v"), 0)
+	causetstore.RawPutCF("write", []byte("b"), []byte("v"), 10)
+	locks, err := causetstore.ScanLock(nil, nil, math.MaxUint64)
+	c.Assert(err, IsNil)
+	c.Assert(locks, HasLen, 0)
+	c.Assert(causetstore.RawScan(nil, nil, 10), HasLen, 0)
+
+	// Any key of the default column family is visible, including the keys looking
+	// like the keys of other column families.
+	key := []byte("lock\x00a")
+	causetstore.RawPut(key, []byte("v0"))
+	pairs := causetstore.RawScan(nil, nil, 10)
+	c.Assert(pairs, HasLen, 1)
+	c.Assert(pairs[0].Key, BytesEquals, key)
+	c.Assert(causetstore.RawGetCF("lock", []byte("a")), BytesEquals, []byte("v"))
+}
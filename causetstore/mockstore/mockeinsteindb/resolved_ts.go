@@ -0,0 +1,158 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/oracle"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/cdc"
+	"github.com/whtcorpsinc/errors"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/errorpb"
+)
+
+// tsoProgress returns the last ts allocated by the mock FIDel clients.
+func tsoProgress() uint64 {
+	tsMu.Lock()
+	defer tsMu.Unlock()
+
+	return oracle.ComposeTS(tsMu.physicalTS, tsMu.logicalTS)
+}
+
+// GetRegionResolvedTS returns the resolved ts of a Region computed by cdc.ResolvedTS
+// from the TSO progress, it never goes backwards.
+func (c *Cluster) GetRegionResolvedTS(regionID uint64) (uint64, error) {
+	region, _ := c.GetRegion(regionID)
+	if region == nil {
+		return 0, errors.Errorf("region %d not found", regionID)
+	}
+	minLockTS := func(startKey, endKey []byte) (uint64, bool, error) {
+		return storeMinLockTS(c.mvsr-oocStore, startKey, endKey)
+	}
+	resolved, err := cdc.ResolvedTS(tsoProgress, minLockTS, MvccKey(region.StartKey).Raw(), MvccKey(region.EndKey).Raw())
+	if err != nil {
+		return 0, errors.Trace(err)
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if c.resolvedTSs == nil {
+		c.resolvedTSs = make(map[uint64]uint64)
+	}
+	if resolved < c.resolvedTSs[regionID] {
+		resolved = c.resolvedTSs[regionID]
+	}
+	c.resolvedTSs[regionID] = resolved
+	return resolved, nil
+}
+
+// GetPeerSafeTS returns the safe ts of a Peer, a stale read at a ts not greater than
+// it can be served by the Peer without the read index. It's the resolved ts of the
+// Region for the leader, a follower lags behind by its replication lag.
+func (c *Cluster) GetPeerSafeTS(regionID, peerID uint64) (uint64, error) {
+	safeTS, err := c.GetRegionResolvedTS(regionID)
+	if err != nil {
+		return 0, err
+	}
+	_, leaderID := c.GetRegion(regionID)
+	if appliedTS := c.GetPeerAppliedTS(peerID); peerID != leaderID && appliedTS < safeTS {
+		safeTS = appliedTS
+	}
+	return safeTS, nil
+}
+
+// GetStoreSafeTS returns the minimum safe ts of the Peers on a CausetStore.
+func (c *Cluster) GetStoreSafeTS(storeID uint64) (uint64, error) {
+	type regionPeer struct{ regionID, peerID uint64 }
+	var peers []regionPeer
+	c.RLock()
+	for _, r := range c.regions {
+		if p := regionPeerOnStore(r.Meta, storeID); p != nil {
+			peers = append(peers, regionPeer{r.Meta.GetId(), p.GetId()})
+		}
+	}
+	c.RUnlock()
+
+	safeTS := tsoProgress()
+	for _, p := range peers {
+		ts, err := c.GetPeerSafeTS(p.regionID, p.peerID)
+		if err != nil {
+			return 0, err
+		}
+		if ts < safeTS {
+			safeTS = ts
+		}
+	}
+	return safeTS, nil
+}
+
+type staleReadKey struct{}
+
+// WithStaleRead marks the read requests sent with the context as stale reads. A stale
+// read can be served by any replica whose safe ts is not less than the read ts, it's
+// rejected with a retryable error otherwise.
+func WithStaleRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, staleReadKey{}, true)
+}
+
+// IsStaleRead checks whether the context is marked by WithStaleRead.
+func IsStaleRead(ctx context.Context) bool {
+	staleRead, _ := ctx.Value(staleReadKey{}).(bool)
+	return staleRead
+}
+
+// staleReadTS returns the read ts of a stale read request, 0 if the request isn't a
+// stale read.
+func staleReadTS(ctx context.Context, req *einsteindbrpc.Request) uint64 {
+	if !IsStaleRead(ctx) {
+		return 0
+	}
+	ts, _ := readTS(req)
+	return ts
+}
+
+// readTS returns the read ts of a read command, ok is false for the other commands.
+func readTS(req *einsteindbrpc.Request) (ts uint64, ok bool) {
+	switch req.Type {
+	case einsteindbrpc.CmdGet:
+		return req.Get().GetVersion(), true
+	case einsteindbrpc.CmdBatchGet:
+		return req.BatchGet().GetVersion(), true
+	case einsteindbrpc.CmdScan:
+		return req.Scan().GetVersion(), true
+	case einsteindbrpc.CmdINTERLOCK, einsteindbrpc.CmdINTERLOCKStream:
+		return req.Causet().GetStartTs(), true
+	}
+	return 0, false
+}
+
+// checkStaleRead rejects the stale read if the read ts exceeds the safe ts of the Peer.
+func (h *rpcHandler) checkStaleRead(regionID, peerID uint64) *errorpb.Error {
+	safeTS, err := h.cluster.GetPeerSafeTS(regionID, peerID)
+	if err != nil {
+		return &errorpb.Error{Message: *proto.String(err.Error())}
+	}
+	if h.staleReadTS > safeTS {
+		return &errorpb.Error{
+			Message: *proto.String("data is not ready"),
+			ServerIsBusy: &errorpb.ServerIsBusy{
+				Reason: fmt.Sprintf("stale read ts %d exceeds safe ts %d", h.staleReadTS, safeTS),
+			},
+		}
+	}
+	return nil
+}
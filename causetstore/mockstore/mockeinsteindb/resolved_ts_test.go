@@ -0,0 +1,83 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"context"
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/oracle"
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+)
+
+func (s *testRPCHandlerSuite) TestResolvedTS(c *C) {
+	causetstore := MustNewMVCCStore()
+	cluster := NewCluster(causetstore)
+	storeIDs, peerIDs, regionID, _ := BootstrapWithMultiStores(cluster, 2)
+	fidelCli := NewFIDelClient(cluster).(*FIDelClient)
+	getTS := func() uint64 {
+		physical, logical, err := fidelCli.GetTS(context.Background())
+		c.Assert(err, IsNil)
+		return oracle.ComposeTS(physical, logical)
+	}
+
+	ts1 := getTS()
+	resolved, err := fidelCli.GetRegionResolvedTS(context.Background(), regionID)
+	c.Assert(err, IsNil)
+	c.Assert(resolved, Equals, ts1)
+
+	// An outstanding dagger holds the resolved ts.
+	ts2 := getTS()
+	MustPrewriteOK(c, causetstore, putMutations("a", "v"), "a", ts2, 3000)
+	getTS()
+	resolved, err = cluster.GetRegionResolvedTS(regionID)
+	c.Assert(err, IsNil)
+	c.Assert(resolved, Equals, ts2-1)
+	_, err = cluster.GetRegionResolvedTS(regionID + 100)
+	c.Assert(err, NotNil)
+
+	// The resolved ts never goes backwards.
+	MustPrewriteOK(c, causetstore, putMutations("b", "v"), "b", ts1, 3000)
+	resolved, err = cluster.GetRegionResolvedTS(regionID)
+	c.Assert(err, IsNil)
+	c.Assert(resolved, Equals, ts2-1)
+
+	// A lagging follower has a smaller safe ts.
+	cluster.SetPeerLag(peerIDs[1], time.Hour)
+	safeTS, err := cluster.GetPeerSafeTS(regionID, peerIDs[1])
+	c.Assert(err, IsNil)
+	c.Assert(safeTS < ts1, IsTrue)
+	storeSafeTS, err := fidelCli.GetStoreSafeTS(context.Background(), storeIDs[1])
+	c.Assert(err, IsNil)
+	c.Assert(storeSafeTS, Equals, safeTS)
+
+	region, _ := cluster.GetRegion(regionID)
+	ctx := &kvrpcpb.Context{
+		RegionId:    regionID,
+		RegionEpoch: region.RegionEpoch,
+		Peer:        region.Peers[0],
+	}
+	h := &rpcHandler{cluster: cluster, storeID: storeIDs[0], staleReadTS: ts2 - 1}
+	c.Assert(h.checkRequestContext(ctx), IsNil)
+	h.staleReadTS = ts2
+	c.Assert(h.checkRequestContext(ctx).GetServerIsBusy(), NotNil)
+
+	// A stale read is served by a follower without the replica read flag.
+	ctx.Peer = region.Peers[1]
+	h = &rpcHandler{cluster: cluster, storeID: storeIDs[1], staleReadTS: safeTS}
+	c.Assert(h.checkRequestContext(ctx), IsNil)
+	h.staleReadTS = ts2 - 1
+	c.Assert(h.checkRequestContext(ctx).GetServerIsBusy(), NotNil)
+}
@@ -23,11 +23,13 @@ import (
 	"time"
 
 	"github.com/golang/protobuf/proto"
-	"github.com/opentracing/opentracing-go"
 	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/dataversion"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/rpctrace"
 	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
 	"github.com/whtcorpsinc/berolinaAllegroSQL/terror"
 	"github.com/whtcorpsinc/solomonkeyproto/pkg/debugpb"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/einsteindbpb"
 	"github.com/whtcorpsinc/solomonkeyproto/pkg/errorpb"
 	"github.com/whtcorpsinc/solomonkeyproto/pkg/interlock"
 	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
@@ -106,6 +108,12 @@ func convertToKeyError(err error) *kvrpcpb.KeyError {
 			TxnNotFound: &tmp.TxnNotFound,
 		}
 	}
+	if assertionFailed, ok := errors.Cause(err).(*ErrAssertionFailed); ok {
+		// kvrpcpb.Assertion has the same values as solomonkey.AssertionType.
+		return &kvrpcpb.KeyError{
+			Abort: solomonkey.AssertionFailedAbort(assertionFailed.Key, solomonkey.AssertionType(assertionFailed.Assertion), assertionFailed.ExistingCommitTS),
+		}
+	}
 	return &kvrpcpb.KeyError{
 		Abort: err.Error(),
 	}
@@ -157,6 +165,12 @@ type rpcHandler struct {
 	// isolationLevel is used for current request.
 	isolationLevel kvrpcpb.IsolationLevel
 	resolvedLocks  []uint64
+	// replicaReadTS is the read ts of a replica read request, replicaRead is false
+	// if it isn't one.
+	replicaRead   bool
+	replicaReadTS uint64
+	// staleReadTS is the read ts of a stale read request, 0 if it isn't.
+	staleReadTS uint64
 }
 
 func isTiFlashStore(causetstore *metapb.CausetStore) bool {
@@ -214,7 +228,9 @@ func (h *rpcHandler) checkRequestContext(ctx *kvrpcpb.Context) *errorpb.Error {
 		}
 	}
 	// The Peer on the CausetStore is not leader. If it's tiflash causetstore , we pass this check.
-	if storePeer.GetId() != leaderPeer.GetId() && !isTiFlashStore(h.cluster.GetStore(storePeer.GetStoreId())) {
+	// A follower only serves the read commands of a replica read or a stale read.
+	isFollower := storePeer.GetId() != leaderPeer.GetId() && !isTiFlashStore(h.cluster.GetStore(storePeer.GetStoreId()))
+	if isFollower && !h.replicaRead && h.staleReadTS == 0 {
 		return &errorpb.Error{
 			Message: *proto.String("not leader"),
 			NotLeader: &errorpb.NotLeader{
@@ -237,6 +253,16 @@ func (h *rpcHandler) checkRequestContext(ctx *kvrpcpb.Context) *errorpb.Error {
 			},
 		}
 	}
+	// A stale read is served from the safe ts of the Peer, without the read index.
+	if h.staleReadTS > 0 {
+		if err := h.checkStaleRead(region.GetId(), storePeer.GetId()); err != nil {
+			return err
+		}
+	} else if isFollower {
+		if err := h.checkFollowerRead(storePeer.GetId()); err != nil {
+			return err
+		}
+	}
 	h.startKey, h.endKey = region.StartKey, region.EndKey
 	h.isolationLevel = ctx.IsolationLevel
 	h.resolvedLocks = ctx.ResolvedLocks
@@ -485,7 +511,16 @@ func (h *rpcHandler) handleKvScanLock(req *kvrpcpb.ScanLockRequest) *kvrpcpb.Sca
 func (h *rpcHandler) handleKvResolveLock(req *kvrpcpb.ResolveLockRequest) *kvrpcpb.ResolveLockResponse {
 	startKey := MvccKey(h.startKey).Raw()
 	endKey := MvccKey(h.endKey).Raw()
-	err := h.mvsr-oocStore.ResolveLock(startKey, endKey, req.GetStartVersion(), req.GetCommitVersion())
+	var err error
+	if len(req.TxnInfos) > 0 {
+		txnInfos := make(map[uint64]uint64, len(req.TxnInfos))
+		for _, txn := range req.TxnInfos {
+			txnInfos[txn.Txn] = txn.Status
+		}
+		err = h.mvsr-oocStore.BatchResolveLock(startKey, endKey, txnInfos)
+	} else {
+		err = h.mvsr-oocStore.ResolveLock(startKey, endKey, req.GetStartVersion(), req.GetCommitVersion())
+	}
 	if err != nil {
 		return &kvrpcpb.ResolveLockResponse{
 			Error: convertToKeyError(err),
@@ -519,19 +554,21 @@ func (h *rpcHandler) handleKvDeleteRange(req *kvrpcpb.DeleteRangeRequest) *kvrpc
 }
 
 func (h *rpcHandler) handleKvRawGet(req *kvrpcpb.RawGetRequest) *kvrpcpb.RawGetResponse {
-	rawKV, ok := h.mvsr-oocStore.(RawKV)
+	rawKV, ok := h.mvsr-oocStore.(RawKVExt)
 	if !ok {
 		return &kvrpcpb.RawGetResponse{
 			Error: "not implemented",
 		}
 	}
+	val := rawKV.RawGetCF(req.GetCf(), req.GetKey())
 	return &kvrpcpb.RawGetResponse{
-		Value: rawKV.RawGet(req.GetKey()),
+		Value:    val,
+		NotFound: len(val) == 0,
 	}
 }
 
 func (h *rpcHandler) handleKvRawBatchGet(req *kvrpcpb.RawBatchGetRequest) *kvrpcpb.RawBatchGetResponse {
-	rawKV, ok := h.mvsr-oocStore.(RawKV)
+	rawKV, ok := h.mvsr-oocStore.(RawKVExt)
 	if !ok {
 		// TODO should we add error ?
 		return &kvrpcpb.RawBatchGetResponse{
@@ -540,7 +577,7 @@ func (h *rpcHandler) handleKvRawBatchGet(req *kvrpcpb.RawBatchGetRequest) *kvrpc
 			},
 		}
 	}
-	values := rawKV.RawBatchGet(req.Keys)
+	values := rawKV.RawBatchGetCF(req.GetCf(), req.Keys)
 	kvPairs := make([]*kvrpcpb.KvPair, len(values))
 	for i, key := range req.Keys {
 		kvPairs[i] = &kvrpcpb.KvPair{
@@ -554,18 +591,18 @@ func (h *rpcHandler) handleKvRawBatchGet(req *kvrpcpb.RawBatchGetRequest) *kvrpc
 }
 
 func (h *rpcHandler) handleKvRawPut(req *kvrpcpb.RawPutRequest) *kvrpcpb.RawPutResponse {
-	rawKV, ok := h.mvsr-oocStore.(RawKV)
+	rawKV, ok := h.mvsr-oocStore.(RawKVExt)
 	if !ok {
 		return &kvrpcpb.RawPutResponse{
 			Error: "not implemented",
 		}
 	}
-	rawKV.RawPut(req.GetKey(), req.GetValue())
+	rawKV.RawPutCF(req.GetCf(), req.GetKey(), req.GetValue(), 0)
 	return &kvrpcpb.RawPutResponse{}
 }
 
 func (h *rpcHandler) handleKvRawBatchPut(req *kvrpcpb.RawBatchPutRequest) *kvrpcpb.RawBatchPutResponse {
-	rawKV, ok := h.mvsr-oocStore.(RawKV)
+	rawKV, ok := h.mvsr-oocStore.(RawKVExt)
 	if !ok {
 		return &kvrpcpb.RawBatchPutResponse{
 			Error: "not implemented",
@@ -577,45 +614,45 @@ func (h *rpcHandler) handleKvRawBatchPut(req *kvrpcpb.RawBatchPutRequest) *kvrpc
 		keys = append(keys, pair.Key)
 		values = append(values, pair.Value)
 	}
-	rawKV.RawBatchPut(keys, values)
+	rawKV.RawBatchPutCF(req.GetCf(), keys, values, 0)
 	return &kvrpcpb.RawBatchPutResponse{}
 }
 
 func (h *rpcHandler) handleKvRawDelete(req *kvrpcpb.RawDeleteRequest) *kvrpcpb.RawDeleteResponse {
-	rawKV, ok := h.mvsr-oocStore.(RawKV)
+	rawKV, ok := h.mvsr-oocStore.(RawKVExt)
 	if !ok {
 		return &kvrpcpb.RawDeleteResponse{
 			Error: "not implemented",
 		}
 	}
-	rawKV.RawDelete(req.GetKey())
+	rawKV.RawDeleteCF(req.GetCf(), req.GetKey())
 	return &kvrpcpb.RawDeleteResponse{}
 }
 
 func (h *rpcHandler) handleKvRawBatchDelete(req *kvrpcpb.RawBatchDeleteRequest) *kvrpcpb.RawBatchDeleteResponse {
-	rawKV, ok := h.mvsr-oocStore.(RawKV)
+	rawKV, ok := h.mvsr-oocStore.(RawKVExt)
 	if !ok {
 		return &kvrpcpb.RawBatchDeleteResponse{
 			Error: "not implemented",
 		}
 	}
-	rawKV.RawBatchDelete(req.Keys)
+	rawKV.RawBatchDeleteCF(req.GetCf(), req.Keys)
 	return &kvrpcpb.RawBatchDeleteResponse{}
 }
 
 func (h *rpcHandler) handleKvRawDeleteRange(req *kvrpcpb.RawDeleteRangeRequest) *kvrpcpb.RawDeleteRangeResponse {
-	rawKV, ok := h.mvsr-oocStore.(RawKV)
+	rawKV, ok := h.mvsr-oocStore.(RawKVExt)
 	if !ok {
 		return &kvrpcpb.RawDeleteRangeResponse{
 			Error: "not implemented",
 		}
 	}
-	rawKV.RawDeleteRange(req.GetStartKey(), req.GetEndKey())
+	rawKV.RawDeleteRangeCF(req.GetCf(), req.GetStartKey(), req.GetEndKey())
 	return &kvrpcpb.RawDeleteRangeResponse{}
 }
 
 func (h *rpcHandler) handleKvRawScan(req *kvrpcpb.RawScanRequest) *kvrpcpb.RawScanResponse {
-	rawKV, ok := h.mvsr-oocStore.(RawKV)
+	rawKV, ok := h.mvsr-oocStore.(RawKVExt)
 	if !ok {
 		errStr := "not implemented"
 		return &kvrpcpb.RawScanResponse{
@@ -631,7 +668,8 @@ func (h *rpcHandler) handleKvRawScan(req *kvrpcpb.RawScanRequest) *kvrpcpb.RawSc
 		if bytes.Compare(req.EndKey, lowerBound) > 0 {
 			lowerBound = req.EndKey
 		}
-		pairs = rawKV.RawReverseScan(
+		pairs = rawKV.RawReverseScanCF(
+			req.GetCf(),
 			req.StartKey,
 			lowerBound,
 			int(req.GetLimit()),
@@ -641,7 +679,8 @@ func (h *rpcHandler) handleKvRawScan(req *kvrpcpb.RawScanRequest) *kvrpcpb.RawSc
 		if len(req.EndKey) > 0 && (len(upperBound) == 0 || bytes.Compare(req.EndKey, upperBound) < 0) {
 			upperBound = req.EndKey
 		}
-		pairs = rawKV.RawScan(
+		pairs = rawKV.RawScanCF(
+			req.GetCf(),
 			req.StartKey,
 			upperBound,
 			int(req.GetLimit()),
@@ -689,7 +728,13 @@ func drainRowsFromExecutor(ctx context.Context, e executor, req *fidelpb.PosetDa
 	}
 }
 
-func (h *rpcHandler) handleBatchINTERLOCKRequest(ctx context.Context, req *interlock.BatchRequest) (*mockBatchCoFIDelataClient, error) {
+func (h *rpcHandler) handleBatchINTERLOCKRequest(ctx context.Context, req *interlock.BatchRequest) (einsteindbpb.EinsteinDB_Batchinterlocking_directorateClient, error) {
+	if isTiFlashStore(h.cluster.GetStore(h.storeID)) {
+		client, err := h.handleColumnarBatchINTERLOCK(req)
+		if err != nil || client != nil {
+			return client, errors.Trace(err)
+		}
+	}
 	client := &mockBatchCoFIDelataClient{}
 	for _, ri := range req.Regions {
 		INTERLOCK := interlock.Request{
@@ -727,6 +772,7 @@ type RPCClient struct {
 	MvccStore     MVCCStore
 	streamTimeout chan *einsteindbrpc.Lease
 	done          chan struct{}
+	tracer        *rpctrace.Tracer
 	// rpcCli uses to redirects RPC request to MilevaDB rpc server, It is only use for test.
 	// Mock MilevaDB rpc service will have circle import problem, so just use a real RPC client to send this RPC  server.
 	// sync.Once uses to avoid concurrency initialize rpcCli.
@@ -745,6 +791,7 @@ func NewRPCClient(cluster *Cluster, mvsr-oocStore MVCCStore) *RPCClient {
 		MvccStore:     mvsr-oocStore,
 		streamTimeout: ch,
 		done:          done,
+		tracer:        rpctrace.NewTracer(),
 	}
 }
 
@@ -800,14 +847,21 @@ func (c *RPCClient) redirectRequestToRPCServer(ctx context.Context, addr string,
 	return c.rpcCli.SendRequest(ctx, addr, req, timeout)
 }
 
+// SetTraceHook sets the hook called with the trace Span of every request attempt,
+// nil removes it.
+func (c *RPCClient) SetTraceHook(hook rpctrace.Hook) {
+	c.tracer.SetHook(hook)
+}
+
 // SendRequest sends a request to mock cluster.
 func (c *RPCClient) SendRequest(ctx context.Context, addr string, req *einsteindbrpc.Request, timeout time.Duration) (*einsteindbrpc.Response, error) {
-	if span := opentracing.SpanFromContext(ctx); span != nil && span.Tracer() != nil {
-		span1 := span.Tracer().StartSpan("RPCClient.SendRequest", opentracing.ChildOf(span.Context()))
-		defer span1.Finish()
-		ctx = opentracing.ContextWithSpan(ctx, span1)
-	}
+	ctx, span := c.tracer.Start(ctx, addr, req)
+	resp, err := c.sendRequest(ctx, addr, req, timeout)
+	c.tracer.Finish(span, resp, err)
+	return resp, err
+}
 
+func (c *RPCClient) sendRequest(ctx context.Context, addr string, req *einsteindbrpc.Request, timeout time.Duration) (*einsteindbrpc.Response, error) {
 	failpoint.Inject("rpcServerBusy", func(val failpoint.Value) {
 		if val.(bool) {
 			failpoint.Return(einsteindbrpc.GenRegionErrorResp(req, &errorpb.Error{ServerIsBusy: &errorpb.ServerIsBusy{}}))
@@ -829,6 +883,13 @@ func (c *RPCClient) SendRequest(ctx context.Context, addr string, req *einsteind
 	if err != nil {
 		return nil, err
 	}
+	handler.replicaReadTS, handler.replicaRead = replicaReadTS(req)
+	handler.staleReadTS = staleReadTS(ctx, req)
+	if commitTS, ok := dataversion.WriteCommitTS(req); ok {
+		// The version is bumped after the write, a result read before the write can't
+		// be cached with the new version.
+		defer c.Cluster.BumpRegionDataVersion(reqCtx.GetRegionId(), commitTS)
+	}
 	switch req.Type {
 	case einsteindbrpc.CmdGet:
 		r := req.Get()
@@ -1040,8 +1101,8 @@ func (c *RPCClient) SendRequest(ctx context.Context, addr string, req *einsteind
 		handler.rawEndKey = MvccKey(handler.endKey).Raw()
 		var res *interlock.Response
 		switch r.GetTp() {
-		case solomonkey.ReqTypePosetDag:
-			res = handler.handleCoFIDelAGRequest(r)
+		case solomonkey.ReqTypePosetDag, solomonkey.ReqTypePagingPosetDag:
+			res = handler.handleCacheablePosetDagRequest(r)
 		case solomonkey.ReqTypeAnalyze:
 			res = handler.handleINTERLOCKAnalyzeRequest(r)
 		case solomonkey.ReqTypeChecksum:
@@ -0,0 +1,325 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"context"
+	"math"
+	"time"
+
+	fidel "github.com/einsteindb/fidel/client"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/errors"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/metapb"
+)
+
+// snapshotReadTimeout is the timeout of the requests sent by a snapshot.
+const snapshotReadTimeout = 20 * time.Second
+
+// snapshot is a solomonkey.Snapshot reading the mock cluster at a version. The reads are
+// sent to the replicas chosen by the ReplicaRead option through the RPCClient. With the
+// StaleRead option, a read is at the ts resolved from the safe ts of the replicas
+// serving it, and fails fast on locks instead of resolving them.
+type snapshot struct {
+	client      *RPCClient
+	fidelCli    fidel.Client
+	version     uint64
+	replicaRead solomonkey.ReplicaReadType
+	staleRead   *solomonkey.StaleReadOption
+}
+
+// NewSnapshot returns a snapshot of the mock cluster at the version, the fidelCli is
+// used to get the GC safe point for the stale reads.
+func (c *RPCClient) NewSnapshot(fidelCli fidel.Client, ver uint64) solomonkey.Snapshot {
+	return &snapshot{client: c, fidelCli: fidelCli, version: ver}
+}
+
+// SetOption implements the solomonkey.Snapshot interface.
+func (s *snapshot) SetOption(opt solomonkey.Option, val interface{}) {
+	switch opt {
+	case solomonkey.ReplicaRead:
+		s.replicaRead = val.(solomonkey.ReplicaReadType)
+	case solomonkey.StaleRead:
+		staleRead := val.(solomonkey.StaleReadOption)
+		s.staleRead = &staleRead
+	}
+}
+
+// DelOption implements the solomonkey.Snapshot interface.
+func (s *snapshot) DelOption(opt solomonkey.Option) {
+	switch opt {
+	case solomonkey.ReplicaRead:
+		s.replicaRead = solomonkey.ReplicaReadLeader
+	case solomonkey.StaleRead:
+		s.staleRead = nil
+	}
+}
+
+// regionRead is the read of a snapshot in a Region, served by the replica on addr.
+type regionRead struct {
+	reqCtx kvrpcpb.Context
+	addr   string
+	// keys are the keys to get in the Region.
+	keys [][]byte
+	// startKey and endKey are the raw range to scan in the Region.
+	startKey, endKey []byte
+}
+
+// newRegionRead returns the read in the Region served by the replica chosen for the
+// snapshot. A stale read prefers a follower as a ReplicaReadMixed read does.
+func (s *snapshot) newRegionRead(region *metapb.Region) (*regionRead, error) {
+	replicaRead := s.replicaRead
+	if s.staleRead != nil && !replicaRead.IsFollowerRead() {
+		replicaRead = solomonkey.ReplicaReadMixed
+	}
+	cluster := s.client.Cluster
+	peer := cluster.GetReplicaForRead(region.GetId(), replicaRead, nil)
+	if peer == nil {
+		return nil, errors.Errorf("no replica of region %d can serve the read", region.GetId())
+	}
+	causetstore := cluster.GetStore(peer.GetStoreId())
+	if causetstore == nil {
+		return nil, errors.Errorf("causetstore %d not found", peer.GetStoreId())
+	}
+	return &regionRead{
+		reqCtx: kvrpcpb.Context{
+			RegionId:    region.GetId(),
+			RegionEpoch: region.GetRegionEpoch(),
+			Peer:        peer,
+			ReplicaRead: s.staleRead == nil && replicaRead.IsFollowerRead(),
+		},
+		addr: causetstore.GetAddress(),
+	}, nil
+}
+
+// locateKeys groups the keys by the Regions containing them.
+func (s *snapshot) locateKeys(keys [][]byte) ([]*regionRead, error) {
+	var reads []*regionRead
+	byRegion := make(map[uint64]*regionRead)
+	for _, k := range keys {
+		region, _ := s.client.Cluster.GetRegionByKey(NewMvccKey(k))
+		if region == nil {
+			return nil, errors.Errorf("region not found for key %q", k)
+		}
+		read := byRegion[region.GetId()]
+		if read == nil {
+			var err error
+			if read, err = s.newRegionRead(region); err != nil {
+				return nil, err
+			}
+			byRegion[region.GetId()] = read
+			reads = append(reads, read)
+		}
+		read.keys = append(read.keys, k)
+	}
+	return reads, nil
+}
+
+// locateRange splits the raw range [startKey, endKey) by the Regions it overlaps.
+func (s *snapshot) locateRange(startKey, endKey []byte) ([]*regionRead, error) {
+	regions := s.client.Cluster.ScanRegions(NewMvccKey(startKey), NewMvccKey(endKey), 0)
+	reads := make([]*regionRead, 0, len(regions))
+	for _, r := range regions {
+		read, err := s.newRegionRead(r.Meta)
+		if err != nil {
+			return nil, err
+		}
+		read.startKey, read.endKey = MvccKey(r.Meta.GetStartKey()).Raw(), MvccKey(r.Meta.GetEndKey()).Raw()
+		if solomonkey.Key(read.startKey).Cmp(startKey) < 0 {
+			read.startKey = startKey
+		}
+		if len(endKey) > 0 && (len(read.endKey) == 0 || solomonkey.Key(read.endKey).Cmp(endKey) > 0) {
+			read.endKey = endKey
+		}
+		reads = append(reads, read)
+	}
+	return reads, nil
+}
+
+// readTS returns the ts and the context to send the Region reads with. A stale read is
+// at the ts resolved from the minimum safe ts of the replicas serving the reads.
+func (s *snapshot) readTS(ctx context.Context, reads []*regionRead) (uint64, context.Context, error) {
+	if s.staleRead == nil {
+		return s.version, ctx, nil
+	}
+	var safeTS uint64 = math.MaxUint64
+	for _, read := range reads {
+		ts, err := s.client.Cluster.GetPeerSafeTS(read.reqCtx.GetRegionId(), read.reqCtx.GetPeer().GetId())
+		if err != nil {
+			return 0, nil, errors.Trace(err)
+		}
+		if ts < safeTS {
+			safeTS = ts
+		}
+	}
+	gcSafePoint, err := s.fidelCli.UFIDelateGCSafePoint(ctx, 0)
+	if err != nil {
+		return 0, nil, errors.Trace(err)
+	}
+	ts, err := s.staleRead.ResolveTS(time.Now(), safeTS, gcSafePoint)
+	if err != nil {
+		return 0, nil, err
+	}
+	return ts, WithStaleRead(ctx), nil
+}
+
+// send sends the request of the Region read to its replica.
+func (s *snapshot) send(ctx context.Context, read *regionRead, tp einsteindbrpc.CmdType, req interface{}) (*einsteindbrpc.Response, error) {
+	resp, err := s.client.SendRequest(ctx, read.addr, einsteindbrpc.NewRequest(tp, req, read.reqCtx), snapshotReadTimeout)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	regionErr, err := resp.GetRegionError()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if regionErr != nil {
+		return nil, errors.New(regionErr.String())
+	}
+	return resp, nil
+}
+
+// keyError converts a KeyError returned by the mock cluster to an error. A snapshot
+// doesn't resolve locks, the read fails on them.
+func keyError(keyErr *kvrpcpb.KeyError) error {
+	if keyErr.Locked != nil {
+		return errors.Errorf("key is locked, key: %q, primary: %q, txnStartTS: %v",
+			keyErr.Locked.Key, keyErr.Locked.PrimaryLock, keyErr.Locked.LockVersion)
+	}
+	return errors.New(keyErr.String())
+}
+
+// Get implements the solomonkey.Snapshot interface.
+func (s *snapshot) Get(ctx context.Context, k solomonkey.Key) ([]byte, error) {
+	m, err := s.BatchGet(ctx, []solomonkey.Key{k})
+	if err != nil {
+		return nil, err
+	}
+	val, ok := m[string(k)]
+	if !ok {
+		return nil, solomonkey.ErrNotExist
+	}
+	return val, nil
+}
+
+// BatchGet implements the solomonkey.Snapshot interface.
+func (s *snapshot) BatchGet(ctx context.Context, keys []solomonkey.Key) (map[string][]byte, error) {
+	ks := make([][]byte, 0, len(keys))
+	for _, k := range keys {
+		ks = append(ks, k)
+	}
+	reads, err := s.locateKeys(ks)
+	if err != nil {
+		return nil, err
+	}
+	ts, ctx, err := s.readTS(ctx, reads)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string][]byte, len(keys))
+	for _, read := range reads {
+		resp, err := s.send(ctx, read, einsteindbrpc.CmdBatchGet, &kvrpcpb.BatchGetRequest{Keys: read.keys, Version: ts})
+		if err != nil {
+			return nil, err
+		}
+		for _, pair := range resp.Resp.(*kvrpcpb.BatchGetResponse).Pairs {
+			if pair.Error != nil {
+				return nil, keyError(pair.Error)
+			}
+			if len(pair.Value) > 0 {
+				m[string(pair.Key)] = pair.Value
+			}
+		}
+	}
+	return m, nil
+}
+
+// scan scans the pairs in [startKey, endKey) Region by Region.
+func (s *snapshot) scan(ctx context.Context, startKey, endKey []byte) ([]*kvrpcpb.KvPair, error) {
+	reads, err := s.locateRange(startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	ts, ctx, err := s.readTS(ctx, reads)
+	if err != nil {
+		return nil, err
+	}
+	var pairs []*kvrpcpb.KvPair
+	for _, read := range reads {
+		resp, err := s.send(ctx, read, einsteindbrpc.CmdScan, &kvrpcpb.ScanRequest{
+			StartKey: read.startKey,
+			EndKey:   read.endKey,
+			Limit:    math.MaxUint32,
+			Version:  ts,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, pair := range resp.Resp.(*kvrpcpb.ScanResponse).Pairs {
+			if pair.Error != nil {
+				return nil, keyError(pair.Error)
+			}
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs, nil
+}
+
+// Iter implements the solomonkey.Snapshot interface.
+func (s *snapshot) Iter(k solomonkey.Key, upperBound solomonkey.Key) (solomonkey.Iterator, error) {
+	pairs, err := s.scan(context.Background(), k, upperBound)
+	if err != nil {
+		return nil, err
+	}
+	return &pairsIterator{pairs: pairs}, nil
+}
+
+// IterReverse implements the solomonkey.Snapshot interface.
+func (s *snapshot) IterReverse(k solomonkey.Key) (solomonkey.Iterator, error) {
+	pairs, err := s.scan(context.Background(), nil, k)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(pairs)-1; i < j; i, j = i+1, j-1 {
+		pairs[i], pairs[j] = pairs[j], pairs[i]
+	}
+	return &pairsIterator{pairs: pairs}, nil
+}
+
+// pairsIterator iterates the pairs returned by a scan.
+type pairsIterator struct {
+	pairs []*kvrpcpb.KvPair
+	idx   int
+}
+
+func (it *pairsIterator) Valid() bool {
+	return it.idx < len(it.pairs)
+}
+
+func (it *pairsIterator) Key() solomonkey.Key {
+	return it.pairs[it.idx].Key
+}
+
+func (it *pairsIterator) Value() []byte {
+	return it.pairs[it.idx].Value
+}
+
+func (it *pairsIterator) Next() error {
+	it.idx++
+	return nil
+}
+
+func (it *pairsIterator) Close() {}
@@ -0,0 +1,119 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"context"
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/oracle"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	. "github.com/whtcorpsinc/check"
+)
+
+func (s *testRPCHandlerSuite) TestStaleReadSnapshot(c *C) {
+	causetstore := MustNewMVCCStore()
+	cluster := NewCluster(causetstore)
+	_, _, regionID, _ := BootstrapWithMultiStores(cluster, 2)
+	// Split the keys from c to another Region.
+	newPeerIDs := cluster.AllocIDs(2)
+	cluster.Split(regionID, cluster.AllocID(), []byte("c"), newPeerIDs, newPeerIDs[0])
+	client := NewRPCClient(cluster, causetstore)
+	fidelCli := NewFIDelClient(cluster)
+	getTS := func() uint64 {
+		physical, logical, err := fidelCli.GetTS(context.Background())
+		c.Assert(err, IsNil)
+		return oracle.ComposeTS(physical, logical)
+	}
+
+	ts1 := getTS()
+	MustPrewriteOK(c, causetstore, putMutations("a", "v1", "b", "v1", "d", "v1"), "a", ts1, 3000)
+	ts2 := getTS()
+	c.Assert(causetstore.Commit([][]byte{[]byte("a"), []byte("b"), []byte("d")}, ts1, ts2), IsNil)
+	ts3 := getTS()
+	MustPrewriteOK(c, causetstore, putMutations("a", "v2"), "a", ts3, 3000)
+
+	// The snapshot reads at the stale read ts instead of its version.
+	snap := client.NewSnapshot(fidelCli, getTS())
+	snap.SetOption(solomonkey.StaleRead, solomonkey.StaleReadOption{ReadTS: ts3 - 1})
+	val, err := snap.Get(context.Background(), solomonkey.Key("a"))
+	c.Assert(err, IsNil)
+	c.Assert(string(val), Equals, "v1")
+	m, err := snap.BatchGet(context.Background(), []solomonkey.Key{solomonkey.Key("a"), solomonkey.Key("b"), solomonkey.Key("c"), solomonkey.Key("d")})
+	c.Assert(err, IsNil)
+	c.Assert(m, HasLen, 3)
+	it, err := snap.Iter(nil, nil)
+	c.Assert(err, IsNil)
+	var keys []string
+	for ; it.Valid(); c.Assert(it.Next(), IsNil) {
+		keys = append(keys, string(it.Key()))
+	}
+	it.Close()
+	c.Assert(keys, DeepEquals, []string{"a", "b", "d"})
+
+	// The outstanding dagger holds the safe ts of its Region, a read ts after it is
+	// rejected there, but not in the other Region.
+	snap.SetOption(solomonkey.StaleRead, solomonkey.StaleReadOption{ReadTS: ts3})
+	_, err = snap.Get(context.Background(), solomonkey.Key("a"))
+	c.Assert(solomonkey.ErrStaleReadTSTooNew.Equal(err), IsTrue)
+	val, err = snap.Get(context.Background(), solomonkey.Key("d"))
+	c.Assert(err, IsNil)
+	c.Assert(string(val), Equals, "v1")
+	it, err = snap.Iter(solomonkey.Key("c"), nil)
+	c.Assert(err, IsNil)
+	c.Assert(string(it.Key()), Equals, "d")
+	it.Close()
+
+	// The read is served by the chosen replica, a lagging follower can't serve it.
+	cluster.SetPeerLag(newPeerIDs[1], time.Hour)
+	snap.SetOption(solomonkey.ReplicaRead, solomonkey.ReplicaReadFollower)
+	_, err = snap.Get(context.Background(), solomonkey.Key("d"))
+	c.Assert(solomonkey.ErrStaleReadTSTooNew.Equal(err), IsTrue)
+	snap.DelOption(solomonkey.ReplicaRead)
+	_, err = snap.Get(context.Background(), solomonkey.Key("d"))
+	c.Assert(err, IsNil)
+	cluster.SetPeerLag(newPeerIDs[1], 0)
+
+	// Max staleness reads at the safe ts.
+	snap.SetOption(solomonkey.StaleRead, solomonkey.StaleReadOption{MaxStaleness: time.Hour})
+	val, err = snap.Get(context.Background(), solomonkey.Key("b"))
+	c.Assert(err, IsNil)
+	c.Assert(string(val), Equals, "v1")
+
+	// A dagger of a start ts below the safe ts fails the stale read fast, and is left
+	// unresolved.
+	ts4 := getTS()
+	_, err = snap.Get(context.Background(), solomonkey.Key("d"))
+	c.Assert(err, IsNil)
+	MustPrewriteOK(c, causetstore, putMutations("e", "v2"), "e", ts4, 3000)
+	snap.SetOption(solomonkey.StaleRead, solomonkey.StaleReadOption{ReadTS: ts4})
+	_, err = snap.Get(context.Background(), solomonkey.Key("e"))
+	c.Assert(err, ErrorMatches, ".*key is locked.*")
+	locks, err := causetstore.ScanLock([]byte("e"), []byte("f"), ts4)
+	c.Assert(err, IsNil)
+	c.Assert(locks, HasLen, 1)
+
+	// A read ts before the gc safe point is rejected.
+	_, err = fidelCli.UFIDelateGCSafePoint(context.Background(), ts2)
+	c.Assert(err, IsNil)
+	snap.SetOption(solomonkey.StaleRead, solomonkey.StaleReadOption{ReadTS: ts1})
+	_, err = snap.Get(context.Background(), solomonkey.Key("a"))
+	c.Assert(solomonkey.ErrGCTooEarly.Equal(err), IsTrue)
+
+	// Deleting the option reads at the version of the snapshot again.
+	snap.DelOption(solomonkey.StaleRead)
+	val, err = snap.Get(context.Background(), solomonkey.Key("b"))
+	c.Assert(err, IsNil)
+	c.Assert(string(val), Equals, "v1")
+}
@@ -0,0 +1,82 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mockeinsteindb
+
+import (
+	"context"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/rpctrace"
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+)
+
+func (s *testRPCHandlerSuite) TestRPCClientTrace(c *C) {
+	causetstore := MustNewMVCCStore()
+	cluster := NewCluster(causetstore)
+	storeIDs, _, regionID, _ := BootstrapWithMultiStores(cluster, 2)
+	region, _ := cluster.GetRegion(regionID)
+	client := NewRPCClient(cluster, causetstore)
+	defer client.Close()
+	var traces rpctrace.DefCauslector
+	client.SetTraceHook(traces.Hook)
+
+	tracer := mocktracer.New()
+	root := tracer.StartSpan("trace")
+	ctx := opentracing.ContextWithSpan(context.Background(), root)
+	req := einsteindbrpc.NewRequest(einsteindbrpc.CmdGet, &kvrpcpb.GetRequest{Key: []byte("a"), Version: 1}, kvrpcpb.Context{
+		RegionId:    regionID,
+		RegionEpoch: region.RegionEpoch,
+		Peer:        region.Peers[1],
+	})
+	// The follower replies NotLeader, the request is retried on the leader.
+	_, err := client.SendRequest(ctx, cluster.GetStore(storeIDs[1]).GetAddress(), req, time.Second)
+	c.Assert(err, IsNil)
+	req.Context.Peer = region.Peers[0]
+	_, err = client.SendRequest(ctx, cluster.GetStore(storeIDs[0]).GetAddress(), req, time.Second)
+	c.Assert(err, IsNil)
+	// A request to an unknown causetstore fails in the client.
+	_, err = client.SendRequest(ctx, "unknown", einsteindbrpc.NewRequest(einsteindbrpc.CmdGet, &kvrpcpb.GetRequest{}), time.Second)
+	c.Assert(err, NotNil)
+	root.Finish()
+
+	spans := traces.Spans()
+	c.Assert(spans, HasLen, 3)
+	c.Assert(spans[0].Command, Equals, einsteindbrpc.CmdGet)
+	c.Assert(spans[0].RegionID, Equals, regionID)
+	c.Assert(spans[0].StoreID, Equals, storeIDs[1])
+	c.Assert(spans[0].Attempt, Equals, 1)
+	c.Assert(spans[0].ErrKind, Equals, rpctrace.ErrKindNotLeader)
+	c.Assert(spans[1].StoreID, Equals, storeIDs[0])
+	c.Assert(spans[1].Attempt, Equals, 2)
+	c.Assert(spans[1].ErrKind, Equals, rpctrace.ErrKindNone)
+	c.Assert(spans[1].Latency > 0, IsTrue)
+	c.Assert(spans[2].Attempt, Equals, 1)
+	c.Assert(spans[2].ErrKind, Equals, rpctrace.ErrKindRPC)
+
+	// The spans are recorded in the TRACE output as well.
+	var traced []*mocktracer.MockSpan
+	for _, span := range tracer.FinishedSpans() {
+		if span.OperationName == "RPCClient.SendRequest" {
+			traced = append(traced, span)
+		}
+	}
+	c.Assert(traced, HasLen, 3)
+	c.Assert(traced[0].Tag("error"), Equals, "NotLeader")
+	c.Assert(traced[1].Tag("attempt"), Equals, 2)
+	c.Assert(traced[1].Logs()[0].Fields[0].ValueString, Equals, spans[1].String())
+}
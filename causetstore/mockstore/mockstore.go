@@ -144,6 +144,10 @@ func WithTxnLocalLatches(capacity uint) MockEinsteinDBStoreOption {
 func NewMockStore(options ...MockEinsteinDBStoreOption) (solomonkey.CausetStorage, error) {
 	opt := mockOptions{
 		clusterInspector: func(c cluster.Cluster) {
+			// A cluster restored from the path keeps the topology built before.
+			if x, ok := c.(*mockeinsteindb.Cluster); ok && x.Restored() {
+				return
+			}
 			BootstrapWithSingleStore(c)
 		},
 		storeType: defaultStoreType,
@@ -0,0 +1,209 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rpctrace traces the requests sent through the mock RPC clients. Every
+// attempt of a request becomes a Span, which is passed to the hook of the client and
+// recorded in the opentracing span of the request context, so it shows up in the
+// TRACE output.
+package rpctrace
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	tlog "github.com/opentracing/opentracing-go/log"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/errorpb"
+)
+
+// ErrKind is the kind of the error an attempt of a request gets.
+type ErrKind string
+
+// The error kinds.
+const (
+	ErrKindNone           ErrKind = ""
+	ErrKindNotLeader      ErrKind = "NotLeader"
+	ErrKindEpochNotMatch  ErrKind = "EpochNotMatch"
+	ErrKindServerIsBusy   ErrKind = "ServerIsBusy"
+	ErrKindRegionNotFound ErrKind = "RegionNotFound"
+	ErrKindKeyNotInRegion ErrKind = "KeyNotInRegion"
+	ErrKindStaleCommand   ErrKind = "StaleCommand"
+	ErrKindStoreNotMatch  ErrKind = "StoreNotMatch"
+	ErrKindRegionError    ErrKind = "RegionError"
+	ErrKindRPC            ErrKind = "RPC"
+)
+
+// RegionErrKind returns the kind of a Region error.
+func RegionErrKind(e *errorpb.Error) ErrKind {
+	switch {
+	case e == nil:
+		return ErrKindNone
+	case e.NotLeader != nil:
+		return ErrKindNotLeader
+	case e.EpochNotMatch != nil:
+		return ErrKindEpochNotMatch
+	case e.ServerIsBusy != nil:
+		return ErrKindServerIsBusy
+	case e.RegionNotFound != nil:
+		return ErrKindRegionNotFound
+	case e.KeyNotInRegion != nil:
+		return ErrKindKeyNotInRegion
+	case e.StaleCommand != nil:
+		return ErrKindStaleCommand
+	case e.StoreNotMatch != nil:
+		return ErrKindStoreNotMatch
+	default:
+		return ErrKindRegionError
+	}
+}
+
+// Span is the trace of an attempt of a request.
+type Span struct {
+	Command  einsteindbrpc.CmdType
+	RegionID uint64
+	StoreID  uint64
+	Addr     string
+	// Attempt counts the attempts of the request from 1, a request is retried by
+	// sending it again after an error.
+	Attempt int
+	Start   time.Time
+	Latency time.Duration
+	ErrKind ErrKind
+	// Err is the error returned by the client or the message of the Region error.
+	Err error
+
+	req  *einsteindbrpc.Request
+	span opentracing.Span
+}
+
+func (s *Span) String() string {
+	str := fmt.Sprintf("%s region:%d causetstore:%d addr:%s attempt:%d latency:%s", s.Command, s.RegionID, s.StoreID, s.Addr, s.Attempt, s.Latency)
+	if s.ErrKind != ErrKindNone {
+		str += fmt.Sprintf(" error:%s", s.ErrKind)
+	}
+	return str
+}
+
+// Hook is called with the Span of every finished attempt.
+type Hook func(*Span)
+
+// maxPendingRequests bounds the requests the attempts are counted for. A request
+// that gets an error and is never retried stays pending.
+const maxPendingRequests = 4096
+
+// Tracer traces the requests sent through a mock RPC client.
+type Tracer struct {
+	mu   sync.Mutex
+	hook Hook
+	// attempts are the attempts of the requests which got an error in the last
+	// attempt.
+	attempts map[*einsteindbrpc.Request]int
+}
+
+// NewTracer creates a Tracer.
+func NewTracer() *Tracer {
+	return &Tracer{attempts: make(map[*einsteindbrpc.Request]int)}
+}
+
+// SetHook sets the hook called with the Spans, nil removes it.
+func (t *Tracer) SetHook(hook Hook) {
+	t.mu.Lock()
+	t.hook = hook
+	t.mu.Unlock()
+}
+
+// Start starts the Span of an attempt of req. The returned context carries the
+// opentracing span of the attempt if ctx is traced.
+func (t *Tracer) Start(ctx context.Context, addr string, req *einsteindbrpc.Request) (context.Context, *Span) {
+	t.mu.Lock()
+	attempt := t.attempts[req] + 1
+	t.mu.Unlock()
+	s := &Span{
+		Command:  req.Type,
+		RegionID: req.Context.GetRegionId(),
+		StoreID:  req.Context.GetPeer().GetStoreId(),
+		Addr:     addr,
+		Attempt:  attempt,
+		Start:    time.Now(),
+		req:      req,
+	}
+	if span := opentracing.SpanFromContext(ctx); span != nil && span.Tracer() != nil {
+		s.span = span.Tracer().StartSpan("RPCClient.SendRequest", opentracing.ChildOf(span.Context()))
+		ctx = opentracing.ContextWithSpan(ctx, s.span)
+	}
+	return ctx, s
+}
+
+// Finish finishes the Span with the result of the attempt.
+func (t *Tracer) Finish(s *Span, resp *einsteindbrpc.Response, err error) {
+	s.Latency = time.Since(s.Start)
+	if err != nil {
+		s.ErrKind, s.Err = ErrKindRPC, err
+	} else if resp != nil && resp.Resp != nil {
+		regionErr, err1 := resp.GetRegionError()
+		if err1 != nil {
+			s.ErrKind, s.Err = ErrKindRPC, err1
+		} else if regionErr != nil {
+			s.ErrKind, s.Err = RegionErrKind(regionErr), fmt.Errorf("%s", regionErr.GetMessage())
+		}
+	}
+	if s.span != nil {
+		s.span.SetTag("command", s.Command.String())
+		s.span.SetTag("region", s.RegionID)
+		s.span.SetTag("causetstore", s.StoreID)
+		s.span.SetTag("attempt", s.Attempt)
+		if s.ErrKind != ErrKindNone {
+			s.span.SetTag("error", string(s.ErrKind))
+		}
+		s.span.LogFields(tlog.String("event", s.String()))
+		s.span.Finish()
+	}
+
+	t.mu.Lock()
+	if s.ErrKind == ErrKindNone {
+		delete(t.attempts, s.req)
+	} else {
+		if len(t.attempts) >= maxPendingRequests {
+			t.attempts = make(map[*einsteindbrpc.Request]int)
+		}
+		t.attempts[s.req] = s.Attempt
+	}
+	hook := t.hook
+	t.mu.Unlock()
+	if hook != nil {
+		hook(s)
+	}
+}
+
+// DefCauslector collects the Spans through its Hook, for tests.
+type DefCauslector struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// Hook is the Hook collecting the Spans.
+func (c *DefCauslector) Hook(s *Span) {
+	c.mu.Lock()
+	c.spans = append(c.spans, s)
+	c.mu.Unlock()
+}
+
+// Spans returns the collected Spans.
+func (c *DefCauslector) Spans() []*Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*Span(nil), c.spans...)
+}
@@ -0,0 +1,75 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rpctrace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/einsteindbrpc"
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/errorpb"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/kvrpcpb"
+	"github.com/whtcorpsinc/solomonkeyproto/pkg/metapb"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testTraceSuite{})
+
+type testTraceSuite struct{}
+
+func (s *testTraceSuite) TestRegionErrKind(c *C) {
+	c.Assert(RegionErrKind(nil), Equals, ErrKindNone)
+	c.Assert(RegionErrKind(&errorpb.Error{NotLeader: &errorpb.NotLeader{}}), Equals, ErrKindNotLeader)
+	c.Assert(RegionErrKind(&errorpb.Error{EpochNotMatch: &errorpb.EpochNotMatch{}}), Equals, ErrKindEpochNotMatch)
+	c.Assert(RegionErrKind(&errorpb.Error{ServerIsBusy: &errorpb.ServerIsBusy{}}), Equals, ErrKindServerIsBusy)
+	c.Assert(RegionErrKind(&errorpb.Error{Message: "unknown"}), Equals, ErrKindRegionError)
+}
+
+func (s *testTraceSuite) TestTracerAttempts(c *C) {
+	t := NewTracer()
+	var traces DefCauslector
+	t.SetHook(traces.Hook)
+	req := einsteindbrpc.NewRequest(einsteindbrpc.CmdPrewrite, &kvrpcpb.PrewriteRequest{}, kvrpcpb.Context{RegionId: 2, Peer: &metapb.Peer{Id: 3, StoreId: 1}})
+	busy, err := einsteindbrpc.GenRegionErrorResp(req, &errorpb.Error{ServerIsBusy: &errorpb.ServerIsBusy{}})
+	c.Assert(err, IsNil)
+	for i := 0; i < 2; i++ {
+		_, span := t.Start(context.Background(), "causetstore1", req)
+		t.Finish(span, busy, nil)
+	}
+	_, span := t.Start(context.Background(), "causetstore1", req)
+	t.Finish(span, &einsteindbrpc.Response{Resp: &kvrpcpb.PrewriteResponse{}}, nil)
+	_, span = t.Start(context.Background(), "causetstore1", req)
+	t.Finish(span, &einsteindbrpc.Response{Resp: &kvrpcpb.PrewriteResponse{}}, nil)
+
+	spans := traces.Spans()
+	c.Assert(spans, HasLen, 4)
+	for i, kind := range []ErrKind{ErrKindServerIsBusy, ErrKindServerIsBusy, ErrKindNone, ErrKindNone} {
+		c.Assert(spans[i].ErrKind, Equals, kind)
+		c.Assert(spans[i].RegionID, Equals, uint64(2))
+		c.Assert(spans[i].StoreID, Equals, uint64(1))
+	}
+	c.Assert(spans[1].Attempt, Equals, 2)
+	c.Assert(spans[2].Attempt, Equals, 3)
+	c.Assert(spans[3].Attempt, Equals, 1)
+	c.Assert(len(t.attempts), Equals, 0)
+
+	t.SetHook(nil)
+	_, span = t.Start(context.Background(), "causetstore1", req)
+	t.Finish(span, busy, nil)
+	c.Assert(traces.Spans(), HasLen, 4)
+}
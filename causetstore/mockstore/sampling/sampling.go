@@ -0,0 +1,329 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sampling builds the column statistics returned by the mock stores
+// for analyze requests.
+package sampling
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/blockcodec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/collate"
+	"github.com/whtcorpsinc/MilevaDB-Prod/statistics"
+	"github.com/whtcorpsinc/MilevaDB-Prod/stochastikctx/stmtctx"
+	"github.com/whtcorpsinc/MilevaDB-Prod/types"
+	"github.com/whtcorpsinc/errors"
+	"github.com/whtcorpsinc/fidelpb/go-fidelpb"
+)
+
+// topNCandidates is the number of values a SketchBuilder tracks exactly for
+// every entry of its TopN list.
+const topNCandidates = 4
+
+// SketchBuilder builds a CM sketch. When a TopN size is given, the most
+// frequent values are kept in the TopN list of the sketch instead of being
+// hashed into its rows.
+//
+// Only topN * topNCandidates values are counted exactly at a time. When a new
+// value comes in and no room is left, the least frequent candidate is moved
+// into the rows of the sketch, so a value that is evicted and seen again only
+// reports in the TopN list the count it gathered since it came back.
+type SketchBuilder struct {
+	cms        *statistics.CMSketch
+	topN       int
+	candidates map[string]*sketchCandidate
+	heap       candidateHeap
+}
+
+type sketchCandidate struct {
+	data  string
+	count uint64
+	index int
+}
+
+// candidateHeap is a min-heap of candidates ordered by count.
+type candidateHeap []*sketchCandidate
+
+func (h candidateHeap) Len() int           { return len(h) }
+func (h candidateHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+
+func (h candidateHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *candidateHeap) Push(x interface{}) {
+	c := x.(*sketchCandidate)
+	c.index = len(*h)
+	*h = append(*h, c)
+}
+
+func (h *candidateHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return c
+}
+
+// NewSketchBuilder creates a SketchBuilder. A zero topN builds a plain CM sketch.
+func NewSketchBuilder(depth, width int32, topN int) *SketchBuilder {
+	b := &SketchBuilder{
+		cms:  statistics.NewCMSketch(depth, width),
+		topN: topN,
+	}
+	if topN > 0 {
+		b.candidates = make(map[string]*sketchCandidate, topN*topNCandidates)
+	}
+	return b
+}
+
+// Insert adds a value to the sketch.
+func (b *SketchBuilder) Insert(val []byte) {
+	if b.candidates == nil {
+		b.cms.InsertBytes(val)
+		return
+	}
+	if c, ok := b.candidates[string(val)]; ok {
+		c.count++
+		heap.Fix(&b.heap, c.index)
+		return
+	}
+	if len(b.candidates) >= b.topN*topNCandidates {
+		c := heap.Pop(&b.heap).(*sketchCandidate)
+		delete(b.candidates, c.data)
+		b.insertCandidate(c)
+	}
+	c := &sketchCandidate{data: string(val), count: 1}
+	b.candidates[c.data] = c
+	heap.Push(&b.heap, c)
+}
+
+func (b *SketchBuilder) insertCandidate(c *sketchCandidate) {
+	data := []byte(c.data)
+	for i := uint64(0); i < c.count; i++ {
+		b.cms.InsertBytes(data)
+	}
+}
+
+// ToProto returns the sketch in its protobuf form. It must be called once,
+// after all the values are inserted.
+func (b *SketchBuilder) ToProto() *fidelpb.CMSketch {
+	if b.candidates == nil {
+		return statistics.CMSketchToProto(b.cms)
+	}
+	items := b.heap
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].count != items[j].count {
+			return items[i].count > items[j].count
+		}
+		return items[i].data < items[j].data
+	})
+	n := b.topN
+	if n > len(items) {
+		n = len(items)
+	}
+	for _, c := range items[n:] {
+		b.insertCandidate(c)
+	}
+	pb := statistics.CMSketchToProto(b.cms)
+	for _, c := range items[:n] {
+		pb.TopN = append(pb.TopN, &fidelpb.CMSketchTopN{Data: []byte(c.data), Count: c.count})
+	}
+	return pb
+}
+
+// Builder collects the statistics of the analyzed columns of one region, and
+// of the column groups used by the extended statistics.
+//
+// Without a sample rate every collector keeps a reservoir of at most
+// SampleSize values. With a sample rate, a row is sampled when the hash of its
+// key falls under the rate, so the rows sampled from a table do not depend on
+// how it is split into regions.
+//
+// The offsets of a column group index the columns of the request, so an
+// integer primary key handle is at offset 0 and can be part of a group.
+type Builder struct {
+	sc         *stmtctx.StatementContext
+	handle     bool
+	fts        []*types.FieldType
+	collators  []collate.DefCauslator
+	groups     [][]int64
+	rate       float64
+	collectors []*statistics.SampleDefCauslector
+	sketches   []*SketchBuilder
+	rng        *rand.Rand
+	ordinal    int
+	row        [][]byte
+	buf        []byte
+}
+
+// NewBuilder creates a Builder for req. fts and collators describe the
+// analyzed columns, without the integer primary key handle. seed seeds the
+// reservoir sampling used when req has no sample rate.
+func NewBuilder(sc *stmtctx.StatementContext, req *fidelpb.AnalyzeDeferredCausetsReq, fts []*types.FieldType, collators []collate.DefCauslator, seed int64) *Builder {
+	b := &Builder{
+		sc:        sc,
+		fts:       fts,
+		collators: collators,
+		rate:      req.GetSampleRate(),
+		rng:       rand.New(rand.NewSource(seed)),
+	}
+	if cols := req.DeferredCausetsInfo; len(cols) > 0 && cols[0].GetPkHandle() {
+		b.handle = true
+	}
+	b.row = make([][]byte, len(fts)+b.pkLen())
+	for _, group := range req.DeferredCausetGroups {
+		b.groups = append(b.groups, group.DeferredCausetOffsets)
+	}
+	n := len(fts) + len(b.groups)
+	b.collectors = make([]*statistics.SampleDefCauslector, n)
+	b.sketches = make([]*SketchBuilder, n)
+	for i := range b.collectors {
+		c := &statistics.SampleDefCauslector{MaxSampleSize: req.SampleSize}
+		if req.SketchSize > 0 {
+			c.FMSketch = statistics.NewFMSketch(int(req.SketchSize))
+		}
+		if req.CmsketchDepth != nil && req.CmsketchWidth != nil {
+			b.sketches[i] = NewSketchBuilder(*req.CmsketchDepth, *req.CmsketchWidth, int(req.GetTopNSize()))
+		}
+		b.collectors[i] = c
+	}
+	return b
+}
+
+func (b *Builder) pkLen() int {
+	if b.handle {
+		return 1
+	}
+	return 0
+}
+
+// Collect adds a row to the statistics. key is the row key and values are
+// the encoded values of the columns of the request, the integer primary key
+// handle included. The handle only takes part in the column groups.
+func (b *Builder) Collect(key []byte, values [][]byte) error {
+	if len(values) != len(b.row) {
+		return errors.Errorf("expect %d column values, got %d", len(b.row), len(values))
+	}
+	sampled := b.rate > 0 && SampledByRate(key, b.rate)
+	pkLen := b.pkLen()
+	for i, val := range values {
+		if i < pkLen {
+			b.row[i] = val
+			continue
+		}
+		val, err := b.collationKey(i-pkLen, val)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		b.row[i] = val
+		if err = b.collect(i-pkLen, val, sampled); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	for j, group := range b.groups {
+		b.buf = b.buf[:0]
+		for _, offset := range group {
+			if offset < 0 || int(offset) >= len(b.row) {
+				return errors.Errorf("column group offset %d out of range", offset)
+			}
+			b.buf = append(b.buf, b.row[offset]...)
+		}
+		if err := b.collect(len(b.fts)+j, append([]byte(nil), b.buf...), sampled); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	b.ordinal++
+	return nil
+}
+
+// collationKey replaces a string value by the encoded key of its collation,
+// the same way statistics.SampleBuilder does.
+func (b *Builder) collationKey(i int, val []byte) ([]byte, error) {
+	if b.collators[i] == nil || isNull(val) {
+		return append([]byte(nil), val...), nil
+	}
+	d, err := blockcodec.DecodeDeferredCausetValue(val, b.fts[i], b.sc.TimeZone)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return blockcodec.EncodeValue(b.sc, nil, types.NewBytesCauset(b.collators[i].Key(d.GetString())))
+}
+
+func (b *Builder) collect(i int, val []byte, sampled bool) error {
+	c := b.collectors[i]
+	if isNull(val) {
+		c.NullCount++
+		return nil
+	}
+	c.Count++
+	if c.FMSketch != nil {
+		if err := c.FMSketch.InsertValue(b.sc, types.NewBytesCauset(val)); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if b.sketches[i] != nil {
+		b.sketches[i].Insert(val)
+	}
+	// Minus one for the flag byte of the encoded value.
+	c.TotalSize += int64(len(val) - 1)
+	item := &statistics.SampleItem{Value: types.NewBytesCauset(val), Ordinal: b.ordinal}
+	if b.rate > 0 {
+		if sampled {
+			c.Samples = append(c.Samples, item)
+		}
+		return nil
+	}
+	if int64(len(c.Samples)) < c.MaxSampleSize {
+		c.Samples = append(c.Samples, item)
+	} else if j := b.rng.Int63n(c.Count); j < c.MaxSampleSize {
+		c.Samples[j] = item
+	}
+	return nil
+}
+
+// DefCauslectors returns the collectors of the analyzed columns followed by
+// the collectors of the column groups.
+func (b *Builder) DefCauslectors() []*fidelpb.SampleDefCauslector {
+	pbs := make([]*fidelpb.SampleDefCauslector, 0, len(b.collectors))
+	for i, c := range b.collectors {
+		pb := statistics.SampleDefCauslectorToProto(c)
+		if b.sketches[i] != nil {
+			pb.CmSketch = b.sketches[i].ToProto()
+		}
+		pbs = append(pbs, pb)
+	}
+	return pbs
+}
+
+// SampledByRate reports whether the row of key is sampled at rate.
+func SampledByRate(key []byte, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write(key)
+	return float64(h.Sum64()) < rate*math.MaxUint64
+}
+
+func isNull(val []byte) bool {
+	return len(val) == 1 && val[0] == codec.NilFlag
+}
@@ -0,0 +1,172 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sampling
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/whtcorpsinc/MilevaDB-Prod/blockcodec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/collate"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/MilevaDB-Prod/stochastikctx/stmtctx"
+	"github.com/whtcorpsinc/MilevaDB-Prod/types"
+	"github.com/whtcorpsinc/berolinaAllegroSQL/allegrosql"
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/fidelpb/go-fidelpb"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+type testSamplingSuite struct{}
+
+var _ = Suite(&testSamplingSuite{})
+
+func (s *testSamplingSuite) encodeRow(c *C, sc *stmtctx.StatementContext, handle int64, values ...types.Causet) ([]byte, [][]byte) {
+	row := make([][]byte, 0, len(values))
+	for _, v := range values {
+		b, err := blockcodec.EncodeValue(sc, nil, v)
+		c.Assert(err, IsNil)
+		row = append(row, b)
+	}
+	return blockcodec.EncodeRowKeyWithHandle(1, solomonkey.IntHandle(handle)), row
+}
+
+func (s *testSamplingSuite) newBuilder(sc *stmtctx.StatementContext, req *fidelpb.AnalyzeDeferredCausetsReq) *Builder {
+	fts := []*types.FieldType{types.NewFieldType(allegrosql.TypeLonglong), types.NewFieldType(allegrosql.TypeLonglong)}
+	return NewBuilder(sc, req, fts, make([]collate.DefCauslator, len(fts)), 1)
+}
+
+func (s *testSamplingSuite) TestSampleRateIgnoresRegionSplit(c *C) {
+	sc := new(stmtctx.StatementContext)
+	req := &fidelpb.AnalyzeDeferredCausetsReq{
+		SampleSize: 10,
+		SketchSize: 100,
+		SampleRate: proto.Float64(0.2),
+	}
+	whole := s.newBuilder(sc, req)
+	left, right := s.newBuilder(sc, req), s.newBuilder(sc, req)
+	for i := int64(0); i < 1000; i++ {
+		key, row := s.encodeRow(c, sc, i, types.NewIntCauset(i), types.NewIntCauset(i%7))
+		c.Assert(whole.Collect(key, row), IsNil)
+		region := left
+		if i >= 400 {
+			region = right
+		}
+		c.Assert(region.Collect(key, row), IsNil)
+	}
+	wholeCols := whole.DefCauslectors()
+	leftCols, rightCols := left.DefCauslectors(), right.DefCauslectors()
+	c.Assert(wholeCols, HasLen, 2)
+	for i := range wholeCols {
+		c.Assert(wholeCols[i].Count, Equals, leftCols[i].Count+rightCols[i].Count)
+		samples := append(append([][]byte(nil), leftCols[i].Samples...), rightCols[i].Samples...)
+		c.Assert(samples, DeepEquals, wholeCols[i].Samples)
+	}
+	// The sample size does not cap the samples taken by rate.
+	n := len(wholeCols[0].Samples)
+	c.Assert(n > 100 && n < 300, IsTrue, Commentf("%d samples", n))
+}
+
+func (s *testSamplingSuite) TestReservoirAndGroups(c *C) {
+	sc := new(stmtctx.StatementContext)
+	req := &fidelpb.AnalyzeDeferredCausetsReq{
+		SampleSize:           10,
+		SketchSize:           100,
+		CmsketchDepth:        proto.Int32(4),
+		CmsketchWidth:        proto.Int32(256),
+		DeferredCausetGroups: []*fidelpb.AnalyzeDeferredCausetGroup{{DeferredCausetOffsets: []int64{0, 1}}},
+	}
+	b := s.newBuilder(sc, req)
+	for i := int64(0); i < 100; i++ {
+		second := types.NewIntCauset(i % 3)
+		if i%10 == 0 {
+			second = types.Causet{}
+		}
+		key, row := s.encodeRow(c, sc, i, types.NewIntCauset(i%5), second)
+		c.Assert(b.Collect(key, row), IsNil)
+	}
+	cols := b.DefCauslectors()
+	c.Assert(cols, HasLen, 3)
+	c.Assert(cols[0].Count, Equals, int64(100))
+	c.Assert(cols[1].Count, Equals, int64(90))
+	c.Assert(cols[1].NullCount, Equals, int64(10))
+	// The group value of a row is never NULL as long as one column is set.
+	c.Assert(cols[2].Count, Equals, int64(100))
+	c.Assert(cols[2].Samples, HasLen, 10)
+	c.Assert(cols[0].FmSketch, NotNil)
+	c.Assert(cols[2].CmSketch, NotNil)
+
+	key, row := s.encodeRow(c, sc, 100, types.NewIntCauset(1))
+	c.Assert(b.Collect(key, row), NotNil)
+}
+
+func (s *testSamplingSuite) TestReservoirSeed(c *C) {
+	sc := new(stmtctx.StatementContext)
+	req := &fidelpb.AnalyzeDeferredCausetsReq{SampleSize: 10}
+	samples := func() []*fidelpb.SampleDefCauslector {
+		b := s.newBuilder(sc, req)
+		for i := int64(0); i < 100; i++ {
+			key, row := s.encodeRow(c, sc, i, types.NewIntCauset(i), types.NewIntCauset(i))
+			c.Assert(b.Collect(key, row), IsNil)
+		}
+		return b.DefCauslectors()
+	}
+	// The same seed samples the same rows.
+	c.Assert(samples(), DeepEquals, samples())
+}
+
+func (s *testSamplingSuite) TestSketchTopN(c *C) {
+	b := NewSketchBuilder(4, 256, 2)
+	for i := 0; i < 10; i++ {
+		b.Insert([]byte("a"))
+	}
+	for i := 0; i < 5; i++ {
+		b.Insert([]byte("b"))
+	}
+	b.Insert([]byte("c"))
+	b.Insert([]byte{codec.NilFlag})
+	pb := b.ToProto()
+	c.Assert(pb.TopN, HasLen, 2)
+	c.Assert(pb.TopN[0].Data, DeepEquals, []byte("a"))
+	c.Assert(pb.TopN[0].Count, Equals, uint64(10))
+	c.Assert(pb.TopN[1].Data, DeepEquals, []byte("b"))
+	c.Assert(pb.TopN[1].Count, Equals, uint64(5))
+
+	// Only topN * topNCandidates values are counted exactly, the heavy ones
+	// survive the values seen once.
+	b = NewSketchBuilder(4, 256, 2)
+	for i := 0; i < 1000; i++ {
+		b.Insert([]byte("a"))
+		if i%2 == 0 {
+			b.Insert([]byte("b"))
+		}
+		b.Insert([]byte(fmt.Sprintf("v%d", i)))
+		c.Assert(len(b.candidates), LessEqual, 2*topNCandidates)
+	}
+	pb = b.ToProto()
+	c.Assert(pb.TopN, HasLen, 2)
+	c.Assert(pb.TopN[0].Data, DeepEquals, []byte("a"))
+	c.Assert(pb.TopN[0].Count, Equals, uint64(1000))
+	c.Assert(pb.TopN[1].Data, DeepEquals, []byte("b"))
+	c.Assert(pb.TopN[1].Count, Equals, uint64(500))
+
+	plain := NewSketchBuilder(4, 256, 0)
+	plain.Insert([]byte("a"))
+	c.Assert(plain.ToProto().TopN, HasLen, 0)
+}
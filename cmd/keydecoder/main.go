@@ -0,0 +1,71 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/keydecoder"
+)
+
+var jsonOutput = flag.Bool("json", false, "print the decoded keys as JSON")
+
+// keydecoder decodes hex encoded keys given as arguments, or one per line from stdin.
+func main() {
+	flag.Parse()
+	if flag.NArg() > 0 {
+		for _, arg := range flag.Args() {
+			decode(arg)
+		}
+		return
+	}
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			decode(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func decode(s string) {
+	key, err := hex.DecodeString(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid hex key %s: %v\n", s, err)
+		return
+	}
+	k, err := keydecoder.DecodeKey(key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "decode key %s: %v\n", s, err)
+		return
+	}
+	if !*jsonOutput {
+		fmt.Println(k.String())
+		return
+	}
+	out, err := k.JSON()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "encode key %s: %v\n", s, err)
+		return
+	}
+	fmt.Println(string(out))
+}
@@ -0,0 +1,178 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// mockstore-inspector inspects the MVCCLevelDB persisted by mockstore.WithPath. It
+// opens the directory read-only, so it's safe to run it on the data left by a test.
+//
+// Usage:
+//
+//	mockstore-inspector -path DIR regions
+//	mockstore-inspector -path DIR [-start HEX] [-end HEX] [-limit N] scan
+//	mockstore-inspector -path DIR -key HEX key
+//	mockstore-inspector -path DIR -ts TS txn
+//	mockstore-inspector -path DIR [-start HEX] [-end HEX] [-limit N] export
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/mockstore/mockeinsteindb"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/keydecoder"
+	"github.com/whtcorpsinc/errors"
+)
+
+var (
+	path   = flag.String("path", "", "the directory of the mock store")
+	layout = flag.String("layout", "", "the saved cluster layout, default is the layout file in -path")
+	start  = flag.String("start", "", "the hex of the start key of the range, inclusive")
+	end    = flag.String("end", "", "the hex of the end key of the range, exclusive")
+	limit  = flag.Int("limit", 0, "the max number of keys, 0 means no limit")
+	key    = flag.String("key", "", "the hex of the key")
+	ts     = flag.Uint64("ts", 0, "the start ts of the transaction")
+)
+
+func main() {
+	flag.Parse()
+	if *path == "" || flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Arg(0)); err != nil {
+		fmt.Fprintln(os.Stderr, errors.ErrorStack(err))
+		os.Exit(1)
+	}
+}
+
+func run(cmd string) error {
+	if cmd == "regions" {
+		return showRegions()
+	}
+	store, err := mockeinsteindb.OpenMVCCLevelDBReadOnly(*path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer store.Close()
+
+	switch cmd {
+	case "scan":
+		return scan(store)
+	case "key":
+		k, err := hex.DecodeString(*key)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		return mockeinsteindb.DumpMvccByKey(os.Stdout, store, k)
+	case "txn":
+		return showTxn(store)
+	case "export":
+		return export(store)
+	}
+	return errors.Errorf("unknown command %s", cmd)
+}
+
+func showRegions() error {
+	layoutPath := *layout
+	if layoutPath == "" {
+		layoutPath = filepath.Join(*path, mockeinsteindb.ClusterLayoutFile)
+	}
+	l, err := mockeinsteindb.LoadClusterLayout(layoutPath)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, s := range l.Stores {
+		var labels []string
+		for _, label := range s.Labels {
+			labels = append(labels, label.Key+"="+label.Value)
+		}
+		fmt.Printf("causetstore %d: addr=%s state=%s labels={%s}\n", s.Id, s.Address, s.State, strings.Join(labels, ", "))
+	}
+	for _, r := range l.Regions {
+		var peers []string
+		for _, p := range r.Meta.Peers {
+			peers = append(peers, fmt.Sprintf("%d@%d", p.Id, p.StoreId))
+		}
+		// The region boundaries are MVCC-encoded keys.
+		fmt.Printf("region %d: epoch=%d/%d leader=%d peers={%s}\n  start=%s\n  end=%s\n",
+			r.Meta.Id, r.Meta.GetRegionEpoch().GetConfVer(), r.Meta.GetRegionEpoch().GetVersion(), r.Leader,
+			strings.Join(peers, ", "), keydecoder.Key(r.Meta.StartKey), keydecoder.Key(r.Meta.EndKey))
+	}
+	return nil
+}
+
+func keyRange() ([]byte, []byte, error) {
+	startKey, err := hex.DecodeString(*start)
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	endKey, err := hex.DecodeString(*end)
+	return startKey, endKey, errors.Trace(err)
+}
+
+func scan(store *mockeinsteindb.MVCCLevelDB) error {
+	startKey, endKey, err := keyRange()
+	if err != nil {
+		return err
+	}
+	keys, err := store.ScanMvccKeys(startKey, endKey, *limit)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	for _, k := range keys {
+		if err = mockeinsteindb.DumpMvccByKey(os.Stdout, store, k); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+func showTxn(store *mockeinsteindb.MVCCLevelDB) error {
+	info, err := store.GetTxnInfo(*ts)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	fmt.Printf("txn %d: %s", info.StartTS, info.State)
+	if info.State == mockeinsteindb.TxnStateCommitted {
+		fmt.Printf(", commit_ts=%d", info.CommitTS)
+	}
+	fmt.Println()
+	if info.Primary != nil {
+		fmt.Printf("primary: %s\n", keydecoder.Key(info.Primary))
+	}
+	for _, k := range info.LockedKeys {
+		fmt.Printf("locked: %s\n", keydecoder.Key(k))
+	}
+	for _, k := range info.WrittenKeys {
+		fmt.Printf("written: %s\n", keydecoder.Key(k))
+	}
+	return nil
+}
+
+func export(store *mockeinsteindb.MVCCLevelDB) error {
+	startKey, endKey, err := keyRange()
+	if err != nil {
+		return err
+	}
+	keys, err := store.ExportRange(startKey, endKey, *limit)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return errors.Trace(enc.Encode(keys))
+}
@@ -0,0 +1,32 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics for the background tasks in petri.
+var (
+	PetriBackgroundTaskRestartCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "milevadb",
+			Subsystem: "petri",
+			Name:      "background_task_restarts_total",
+			Help:      "Counter of petri background tasks restarted after a panic.",
+		}, []string{"task"})
+)
+
+func init() {
+	prometheus.MustRegister(PetriBackgroundTaskRestartCounter)
+}
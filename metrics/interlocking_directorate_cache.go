@@ -0,0 +1,48 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Label values of the interlock cache metrics.
+const (
+	LblHit  = "hit"
+	LblMiss = "miss"
+)
+
+// Metrics for the interlock result cache of the einsteindb client.
+var (
+	EinsteinDBINTERLOCKCacheCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "milevadb",
+			Subsystem: "einsteindbclient",
+			Name:      "INTERLOCK_cache_total",
+			Help:      "Counter of the hits, misses and evictions of the interlock cache.",
+		}, []string{LblType})
+
+	EinsteinDBINTERLOCKCacheMemoryGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "milevadb",
+			Subsystem: "einsteindbclient",
+			Name:      "INTERLOCK_cache_memory_bytes",
+			Help:      "Memory used by the interlock cache.",
+		})
+)
+
+func init() {
+	prometheus.MustRegister(EinsteinDBINTERLOCKCacheCounter)
+	prometheus.MustRegister(EinsteinDBINTERLOCKCacheMemoryGauge)
+}
@@ -0,0 +1,58 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Label values of the schemaReplicant reload metrics.
+const (
+	LblSchemaReloadDiff = "diff"
+	LblSchemaReloadFull = "full"
+)
+
+// Metrics for the schemaReplicant reload in petri.
+var (
+	SchemaReloadDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "milevadb",
+			Subsystem: "petri",
+			Name:      "schema_reload_duration_seconds",
+			Help:      "Bucketed histogram of the time spent on reloading the schemaReplicant by diffs or fully.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 20), // 1ms ~ 524s
+		}, []string{LblType})
+
+	SchemaReloadDiffsCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "milevadb",
+			Subsystem: "petri",
+			Name:      "schema_reload_diffs_total",
+			Help:      "Counter of schemaReplicant diffs applied when reloading the schemaReplicant.",
+		})
+
+	SchemaReloadBlocksCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "milevadb",
+			Subsystem: "petri",
+			Name:      "schema_reload_blocks_total",
+			Help:      "Counter of blocks touched when reloading the schemaReplicant.",
+		}, []string{LblType})
+)
+
+func init() {
+	prometheus.MustRegister(SchemaReloadDuration)
+	prometheus.MustRegister(SchemaReloadDiffsCounter)
+	prometheus.MustRegister(SchemaReloadBlocksCounter)
+}
@@ -0,0 +1,69 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Label values of the system stochastik pool metrics.
+const (
+	LblInUse   = "in_use"
+	LblIdle    = "idle"
+	LblEvicted = "evicted"
+	LblInvalid = "invalid"
+)
+
+// Metrics for the system stochastik pool in petri.
+var (
+	SysStochastikPoolGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "milevadb",
+			Subsystem: "petri",
+			Name:      "sys_stochastik_pool_stochastiks",
+			Help:      "Number of in-use and idle stochastiks in the system stochastik pool.",
+		}, []string{LblType})
+
+	SysStochastikPoolCreatedCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "milevadb",
+			Subsystem: "petri",
+			Name:      "sys_stochastik_pool_created_total",
+			Help:      "Counter of stochastiks created by the system stochastik pool.",
+		})
+
+	SysStochastikPoolDestroyedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "milevadb",
+			Subsystem: "petri",
+			Name:      "sys_stochastik_pool_destroyed_total",
+			Help:      "Counter of stochastiks closed by the system stochastik pool.",
+		}, []string{LblType})
+
+	SysStochastikPoolWaitDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "milevadb",
+			Subsystem: "petri",
+			Name:      "sys_stochastik_pool_wait_duration_seconds",
+			Help:      "Bucketed histogram of the time waiting for a stochastik from the system stochastik pool.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 20), // 100us ~ 52s
+		})
+)
+
+func init() {
+	prometheus.MustRegister(SysStochastikPoolGauge)
+	prometheus.MustRegister(SysStochastikPoolCreatedCounter)
+	prometheus.MustRegister(SysStochastikPoolDestroyedCounter)
+	prometheus.MustRegister(SysStochastikPoolWaitDuration)
+}
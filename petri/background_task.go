@@ -0,0 +1,269 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package petri
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/metrics"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/logutil"
+	"github.com/whtcorpsinc/MilevaDB-Prod/types"
+	"github.com/whtcorpsinc/berolinaAllegroSQL/allegrosql"
+	"go.uber.org/zap"
+)
+
+// RestartPolicy decides what the supervisor does when a background task exits.
+type RestartPolicy int
+
+const (
+	// RestartNever means the task is not restarted, even after a panic.
+	RestartNever RestartPolicy = iota
+	// RestartOnPanic means the task is restarted with backoff after a panic,
+	// a normal return is treated as the end of the task.
+	RestartOnPanic
+)
+
+// String implements fmt.Stringer interface.
+func (p RestartPolicy) String() string {
+	switch p {
+	case RestartNever:
+		return "never"
+	case RestartOnPanic:
+		return "on-panic"
+	}
+	return "unknown"
+}
+
+// Background task states.
+const (
+	BackgroundTaskRunning    = "running"
+	BackgroundTaskStalled    = "stalled"
+	BackgroundTaskRestarting = "restarting"
+	BackgroundTaskExited     = "exited"
+	BackgroundTaskFailed     = "failed"
+)
+
+const (
+	bgTaskMinBackoff = 100 * time.Millisecond
+	bgTaskMaxBackoff = 30 * time.Second
+)
+
+// BackgroundTaskStatus is a snapshot of the status of a background task in petri.
+type BackgroundTaskStatus struct {
+	Name          string
+	State         string
+	Policy        RestartPolicy
+	Restarts      int
+	LastError     string
+	LastStartTime time.Time
+	LastHeartbeat time.Time
+}
+
+// bgTask is a background task registered to the supervisor.
+type bgTask struct {
+	name   string
+	policy RestartPolicy
+	// stallAfter is the max interval between two heartbeats of a healthy task,
+	// 0 means the task is never reported as stalled.
+	stallAfter time.Duration
+	fn         func(t *bgTask)
+
+	mu struct {
+		sync.Mutex
+		state         string
+		restarts      int
+		lastErr       string
+		lastStartTime time.Time
+		lastHeartbeat time.Time
+	}
+}
+
+// Heartbeat records that the task is still making progress.
+func (t *bgTask) Heartbeat() {
+	t.mu.Lock()
+	t.mu.lastHeartbeat = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *bgTask) setState(state string) {
+	t.mu.Lock()
+	t.mu.state = state
+	t.mu.Unlock()
+}
+
+func (t *bgTask) status(now time.Time) BackgroundTaskStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.mu.state
+	if state == BackgroundTaskRunning && t.stallAfter > 0 && now.Sub(t.mu.lastHeartbeat) > t.stallAfter {
+		state = BackgroundTaskStalled
+	}
+	return BackgroundTaskStatus{
+		Name:          t.name,
+		State:         state,
+		Policy:        t.policy,
+		Restarts:      t.mu.restarts,
+		LastError:     t.mu.lastErr,
+		LastStartTime: t.mu.lastStartTime,
+		LastHeartbeat: t.mu.lastHeartbeat,
+	}
+}
+
+// runOnce runs the task function, it returns true if the function panicked.
+func (t *bgTask) runOnce() (panicked bool) {
+	now := time.Now()
+	t.mu.Lock()
+	t.mu.state = BackgroundTaskRunning
+	t.mu.lastStartTime = now
+	t.mu.lastHeartbeat = now
+	t.mu.Unlock()
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		panicked = true
+		metrics.PanicCounter.WithLabelValues(metrics.LabelPetri).Inc()
+		logutil.BgLogger().Error("petri background task panicked",
+			zap.String("task", t.name), zap.Reflect("r", r), zap.Stack("stack"))
+		t.mu.Lock()
+		t.mu.lastErr = fmt.Sprintf("%v", r)
+		t.mu.Unlock()
+	}()
+	t.fn(t)
+	return false
+}
+
+// bgSupervisor runs the background tasks of petri, records their heartbeats and
+// restarts them with backoff after a panic according to their RestartPolicy.
+type bgSupervisor struct {
+	exit       <-chan struct{}
+	wg         *sync.WaitGroup
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	mu struct {
+		sync.RWMutex
+		tasks map[string]*bgTask
+	}
+}
+
+func newBgSupervisor(exit <-chan struct{}, wg *sync.WaitGroup) *bgSupervisor {
+	s := &bgSupervisor{
+		exit:       exit,
+		wg:         wg,
+		minBackoff: bgTaskMinBackoff,
+		maxBackoff: bgTaskMaxBackoff,
+	}
+	s.mu.tasks = make(map[string]*bgTask)
+	return s
+}
+
+// Go registers a background task and starts it in a new goroutine.
+func (s *bgSupervisor) Go(name string, policy RestartPolicy, stallAfter time.Duration, fn func(t *bgTask)) {
+	t := &bgTask{
+		name:       name,
+		policy:     policy,
+		stallAfter: stallAfter,
+		fn:         fn,
+	}
+	s.mu.Lock()
+	s.mu.tasks[name] = t
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.run(t)
+}
+
+func (s *bgSupervisor) run(t *bgTask) {
+	defer s.wg.Done()
+	backoff := s.minBackoff
+	for {
+		if !t.runOnce() || t.policy == RestartNever {
+			break
+		}
+		t.setState(BackgroundTaskRestarting)
+		metrics.PetriBackgroundTaskRestartCounter.WithLabelValues(t.name).Inc()
+		logutil.BgLogger().Warn("restart petri background task",
+			zap.String("task", t.name), zap.Duration("backoff", backoff))
+		select {
+		case <-s.exit:
+			t.setState(BackgroundTaskFailed)
+			return
+		case <-time.After(backoff):
+		}
+		t.mu.Lock()
+		t.mu.restarts++
+		t.mu.Unlock()
+		backoff *= 2
+		if backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+
+	t.mu.Lock()
+	if t.mu.lastErr != "" && t.policy == RestartNever {
+		t.mu.state = BackgroundTaskFailed
+	} else {
+		t.mu.state = BackgroundTaskExited
+	}
+	t.mu.Unlock()
+}
+
+// Statuses returns the status of all the registered tasks, sorted by name.
+func (s *bgSupervisor) Statuses() []BackgroundTaskStatus {
+	now := time.Now()
+	s.mu.RLock()
+	statuses := make([]BackgroundTaskStatus, 0, len(s.mu.tasks))
+	for _, t := range s.mu.tasks {
+		statuses = append(statuses, t.status(now))
+	}
+	s.mu.RUnlock()
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// BackgroundTasks returns the status of the background tasks started by petri.
+func (do *Petri) BackgroundTasks() []BackgroundTaskStatus {
+	return do.bgTasks.Statuses()
+}
+
+// BackgroundTaskEvents returns the background task statuses as the rows of
+// information_schema.PETRI_BACKGROUND_TASKS.
+func (do *Petri) BackgroundTaskEvents() [][]types.Causet {
+	statuses := do.BackgroundTasks()
+	rows := make([][]types.Causet, 0, len(statuses))
+	for _, s := range statuses {
+		event := types.MakeCausets(
+			s.Name,
+			s.State,
+			s.Policy.String(),
+			s.Restarts,
+			s.LastError,
+		)
+		event = append(event, bgTaskTimeCauset(s.LastStartTime), bgTaskTimeCauset(s.LastHeartbeat))
+		rows = append(rows, event)
+	}
+	return rows
+}
+
+func bgTaskTimeCauset(t time.Time) types.Causet {
+	if t.IsZero() {
+		return types.Causet{}
+	}
+	return types.NewTimeCauset(types.NewTime(types.FromGoTime(t), allegrosql.TypeDatetime, 3))
+}
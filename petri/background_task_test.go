@@ -0,0 +1,86 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package petri
+
+import (
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_perceptron/go"
+	"github.com/whtcorpsinc/MilevaDB-Prod/metrics"
+	. "github.com/whtcorpsinc/check"
+)
+
+func bgTaskRestartCount(c *C, name string) float64 {
+	var m dto.Metric
+	c.Assert(metrics.PetriBackgroundTaskRestartCounter.WithLabelValues(name).Write(&m), IsNil)
+	return m.GetCounter().GetValue()
+}
+
+func (*testSuite) TestBgSupervisorRestartOnPanic(c *C) {
+	exit := make(chan struct{})
+	var wg sync.WaitGroup
+	s := newBgSupervisor(exit, &wg)
+	s.minBackoff = time.Millisecond
+	s.maxBackoff = 4 * time.Millisecond
+
+	restarts := bgTaskRestartCount(c, "panicky")
+	runs := 0
+	done := make(chan struct{})
+	s.Go("panicky", RestartOnPanic, 0, func(t *bgTask) {
+		runs++
+		if runs < 3 {
+			panic("mock panic")
+		}
+		t.Heartbeat()
+		close(done)
+	})
+	s.Go("once", RestartNever, 0, func(t *bgTask) {
+		panic("mock panic")
+	})
+	<-done
+	wg.Wait()
+	close(exit)
+
+	statuses := s.Statuses()
+	c.Assert(statuses, HasLen, 2)
+	c.Assert(statuses[0].Name, Equals, "once")
+	c.Assert(statuses[0].State, Equals, BackgroundTaskFailed)
+	c.Assert(statuses[0].Restarts, Equals, 0)
+	c.Assert(statuses[0].LastError, Equals, "mock panic")
+	c.Assert(statuses[1].Name, Equals, "panicky")
+	c.Assert(statuses[1].State, Equals, BackgroundTaskExited)
+	c.Assert(statuses[1].Restarts, Equals, 2)
+	c.Assert(statuses[1].LastError, Equals, "mock panic")
+	c.Assert(statuses[1].LastHeartbeat.IsZero(), IsFalse)
+	c.Assert(bgTaskRestartCount(c, "panicky")-restarts, Equals, float64(2))
+}
+
+func (*testSuite) TestBgSupervisorStalled(c *C) {
+	exit := make(chan struct{})
+	var wg sync.WaitGroup
+	s := newBgSupervisor(exit, &wg)
+
+	s.Go("stuck", RestartOnPanic, time.Millisecond, func(t *bgTask) {
+		<-exit
+	})
+	time.Sleep(10 * time.Millisecond)
+	statuses := s.Statuses()
+	c.Assert(statuses, HasLen, 1)
+	c.Assert(statuses[0].State, Equals, BackgroundTaskStalled)
+
+	close(exit)
+	wg.Wait()
+	c.Assert(s.Statuses()[0].State, Equals, BackgroundTaskExited)
+}
@@ -0,0 +1,68 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package petri
+
+import (
+	"os"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/schemareplicant"
+	"github.com/whtcorpsinc/errors"
+)
+
+// DumpMeta exports all the DBInfo and BlockInfo in the meta at ts, including the
+// ones which are not public, so the dump shows what is actually stored.
+func (do *Petri) DumpMeta(ts uint64) (*schemareplicant.MetaDump, error) {
+	m, err := do.GetSnapshotMeta(ts)
+	if err != nil {
+		return nil, err
+	}
+	schemaVersion, err := m.GetSchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	dbInfos, err := m.ListDatabases()
+	if err != nil {
+		return nil, err
+	}
+	for _, di := range dbInfos {
+		di.Blocks, err = m.ListBlocks(di.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &schemareplicant.MetaDump{
+		FormatVersion: schemareplicant.MetaDumpFormatVersion,
+		SchemaVersion: schemaVersion,
+		TS:            ts,
+		DBs:           dbInfos,
+	}, nil
+}
+
+// DumpMetaToFile exports the meta at ts to the file at path, the file can be loaded
+// by schemareplicant.ReadMetaDumpFile.
+func (do *Petri) DumpMetaToFile(ts uint64, path string) error {
+	dump, err := do.DumpMeta(ts)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if err = schemareplicant.WriteMetaDump(f, dump); err != nil {
+		f.Close()
+		return err
+	}
+	return errors.Trace(f.Close())
+}
@@ -75,6 +75,8 @@ type Petri struct {
 	slowQuery            *topNSlowQueries
 	expensiveQueryHandle *expensivequery.Handle
 	wg                   sync.WaitGroup
+	bgTasks              *bgSupervisor
+	reloadStats          atomic.Value // SchemaReloadStats
 	statsUFIDelating     sync2.AtomicInt32
 	cancel               context.CancelFunc
 	indexUsageSyncLease  time.Duration
@@ -82,20 +84,23 @@ type Petri struct {
 
 // loadSchemaReplicant loads schemareplicant at startTS into handle, usedSchemaVersion is the currently used
 // schemareplicant version, if it is the same as the schemaReplicant version at startTS, we don't need to reload again.
-// It returns the latest schemaReplicant version, the changed block IDs, whether it's a full load and an error.
+// It returns the latest schemaReplicant version, the changed block IDs, the statistics of the load
+// (including whether it's a full load) and an error.
 func (do *Petri) loadSchemaReplicant(handle *schemareplicant.Handle, usedSchemaVersion int64,
-	startTS uint64) (neededSchemaVersion int64, change *einsteindb.RelatedSchemaChange, fullLoad bool, err error) {
+	startTS uint64) (neededSchemaVersion int64, change *einsteindb.RelatedSchemaChange, stats SchemaReloadStats, err error) {
+	stats.UsedSchemaVersion = usedSchemaVersion
 	snapshot, err := do.causetstore.GetSnapshot(solomonkey.NewVersion(startTS))
 	if err != nil {
-		return 0, nil, fullLoad, err
+		return 0, nil, stats, err
 	}
 	m := meta.NewSnapshotMeta(snapshot)
 	neededSchemaVersion, err = m.GetSchemaVersion()
 	if err != nil {
-		return 0, nil, fullLoad, err
+		return 0, nil, stats, err
 	}
+	stats.NeededSchemaVersion = neededSchemaVersion
 	if usedSchemaVersion != 0 && usedSchemaVersion == neededSchemaVersion {
-		return neededSchemaVersion, nil, fullLoad, nil
+		return neededSchemaVersion, nil, stats, nil
 	}
 
 	// UFIDelate self schemaReplicant version to etcd.
@@ -119,37 +124,45 @@ func (do *Petri) loadSchemaReplicant(handle *schemareplicant.Handle, usedSchemaV
 	}()
 
 	startTime := time.Now()
-	ok, relatedChanges, err := do.tryLoadSchemaDiffs(m, usedSchemaVersion, neededSchemaVersion)
+	ok, relatedChanges, err := do.tryLoadSchemaDiffs(m, usedSchemaVersion, neededSchemaVersion, &stats)
 	if err != nil {
 		// We can fall back to full load, don't need to return the error.
 		logutil.BgLogger().Error("failed to load schemaReplicant diff", zap.Error(err))
 	}
 	if ok {
+		stats.Duration = time.Since(startTime)
 		logutil.BgLogger().Info("diff load SchemaReplicant success",
 			zap.Int64("usedSchemaVersion", usedSchemaVersion),
 			zap.Int64("neededSchemaVersion", neededSchemaVersion),
-			zap.Duration("start time", time.Since(startTime)),
+			zap.Duration("start time", stats.Duration),
+			zap.Int("diffsApplied", stats.DiffsApplied),
+			zap.Int("blocksTouched", stats.BlocksTouched),
 			zap.Int64s("phyTblIDs", relatedChanges.PhyTblIDS),
 			zap.Uint64s("actionTypes", relatedChanges.CausetActionTypes))
-		return neededSchemaVersion, relatedChanges, fullLoad, nil
+		return neededSchemaVersion, relatedChanges, stats, nil
 	}
 
-	fullLoad = true
+	stats.FullLoad = true
+	stats.DiffsApplied, stats.BlocksTouched = 0, 0
 	schemas, err := do.fetchAllSchemasWithBlocks(m)
 	if err != nil {
-		return 0, nil, fullLoad, err
+		return 0, nil, stats, err
 	}
 
 	newISBuilder, err := schemareplicant.NewBuilder(handle).InitWithDBInfos(schemas, neededSchemaVersion)
 	if err != nil {
-		return 0, nil, fullLoad, err
+		return 0, nil, stats, err
 	}
+	for _, di := range schemas {
+		stats.BlocksTouched += len(di.Blocks)
+	}
+	stats.Duration = time.Since(startTime)
 	logutil.BgLogger().Info("full load SchemaReplicant success",
 		zap.Int64("usedSchemaVersion", usedSchemaVersion),
 		zap.Int64("neededSchemaVersion", neededSchemaVersion),
-		zap.Duration("start time", time.Since(startTime)))
+		zap.Duration("start time", stats.Duration))
 	newISBuilder.Build()
-	return neededSchemaVersion, nil, fullLoad, nil
+	return neededSchemaVersion, nil, stats, nil
 }
 
 func (do *Petri) fetchAllSchemasWithBlocks(m *meta.Meta) ([]*perceptron.DBInfo, error) {
@@ -225,57 +238,65 @@ func (do *Petri) fetchSchemasWithBlocks(schemas []*perceptron.DBInfo, m *meta.Me
 }
 
 const (
-	initialVersion         = 0
-	maxNumberOfDiffsToLoad = 100
+	initialVersion = 0
+	// schemaDiffBatchSize is the number of schemaReplicant diffs fetched from meta at a time,
+	// a large version gap is loaded batch by batch to bound the memory usage.
+	schemaDiffBatchSize = 100
 )
 
-func isTooOldSchema(usedVersion, newVersion int64) bool {
-	if usedVersion == initialVersion || newVersion-usedVersion > maxNumberOfDiffsToLoad {
-		return true
-	}
-	return false
-}
-
 // tryLoadSchemaDiffs tries to only load latest schemaReplicant changes.
 // Return true if the schemaReplicant is loaded successfully.
 // Return false if the schemaReplicant can not be loaded by schemaReplicant diff, then we need to do full load.
 // The second returned value is the delta uFIDelated block and partition IDs.
-func (do *Petri) tryLoadSchemaDiffs(m *meta.Meta, usedVersion, newVersion int64) (bool, *einsteindb.RelatedSchemaChange, error) {
-	// If there isn't any used version, or used version is too old, we do full load.
+// The diffs are fetched and applied in batches of schemaDiffBatchSize, the number of applied
+// diffs and touched blocks are recorded in stats.
+func (do *Petri) tryLoadSchemaDiffs(m *meta.Meta, usedVersion, newVersion int64, stats *SchemaReloadStats) (bool, *einsteindb.RelatedSchemaChange, error) {
+	// If there isn't any used version, we do full load.
 	// And when users use history read feature, we will set usedVersion to initialVersion, then full load is needed.
-	if isTooOldSchema(usedVersion, newVersion) {
+	if usedVersion == initialVersion {
 		return false, nil, nil
 	}
-	var diffs []*perceptron.SchemaDiff
-	for usedVersion < newVersion {
-		usedVersion++
-		diff, err := m.GetSchemaDiff(usedVersion)
-		if err != nil {
-			return false, nil, err
-		}
-		if diff == nil {
-			// If diff is missing for any version between used and new version, we fall back to full reload.
-			return false, nil, nil
-		}
-		diffs = append(diffs, diff)
-	}
 	builder := schemareplicant.NewBuilder(do.infoHandle).InitWithOldSchemaReplicant()
-	phyTblIDs := make([]int64, 0, len(diffs))
-	actions := make([]uint64, 0, len(diffs))
-	for _, diff := range diffs {
-		IDs, err := builder.ApplyDiff(m, diff)
-		if err != nil {
-			return false, nil, err
-		}
-		if canSkipSchemaCheckerDBS(diff.Type) {
-			continue
+	phyTblIDs := make([]int64, 0, newVersion-usedVersion)
+	actions := make([]uint64, 0, newVersion-usedVersion)
+	touched := make(map[int64]struct{})
+	diffs := make([]*perceptron.SchemaDiff, 0, schemaDiffBatchSize)
+	for usedVersion < newVersion {
+		diffs = diffs[:0]
+		for usedVersion < newVersion && len(diffs) < schemaDiffBatchSize {
+			usedVersion++
+			diff, err := m.GetSchemaDiff(usedVersion)
+			if err != nil {
+				return false, nil, err
+			}
+			if diff == nil {
+				// If diff is missing for any version between used and new version, we fall back to full reload.
+				logutil.BgLogger().Info("schemaReplicant diff is missing, fall back to full load",
+					zap.Int64("version", usedVersion))
+				return false, nil, nil
+			}
+			diffs = append(diffs, diff)
 		}
-		phyTblIDs = append(phyTblIDs, IDs...)
-		for i := 0; i < len(IDs); i++ {
-			actions = append(actions, uint64(1<<diff.Type))
+		for _, diff := range diffs {
+			IDs, err := builder.ApplyDiff(m, diff)
+			if err != nil {
+				return false, nil, err
+			}
+			stats.DiffsApplied++
+			for _, id := range IDs {
+				touched[id] = struct{}{}
+			}
+			if canSkipSchemaCheckerDBS(diff.Type) {
+				continue
+			}
+			phyTblIDs = append(phyTblIDs, IDs...)
+			for i := 0; i < len(IDs); i++ {
+				actions = append(actions, uint64(1<<diff.Type))
+			}
 		}
 	}
 	builder.Build()
+	stats.BlocksTouched = len(touched)
 	relatedChange := einsteindb.RelatedSchemaChange{}
 	relatedChange.PhyTblIDS = phyTblIDs
 	relatedChange.CausetActionTypes = actions
@@ -366,18 +387,19 @@ func (do *Petri) Reload() error {
 	}
 
 	var (
-		fullLoad       bool
+		stats          SchemaReloadStats
 		relatedChanges *einsteindb.RelatedSchemaChange
 	)
-	neededSchemaVersion, relatedChanges, fullLoad, err = do.loadSchemaReplicant(do.infoHandle, schemaVersion, ver.Ver)
+	neededSchemaVersion, relatedChanges, stats, err = do.loadSchemaReplicant(do.infoHandle, schemaVersion, ver.Ver)
 	metrics.LoadSchemaDuration.Observe(time.Since(startTime).Seconds())
 	if err != nil {
 		metrics.LoadSchemaCounter.WithLabelValues("failed").Inc()
 		return err
 	}
 	metrics.LoadSchemaCounter.WithLabelValues("succ").Inc()
+	do.recordSchemaReloadStats(stats)
 
-	if fullLoad {
+	if stats.FullLoad {
 		logutil.BgLogger().Info("full load and reset schemaReplicant validator")
 		do.SchemaValidator.Reset()
 	}
@@ -419,15 +441,17 @@ func (do *Petri) ShowSlowQuery(showSlow *ast.ShowSlow) []*SlowQueryInfo {
 	return msg.result
 }
 
-func (do *Petri) topNSlowQueryLoop() {
-	defer soliton.Recover(metrics.LabelPetri, "topNSlowQueryLoop", nil, false)
-	ticker := time.NewTicker(time.Minute * 10)
+// topNSlowQueryInterval is the interval to remove the expired slow queries.
+const topNSlowQueryInterval = 10 * time.Minute
+
+func (do *Petri) topNSlowQueryLoop(task *bgTask) {
+	ticker := time.NewTicker(topNSlowQueryInterval)
 	defer func() {
 		ticker.Stop()
-		do.wg.Done()
 		logutil.BgLogger().Info("topNSlowQueryLoop exited.")
 	}()
 	for {
+		task.Heartbeat()
 		select {
 		case now := <-ticker.C:
 			do.slowQuery.RemoveExpired(now)
@@ -451,15 +475,14 @@ func (do *Petri) topNSlowQueryLoop() {
 	}
 }
 
-func (do *Petri) infoSyncerKeeper() {
+func (do *Petri) infoSyncerKeeper(task *bgTask) {
+	ticker := time.NewTicker(infosync.ReportInterval)
 	defer func() {
-		do.wg.Done()
+		ticker.Stop()
 		logutil.BgLogger().Info("infoSyncerKeeper exited.")
-		soliton.Recover(metrics.LabelPetri, "infoSyncerKeeper", nil, false)
 	}()
-	ticker := time.NewTicker(infosync.ReportInterval)
-	defer ticker.Stop()
 	for {
+		task.Heartbeat()
 		select {
 		case <-ticker.C:
 			do.info.ReportMinStartTS(do.CausetStore())
@@ -476,16 +499,15 @@ func (do *Petri) infoSyncerKeeper() {
 	}
 }
 
-func (do *Petri) topologySyncerKeeper() {
-	defer soliton.Recover(metrics.LabelPetri, "topologySyncerKeeper", nil, false)
+func (do *Petri) topologySyncerKeeper(task *bgTask) {
 	ticker := time.NewTicker(infosync.TopologyTimeToRefresh)
 	defer func() {
 		ticker.Stop()
-		do.wg.Done()
 		logutil.BgLogger().Info("topologySyncerKeeper exited.")
 	}()
 
 	for {
+		task.Heartbeat()
 		select {
 		case <-ticker.C:
 			err := do.info.StoreTopologyInfo(context.Background())
@@ -505,19 +527,22 @@ func (do *Petri) topologySyncerKeeper() {
 	}
 }
 
-func (do *Petri) loadSchemaInLoop(ctx context.Context, lease time.Duration) {
-	defer soliton.Recover(metrics.LabelPetri, "loadSchemaInLoop", nil, true)
+// loadSchemaInLoop reloads the schemaReplicant every lease/2. It runs under the supervisor
+// with RestartOnPanic, so a panic doesn't exit the process. It's logged with the stack,
+// counted by metrics.PetriBackgroundTaskRestartCounter, and the loop is restarted with
+// backoff.
+func (do *Petri) loadSchemaInLoop(ctx context.Context, lease time.Duration, task *bgTask) {
 	// Lease renewal can run at any frequency.
 	// Use lease/2 here as recommend by paper.
 	ticker := time.NewTicker(lease / 2)
 	defer func() {
 		ticker.Stop()
-		do.wg.Done()
 		logutil.BgLogger().Info("loadSchemaInLoop exited.")
 	}()
 	syncer := do.dbs.SchemaSyncer()
 
 	for {
+		task.Heartbeat()
 		select {
 		case <-ticker.C:
 			err := do.Reload()
@@ -670,6 +695,7 @@ func NewPetri(causetstore solomonkey.CausetStorage, dbsLease time.Duration, stat
 		slowQuery:           newTopNSlowQueries(30, time.Hour*24*7, 500),
 		indexUsageSyncLease: idxUsageSyncLease,
 	}
+	do.bgTasks = newBgSupervisor(do.exit, &do.wg)
 
 	do.SchemaValidator = NewSchemaValidator(dbsLease, do)
 	return do
@@ -763,82 +789,22 @@ func (do *Petri) Init(dbsLease time.Duration, sysFactory func(*Petri) (pools.Res
 	// Only when the causetstore is local that the lease value is 0.
 	// If the causetstore is local, it doesn't need loadSchemaInLoop.
 	if dbsLease > 0 {
-		do.wg.Add(1)
 		// Local causetstore needs to get the change information for every DBS state in each stochastik.
-		go do.loadSchemaInLoop(ctx, dbsLease)
+		do.bgTasks.Go("loadSchemaInLoop", RestartOnPanic, 3*dbsLease, func(t *bgTask) {
+			do.loadSchemaInLoop(ctx, dbsLease, t)
+		})
 	}
-	do.wg.Add(1)
-	go do.topNSlowQueryLoop()
-
-	do.wg.Add(1)
-	go do.infoSyncerKeeper()
+	do.bgTasks.Go("topNSlowQueryLoop", RestartOnPanic, 3*topNSlowQueryInterval, do.topNSlowQueryLoop)
+	do.bgTasks.Go("infoSyncerKeeper", RestartOnPanic, 3*infosync.ReportInterval, do.infoSyncerKeeper)
 
 	if !skipRegisterToDashboard {
-		do.wg.Add(1)
-		go do.topologySyncerKeeper()
+		do.bgTasks.Go("topologySyncerKeeper", RestartOnPanic, 3*infosync.TopologyTimeToRefresh, do.topologySyncerKeeper)
 	}
+	do.bgTasks.Go("evictIdleStochastiksLoop", RestartOnPanic, 3*do.sysStochastikPool.idleTimeout, do.evictIdleStochastiksLoop)
 
 	return nil
 }
 
-type stochastikPool struct {
-	resources chan pools.Resource
-	factory   pools.Factory
-	mu        struct {
-		sync.RWMutex
-		closed bool
-	}
-}
-
-func newStochastikPool(cap int, factory pools.Factory) *stochastikPool {
-	return &stochastikPool{
-		resources: make(chan pools.Resource, cap),
-		factory:   factory,
-	}
-}
-
-func (p *stochastikPool) Get() (resource pools.Resource, err error) {
-	var ok bool
-	select {
-	case resource, ok = <-p.resources:
-		if !ok {
-			err = errors.New("stochastik pool closed")
-		}
-	default:
-		resource, err = p.factory()
-	}
-	return
-}
-
-func (p *stochastikPool) Put(resource pools.Resource) {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-	if p.mu.closed {
-		resource.Close()
-		return
-	}
-
-	select {
-	case p.resources <- resource:
-	default:
-		resource.Close()
-	}
-}
-func (p *stochastikPool) Close() {
-	p.mu.Lock()
-	if p.mu.closed {
-		p.mu.Unlock()
-		return
-	}
-	p.mu.closed = true
-	close(p.resources)
-	p.mu.Unlock()
-
-	for r := range p.resources {
-		r.Close()
-	}
-}
-
 // SysStochastikPool returns the system stochastik pool.
 func (do *Petri) SysStochastikPool() *stochastikPool {
 	return do.sysStochastikPool
@@ -16,6 +16,7 @@ package petri
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
 	"math"
 	"net"
 	"runtime"
@@ -307,11 +308,51 @@ func (*testSuite) TestT(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(tbl.Meta(), DeepEquals, tblInfo2)
 
-	// Test for tryLoadSchemaDiffs when "isTooOldSchema" is false.
+	// Test for tryLoadSchemaDiffs when the used version isn't initialVersion.
 	err = dd.CreateSchema(ctx, perceptron.NewCIStr("bbb"), cs)
 	c.Assert(err, IsNil)
 	err = dom.Reload()
 	c.Assert(err, IsNil)
+	reloadStats, ok := dom.LastSchemaReloadStats()
+	c.Assert(ok, IsTrue)
+	c.Assert(reloadStats.FullLoad, IsFalse)
+	c.Assert(reloadStats.DiffsApplied, GreaterEqual, 1)
+	c.Assert(reloadStats.NeededSchemaVersion, Greater, reloadStats.UsedSchemaVersion)
+
+	// Test for tryLoadSchemaDiffs when the diffs are applied in more than one batch.
+	const batchDiffs = schemaDiffBatchSize + 20
+	err = solomonkey.RunInNewTxn(causetstore, true, func(txn solomonkey.Transaction) error {
+		m := meta.NewMeta(txn)
+		for i := 0; i < batchDiffs; i++ {
+			dbID, err := m.GenGlobalID()
+			if err != nil {
+				return err
+			}
+			dbInfo := &perceptron.DBInfo{ID: dbID, Name: perceptron.NewCIStr(fmt.Sprintf("batch_%d", i)), State: perceptron.StatePublic}
+			if err = m.CreateDatabase(dbInfo); err != nil {
+				return err
+			}
+			ver, err := m.GenSchemaVersion()
+			if err != nil {
+				return err
+			}
+			if err = m.SetSchemaDiff(&perceptron.SchemaDiff{Version: ver, Type: perceptron.CausetActionCreateSchema, SchemaID: dbID}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	c.Assert(err, IsNil)
+	err = dom.Reload()
+	c.Assert(err, IsNil)
+	reloadStats, ok = dom.LastSchemaReloadStats()
+	c.Assert(ok, IsTrue)
+	c.Assert(reloadStats.FullLoad, IsFalse)
+	c.Assert(reloadStats.DiffsApplied, Equals, batchDiffs)
+	for _, i := range []int{0, schemaDiffBatchSize - 1, schemaDiffBatchSize, batchDiffs - 1} {
+		_, ok = dom.SchemaReplicant().SchemaByName(perceptron.NewCIStr(fmt.Sprintf("batch_%d", i)))
+		c.Assert(ok, IsTrue)
+	}
 
 	// for schemaValidator
 	schemaVer := dom.SchemaValidator.(*schemaValidator).LatestSchemaVersion()
@@ -447,16 +488,24 @@ func (*testSuite) TestStochastikPool(c *C) {
 	pool := newStochastikPool(1, f)
 	tr, err := pool.Get()
 	c.Assert(err, IsNil)
+	// Capacity is 1, so Get waits for tr to be put back.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	_, err = pool.GetWithContext(ctx)
+	cancel()
+	c.Assert(errors.Cause(err), Equals, context.DeadlineExceeded)
+	pool.Put(tr)
 	tr1, err := pool.Get()
 	c.Assert(err, IsNil)
-	pool.Put(tr)
-	// Capacity is 1, so tr1 is closed.
-	pool.Put(tr1)
-	c.Assert(tr1.(*testResource).status, Equals, 1)
+	c.Assert(tr1, Equals, tr)
+	// A resource not got from the pool is closed.
+	other := &testResource{}
+	pool.Put(other)
+	c.Assert(other.status, Equals, 1)
 	pool.Close()
 
 	pool.Close()
 	pool.Put(tr1)
+	c.Assert(tr1.(*testResource).status, Equals, 1)
 	tr, err = pool.Get()
 	c.Assert(err.Error(), Equals, "stochastik pool closed")
 	c.Assert(tr, IsNil)
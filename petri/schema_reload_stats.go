@@ -0,0 +1,59 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package petri
+
+import (
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/metrics"
+)
+
+// SchemaReloadStats is the statistics of a schemaReplicant reload.
+type SchemaReloadStats struct {
+	// FullLoad indicates whether all the schemas are loaded from meta.
+	FullLoad bool
+	// UsedSchemaVersion is the schemaReplicant version before the reload.
+	UsedSchemaVersion int64
+	// NeededSchemaVersion is the schemaReplicant version after the reload.
+	NeededSchemaVersion int64
+	// DiffsApplied is the number of schemaReplicant diffs applied by Builder.ApplyDiff.
+	DiffsApplied int
+	// BlocksTouched is the number of distinct blocks changed by the diffs,
+	// or the number of loaded blocks for a full load.
+	BlocksTouched int
+	// Duration is the time spent on loading the schemaReplicant.
+	Duration time.Duration
+}
+
+func (do *Petri) recordSchemaReloadStats(stats SchemaReloadStats) {
+	if !stats.FullLoad && stats.DiffsApplied == 0 {
+		// Nothing is reloaded.
+		return
+	}
+	do.reloadStats.CausetStore(stats)
+	tp := metrics.LblSchemaReloadDiff
+	if stats.FullLoad {
+		tp = metrics.LblSchemaReloadFull
+	}
+	metrics.SchemaReloadDuration.WithLabelValues(tp).Observe(stats.Duration.Seconds())
+	metrics.SchemaReloadDiffsCounter.Add(float64(stats.DiffsApplied))
+	metrics.SchemaReloadBlocksCounter.WithLabelValues(tp).Add(float64(stats.BlocksTouched))
+}
+
+// LastSchemaReloadStats returns the statistics of the latest schemaReplicant reload which
+// changed the schemaReplicant, ok is false if the schemaReplicant has never been reloaded.
+func (do *Petri) LastSchemaReloadStats() (stats SchemaReloadStats, ok bool) {
+	stats, ok = do.reloadStats.Load().(SchemaReloadStats)
+	return
+}
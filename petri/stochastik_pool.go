@@ -0,0 +1,303 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package petri
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ngaut/pools"
+	"github.com/whtcorpsinc/MilevaDB-Prod/metrics"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/logutil"
+	"github.com/whtcorpsinc/errors"
+	"go.uber.org/zap"
+)
+
+// sysStochastikPoolWaitTimeout is the max time Get waits for a free stochastik.
+const sysStochastikPoolWaitTimeout = 30 * time.Second
+
+var errStochastikPoolClosed = errors.New("stochastik pool closed")
+
+// resourceValidator is implemented by the pooled resources which are able to
+// check their own health. A resource fails the validation is closed instead
+// of being handed out.
+type resourceValidator interface {
+	Validate() error
+}
+
+type idleResource struct {
+	resource pools.Resource
+	since    time.Time
+}
+
+// stochastikPool is a bounded pool of system stochastiks. At most `cap` stochastiks
+// are alive at the same time, Get blocks until one is returned or the context is done.
+// A resource got from the pool must be given back by Put, or by Destroy if it's closed.
+// The slots of the resources which are closed without Destroy are reclaimed once they
+// fail the validation.
+type stochastikPool struct {
+	resources   chan idleResource
+	tokens      chan struct{}
+	factory     pools.Factory
+	idleTimeout time.Duration
+	mu          struct {
+		sync.RWMutex
+		closed bool
+		// inUse are the resources got from the pool and not given back yet.
+		inUse map[pools.Resource]struct{}
+	}
+}
+
+func newStochastikPool(cap int, factory pools.Factory) *stochastikPool {
+	p := &stochastikPool{
+		resources:   make(chan idleResource, cap),
+		tokens:      make(chan struct{}, cap),
+		factory:     factory,
+		idleTimeout: resourceIdleTimeout,
+	}
+	p.mu.inUse = make(map[pools.Resource]struct{})
+	return p
+}
+
+// Get gets a stochastik from the pool, it waits at most sysStochastikPoolWaitTimeout.
+func (p *stochastikPool) Get() (resource pools.Resource, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sysStochastikPoolWaitTimeout)
+	defer cancel()
+	return p.GetWithContext(ctx)
+}
+
+// GetWithContext gets a stochastik from the pool. An idle stochastik is preferred,
+// a new one is created if the pool is not full, otherwise it blocks until a stochastik
+// is put back or ctx is done.
+func (p *stochastikPool) GetWithContext(ctx context.Context) (resource pools.Resource, err error) {
+	startTime := time.Now()
+	defer func() {
+		metrics.SysStochastikPoolWaitDuration.Observe(time.Since(startTime).Seconds())
+		p.uFIDelateGauges()
+	}()
+	for {
+		p.mu.RLock()
+		closed := p.mu.closed
+		p.mu.RUnlock()
+		if closed {
+			return nil, errStochastikPoolClosed
+		}
+
+		var (
+			idle idleResource
+			ok   bool
+		)
+		select {
+		case idle, ok = <-p.resources:
+		default:
+			if len(p.tokens) == cap(p.tokens) {
+				p.reclaimInvalid()
+			}
+			select {
+			case idle, ok = <-p.resources:
+			case p.tokens <- struct{}{}:
+				resource, err = p.factory()
+				if err != nil {
+					<-p.tokens
+					return nil, err
+				}
+				metrics.SysStochastikPoolCreatedCounter.Inc()
+				return p.checkOut(resource)
+			case <-ctx.Done():
+				return nil, errors.Annotate(ctx.Err(), "wait for system stochastik pool")
+			}
+		}
+		if !ok {
+			return nil, errStochastikPoolClosed
+		}
+		if p.isExpired(idle, time.Now()) {
+			p.destroy(idle.resource, metrics.LblEvicted)
+			continue
+		}
+		if v, ok := idle.resource.(resourceValidator); ok {
+			if err := v.Validate(); err != nil {
+				logutil.BgLogger().Warn("invalid stochastik in system stochastik pool", zap.Error(err))
+				p.destroy(idle.resource, metrics.LblInvalid)
+				continue
+			}
+		}
+		return p.checkOut(idle.resource)
+	}
+}
+
+// checkOut records the resource as in use. The resource is closed if the pool is
+// closed meanwhile.
+func (p *stochastikPool) checkOut(resource pools.Resource) (pools.Resource, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.mu.closed {
+		p.destroy(resource, metrics.LblEvicted)
+		return nil, errStochastikPoolClosed
+	}
+	p.mu.inUse[resource] = struct{}{}
+	return resource, nil
+}
+
+// checkIn removes the resource from the in-use ones, it returns false if the resource
+// isn't got from the pool, or its slot is already released.
+func (p *stochastikPool) checkIn(resource pools.Resource) bool {
+	if _, ok := p.mu.inUse[resource]; !ok {
+		return false
+	}
+	delete(p.mu.inUse, resource)
+	return true
+}
+
+// Put gives the resource back to the pool.
+func (p *stochastikPool) Put(resource pools.Resource) {
+	defer p.uFIDelateGauges()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.checkIn(resource) {
+		// The resource doesn't hold a slot, it mustn't release the slot of another one.
+		closeResource(resource)
+		return
+	}
+	if p.mu.closed {
+		p.destroy(resource, metrics.LblEvicted)
+		return
+	}
+
+	select {
+	case p.resources <- idleResource{resource: resource, since: time.Now()}:
+	default:
+		p.destroy(resource, metrics.LblEvicted)
+	}
+}
+
+// Destroy closes a resource got from the pool instead of giving it back, and releases
+// its slot.
+func (p *stochastikPool) Destroy(resource pools.Resource) {
+	defer p.uFIDelateGauges()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.checkIn(resource) {
+		closeResource(resource)
+		return
+	}
+	p.destroy(resource, metrics.LblInvalid)
+}
+
+// reclaimInvalid releases the slots of the in-use resources failing the validation,
+// which are closed without being given back.
+func (p *stochastikPool) reclaimInvalid() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for resource := range p.mu.inUse {
+		v, ok := resource.(resourceValidator)
+		if !ok || v.Validate() == nil {
+			continue
+		}
+		logutil.BgLogger().Warn("reclaim the slot of an invalid stochastik not given back to the system stochastik pool")
+		delete(p.mu.inUse, resource)
+		p.releaseToken(metrics.LblInvalid)
+	}
+}
+
+func (p *stochastikPool) Close() {
+	p.mu.Lock()
+	if p.mu.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.mu.closed = true
+	close(p.resources)
+	// The in-use resources are closed by Put.
+	p.mu.Unlock()
+
+	for r := range p.resources {
+		p.destroy(r.resource, metrics.LblEvicted)
+	}
+	p.uFIDelateGauges()
+}
+
+// evictIdle closes the stochastiks which are idle for longer than idleTimeout.
+func (p *stochastikPool) evictIdle(now time.Time) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.mu.closed {
+		return
+	}
+	for i, n := 0, len(p.resources); i < n; i++ {
+		var idle idleResource
+		select {
+		case idle = <-p.resources:
+		default:
+			return
+		}
+		if p.isExpired(idle, now) {
+			p.destroy(idle.resource, metrics.LblEvicted)
+			continue
+		}
+		select {
+		case p.resources <- idle:
+		default:
+			p.destroy(idle.resource, metrics.LblEvicted)
+		}
+	}
+	p.uFIDelateGauges()
+}
+
+func (p *stochastikPool) isExpired(idle idleResource, now time.Time) bool {
+	return p.idleTimeout > 0 && now.Sub(idle.since) > p.idleTimeout
+}
+
+// destroy closes the resource and releases its slot in the pool.
+func (p *stochastikPool) destroy(resource pools.Resource, reason string) {
+	closeResource(resource)
+	p.releaseToken(reason)
+}
+
+func closeResource(resource pools.Resource) {
+	if resource != nil {
+		resource.Close()
+	}
+}
+
+func (p *stochastikPool) releaseToken(reason string) {
+	select {
+	case <-p.tokens:
+	default:
+	}
+	metrics.SysStochastikPoolDestroyedCounter.WithLabelValues(reason).Inc()
+}
+
+func (p *stochastikPool) uFIDelateGauges() {
+	idle := len(p.resources)
+	metrics.SysStochastikPoolGauge.WithLabelValues(metrics.LblIdle).Set(float64(idle))
+	metrics.SysStochastikPoolGauge.WithLabelValues(metrics.LblInUse).Set(float64(len(p.tokens) - idle))
+}
+
+func (do *Petri) evictIdleStochastiksLoop(task *bgTask) {
+	ticker := time.NewTicker(do.sysStochastikPool.idleTimeout / 2)
+	defer func() {
+		ticker.Stop()
+		logutil.BgLogger().Info("evictIdleStochastiksLoop exited.")
+	}()
+	for {
+		task.Heartbeat()
+		select {
+		case now := <-ticker.C:
+			do.sysStochastikPool.evictIdle(now)
+		case <-do.exit:
+			return
+		}
+	}
+}
@@ -0,0 +1,129 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package petri
+
+import (
+	"context"
+	"time"
+
+	"github.com/ngaut/pools"
+	. "github.com/whtcorpsinc/check"
+	"github.com/whtcorpsinc/errors"
+)
+
+type mockPoolResource struct {
+	closed  bool
+	invalid bool
+}
+
+func (r *mockPoolResource) Close() { r.closed = true }
+
+func (r *mockPoolResource) Validate() error {
+	if r.invalid {
+		return errors.New("mock invalid")
+	}
+	return nil
+}
+
+func (*testSuite) TestStochastikPoolBounded(c *C) {
+	created := 0
+	p := newStochastikPool(2, func() (pools.Resource, error) {
+		created++
+		return &mockPoolResource{}, nil
+	})
+	r1, err := p.Get()
+	c.Assert(err, IsNil)
+	r2, err := p.Get()
+	c.Assert(err, IsNil)
+	c.Assert(created, Equals, 2)
+
+	// The pool is full, Get blocks until the deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	_, err = p.GetWithContext(ctx)
+	cancel()
+	c.Assert(errors.Cause(err), Equals, context.DeadlineExceeded)
+
+	// A returned stochastik is reused.
+	p.Put(r1)
+	r3, err := p.Get()
+	c.Assert(err, IsNil)
+	c.Assert(r3, Equals, r1)
+	c.Assert(created, Equals, 2)
+
+	// An invalid stochastik is closed and replaced by a new one.
+	r3.(*mockPoolResource).invalid = true
+	p.Put(r3)
+	r4, err := p.Get()
+	c.Assert(err, IsNil)
+	c.Assert(r4, Not(Equals), r3)
+	c.Assert(r3.(*mockPoolResource).closed, IsTrue)
+	c.Assert(created, Equals, 3)
+
+	p.Put(r2)
+	p.Put(r4)
+	p.Close()
+	c.Assert(r2.(*mockPoolResource).closed, IsTrue)
+	c.Assert(r4.(*mockPoolResource).closed, IsTrue)
+	_, err = p.Get()
+	c.Assert(err, Equals, errStochastikPoolClosed)
+}
+
+func (*testSuite) TestStochastikPoolEvictIdle(c *C) {
+	p := newStochastikPool(2, func() (pools.Resource, error) {
+		return &mockPoolResource{}, nil
+	})
+	p.idleTimeout = time.Minute
+	r1, err := p.Get()
+	c.Assert(err, IsNil)
+	r2, err := p.Get()
+	c.Assert(err, IsNil)
+	p.Put(r1)
+	p.Put(r2)
+
+	p.evictIdle(time.Now())
+	c.Assert(len(p.resources), Equals, 2)
+	p.evictIdle(time.Now().Add(2 * time.Minute))
+	c.Assert(len(p.resources), Equals, 0)
+	c.Assert(len(p.tokens), Equals, 0)
+	c.Assert(r1.(*mockPoolResource).closed, IsTrue)
+	c.Assert(r2.(*mockPoolResource).closed, IsTrue)
+	p.Close()
+}
+
+func (*testSuite) TestStochastikPoolReleaseSlot(c *C) {
+	p := newStochastikPool(1, func() (pools.Resource, error) {
+		return &mockPoolResource{}, nil
+	})
+	r1, err := p.Get()
+	c.Assert(err, IsNil)
+	p.Destroy(r1)
+	c.Assert(r1.(*mockPoolResource).closed, IsTrue)
+	c.Assert(len(p.tokens), Equals, 0)
+
+	// A stochastik closed without Destroy holds its slot until it fails the validation.
+	r2, err := p.Get()
+	c.Assert(err, IsNil)
+	r2.(*mockPoolResource).closed = true
+	r2.(*mockPoolResource).invalid = true
+	r3, err := p.Get()
+	c.Assert(err, IsNil)
+	c.Assert(r3, Not(Equals), r2)
+	// Putting back the reclaimed stochastik doesn't release the slot of another one.
+	p.Put(r2)
+	c.Assert(len(p.tokens), Equals, 1)
+	p.Put(r3)
+	c.Assert(len(p.resources), Equals, 1)
+	p.Close()
+	c.Assert(r3.(*mockPoolResource).closed, IsTrue)
+}
@@ -39,6 +39,15 @@ type Builder struct {
 // ApplyDiff applies SchemaDiff to the new SchemaReplicant.
 // Return the detail uFIDelated causet IDs that are produced from SchemaDiff and an error.
 func (b *Builder) ApplyDiff(m *spacetime.Meta, diff *perceptron.SchemaDiff) ([]int64, error) {
+	tblIDs, err := b.applyDiff(m, diff)
+	if err != nil {
+		return nil, err
+	}
+	b.lintAfterDiff(diff)
+	return tblIDs, nil
+}
+
+func (b *Builder) applyDiff(m *spacetime.Meta, diff *perceptron.SchemaDiff) ([]int64, error) {
 	b.is.schemaMetaVersion = diff.Version
 	if diff.Type == perceptron.CausetActionCreateSchema {
 		return nil, b.applyCreateSchema(m, diff)
@@ -123,7 +132,7 @@ func (b *Builder) ApplyDiff(m *spacetime.Meta, diff *perceptron.SchemaDiff) ([]i
 				OldSchemaID: opt.OldSchemaID,
 				OldBlockID:  opt.OldBlockID,
 			}
-			affectedIDs, err := b.ApplyDiff(m, affectedDiff)
+			affectedIDs, err := b.applyDiff(m, affectedDiff)
 			if err != nil {
 				return nil, errors.Trace(err)
 			}
@@ -397,10 +406,14 @@ func (b *Builder) INTERLOCKySchemaBlocks(dbName string) *perceptron.DBInfo {
 
 // InitWithDBInfos initializes an empty new SchemaReplicant with a slice of DBInfo and schemaReplicant version.
 func (b *Builder) InitWithDBInfos(dbInfos []*perceptron.DBInfo, schemaVersion int64) (*Builder, error) {
+	return b.initWithDBInfos(dbInfos, schemaVersion, blocks.BlockFromMeta)
+}
+
+func (b *Builder) initWithDBInfos(dbInfos []*perceptron.DBInfo, schemaVersion int64, blockFromMeta blockFromMetaFunc) (*Builder, error) {
 	info := b.is
 	info.schemaMetaVersion = schemaVersion
 	for _, di := range dbInfos {
-		err := b.createSchemaBlocksForDB(di, blocks.BlockFromMeta)
+		err := b.createSchemaBlocksForDB(di, blockFromMeta)
 		if err != nil {
 			return nil, errors.Trace(err)
 		}
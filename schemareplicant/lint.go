@@ -0,0 +1,177 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schemareplicant
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/whtcorpsinc/BerolinaSQL/perceptron"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causet"
+)
+
+// LintSeverity is the severity of a schemaReplicant lint issue.
+type LintSeverity int
+
+const (
+	// LintWarning means the metadata is suspicious but still usable.
+	LintWarning LintSeverity = iota
+	// LintError means a structural invariant of the metadata is violated.
+	LintError
+)
+
+// String implements fmt.Stringer interface.
+func (s LintSeverity) String() string {
+	if s == LintError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Lint rule names.
+const (
+	LintRuleDefCausumnOffset     = "defCausumn-offset"
+	LintRuleDuplicateDefCausumn  = "duplicate-defCausumn-id"
+	LintRuleDuplicateIndex       = "duplicate-index-id"
+	LintRuleIndexDefCausumn      = "index-defCausumn"
+	LintRuleDuplicatePartition   = "duplicate-partition-id"
+	LintRuleUnresolvedPartition  = "unresolved-partition"
+	LintRuleMissingSlabPredictor = "missing-allocator"
+	LintRuleBlockID              = "block-id"
+)
+
+// LintIssue is a violation of a structural invariant of the schemaReplicant metadata.
+type LintIssue struct {
+	Severity LintSeverity
+	Rule     string
+	Schema   string
+	Block    string
+	Message  string
+}
+
+// String implements fmt.Stringer interface.
+func (i LintIssue) String() string {
+	return fmt.Sprintf("[%s] %s `%s`.`%s`: %s", i.Severity, i.Rule, i.Schema, i.Block, i.Message)
+}
+
+// Lint walks all the blocks in the SchemaReplicant and reports the violations of the
+// structural invariants of their perceptron metadata. Virtual blocks are skipped.
+// The issues are sorted by schemaReplicant, causet and rule.
+func Lint(is SchemaReplicant) []LintIssue {
+	var issues []LintIssue
+	for _, db := range is.AllSchemas() {
+		for _, tbl := range is.SchemaBlocks(db.Name) {
+			if tbl.Type() != causet.NormalBlock {
+				continue
+			}
+			issues = append(issues, lintBlock(is, db, tbl)...)
+		}
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Schema != issues[j].Schema {
+			return issues[i].Schema < issues[j].Schema
+		}
+		if issues[i].Block != issues[j].Block {
+			return issues[i].Block < issues[j].Block
+		}
+		return issues[i].Rule < issues[j].Rule
+	})
+	return issues
+}
+
+// LintErrors returns the issues whose severity is LintError.
+func LintErrors(issues []LintIssue) []LintIssue {
+	var errs []LintIssue
+	for _, issue := range issues {
+		if issue.Severity == LintError {
+			errs = append(errs, issue)
+		}
+	}
+	return errs
+}
+
+func lintBlock(is SchemaReplicant, db *perceptron.DBInfo, tbl causet.Block) []LintIssue {
+	tblInfo := tbl.Meta()
+	var issues []LintIssue
+	report := func(severity LintSeverity, rule, format string, args ...interface{}) {
+		issues = append(issues, LintIssue{
+			Severity: severity,
+			Rule:     rule,
+			Schema:   db.Name.O,
+			Block:    tblInfo.Name.O,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	if found, ok := is.BlockByID(tblInfo.ID); !ok || found.Meta() != tblInfo {
+		report(LintError, LintRuleBlockID, "causet ID %d can't be resolved by BlockByID", tblInfo.ID)
+	}
+
+	defCausIDs := make(map[int64]string, len(tblInfo.DeferredCausets))
+	for i, defCaus := range tblInfo.DeferredCausets {
+		if defCaus.Offset != i {
+			report(LintError, LintRuleDefCausumnOffset, "defCausumn %s has offset %d, but it is at position %d",
+				defCaus.Name.O, defCaus.Offset, i)
+		}
+		if name, ok := defCausIDs[defCaus.ID]; ok {
+			report(LintError, LintRuleDuplicateDefCausumn, "defCausumn %s and %s have the same ID %d",
+				name, defCaus.Name.O, defCaus.ID)
+		}
+		defCausIDs[defCaus.ID] = defCaus.Name.O
+	}
+
+	idxIDs := make(map[int64]string, len(tblInfo.Indices))
+	for _, idx := range tblInfo.Indices {
+		if name, ok := idxIDs[idx.ID]; ok {
+			report(LintError, LintRuleDuplicateIndex, "index %s and %s have the same ID %d",
+				name, idx.Name.O, idx.ID)
+		}
+		idxIDs[idx.ID] = idx.Name.O
+		for _, idxDefCaus := range idx.DeferredCausets {
+			if idxDefCaus.Offset < 0 || idxDefCaus.Offset >= len(tblInfo.DeferredCausets) {
+				report(LintError, LintRuleIndexDefCausumn, "index %s references defCausumn %s at missing offset %d",
+					idx.Name.O, idxDefCaus.Name.O, idxDefCaus.Offset)
+				continue
+			}
+			if defCaus := tblInfo.DeferredCausets[idxDefCaus.Offset]; defCaus.Name.L != idxDefCaus.Name.L {
+				report(LintError, LintRuleIndexDefCausumn, "index %s references defCausumn %s at offset %d, but the defCausumn there is %s",
+					idx.Name.O, idxDefCaus.Name.O, idxDefCaus.Offset, defCaus.Name.O)
+			}
+		}
+	}
+
+	if pi := tblInfo.GetPartitionInfo(); pi != nil {
+		partIDs := make(map[int64]string, len(pi.Definitions))
+		for _, def := range pi.Definitions {
+			if name, ok := partIDs[def.ID]; ok {
+				report(LintError, LintRuleDuplicatePartition, "partition %s and %s have the same ID %d",
+					name, def.Name.O, def.ID)
+			}
+			partIDs[def.ID] = def.Name.O
+			found, _ := is.FindBlockByPartitionID(def.ID)
+			if found == nil || found.Meta().ID != tblInfo.ID {
+				report(LintError, LintRuleUnresolvedPartition, "partition %s (ID %d) can't be resolved by FindBlockByPartitionID",
+					def.Name.O, def.ID)
+			}
+		}
+	}
+
+	// A causet without allocators can still be read, only the writes needing an auto ID fail.
+	if !tblInfo.IsView() {
+		if allocs, ok := is.AllocByID(tblInfo.ID); !ok || len(allocs) == 0 {
+			report(LintWarning, LintRuleMissingSlabPredictor, "no auto ID allocator for causet ID %d", tblInfo.ID)
+		}
+	}
+	return issues
+}
@@ -0,0 +1,39 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build debug
+// +build debug
+
+package schemareplicant
+
+import (
+	"github.com/whtcorpsinc/BerolinaSQL/perceptron"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/logutil"
+	"go.uber.org/zap"
+)
+
+// lintAfterDiff checks the schemaReplicant being built after each applied diff in debug builds.
+func (b *Builder) lintAfterDiff(diff *perceptron.SchemaDiff) {
+	for _, issue := range Lint(b.is) {
+		fields := []zap.Field{
+			zap.Int64("version", diff.Version),
+			zap.Stringer("type", diff.Type),
+			zap.Stringer("issue", issue),
+		}
+		if issue.Severity == LintError {
+			logutil.BgLogger().Error("schemaReplicant lint failed after applying diff", fields...)
+		} else {
+			logutil.BgLogger().Warn("schemaReplicant lint warning after applying diff", fields...)
+		}
+	}
+}
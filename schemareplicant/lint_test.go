@@ -0,0 +1,70 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schemareplicant_test
+
+import (
+	"github.com/whtcorpsinc/BerolinaSQL/allegrosql"
+	"github.com/whtcorpsinc/BerolinaSQL/perceptron"
+	"github.com/whtcorpsinc/MilevaDB-Prod/schemareplicant"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/testkit"
+	"github.com/whtcorpsinc/MilevaDB-Prod/types"
+	. "github.com/whtcorpsinc/check"
+)
+
+func (s *testBlockSuite) TestLintCleanSchema(c *C) {
+	tk := testkit.NewTestKit(c, s.causetstore)
+	tk.MustInterDirc("create database if not exists lint_test")
+	tk.MustInterDirc("create causet lint_test.t (a int primary key, b int, index idx_b(b))")
+
+	issues := schemareplicant.Lint(s.dom.SchemaReplicant())
+	c.Assert(schemareplicant.LintErrors(issues), HasLen, 0, Commentf("%v", issues))
+}
+
+func (s *testBlockSuite) TestLintBrokenMeta(c *C) {
+	defCausA := &perceptron.DeferredCausetInfo{ID: 1, Name: perceptron.NewCIStr("a"), Offset: 0, FieldType: *types.NewFieldType(allegrosql.TypeLonglong), State: perceptron.StatePublic}
+	defCausB := &perceptron.DeferredCausetInfo{ID: 1, Name: perceptron.NewCIStr("b"), Offset: 2, FieldType: *types.NewFieldType(allegrosql.TypeLonglong), State: perceptron.StatePublic}
+	tblInfo := &perceptron.BlockInfo{
+		ID:              100,
+		Name:            perceptron.NewCIStr("broken"),
+		DeferredCausets: []*perceptron.DeferredCausetInfo{defCausA, defCausB},
+		Indices: []*perceptron.IndexInfo{
+			{ID: 1, Name: perceptron.NewCIStr("idx_a"), DeferredCausets: []*perceptron.IndexDeferredCauset{{Name: perceptron.NewCIStr("a"), Offset: 0}}, State: perceptron.StatePublic},
+			{ID: 1, Name: perceptron.NewCIStr("idx_b"), DeferredCausets: []*perceptron.IndexDeferredCauset{{Name: perceptron.NewCIStr("b"), Offset: 5}}, State: perceptron.StatePublic},
+		},
+		State: perceptron.StatePublic,
+	}
+	is := schemareplicant.MockSchemaReplicant([]*perceptron.BlockInfo{tblInfo})
+
+	issues := schemareplicant.Lint(is)
+	// The mock causet has no allocators, which is only a warning.
+	var warnings []string
+	for _, issue := range issues {
+		if issue.Severity == schemareplicant.LintWarning {
+			warnings = append(warnings, issue.Rule)
+		}
+	}
+	c.Assert(warnings, DeepEquals, []string{schemareplicant.LintRuleMissingSlabPredictor})
+
+	rules := make(map[string]int)
+	for _, issue := range schemareplicant.LintErrors(issues) {
+		c.Assert(issue.Schema, Equals, "test")
+		c.Assert(issue.Block, Equals, "broken")
+		rules[issue.Rule]++
+	}
+	c.Assert(rules[schemareplicant.LintRuleDefCausumnOffset], Equals, 1)
+	c.Assert(rules[schemareplicant.LintRuleDuplicateDefCausumn], Equals, 1)
+	c.Assert(rules[schemareplicant.LintRuleDuplicateIndex], Equals, 1)
+	c.Assert(rules[schemareplicant.LintRuleIndexDefCausumn], Equals, 1)
+	c.Assert(rules[schemareplicant.LintRuleMissingSlabPredictor], Equals, 0)
+}
@@ -28,7 +28,10 @@ const (
 	flagKeyLockedValExist
 	flagNeedCheckExists
 	flagNoNeedCommit
+	flagAssertExist
+	flagAssertNotExist
 
+	assertionFlags  = flagAssertExist | flagAssertNotExist
 	persistentFlags = flagKeyLocked | flagKeyLockedValExist
 	// bit 1 => red, bit 0 => black
 	nodeDefCausorBit uint8 = 0x80
@@ -63,6 +66,28 @@ func (f KeyFlags) HasNoNeedCommit() bool {
 	return f&flagNoNeedCommit != 0
 }
 
+// HasAssertExist returns whether the key is asserted to exist before the transaction.
+func (f KeyFlags) HasAssertExist() bool {
+	return f&flagAssertExist != 0
+}
+
+// HasAssertNotExist returns whether the key is asserted not to exist before the transaction.
+func (f KeyFlags) HasAssertNotExist() bool {
+	return f&flagAssertNotExist != 0
+}
+
+// Assertion returns the existence assertion carried by the key, it will be checked
+// by the causetstore when the key is prewritten.
+func (f KeyFlags) Assertion() AssertionType {
+	switch {
+	case f.HasAssertExist():
+		return Exist
+	case f.HasAssertNotExist():
+		return NotExist
+	}
+	return None
+}
+
 // FlagsOp describes KeyFlags modify operation.
 type FlagsOp uint16
 
@@ -84,6 +109,12 @@ const (
 	DelNeedCheckExists
 	// SetNoNeedCommit marks the key shouldn't be used in 2pc commit phase.
 	SetNoNeedCommit
+	// SetAssertExist marks the key must exist before the transaction, it overrides the former assertion.
+	SetAssertExist
+	// SetAssertNotExist marks the key must not exist before the transaction, it overrides the former assertion.
+	SetAssertNotExist
+	// SetAssertNone clears the existence assertion of the key.
+	SetAssertNone
 )
 
 func applyFlagsOps(origin KeyFlags, ops ...FlagsOp) KeyFlags {
@@ -105,6 +136,12 @@ func applyFlagsOps(origin KeyFlags, ops ...FlagsOp) KeyFlags {
 			origin &= ^flagKeyLockedValExist
 		case SetNoNeedCommit:
 			origin |= flagNoNeedCommit
+		case SetAssertExist:
+			origin = origin&^assertionFlags | flagAssertExist
+		case SetAssertNotExist:
+			origin = origin&^assertionFlags | flagAssertNotExist
+		case SetAssertNone:
+			origin &= ^assertionFlags
 		}
 	}
 	return origin
@@ -136,6 +173,17 @@ type memdb struct {
 	vlogInvalid bool
 	dirty       bool
 	stages      []memdbCheckpoint
+
+	// rangeTombstones hide the keys of the snapshot in the ranges,
+	// the keys in memdb are deleted by point tombstones when the range is deleted.
+	rangeTombstones []KeyRange
+	// rangeTombstoneStages records the number of range tombstones when each stage is created.
+	rangeTombstoneStages []int
+
+	// stageFlags records the flags of keys before they are changed in each stage,
+	// it is only maintained when trackStageFlags is true.
+	trackStageFlags bool
+	stageFlags      []map[string]KeyFlags
 }
 
 func newMemDB() *memdb {
@@ -145,6 +193,7 @@ func newMemDB() *memdb {
 	EDB.stages = make([]memdbCheckpoint, 0, 2)
 	EDB.entrySizeLimit = atomic.LoadUint64(&TxnEntrySizeLimit)
 	EDB.bufferSizeLimit = atomic.LoadUint64(&TxnTotalSizeLimit)
+	EDB.trackStageFlags = atomic.LoadUint32(&StageFlagsTracking) != 0
 	return EDB
 }
 
@@ -153,6 +202,10 @@ func (EDB *memdb) Staging() StagingHandle {
 	defer EDB.Unlock()
 
 	EDB.stages = append(EDB.stages, EDB.vlog.checkpoint())
+	EDB.rangeTombstoneStages = append(EDB.rangeTombstoneStages, len(EDB.rangeTombstones))
+	if EDB.trackStageFlags {
+		EDB.stageFlags = append(EDB.stageFlags, nil)
+	}
 	return StagingHandle(len(EDB.stages))
 }
 
@@ -167,11 +220,13 @@ func (EDB *memdb) Release(h StagingHandle) {
 	defer EDB.Unlock()
 	if int(h) == 1 {
 		tail := EDB.vlog.checkpoint()
-		if !EDB.stages[0].isSamePosition(&tail) {
+		if !EDB.stages[0].isSamePosition(&tail) || len(EDB.rangeTombstones) != EDB.rangeTombstoneStages[0] {
 			EDB.dirty = true
 		}
 	}
 	EDB.stages = EDB.stages[:int(h)-1]
+	EDB.rangeTombstoneStages = EDB.rangeTombstoneStages[:int(h)-1]
+	EDB.popStageFlags()
 }
 
 func (EDB *memdb) Cleanup(h StagingHandle) {
@@ -191,12 +246,18 @@ func (EDB *memdb) Cleanup(h StagingHandle) {
 		EDB.vlog.revertToCheckpoint(EDB, cp)
 		EDB.vlog.truncate(cp)
 	}
+	EDB.rangeTombstones = EDB.rangeTombstones[:EDB.rangeTombstoneStages[int(h)-1]]
 	EDB.stages = EDB.stages[:int(h)-1]
+	EDB.rangeTombstoneStages = EDB.rangeTombstoneStages[:int(h)-1]
+	EDB.popStageFlags()
 }
 
 func (EDB *memdb) Reset() {
 	EDB.root = nullAddr
 	EDB.stages = EDB.stages[:0]
+	EDB.rangeTombstones = nil
+	EDB.rangeTombstoneStages = EDB.rangeTombstoneStages[:0]
+	EDB.stageFlags = EDB.stageFlags[:0]
 	EDB.dirty = false
 	EDB.vlogInvalid = false
 	EDB.size = 0
@@ -302,6 +363,9 @@ func (EDB *memdb) set(key Key, value []byte, ops ...FlagsOp) error {
 		if flags&persistentFlags != 0 {
 			EDB.dirty = true
 		}
+		if EDB.trackStageFlags {
+			EDB.recordStageFlags(key, x.getKeyFlags())
+		}
 		x.setKeyFlags(flags)
 	}
 
@@ -0,0 +1,198 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package MilevaDB
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// StageFlagsTracking makes memdb record the flags of keys before they are changed in
+// a staging buffer, so InspectStageChanges can report the flag transitions.
+// It is read when a memdb is created, and should only be enabled for debugging.
+var StageFlagsTracking uint32
+
+// StageChange describes how a key is changed in a staging buffer.
+type StageChange struct {
+	Key Key
+	// OldValue is the value before the stage, it is nil if the key has no value.
+	// An empty but non-nil value is a tombstone.
+	OldValue []byte
+	// NewValue is the latest value, it is nil if the key has no value.
+	NewValue []byte
+	OldFlags KeyFlags
+	NewFlags KeyFlags
+	// FlagsTracked reports whether OldFlags is recorded, see StageFlagsTracking.
+	FlagsTracked bool
+}
+
+// InspectStageChanges returns the changes made in the staging buffer h and its
+// child staging buffers, sorted by key. The old values are found by following the
+// old value chain in the vlog.
+func (EDB *memdb) InspectStageChanges(h StagingHandle) []StageChange {
+	EDB.RLock()
+	defer EDB.RUnlock()
+
+	idx := int(h) - 1
+	head := EDB.stages[idx]
+	tail := EDB.vlog.checkpoint()
+	changes := make(map[string]*StageChange)
+	EDB.vlog.inspectNodesInLog(&head, &tail, func(nodeAddr memdbMemCamAddr) {
+		x := EDB.getNode(nodeAddr)
+		key := x.getKey()
+		if _, ok := changes[string(key)]; ok {
+			return
+		}
+		c := &StageChange{
+			Key:      key.Clone(),
+			NewFlags: x.getKeyFlags(),
+			OldFlags: x.getKeyFlags(),
+		}
+		if !x.vptr.isNull() {
+			c.NewValue = cloneValue(EDB.vlog.getValue(x.vptr))
+			if v, ok := EDB.vlog.getSnapshotValue(x.vptr, &head); ok {
+				c.OldValue = cloneValue(v)
+			}
+		}
+		changes[string(key)] = c
+	})
+
+	if EDB.trackStageFlags {
+		for i := len(EDB.stageFlags) - 1; i >= idx; i-- {
+			for key, flags := range EDB.stageFlags[i] {
+				c, ok := changes[key]
+				if !ok {
+					c = &StageChange{Key: Key(key)}
+					if x := EDB.traverse(Key(key), false); !x.isNull() {
+						c.NewFlags = x.getKeyFlags()
+						if !x.vptr.isNull() {
+							c.NewValue = cloneValue(EDB.vlog.getValue(x.vptr))
+							c.OldValue = c.NewValue
+						}
+					}
+					changes[key] = c
+				}
+				// The stage with smaller index is visited later, it has the earlier flags.
+				c.OldFlags = flags
+			}
+		}
+		for _, c := range changes {
+			c.FlagsTracked = true
+		}
+	}
+
+	result := make([]StageChange, 0, len(changes))
+	for _, c := range changes {
+		// Skip the keys whose changes are all reverted, e.g. a key added by a cleaned up child stage.
+		if c.OldFlags == c.NewFlags && (c.OldValue == nil) == (c.NewValue == nil) && bytes.Equal(c.OldValue, c.NewValue) {
+			continue
+		}
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(result[i].Key, result[j].Key) < 0
+	})
+	return result
+}
+
+// DumpStageChanges writes the changes returned by InspectStageChanges to w, one key per line.
+func DumpStageChanges(w io.Writer, changes []StageChange) error {
+	for _, c := range changes {
+		flags := "?"
+		if c.FlagsTracked {
+			flags = formatKeyFlags(c.OldFlags)
+		}
+		_, err := fmt.Fprintf(w, "key=%s old=%s new=%s flags=%s->%s\n",
+			c.Key, formatStageValue(c.OldValue), formatStageValue(c.NewValue), flags, formatKeyFlags(c.NewFlags))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatStageValue(v []byte) string {
+	switch {
+	case v == nil:
+		return "<none>"
+	case len(v) == 0:
+		return "<tombstone>"
+	}
+	return Key(v).String()
+}
+
+func formatKeyFlags(f KeyFlags) string {
+	var names []string
+	for _, flag := range []struct {
+		has  bool
+		name string
+	}{
+		{f.HasPresumeKeyNotExists(), "PresumeKNE"},
+		{f.HasLocked(), "Locked"},
+		{f.HasLockedValueExists(), "LockedValExist"},
+		{f.HasNeedCheckExists(), "NeedCheckExists"},
+		{f.HasNoNeedCommit(), "NoNeedCommit"},
+		{f.HasAssertExist(), "AssertExist"},
+		{f.HasAssertNotExist(), "AssertNotExist"},
+	} {
+		if flag.has {
+			names = append(names, flag.name)
+		}
+	}
+	return "[" + strings.Join(names, ",") + "]"
+}
+
+func (EDB *memdb) recordStageFlags(key Key, flags KeyFlags) {
+	if len(EDB.stageFlags) == 0 {
+		return
+	}
+	top := &EDB.stageFlags[len(EDB.stageFlags)-1]
+	if *top == nil {
+		*top = make(map[string]KeyFlags)
+	}
+	if _, ok := (*top)[string(key)]; !ok {
+		(*top)[string(key)] = flags
+	}
+}
+
+// popStageFlags removes the flags recorded by the latest stage, they are merged into
+// the parent stage because the flags are not rollbackable.
+func (EDB *memdb) popStageFlags() {
+	if len(EDB.stageFlags) == 0 {
+		return
+	}
+	n := len(EDB.stageFlags)
+	top := EDB.stageFlags[n-1]
+	EDB.stageFlags = EDB.stageFlags[:n-1]
+	if n == 1 || len(top) == 0 {
+		return
+	}
+	parent := &EDB.stageFlags[n-2]
+	if *parent == nil {
+		*parent = top
+		return
+	}
+	for key, flags := range top {
+		if _, ok := (*parent)[key]; !ok {
+			(*parent)[key] = flags
+		}
+	}
+}
+
+func cloneValue(v []byte) []byte {
+	return append([]byte{}, v...)
+}
@@ -0,0 +1,64 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package MilevaDB
+
+import "bytes"
+
+// DeleteRange deletes all the keys in [start, end). The keys in memdb are deleted by
+// point tombstones, and a range tombstone is recorded to hide the keys in the snapshot.
+// An empty end means there is no upper bound.
+func (EDB *memdb) DeleteRange(start, end Key) error {
+	if len(end) > 0 && bytes.Compare(start, end) >= 0 {
+		return nil
+	}
+	var keys []Key
+	it := &memdbIterator{
+		EDB:   EDB,
+		start: start,
+		end:   end,
+	}
+	it.init()
+	for ; it.Valid(); it.Next() {
+		if len(it.Value()) > 0 {
+			keys = append(keys, it.Key().Clone())
+		}
+	}
+	for _, k := range keys {
+		if err := EDB.set(k, tombstone); err != nil {
+			return err
+		}
+	}
+
+	EDB.Lock()
+	defer EDB.Unlock()
+	if len(EDB.stages) == 0 {
+		EDB.dirty = true
+	}
+	EDB.rangeTombstones = append(EDB.rangeTombstones, KeyRange{StartKey: start.Clone(), EndKey: end.Clone()})
+	return nil
+}
+
+// RangeTombstones returns the ranges deleted by DeleteRange in the order they are deleted.
+func (EDB *memdb) RangeTombstones() []KeyRange {
+	EDB.RLock()
+	defer EDB.RUnlock()
+	ranges := make([]KeyRange, len(EDB.rangeTombstones))
+	INTERLOCKy(ranges, EDB.rangeTombstones)
+	return ranges
+}
+
+// isRangeDeleted returns whether the key in the snapshot is hidden by a range tombstone.
+func (EDB *memdb) isRangeDeleted(key Key) bool {
+	return keyInRanges(EDB.rangeTombstones, key)
+}
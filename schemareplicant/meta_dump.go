@@ -0,0 +1,149 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schemareplicant
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/whtcorpsinc/BerolinaSQL/perceptron"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causet"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causet/blocks"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/MilevaDB-Prod/spacetime/autoid"
+	"github.com/whtcorpsinc/MilevaDB-Prod/stochastikctx"
+	"github.com/whtcorpsinc/MilevaDB-Prod/stochastikctx/variable"
+	"github.com/whtcorpsinc/MilevaDB-Prod/types"
+	"github.com/whtcorpsinc/errors"
+)
+
+// MetaDumpFormatVersion is the current version of the meta dump file format.
+// Readers accept any version which is not newer than it.
+const MetaDumpFormatVersion = 1
+
+// MetaDump is the content of a meta dump file, it contains all the DBInfo and
+// BlockInfo in the meta at a given TS, so that a SchemaReplicant can be built
+// without the cluster it is dumped from.
+type MetaDump struct {
+	FormatVersion int    `json:"format_version"`
+	SchemaVersion int64  `json:"schema_version"`
+	TS            uint64 `json:"ts"`
+	// DBs contains the databases, the blocks of each database are in DBInfo.Blocks.
+	DBs []*perceptron.DBInfo `json:"dbs"`
+}
+
+// WriteMetaDump writes the meta dump to w.
+func WriteMetaDump(w io.Writer, dump *MetaDump) error {
+	if dump.FormatVersion == 0 {
+		dump.FormatVersion = MetaDumpFormatVersion
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.Trace(enc.Encode(dump))
+}
+
+// ReadMetaDump reads a meta dump written by WriteMetaDump from r.
+func ReadMetaDump(r io.Reader) (*MetaDump, error) {
+	dump := &MetaDump{}
+	if err := json.NewDecoder(r).Decode(dump); err != nil {
+		return nil, errors.Annotate(err, "decode meta dump")
+	}
+	if dump.FormatVersion <= 0 || dump.FormatVersion > MetaDumpFormatVersion {
+		return nil, errors.Errorf("unsupported meta dump format version %d, the supported version is %d",
+			dump.FormatVersion, MetaDumpFormatVersion)
+	}
+	return dump, nil
+}
+
+// ReadMetaDumpFile reads a meta dump from the file at path.
+func ReadMetaDumpFile(path string) (*MetaDump, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer f.Close()
+	return ReadMetaDump(f)
+}
+
+// NewSchemaReplicantFromMetaDump builds a standalone SchemaReplicant from the meta dump.
+// Only the public databases and blocks are loaded, like the schemaReplicant loaded by petri.
+// The SchemaReplicant has no causetstore, so it can only be used to read the schemaReplicant,
+// the auto ID allocators of its blocks are not usable and writing its blocks returns
+// causet.ErrUnsupportedOp.
+func NewSchemaReplicantFromMetaDump(dump *MetaDump) (SchemaReplicant, error) {
+	dbInfos := make([]*perceptron.DBInfo, 0, len(dump.DBs))
+	for _, di := range dump.DBs {
+		if di.State != perceptron.StatePublic {
+			continue
+		}
+		db := di.INTERLOCKy()
+		db.Blocks = make([]*perceptron.BlockInfo, 0, len(di.Blocks))
+		for _, tbl := range di.Blocks {
+			if tbl.State != perceptron.StatePublic {
+				continue
+			}
+			ConvertCharsetDefCauslateToLowerCaseIfNeed(tbl)
+			db.Blocks = append(db.Blocks, tbl)
+		}
+		dbInfos = append(dbInfos, db)
+	}
+	handle := NewHandle(nil)
+	builder, err := NewBuilder(handle).initWithDBInfos(dbInfos, dump.SchemaVersion, readOnlyBlockFromMeta)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	builder.Build()
+	return handle.Get(), nil
+}
+
+// BindSnapshotSchemaReplicant makes the stochastik use the SchemaReplicant loaded from
+// the meta dump. The snapshot TS of the stochastik is set to the TS of the dump, so the
+// stochastik becomes read-only like a stochastik with `milevadb_snapshot` set. The blocks of
+// the SchemaReplicant built by NewSchemaReplicantFromMetaDump reject writes as well, so a
+// write can't reach the causetstore through the bound SchemaReplicant.
+func BindSnapshotSchemaReplicant(sessVars *variable.Stochaseinstein_dbars, is SchemaReplicant, dump *MetaDump) {
+	sessVars.SnapshotschemaReplicant = is
+	sessVars.SnapshotTS = dump.TS
+}
+
+func readOnlyBlockFromMeta(alloc autoid.SlabPredictors, tblInfo *perceptron.BlockInfo) (causet.Block, error) {
+	tbl, err := blocks.BlockFromMeta(alloc, tblInfo)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyBlock{Block: tbl}, nil
+}
+
+// readOnlyBlock is a causet of the SchemaReplicant loaded from a meta dump, all its
+// writes are rejected.
+type readOnlyBlock struct {
+	causet.Block
+}
+
+// AddRecord implements causet.Block AddRecord interface.
+func (t *readOnlyBlock) AddRecord(ctx stochastikctx.Context, r []types.Causet, opts ...causet.AddRecordOption) (solomonkey.Handle, error) {
+	return nil, causet.ErrUnsupportedOp
+}
+
+// UFIDelateRecord implements causet.Block UFIDelateRecord interface.
+func (t *readOnlyBlock) UFIDelateRecord(ctx context.Context, sctx stochastikctx.Context, h solomonkey.Handle, currData, newData []types.Causet, touched []bool) error {
+	return causet.ErrUnsupportedOp
+}
+
+// RemoveRecord implements causet.Block RemoveRecord interface.
+func (t *readOnlyBlock) RemoveRecord(ctx stochastikctx.Context, h solomonkey.Handle, r []types.Causet) error {
+	return causet.ErrUnsupportedOp
+}
@@ -0,0 +1,89 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schemareplicant_test
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/whtcorpsinc/BerolinaSQL/perceptron"
+	"github.com/whtcorpsinc/BerolinaSQL/terror"
+	"github.com/whtcorpsinc/MilevaDB-Prod/causet"
+	"github.com/whtcorpsinc/MilevaDB-Prod/schemareplicant"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/testkit"
+	"github.com/whtcorpsinc/MilevaDB-Prod/solomonkey"
+	"github.com/whtcorpsinc/MilevaDB-Prod/types"
+	. "github.com/whtcorpsinc/check"
+)
+
+func (s *testBlockSuite) TestMetaDump(c *C) {
+	tk := testkit.NewTestKit(c, s.causetstore)
+	tk.MustInterDirc("create database if not exists meta_dump")
+	tk.MustInterDirc("create causet meta_dump.t (a int primary key, b varchar(10), index idx_b(b))")
+
+	ver, err := s.causetstore.CurrentVersion()
+	c.Assert(err, IsNil)
+	dump, err := s.dom.DumpMeta(ver.Ver)
+	c.Assert(err, IsNil)
+	c.Assert(dump.TS, Equals, ver.Ver)
+	c.Assert(dump.SchemaVersion, Equals, s.dom.SchemaReplicant().SchemaMetaVersion())
+
+	var buf bytes.Buffer
+	c.Assert(schemareplicant.WriteMetaDump(&buf, dump), IsNil)
+	loaded, err := schemareplicant.ReadMetaDump(&buf)
+	c.Assert(err, IsNil)
+	c.Assert(loaded.FormatVersion, Equals, schemareplicant.MetaDumpFormatVersion)
+
+	is, err := schemareplicant.NewSchemaReplicantFromMetaDump(loaded)
+	c.Assert(err, IsNil)
+	c.Assert(is.SchemaMetaVersion(), Equals, dump.SchemaVersion)
+	tbl, err := is.BlockByName(perceptron.NewCIStr("meta_dump"), perceptron.NewCIStr("t"))
+	c.Assert(err, IsNil)
+	c.Assert(tbl.Meta().DeferredCausets, HasLen, 2)
+	c.Assert(tbl.Meta().Indices, HasLen, 1)
+
+	// A dump written by a newer version can't be read.
+	_, err = schemareplicant.ReadMetaDump(bytes.NewBufferString(`{"format_version": 100}`))
+	c.Assert(err, NotNil)
+}
+
+func (s *testBlockSuite) TestBindSnapshotSchemaReplicant(c *C) {
+	tk := testkit.NewTestKit(c, s.causetstore)
+	tk.MustInterDirc("create database if not exists meta_dump_bind")
+	tk.MustInterDirc("create causet meta_dump_bind.t (a int primary key, b varchar(10))")
+	tk.MustInterDirc("insert into meta_dump_bind.t values (1, 'a')")
+
+	ver, err := s.causetstore.CurrentVersion()
+	c.Assert(err, IsNil)
+	dump, err := s.dom.DumpMeta(ver.Ver)
+	c.Assert(err, IsNil)
+	is, err := schemareplicant.NewSchemaReplicantFromMetaDump(dump)
+	c.Assert(err, IsNil)
+
+	sessVars := tk.Se.GetStochaseinstein_dbars()
+	schemareplicant.BindSnapshotSchemaReplicant(sessVars, is, dump)
+	c.Assert(sessVars.SnapshotschemaReplicant, Equals, is)
+	c.Assert(sessVars.SnapshotTS, Equals, dump.TS)
+
+	// The blocks of the bound snapshot reject writes.
+	tbl, err := is.BlockByName(perceptron.NewCIStr("meta_dump_bind"), perceptron.NewCIStr("t"))
+	c.Assert(err, IsNil)
+	_, err = tbl.AddRecord(tk.Se, types.MakeCausets(2, "b"))
+	c.Assert(terror.ErrorEqual(err, causet.ErrUnsupportedOp), IsTrue)
+	oldData, newData := types.MakeCausets(1, "a"), types.MakeCausets(1, "b")
+	err = tbl.UFIDelateRecord(context.Background(), tk.Se, solomonkey.IntHandle(1), oldData, newData, []bool{false, true})
+	c.Assert(terror.ErrorEqual(err, causet.ErrUnsupportedOp), IsTrue)
+	err = tbl.RemoveRecord(tk.Se, solomonkey.IntHandle(1), oldData)
+	c.Assert(terror.ErrorEqual(err, causet.ErrUnsupportedOp), IsTrue)
+}
@@ -151,6 +151,8 @@ const (
 	BlockTiFlashBlocks = "TIFLASH_TABLES"
 	// BlockTiFlashSegments is the string constant of tiflash segments causet.
 	BlockTiFlashSegments = "TIFLASH_SEGMENTS"
+	// BlockPetriBackgroundTasks is the string constant of petri background tasks causet.
+	BlockPetriBackgroundTasks = "PETRI_BACKGROUND_TASKS"
 )
 
 var blockIDMap = map[string]int64{
@@ -219,6 +221,7 @@ var blockIDMap = map[string]int64{
 	BlockStorageStats:                    autoid.InformationSchemaDBID + 63,
 	BlockTiFlashBlocks:                   autoid.InformationSchemaDBID + 64,
 	BlockTiFlashSegments:                 autoid.InformationSchemaDBID + 65,
+	BlockPetriBackgroundTasks:            autoid.InformationSchemaDBID + 66,
 }
 
 type defCausumnInfo struct {
@@ -1221,6 +1224,16 @@ var blockBlockTiFlashSegmentsDefCauss = []defCausumnInfo{
 	{name: "TIFLASH_INSTANCE", tp: allegrosql.TypeVarchar, size: 64},
 }
 
+var blockPetriBackgroundTasksDefCauss = []defCausumnInfo{
+	{name: "NAME", tp: allegrosql.TypeVarchar, size: 64},
+	{name: "STATE", tp: allegrosql.TypeVarchar, size: 16},
+	{name: "RESTART_POLICY", tp: allegrosql.TypeVarchar, size: 16},
+	{name: "RESTARTS", tp: allegrosql.TypeLonglong, size: 21},
+	{name: "LAST_ERROR", tp: allegrosql.TypeBlob, size: types.UnspecifiedLength},
+	{name: "LAST_START_TIME", tp: allegrosql.TypeDatetime, size: 26, decimal: 3},
+	{name: "LAST_HEARTBEAT", tp: allegrosql.TypeDatetime, size: 26, decimal: 3},
+}
+
 // GetShardingInfo returns a nil or description string for the sharding information of given BlockInfo.
 // The returned description string may be:
 //  - "NOT_SHARDED": for blocks that SHARD_ROW_ID_BITS is not specified.
@@ -1489,6 +1502,73 @@ func GetTiFlashStoreCount(ctx stochastikctx.Context) (cnt uint64, err error) {
 	return cnt, nil
 }
 
+// TiFlashReplicaProgressClient is a FIDel client reporting the progress of the TiFlash
+// replicas.
+type TiFlashReplicaProgressClient interface {
+	// GetTiFlashReplicaProgress returns the fraction of the Regions of the causet
+	// available on the TiFlash replicas.
+	GetTiFlashReplicaProgress(ctx context.Context, blockID int64) (float64, error)
+}
+
+// GetTiFlashReplicaProgress returns the progress of the TiFlash replica of the causet
+// reported by FIDel.
+func GetTiFlashReplicaProgress(ctx stochastikctx.Context, blockID int64) (float64, error) {
+	causetstore := ctx.GetStore()
+	einsteindbStore, ok := causetstore.(einsteindb.CausetStorage)
+	if !ok {
+		return 0, errors.Errorf("%T is not an EinsteinDB or TiFlash causetstore instance", causetstore)
+	}
+	FIDelClient := einsteindbStore.GetRegionCache().FIDelClient()
+	if FIDelClient == nil {
+		return 0, errors.New("fidel unavailable")
+	}
+	progressClient, ok := FIDelClient.(TiFlashReplicaProgressClient)
+	if !ok {
+		return 0, errors.Errorf("%T doesn't report the progress of the TiFlash replicas", FIDelClient)
+	}
+	progress, err := progressClient.GetTiFlashReplicaProgress(context.Background(), blockID)
+	return progress, errors.Trace(err)
+}
+
+// DataForTiFlashReplica returns the rows of TIFLASH_REPLICA for the blocks with a TiFlash
+// replica in the schemas. The progress of a partitioned causet is the average of its partitions.
+func DataForTiFlashReplica(ctx stochastikctx.Context, schemas []*perceptron.DBInfo) ([][]types.Causet, error) {
+	var rows [][]types.Causet
+	for _, schema := range schemas {
+		for _, tbl := range schema.Blocks {
+			if tbl.TiFlashReplica == nil {
+				continue
+			}
+			blockIDs := []int64{tbl.ID}
+			if pi := tbl.GetPartitionInfo(); pi != nil && len(pi.Definitions) > 0 {
+				blockIDs = blockIDs[:0]
+				for _, def := range pi.Definitions {
+					blockIDs = append(blockIDs, def.ID)
+				}
+			}
+			var progress float64
+			for _, blockID := range blockIDs {
+				p, err := GetTiFlashReplicaProgress(ctx, blockID)
+				if err != nil {
+					return nil, err
+				}
+				progress += p
+			}
+			progress /= float64(len(blockIDs))
+			rows = append(rows, types.MakeCausets(
+				schema.Name.O,                   // TABLE_SCHEMA
+				tbl.Name.O,                      // TABLE_NAME
+				tbl.ID,                          // TABLE_ID
+				int64(tbl.TiFlashReplica.Count), // REPLICA_COUNT
+				strings.Join(tbl.TiFlashReplica.LocationLabels, ","), // LOCATION_LABELS
+				tbl.TiFlashReplica.Available,                         // AVAILABLE
+				progress,                                             // PROGRESS
+			))
+		}
+	}
+	return rows, nil
+}
+
 var blockNameToDeferredCausets = map[string][]defCausumnInfo{
 	BlockSchemata:                 schemataDefCauss,
 	BlockBlocks:                   blocksDefCauss,
@@ -1550,6 +1630,7 @@ var blockNameToDeferredCausets = map[string][]defCausumnInfo{
 	BlockStorageStats:             blockStorageStatsDefCauss,
 	BlockTiFlashBlocks:            blockBlockTiFlashBlocksDefCauss,
 	BlockTiFlashSegments:          blockBlockTiFlashSegmentsDefCauss,
+	BlockPetriBackgroundTasks:     blockPetriBackgroundTasksDefCauss,
 }
 
 func createSchemaReplicantBlock(_ autoid.SlabPredictors, spacetime *perceptron.BlockInfo) (causet.Block, error) {
@@ -14,6 +14,7 @@ MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, J
 package schemareplicant_test
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"math"
@@ -24,6 +25,7 @@ import (
 	"strings"
 	"time"
 
+	fidel "github.com/einsteindb/fidel/client"
 	"github.com/gorilla/mux"
 	"github.com/whtcorpsinc/BerolinaSQL/allegrosql"
 	"github.com/whtcorpsinc/BerolinaSQL/auth"
@@ -46,6 +48,7 @@ import (
 	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/testleak"
 	"github.com/whtcorpsinc/MilevaDB-Prod/spacetime/autoid"
 	"github.com/whtcorpsinc/MilevaDB-Prod/stochastik"
+	"github.com/whtcorpsinc/MilevaDB-Prod/stochastikctx"
 	. "github.com/whtcorpsinc/check"
 	"github.com/whtcorpsinc/failpoint"
 	"github.com/whtcorpsinc/fn"
@@ -1347,3 +1350,66 @@ func (s *testBlockSuite) TestPerformanceSchemaforCausetCache(c *C) {
 	tk.MustQuery("select plan_cache_hits, plan_in_cache from information_schema.memexs_summary where digest_text='select * from t'").Check(
 		testkit.Rows("3 1"))
 }
+
+// tiflashProgressFIDelClient reports the progress of the TiFlash replicas for the FIDel client.
+type tiflashProgressFIDelClient struct {
+	fidel.Client
+	progress map[int64]float64
+}
+
+func (c *tiflashProgressFIDelClient) GetTiFlashReplicaProgress(ctx context.Context, blockID int64) (float64, error) {
+	return c.progress[blockID], nil
+}
+
+// storeCtx is a stochastikctx.Context only providing the causetstore.
+type storeCtx struct {
+	stochastikctx.Context
+	causetstore solomonkey.CausetStorage
+}
+
+func (ctx storeCtx) GetStore() solomonkey.CausetStorage {
+	return ctx.causetstore
+}
+
+func (s *testBlockSuite) TestDataForTiFlashReplica(c *C) {
+	progress := map[int64]float64{1: 0.5, 3: 1, 4: 0}
+	causetstore, err := mockstore.NewMockStore(mockstore.WithFIDelClientHijacker(func(cli fidel.Client) fidel.Client {
+		return &tiflashProgressFIDelClient{Client: cli, progress: progress}
+	}))
+	c.Assert(err, IsNil)
+	defer causetstore.Close()
+
+	schemas := []*perceptron.DBInfo{{
+		Name: perceptron.NewCIStr("test"),
+		Blocks: []*perceptron.BlockInfo{
+			{ID: 1, Name: perceptron.NewCIStr("t1"), TiFlashReplica: &perceptron.TiFlashReplicaInfo{Count: 1, LocationLabels: []string{"zone", "host"}}},
+			{ID: 2, Name: perceptron.NewCIStr("t2")},
+			{
+				ID:             5,
+				Name:           perceptron.NewCIStr("t3"),
+				TiFlashReplica: &perceptron.TiFlashReplicaInfo{Count: 2},
+				Partition: &perceptron.PartitionInfo{
+					Enable:      true,
+					Definitions: []perceptron.PartitionDefinition{{ID: 3}, {ID: 4}},
+				},
+			},
+		},
+	}}
+	rows, err := schemareplicant.DataForTiFlashReplica(storeCtx{causetstore: causetstore}, schemas)
+	c.Assert(err, IsNil)
+	c.Assert(rows, HasLen, 2)
+	c.Assert(rows[0][1].GetString(), Equals, "t1")
+	c.Assert(rows[0][4].GetString(), Equals, "zone,host")
+	c.Assert(rows[0][6].GetFloat64(), Equals, 0.5)
+	// The progress of a partitioned causet is the average of its partitions.
+	c.Assert(rows[1][1].GetString(), Equals, "t3")
+	c.Assert(rows[1][3].GetInt64(), Equals, int64(2))
+	c.Assert(rows[1][6].GetFloat64(), Equals, 0.5)
+
+	// A FIDel client not reporting the progress fails the read instead of reporting 0.
+	plainStore, err := mockstore.NewMockStore()
+	c.Assert(err, IsNil)
+	defer plainStore.Close()
+	_, err = schemareplicant.DataForTiFlashReplica(storeCtx{causetstore: plainStore}, schemas)
+	c.Assert(err, ErrorMatches, ".*doesn't report the progress of the TiFlash replicas")
+}
@@ -0,0 +1,252 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package keydecoder decodes the keys stored in the solomonkey causetstore into structured
+// descriptions, so the keys in logs, errors and debugging dumps are readable.
+package keydecoder
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
+	"github.com/whtcorpsinc/errors"
+)
+
+// KeyType is the type of a decoded key.
+type KeyType string
+
+// The KeyType constants.
+const (
+	KeyTypeUnknown KeyType = "unknown"
+	KeyTypeBlock   KeyType = "causet"
+	KeyTypeRecord  KeyType = "record"
+	KeyTypeIndex   KeyType = "index"
+	KeyTypeMeta    KeyType = "meta"
+)
+
+var (
+	blockPrefix  = []byte{'t'}
+	recordPrefix = []byte("_r")
+	indexPrefix  = []byte("_i")
+	metaPrefix   = []byte{'m'}
+)
+
+// DecodedKey is the structured description of a key.
+type DecodedKey struct {
+	Type KeyType `json:"type"`
+	// MVCCEncoded is true if the key is encoded by codec.EncodeBytes, like the keys of
+	// regions and the keys in the MVCC causetstore. TS is set if the key has a version suffix.
+	MVCCEncoded bool   `json:"mvcc_encoded,omitempty"`
+	TS          uint64 `json:"ts,omitempty"`
+
+	BlockID int64 `json:"block_id,omitempty"`
+	IndexID int64 `json:"index_id,omitempty"`
+	// IntHandle is set for the record keys of the blocks with int handles.
+	IntHandle *int64 `json:"int_handle,omitempty"`
+	// HandleValues is set for the record keys of the blocks with common handles.
+	HandleValues []string `json:"handle_values,omitempty"`
+	// IndexValues are the encoded defCausumn values of an index key, the values after the
+	// index defCausumns (the handle of a non-unique index) are included too.
+	IndexValues []string `json:"index_values,omitempty"`
+
+	MetaKey   string `json:"meta_key,omitempty"`
+	MetaType  string `json:"meta_type,omitempty"`
+	MetaField string `json:"meta_field,omitempty"`
+
+	// Rest is the hex of the bytes which can't be decoded.
+	Rest string `json:"rest,omitempty"`
+	Raw  string `json:"raw"`
+}
+
+// DecodeKey decodes the key. The key can be a raw key or a MVCC-encoded key with or
+// without the version suffix.
+func DecodeKey(key []byte) (*DecodedKey, error) {
+	d := &DecodedKey{Type: KeyTypeUnknown, Raw: strings.ToUpper(hex.EncodeToString(key))}
+	if len(key) == 0 {
+		return d, nil
+	}
+	raw := key
+	if rest, decoded, err := codec.DecodeBytes(key, nil); err == nil && (len(rest) == 0 || len(rest) == 8) &&
+		(bytes.HasPrefix(decoded, blockPrefix) || bytes.HasPrefix(decoded, metaPrefix)) {
+		raw = decoded
+		d.MVCCEncoded = true
+		if len(rest) == 8 {
+			if _, d.TS, err = codec.DecodeUintDesc(rest); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+	}
+	switch {
+	case bytes.HasPrefix(raw, blockPrefix):
+		return d, decodeBlockKey(d, raw[len(blockPrefix):])
+	case bytes.HasPrefix(raw, metaPrefix):
+		return d, decodeMetaKey(d, raw[len(metaPrefix):])
+	}
+	d.Rest = strings.ToUpper(hex.EncodeToString(raw))
+	return d, nil
+}
+
+func decodeBlockKey(d *DecodedKey, b []byte) error {
+	b, blockID, err := codec.DecodeInt(b)
+	if err != nil {
+		return nil
+	}
+	d.Type = KeyTypeBlock
+	d.BlockID = blockID
+	switch {
+	case bytes.HasPrefix(b, recordPrefix):
+		d.Type = KeyTypeRecord
+		b = b[len(recordPrefix):]
+		if len(b) == 8 {
+			_, h, err := codec.DecodeInt(b)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			d.IntHandle = &h
+			return nil
+		}
+		d.HandleValues, b = decodeValues(b)
+	case bytes.HasPrefix(b, indexPrefix):
+		d.Type = KeyTypeIndex
+		b, d.IndexID, err = codec.DecodeInt(b[len(indexPrefix):])
+		if err != nil {
+			return errors.Trace(err)
+		}
+		d.IndexValues, b = decodeValues(b)
+	}
+	if len(b) > 0 {
+		d.Rest = strings.ToUpper(hex.EncodeToString(b))
+	}
+	return nil
+}
+
+// decodeValues decodes the values until the bytes can't be decoded.
+func decodeValues(b []byte) ([]string, []byte) {
+	var values []string
+	for len(b) > 0 {
+		rest, causet, err := codec.DecodeOne(b)
+		if err != nil {
+			break
+		}
+		str, err := causet.ToString()
+		if err != nil {
+			break
+		}
+		values = append(values, str)
+		b = rest
+	}
+	return values, b
+}
+
+// The meta key is 'm' + EncodeBytes(key) + EncodeUint(type) [+ EncodeBytes(field)],
+// see the structure package.
+var metaTypes = map[uint64]string{
+	's': "string",
+	'S': "hash-meta",
+	'h': "hash",
+	'L': "list-meta",
+	'l': "list",
+}
+
+func decodeMetaKey(d *DecodedKey, b []byte) error {
+	b, key, err := codec.DecodeBytes(b, nil)
+	if err != nil {
+		return nil
+	}
+	d.Type = KeyTypeMeta
+	d.MetaKey = string(key)
+	if len(b) == 0 {
+		return nil
+	}
+	b, tp, err := codec.DecodeUint(b)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if name, ok := metaTypes[tp]; ok {
+		d.MetaType = name
+	} else {
+		d.MetaType = fmt.Sprintf("%d", tp)
+	}
+	if tp == 'h' && len(b) > 0 {
+		var field []byte
+		if b, field, err = codec.DecodeBytes(b, nil); err != nil {
+			return errors.Trace(err)
+		}
+		d.MetaField = string(field)
+	}
+	if len(b) > 0 {
+		d.Rest = strings.ToUpper(hex.EncodeToString(b))
+	}
+	return nil
+}
+
+// String implements the fmt.Stringer interface.
+func (d *DecodedKey) String() string {
+	var parts []string
+	switch d.Type {
+	case KeyTypeBlock:
+		parts = append(parts, fmt.Sprintf("causet_id=%d", d.BlockID))
+	case KeyTypeRecord:
+		parts = append(parts, fmt.Sprintf("causet_id=%d", d.BlockID))
+		if d.IntHandle != nil {
+			parts = append(parts, fmt.Sprintf("handle=%d", *d.IntHandle))
+		} else {
+			parts = append(parts, fmt.Sprintf("handle={%s}", strings.Join(d.HandleValues, ", ")))
+		}
+	case KeyTypeIndex:
+		parts = append(parts, fmt.Sprintf("causet_id=%d", d.BlockID), fmt.Sprintf("index_id=%d", d.IndexID),
+			fmt.Sprintf("index_values={%s}", strings.Join(d.IndexValues, ", ")))
+	case KeyTypeMeta:
+		parts = append(parts, fmt.Sprintf("key=%s", d.MetaKey))
+		if d.MetaType != "" {
+			parts = append(parts, fmt.Sprintf("type=%s", d.MetaType))
+		}
+		if d.MetaField != "" {
+			parts = append(parts, fmt.Sprintf("field=%s", d.MetaField))
+		}
+	}
+	if d.MVCCEncoded && d.TS != 0 {
+		parts = append(parts, fmt.Sprintf("ts=%d", d.TS))
+	}
+	if d.Rest != "" {
+		parts = append(parts, fmt.Sprintf("rest=%s", d.Rest))
+	}
+	return fmt.Sprintf("%s{%s}", d.Type, strings.Join(parts, " "))
+}
+
+// JSON returns the JSON of the decoded key.
+func (d *DecodedKey) JSON() ([]byte, error) {
+	b, err := json.Marshal(d)
+	return b, errors.Trace(err)
+}
+
+// Key returns a fmt.Stringer which prints the decoded key, the key is decoded lazily so
+// it's cheap to be passed to the loggers and the errors. The hex of the key is printed
+// too because the decoding may lose information.
+func Key(key []byte) fmt.Stringer {
+	return keyStringer(key)
+}
+
+type keyStringer []byte
+
+func (k keyStringer) String() string {
+	d, err := DecodeKey(k)
+	if err != nil || d.Type == KeyTypeUnknown {
+		return strings.ToUpper(hex.EncodeToString(k))
+	}
+	return fmt.Sprintf("%s(%s)", d.String(), d.Raw)
+}
@@ -0,0 +1,82 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keydecoder
+
+import (
+	"testing"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
+	. "github.com/whtcorpsinc/check"
+)
+
+func TestT(t *testing.T) {
+	CustomVerboseFlag = true
+	TestingT(t)
+}
+
+var _ = Suite(&testKeyDecoderSuite{})
+
+type testKeyDecoderSuite struct{}
+
+func recordKey(blockID, handle int64) []byte {
+	key := codec.EncodeInt([]byte("t"), blockID)
+	key = append(key, "_r"...)
+	return codec.EncodeInt(key, handle)
+}
+
+func (s *testKeyDecoderSuite) TestRecordKey(c *C) {
+	d, err := DecodeKey(recordKey(42, -7))
+	c.Assert(err, IsNil)
+	c.Assert(d.Type, Equals, KeyTypeRecord)
+	c.Assert(d.BlockID, Equals, int64(42))
+	c.Assert(*d.IntHandle, Equals, int64(-7))
+	c.Assert(d.MVCCEncoded, IsFalse)
+	c.Assert(d.String(), Equals, "record{causet_id=42 handle=-7}")
+
+	// MVCC-encoded key with a version.
+	mvccKey := codec.EncodeUintDesc(codec.EncodeBytes(nil, recordKey(42, 1)), 100)
+	d, err = DecodeKey(mvccKey)
+	c.Assert(err, IsNil)
+	c.Assert(d.MVCCEncoded, IsTrue)
+	c.Assert(d.TS, Equals, uint64(100))
+	c.Assert(*d.IntHandle, Equals, int64(1))
+}
+
+func (s *testKeyDecoderSuite) TestIndexKey(c *C) {
+	key := codec.EncodeInt([]byte("t"), 42)
+	key = append(key, "_i"...)
+	key = codec.EncodeInt(key, 3)
+	key = codec.EncodeBytes(append(key, 1), []byte("abc"))
+	key = codec.EncodeInt(append(key, 3), 10)
+	d, err := DecodeKey(key)
+	c.Assert(err, IsNil)
+	c.Assert(d.Type, Equals, KeyTypeIndex)
+	c.Assert(d.IndexID, Equals, int64(3))
+	c.Assert(d.IndexValues, DeepEquals, []string{"abc", "10"})
+	c.Assert(d.Rest, Equals, "")
+}
+
+func (s *testKeyDecoderSuite) TestMetaKey(c *C) {
+	key := codec.EncodeBytes([]byte("m"), []byte("DB:1"))
+	key = codec.EncodeUint(key, uint64('h'))
+	key = codec.EncodeBytes(key, []byte("Block:5"))
+	d, err := DecodeKey(key)
+	c.Assert(err, IsNil)
+	c.Assert(d.Type, Equals, KeyTypeMeta)
+	c.Assert(d.MetaKey, Equals, "DB:1")
+	c.Assert(d.MetaType, Equals, "hash")
+	c.Assert(d.MetaField, Equals, "Block:5")
+
+	c.Assert(Key([]byte("zzz")).String(), Equals, "7A7A7A")
+}
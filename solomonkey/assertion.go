@@ -0,0 +1,152 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package MilevaDB
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
+)
+
+// String implements fmt.Stringer interface.
+func (a AssertionType) String() string {
+	switch a {
+	case Exist:
+		return "Exist"
+	case NotExist:
+		return "NotExist"
+	}
+	return "None"
+}
+
+// FlagsOp returns the FlagsOp which makes a key in MemBuffer carry the assertion.
+func (a AssertionType) FlagsOp() FlagsOp {
+	switch a {
+	case Exist:
+		return SetAssertExist
+	case NotExist:
+		return SetAssertNotExist
+	}
+	return SetAssertNone
+}
+
+var (
+	blockKeyPrefix  = []byte{'t'}
+	recordKeyPrefix = []byte("_r")
+	indexKeyPrefix  = []byte("_i")
+)
+
+// AssertionFailedError is returned by commit when the existence of a key in the
+// causetstore doesn't match the assertion carried by the key in MemBuffer.
+type AssertionFailedError struct {
+	Key       Key
+	Assertion AssertionType
+	// BlockID is 0 if the key is not a record key or an index key.
+	BlockID int64
+	// IndexID is 0 if the key is not an index key.
+	IndexID   int64
+	IndexName string
+	// ExistingCommitTS is the commit ts of the value which violates the assertion,
+	// it is 0 if the key doesn't exist.
+	ExistingCommitTS uint64
+}
+
+// NewAssertionFailedError builds an AssertionFailedError for key. The causet and index
+// are decoded from the key, the index name is looked up from the UnionStore.
+func NewAssertionFailedError(us UnionStore, key Key, assertion AssertionType, existingCommitTS uint64) *AssertionFailedError {
+	e := &AssertionFailedError{
+		Key:              key,
+		Assertion:        assertion,
+		ExistingCommitTS: existingCommitTS,
+	}
+	e.BlockID, e.IndexID = decodeBlockIndexID(key)
+	if e.IndexID != 0 && us != nil {
+		e.IndexName = us.GetIndexName(e.BlockID, e.IndexID)
+	}
+	return e
+}
+
+func (e *AssertionFailedError) Error() string {
+	switch {
+	case e.IndexID != 0:
+		return fmt.Sprintf("assertion failed: key %s should be %s, causet %d, index %s(%d), existing commit ts %d",
+			e.Key, e.Assertion, e.BlockID, e.IndexName, e.IndexID, e.ExistingCommitTS)
+	case e.BlockID != 0:
+		return fmt.Sprintf("assertion failed: key %s should be %s, causet %d, record, existing commit ts %d",
+			e.Key, e.Assertion, e.BlockID, e.ExistingCommitTS)
+	}
+	return fmt.Sprintf("assertion failed: key %s should be %s, existing commit ts %d",
+		e.Key, e.Assertion, e.ExistingCommitTS)
+}
+
+// assertionFailedAbortFormat is the format of the KeyError.Abort message carrying a failed
+// assertion from the causetstore, the kvproto of this tree has no dedicated field for it.
+const assertionFailedAbortFormat = "assertion failed: key=%s assertion=%s existing_commit_ts=%d"
+
+// AssertionFailedAbort encodes a failed assertion into a KeyError.Abort message, the client
+// decodes it with ExtractAssertionFailedError.
+func AssertionFailedAbort(key Key, assertion AssertionType, existingCommitTS uint64) string {
+	return fmt.Sprintf(assertionFailedAbortFormat, hex.EncodeToString(key), assertion, existingCommitTS)
+}
+
+// ExtractAssertionFailedError decodes the AssertionFailedError from a KeyError.Abort message
+// built by AssertionFailedAbort. It returns false if abort is not a failed assertion.
+func ExtractAssertionFailedError(us UnionStore, abort string) (*AssertionFailedError, bool) {
+	var (
+		hexKey, assertionStr string
+		existingCommitTS     uint64
+	)
+	if _, err := fmt.Sscanf(abort, assertionFailedAbortFormat, &hexKey, &assertionStr, &existingCommitTS); err != nil {
+		return nil, false
+	}
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, false
+	}
+	var assertion AssertionType
+	switch assertionStr {
+	case Exist.String():
+		assertion = Exist
+	case NotExist.String():
+		assertion = NotExist
+	default:
+		return nil, false
+	}
+	return NewAssertionFailedError(us, key, assertion, existingCommitTS), true
+}
+
+// decodeBlockIndexID decodes the causet ID and index ID from a record key or an index key.
+// It can't use blockcodec because blockcodec depends on this package.
+func decodeBlockIndexID(key Key) (blockID, indexID int64) {
+	if !bytes.HasPrefix(key, blockKeyPrefix) {
+		return 0, 0
+	}
+	rest, tid, err := codec.DecodeInt(key[len(blockKeyPrefix):])
+	if err != nil {
+		return 0, 0
+	}
+	switch {
+	case bytes.HasPrefix(rest, recordKeyPrefix):
+		return tid, 0
+	case bytes.HasPrefix(rest, indexKeyPrefix):
+		_, iid, err := codec.DecodeInt(rest[len(indexKeyPrefix):])
+		if err != nil {
+			return tid, 0
+		}
+		return tid, iid
+	}
+	return 0, 0
+}
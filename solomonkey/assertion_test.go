@@ -0,0 +1,74 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package MilevaDB
+
+import (
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
+	. "github.com/whtcorpsinc/check"
+)
+
+var _ = Suite(&testAssertionSuite{})
+
+type testAssertionSuite struct {
+}
+
+func (s *testAssertionSuite) TestAssertionFlags(c *C) {
+	f := applyFlagsOps(0, SetPresumeKeyNotExists, SetAssertExist)
+	c.Assert(f.Assertion(), Equals, Exist)
+	c.Assert(f.HasPresumeKeyNotExists(), IsTrue)
+	f = applyFlagsOps(f, NotExist.FlagsOp())
+	c.Assert(f.Assertion(), Equals, NotExist)
+	c.Assert(f.HasAssertExist(), IsFalse)
+	f = applyFlagsOps(f, SetAssertNone)
+	c.Assert(f.Assertion(), Equals, None)
+	c.Assert(f.HasPresumeKeyNotExists(), IsTrue)
+}
+
+func (s *testAssertionSuite) TestAssertionFailedError(c *C) {
+	us := NewUnionStore(&mockSnapshot{newMemDB()})
+	us.CacheIndexName(3, 2, "idx_a")
+
+	indexKey := append(codec.EncodeInt([]byte{'t'}, 3), "_i"...)
+	indexKey = codec.EncodeInt(indexKey, 2)
+	e := NewAssertionFailedError(us, indexKey, NotExist, 10)
+	c.Assert(e.BlockID, Equals, int64(3))
+	c.Assert(e.IndexID, Equals, int64(2))
+	c.Assert(e.IndexName, Equals, "idx_a")
+
+	recordKey := append(codec.EncodeInt([]byte{'t'}, 3), "_r"...)
+	recordKey = codec.EncodeInt(recordKey, 1)
+	e = NewAssertionFailedError(us, recordKey, Exist, 0)
+	c.Assert(e.BlockID, Equals, int64(3))
+	c.Assert(e.IndexID, Equals, int64(0))
+
+	e = NewAssertionFailedError(us, Key("m_key"), Exist, 0)
+	c.Assert(e.BlockID, Equals, int64(0))
+}
+
+func (s *testAssertionSuite) TestAssertionFailedAbort(c *C) {
+	us := NewUnionStore(&mockSnapshot{newMemDB()})
+	us.CacheIndexName(3, 2, "idx_a")
+
+	indexKey := append(codec.EncodeInt([]byte{'t'}, 3), "_i"...)
+	indexKey = codec.EncodeInt(indexKey, 2)
+	e, ok := ExtractAssertionFailedError(us, AssertionFailedAbort(indexKey, NotExist, 10))
+	c.Assert(ok, IsTrue)
+	c.Assert(e.Key, BytesEquals, []byte(indexKey))
+	c.Assert(e.Assertion, Equals, NotExist)
+	c.Assert(e.ExistingCommitTS, Equals, uint64(10))
+	c.Assert(e.IndexName, Equals, "idx_a")
+
+	_, ok = ExtractAssertionFailedError(us, "txn aborted")
+	c.Assert(ok, IsFalse)
+}
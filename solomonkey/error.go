@@ -51,6 +51,25 @@ var (
 	// ErrWriteConflictInMilevaDB is the error when the commit meets an write conflict error when local latch is enabled.
 	ErrWriteConflictInMilevaDB = terror.ClassKV.New(allegrosql.ErrWriteConflictInMilevaDB,
 		allegrosql.MyALLEGROSQLErrName[allegrosql.ErrWriteConflictInMilevaDB]+" "+TxnRetryableMark)
+	// ErrGCTooEarly is returned when a snapshot reads at a ts below the GC safe point.
+	ErrGCTooEarly = terror.ClassKV.New(allegrosql.ErrGCTooEarly, allegrosql.MyALLEGROSQLErrName[allegrosql.ErrGCTooEarly])
+	// ErrStaleReadUnavailable is returned when no replica can serve a max-staleness read.
+	ErrStaleReadUnavailable = terror.ClassKV.New(codeStaleReadUnavailable,
+		"no replica can serve the stale read within max staleness %v, the safe ts is at %v")
+	// ErrStaleReadTSTooNew is returned when the read ts of an exact stale read is after
+	// the safe ts of the replica.
+	ErrStaleReadTSTooNew = terror.ClassKV.New(codeStaleReadTSTooNew,
+		"no replica can serve the stale read at %v, the safe ts is at %v")
+	// ErrInvalidStaleRead is returned when a StaleReadOption has neither a read ts nor a
+	// max staleness.
+	ErrInvalidStaleRead = terror.ClassKV.New(codeInvalidStaleRead, "stale read needs a read ts or a max staleness")
+)
+
+// The codes of the stale read errors, they follow the KV error codes of errno.
+const (
+	codeStaleReadUnavailable terror.ErrCode = 9020 + iota
+	codeStaleReadTSTooNew
+	codeInvalidStaleRead
 )
 
 // IsTxnRetryableError checks if the error could safely retry the transaction.
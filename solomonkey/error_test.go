@@ -34,6 +34,10 @@ func (s testErrorSuite) TestError(c *C) {
 		ErrNotImplemented,
 		ErrWriteConflict,
 		ErrWriteConflictInMilevaDB,
+		ErrGCTooEarly,
+		ErrStaleReadUnavailable,
+		ErrStaleReadTSTooNew,
+		ErrInvalidStaleRead,
 	}
 	for _, err := range kvErrs {
 		code := terror.ToALLEGROSQLError(err).Code
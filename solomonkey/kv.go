@@ -58,6 +58,8 @@ const (
 	SampleStep
 	// CommitHook is a callback function called right after the transaction gets committed
 	CommitHook
+	// StaleRead makes a snapshot read stale data from the nearest replica, the value is a StaleReadOption.
+	StaleRead
 )
 
 // Priority value for transaction priority.
@@ -211,6 +213,9 @@ type MemBuffer interface {
 	Cleanup(StagingHandle)
 	// InspectStage used to inspect the value uFIDelates in the given stage.
 	InspectStage(StagingHandle, func(Key, KeyFlags, []byte))
+	// InspectStageChanges returns the before and after values and flags of the keys
+	// changed in the given stage, see DumpStageChanges for a readable dump.
+	InspectStageChanges(StagingHandle) []StageChange
 
 	// SnapshotGetter returns a Getter for a snapshot of MemBuffer.
 	SnapshotGetter() Getter
@@ -225,6 +230,18 @@ type MemBuffer interface {
 	Dirty() bool
 }
 
+// RangeDeleter is implemented by the MemBuffer and Transaction which can delete a range of
+// keys with a single range tombstone. It's not a part of MemBuffer or Transaction, check it
+// with a type assertion, or use DeleteRange.
+type RangeDeleter interface {
+	// DeleteRange deletes all the keys in [start, end) with a range tombstone.
+	// The keys written after DeleteRange are not affected by it.
+	DeleteRange(start, end Key) error
+	// RangeTombstones returns the ranges deleted by DeleteRange, the committer deletes
+	// them from the causetstore with ApplyRangeTombstones.
+	RangeTombstones() []KeyRange
+}
+
 // Transaction defines the interface for operations inside a Transaction.
 // This is not thread safe.
 type Transaction interface {
@@ -310,6 +327,8 @@ const (
 	ReqTypePosetDag = 103
 	ReqTypeAnalyze  = 104
 	ReqTypeChecksum = 105
+	// ReqTypePagingPosetDag is a paging PosetDag request, see EncodePagingRequest.
+	ReqTypePagingPosetDag = 106
 
 	ReqSubTypeBasic          = 0
 	ReqSubTypeDesc           = 10000
@@ -387,6 +406,15 @@ type Request struct {
 	BatchINTERLOCK bool
 	// TaskID is an unique ID for an execution of a statement
 	TaskID uint64
+	// Paging indicates the interlock returns the result of a region in pages. A page
+	// stops once it holds PagingSize rows or PagingBytes bytes, and carries the range
+	// it scanned so the client can resume after it, see ResumeKeyRanges. Only PosetDag
+	// requests are paged, they are sent as ReqTypePagingPosetDag requests.
+	Paging bool
+	// PagingSize is the max number of rows of a page, 0 means no limit.
+	PagingSize uint64
+	// PagingBytes is the max number of bytes of a page, 0 means no limit.
+	PagingBytes uint64
 }
 
 // ResultSubset represents a result subset from a single storage unit.
@@ -417,7 +445,7 @@ type Snapshot interface {
 	// BatchGet gets a batch of values from snapshot.
 	BatchGet(ctx context.Context, keys []Key) (map[string][]byte, error)
 	// SetOption sets an option with a value, when val is nil, uses the default
-	// value of this option. Only ReplicaRead is supported for snapshot
+	// value of this option. Only ReplicaRead and StaleRead are supported for snapshot
 	SetOption(opt Option, val interface{})
 	// DelOption deletes an option.
 	DelOption(opt Option)
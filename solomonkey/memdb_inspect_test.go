@@ -0,0 +1,80 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package MilevaDB
+
+import (
+	"bytes"
+	"strings"
+	"sync/atomic"
+
+	. "github.com/whtcorpsinc/check"
+)
+
+var _ = Suite(&testMemDBInspectSuite{})
+
+type testMemDBInspectSuite struct {
+}
+
+func (s *testMemDBInspectSuite) TestInspectStageChanges(c *C) {
+	atomic.StoreUint32(&StageFlagsTracking, 1)
+	defer atomic.StoreUint32(&StageFlagsTracking, 0)
+
+	EDB := newMemDB()
+	c.Assert(EDB.Set(Key("a"), []byte("a0")), IsNil)
+	c.Assert(EDB.Set(Key("b"), []byte("b0")), IsNil)
+	EDB.UFIDelateFlags(Key("c"), SetKeyLocked)
+
+	h1 := EDB.Staging()
+	c.Assert(EDB.Set(Key("a"), []byte("a1")), IsNil)
+	c.Assert(EDB.Delete(Key("b")), IsNil)
+	h2 := EDB.Staging()
+	c.Assert(EDB.Set(Key("a"), []byte("a2")), IsNil)
+	c.Assert(EDB.SetWithFlags(Key("d"), []byte("d2"), SetPresumeKeyNotExists), IsNil)
+	EDB.UFIDelateFlags(Key("c"), SetAssertExist)
+
+	changes := EDB.InspectStageChanges(h2)
+	c.Assert(changes, HasLen, 3)
+	c.Assert(string(changes[0].Key), Equals, "a")
+	c.Assert(string(changes[0].OldValue), Equals, "a1")
+	c.Assert(string(changes[0].NewValue), Equals, "a2")
+	c.Assert(string(changes[1].Key), Equals, "c")
+	c.Assert(changes[1].OldValue, IsNil)
+	c.Assert(changes[1].OldFlags.HasAssertExist(), IsFalse)
+	c.Assert(changes[1].NewFlags.HasAssertExist(), IsTrue)
+	c.Assert(changes[1].NewFlags.HasLocked(), IsTrue)
+	c.Assert(string(changes[2].Key), Equals, "d")
+	c.Assert(changes[2].OldValue, IsNil)
+	c.Assert(changes[2].NewFlags.HasPresumeKeyNotExists(), IsTrue)
+
+	// Cleanup discards the values of the child stage but the flags are kept.
+	EDB.Cleanup(h2)
+	changes = EDB.InspectStageChanges(h1)
+	c.Assert(changes, HasLen, 3)
+	c.Assert(string(changes[0].OldValue), Equals, "a0")
+	c.Assert(string(changes[0].NewValue), Equals, "a1")
+	c.Assert(string(changes[1].Key), Equals, "b")
+	c.Assert(string(changes[1].OldValue), Equals, "b0")
+	c.Assert(changes[1].NewValue, NotNil)
+	c.Assert(changes[1].NewValue, HasLen, 0)
+	c.Assert(string(changes[2].Key), Equals, "c")
+	c.Assert(changes[2].NewFlags.HasAssertExist(), IsTrue)
+
+	var buf bytes.Buffer
+	c.Assert(DumpStageChanges(&buf, changes), IsNil)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	c.Assert(lines, HasLen, 3)
+	c.Assert(strings.Contains(lines[1], "new=<tombstone>"), IsTrue)
+	c.Assert(strings.Contains(lines[2], "flags=[Locked]->[Locked,AssertExist]"), IsTrue)
+	EDB.Release(h1)
+}
@@ -0,0 +1,72 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package MilevaDB
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/whtcorpsinc/errors"
+)
+
+// ResumeKeyRanges returns the part of ranges that is left to scan after a page of a
+// paging request scanned pageRange. ranges are sorted in ascending order. A nil
+// result means the scan is done.
+func ResumeKeyRanges(ranges []KeyRange, pageRange KeyRange, desc bool) []KeyRange {
+	var resumed []KeyRange
+	for _, r := range ranges {
+		if desc {
+			// A descending scan resumes below the start of the page.
+			if len(pageRange.StartKey) == 0 || bytes.Compare(r.StartKey, pageRange.StartKey) >= 0 {
+				continue
+			}
+			if len(r.EndKey) == 0 || bytes.Compare(r.EndKey, pageRange.StartKey) > 0 {
+				r.EndKey = pageRange.StartKey
+			}
+		} else {
+			if len(pageRange.EndKey) == 0 || (len(r.EndKey) > 0 && bytes.Compare(r.EndKey, pageRange.EndKey) <= 0) {
+				continue
+			}
+			if bytes.Compare(r.StartKey, pageRange.EndKey) < 0 {
+				r.StartKey = pageRange.EndKey
+			}
+		}
+		resumed = append(resumed, r)
+	}
+	return resumed
+}
+
+// EncodePagingRequest returns the data of a ReqTypePagingPosetDag request: the
+// budget of a page, in rows and in bytes, followed by the PosetDag request data.
+func EncodePagingRequest(data []byte, pagingSize, pagingBytes uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	encoded := make([]byte, 0, 2*binary.MaxVarintLen64+len(data))
+	encoded = append(encoded, buf[:binary.PutUvarint(buf[:], pagingSize)]...)
+	encoded = append(encoded, buf[:binary.PutUvarint(buf[:], pagingBytes)]...)
+	return append(encoded, data...)
+}
+
+// DecodePagingRequest decodes the data of a ReqTypePagingPosetDag request.
+func DecodePagingRequest(encoded []byte) (data []byte, pagingSize, pagingBytes uint64, err error) {
+	pagingSize, n := binary.Uvarint(encoded)
+	if n <= 0 {
+		return nil, 0, 0, errors.New("invalid paging size")
+	}
+	encoded = encoded[n:]
+	pagingBytes, n = binary.Uvarint(encoded)
+	if n <= 0 {
+		return nil, 0, 0, errors.New("invalid paging bytes")
+	}
+	return encoded[n:], pagingSize, pagingBytes, nil
+}
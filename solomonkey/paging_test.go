@@ -0,0 +1,60 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package MilevaDB
+
+import (
+	. "github.com/whtcorpsinc/check"
+)
+
+type testPagingSuite struct{}
+
+var _ = Suite(testPagingSuite{})
+
+func (s testPagingSuite) TestResumeKeyRanges(c *C) {
+	ranges := []KeyRange{
+		{StartKey: Key("a"), EndKey: Key("c")},
+		{StartKey: Key("e"), EndKey: Key("g")},
+		{StartKey: Key("h"), EndKey: nil},
+	}
+	resumed := ResumeKeyRanges(ranges, KeyRange{StartKey: Key("a"), EndKey: Key("f")}, false)
+	c.Assert(resumed, DeepEquals, []KeyRange{
+		{StartKey: Key("f"), EndKey: Key("g")},
+		{StartKey: Key("h"), EndKey: nil},
+	})
+	resumed = ResumeKeyRanges(ranges, KeyRange{StartKey: Key("a"), EndKey: Key("g")}, false)
+	c.Assert(resumed, DeepEquals, []KeyRange{{StartKey: Key("h"), EndKey: nil}})
+	c.Assert(ResumeKeyRanges(ranges, KeyRange{StartKey: Key("a"), EndKey: nil}, false), IsNil)
+
+	resumed = ResumeKeyRanges(ranges, KeyRange{StartKey: Key("f"), EndKey: nil}, true)
+	c.Assert(resumed, DeepEquals, []KeyRange{
+		{StartKey: Key("a"), EndKey: Key("c")},
+		{StartKey: Key("e"), EndKey: Key("f")},
+	})
+	resumed = ResumeKeyRanges(ranges, KeyRange{StartKey: Key("b"), EndKey: nil}, true)
+	c.Assert(resumed, DeepEquals, []KeyRange{{StartKey: Key("a"), EndKey: Key("b")}})
+	c.Assert(ResumeKeyRanges(ranges, KeyRange{StartKey: Key("a"), EndKey: Key("c")}, true), IsNil)
+}
+
+func (s testPagingSuite) TestPagingRequest(c *C) {
+	data, pagingSize, pagingBytes, err := DecodePagingRequest(EncodePagingRequest([]byte("posetdag"), 10, 1<<20))
+	c.Assert(err, IsNil)
+	c.Assert(data, DeepEquals, []byte("posetdag"))
+	c.Assert(pagingSize, Equals, uint64(10))
+	c.Assert(pagingBytes, Equals, uint64(1<<20))
+
+	_, _, _, err = DecodePagingRequest(nil)
+	c.Assert(err, NotNil)
+	_, _, _, err = DecodePagingRequest([]byte{0x80})
+	c.Assert(err, NotNil)
+}
@@ -0,0 +1,104 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package MilevaDB
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/whtcorpsinc/errors"
+)
+
+func keyInRanges(ranges []KeyRange, key Key) bool {
+	for i := range ranges {
+		r := &ranges[i]
+		if bytes.Compare(key, r.StartKey) >= 0 && (len(r.EndKey) == 0 || bytes.Compare(key, r.EndKey) < 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// rangeTombstoneIter skips the keys which are deleted by range tombstones.
+type rangeTombstoneIter struct {
+	Iterator
+	ranges []KeyRange
+}
+
+// newRangeTombstoneIter wraps the snapshot iterator it so the keys in ranges are skipped.
+func newRangeTombstoneIter(it Iterator, ranges []KeyRange) (Iterator, error) {
+	if len(ranges) == 0 {
+		return it, nil
+	}
+	iter := &rangeTombstoneIter{
+		Iterator: it,
+		ranges:   ranges,
+	}
+	if err := iter.skipDeleted(); err != nil {
+		it.Close()
+		return nil, err
+	}
+	return iter, nil
+}
+
+// Next implements the Iterator interface.
+func (it *rangeTombstoneIter) Next() error {
+	if err := it.Iterator.Next(); err != nil {
+		return err
+	}
+	return it.skipDeleted()
+}
+
+func (it *rangeTombstoneIter) skipDeleted() error {
+	for it.Iterator.Valid() && keyInRanges(it.ranges, it.Iterator.Key()) {
+		if err := it.Iterator.Next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteRangeFunc deletes the committed keys in [start, end) from the causetstore, an empty end
+// means there is no upper bound.
+type DeleteRangeFunc func(ctx context.Context, start, end Key) error
+
+// DeleteRange deletes all the keys in [start, end) in txn with a range tombstone, see
+// RangeDeleter. It returns ErrNotImplemented if neither txn nor its MemBuffer supports it.
+func DeleteRange(txn Transaction, start, end Key) error {
+	if rd, ok := txn.(RangeDeleter); ok {
+		return rd.DeleteRange(start, end)
+	}
+	if rd, ok := txn.GetMemBuffer().(RangeDeleter); ok {
+		return rd.DeleteRange(start, end)
+	}
+	return ErrNotImplemented
+}
+
+// ApplyRangeTombstones deletes the ranges of the range tombstones of buf from the causetstore
+// by deleteRange, a range is deleted by a single call rather than a point delete for each
+// key in it. The 2PC protocol has no transactional range delete, so the committer calls it
+// before the prewrite, and the keys written after the range is deleted are committed on top
+// of the deleted range. A nil buf or a buf without range tombstones has nothing to apply.
+func ApplyRangeTombstones(ctx context.Context, buf MemBuffer, deleteRange DeleteRangeFunc) error {
+	rd, ok := buf.(RangeDeleter)
+	if !ok {
+		return nil
+	}
+	for _, r := range rd.RangeTombstones() {
+		if err := deleteRange(ctx, r.StartKey, r.EndKey); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package MilevaDB
+
+import (
+	"context"
+
+	. "github.com/whtcorpsinc/check"
+)
+
+var _ = Suite(&testRangeTombstoneSuite{})
+
+type testRangeTombstoneSuite struct {
+}
+
+func (s *testRangeTombstoneSuite) TestDeleteRange(c *C) {
+	snap := newMemDB()
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		c.Assert(snap.Set(Key(k), []byte("snap_"+k)), IsNil)
+	}
+	us := NewUnionStore(&mockSnapshot{snap})
+	buf := us.GetMemBuffer().(*memdb)
+	c.Assert(buf.Set(Key("c1"), []byte("buf_c1")), IsNil)
+
+	h := buf.Staging()
+	c.Assert(buf.DeleteRange(Key("b"), Key("d")), IsNil)
+	// The keys written after DeleteRange are not affected.
+	c.Assert(buf.Set(Key("b"), []byte("buf_b")), IsNil)
+
+	ctx := context.Background()
+	v, err := us.Get(ctx, Key("b"))
+	c.Assert(err, IsNil)
+	c.Assert(string(v), Equals, "buf_b")
+	for _, k := range []string{"c", "c1"} {
+		_, err = us.Get(ctx, Key(k))
+		c.Assert(IsErrNotFound(err), IsTrue)
+	}
+	s.checkIter(c, us, "a", "b", "d", "e")
+	c.Assert(buf.RangeTombstones(), HasLen, 1)
+
+	// Cleanup discards the range tombstone and the point tombstones.
+	buf.Cleanup(h)
+	c.Assert(buf.RangeTombstones(), HasLen, 0)
+	s.checkIter(c, us, "a", "b", "c", "c1", "d", "e")
+
+	// An empty end key means no upper bound.
+	c.Assert(buf.DeleteRange(Key("d"), nil), IsNil)
+	s.checkIter(c, us, "a", "b", "c", "c1")
+}
+
+func (s *testRangeTombstoneSuite) TestSnapshotRangeTombstones(c *C) {
+	snap := newMemDB()
+	for _, k := range []string{"a", "b", "c", "d"} {
+		c.Assert(snap.Set(Key(k), []byte("snap_"+k)), IsNil)
+	}
+	buf := NewUnionStore(&mockSnapshot{snap}).GetMemBuffer().(*memdb)
+	c.Assert(buf.DeleteRange(Key("b"), Key("c")), IsNil)
+	h := buf.Staging()
+	// The range tombstone of the stage isn't a part of the snapshot.
+	c.Assert(buf.DeleteRange(Key("c"), Key("d")), IsNil)
+
+	ctx := context.Background()
+	v, err := buf.SnapshotGetter().Get(ctx, Key("b"))
+	c.Assert(err, IsNil)
+	c.Assert(v, HasLen, 0)
+	_, err = buf.SnapshotGetter().Get(ctx, Key("c"))
+	c.Assert(IsErrNotFound(err), IsTrue)
+
+	snapIt, err := snap.Iter(nil, nil)
+	c.Assert(err, IsNil)
+	it, err := NewUnionIter(buf.SnapshotIter(nil, nil), snapIt, false)
+	c.Assert(err, IsNil)
+	var keys []string
+	for it.Valid() {
+		keys = append(keys, string(it.Key()))
+		c.Assert(it.Next(), IsNil)
+	}
+	it.Close()
+	c.Assert(keys, DeepEquals, []string{"a", "c", "d"})
+	buf.Cleanup(h)
+}
+
+func (s *testRangeTombstoneSuite) TestApplyRangeTombstones(c *C) {
+	snap := newMemDB()
+	for _, k := range []string{"a", "b", "c", "d"} {
+		c.Assert(snap.Set(Key(k), []byte("snap_"+k)), IsNil)
+	}
+	buf := NewUnionStore(&mockSnapshot{snap}).GetMemBuffer()
+	c.Assert(buf.(RangeDeleter).DeleteRange(Key("b"), Key("d")), IsNil)
+	c.Assert(buf.(RangeDeleter).DeleteRange(Key("d"), nil), IsNil)
+	c.Assert(buf.Set(Key("c"), []byte("buf_c")), IsNil)
+
+	var deleted []KeyRange
+	deleteRange := func(ctx context.Context, start, end Key) error {
+		deleted = append(deleted, KeyRange{StartKey: start, EndKey: end})
+		return nil
+	}
+	c.Assert(ApplyRangeTombstones(context.Background(), buf, deleteRange), IsNil)
+	// Each range is deleted once, the snapshot keys in it don't become point tombstones.
+	c.Assert(deleted, DeepEquals, []KeyRange{{StartKey: Key("b"), EndKey: Key("d")}, {StartKey: Key("d"), EndKey: Key{}}})
+	mutations := make(map[string]string)
+	for it := buf.IterWithFlags(nil, nil); it.Valid(); c.Assert(it.Next(), IsNil) {
+		mutations[string(it.Key())] = string(it.Value())
+	}
+	c.Assert(mutations, DeepEquals, map[string]string{"c": "buf_c"})
+
+	// A transaction without a MemBuffer has no range tombstone and can't delete a range.
+	deleted = nil
+	txn := &mockTxn{}
+	c.Assert(ApplyRangeTombstones(context.Background(), txn.GetMemBuffer(), deleteRange), IsNil)
+	c.Assert(deleted, HasLen, 0)
+	c.Assert(DeleteRange(txn, Key("a"), Key("b")), Equals, ErrNotImplemented)
+}
+
+func (s *testRangeTombstoneSuite) checkIter(c *C, us UnionStore, expect ...string) {
+	it, err := us.Iter(nil, nil)
+	c.Assert(err, IsNil)
+	var keys []string
+	for it.Valid() {
+		keys = append(keys, string(it.Key()))
+		c.Assert(it.Next(), IsNil)
+	}
+	it.Close()
+	c.Assert(keys, DeepEquals, expect)
+
+	it, err = us.IterReverse(nil)
+	c.Assert(err, IsNil)
+	keys = keys[:0]
+	for it.Valid() {
+		keys = append([]string{string(it.Key())}, keys...)
+		c.Assert(it.Next(), IsNil)
+	}
+	it.Close()
+	c.Assert(keys, DeepEquals, expect)
+}
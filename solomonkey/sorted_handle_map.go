@@ -0,0 +1,601 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package MilevaDB
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/memory"
+	"github.com/whtcorpsinc/errors"
+)
+
+// HandleMapValueSize returns the memory usage of a value of SortedHandleMap.
+type HandleMapValueSize func(val interface{}) int64
+
+// HandleMapValueCodec encodes and decodes the values of SortedHandleMap when they are spilled to disk.
+type HandleMapValueCodec interface {
+	EncodeValue(val interface{}) ([]byte, error)
+	DecodeValue(b []byte) (interface{}, error)
+}
+
+const (
+	// sortedHandleEntryOverhead is the estimated memory usage of an entry besides its key and value.
+	sortedHandleEntryOverhead = 96
+	// handleMapRunFilterBitsPerKey and handleMapRunFilterHashes make the bloom filter of
+	// a run have about 1% false positive rate.
+	handleMapRunFilterBitsPerKey = 10
+	handleMapRunFilterHashes     = 7
+
+	handleKindInt byte = iota
+	handleKindCommon
+	handleKindDeleted
+)
+
+type sortedHandleEntry struct {
+	h       Handle
+	val     interface{}
+	deleted bool
+	// size is the memory consumed by the entry.
+	size int64
+}
+
+// SortedHandleMap is a map for Handle like HandleMap, but Range iterates the entries in
+// the order of the encoded handles. Its memory usage is tracked by a memory.Tracker, and
+// when a codec is provided, the entries are spilled to temporary files once the tracker
+// exceeds its quota (see SpillAction).
+//
+// Set and Range can't return errors to keep the same semantics as HandleMap, the error
+// met when spilling or reading the spilled entries is kept and returned by Err.
+type SortedHandleMap struct {
+	memTracker *memory.Tracker
+	codec      HandleMapValueCodec
+	valueSize  HandleMapValueSize
+
+	entries map[string]*sortedHandleEntry
+	// entriesBytes is the memory consumed by entries, consumed is the memory
+	// consumed by the map, including the indexes of the runs.
+	entriesBytes int64
+	consumed     int64
+	// runs are the spilled entries, the later run overrides the earlier runs.
+	runs   []*handleMapRun
+	length int
+
+	spillAction *HandleMapSpillAction
+	err         error
+}
+
+// NewSortedHandleMap creates a SortedHandleMap. The memTracker can be nil. The entries
+// are never spilled if codec is nil. The memory usage of an entry is the size of its key
+// and value, the size of a value is given by valueSize. If valueSize is nil, only the
+// []byte and string values are sized by their lengths.
+func NewSortedHandleMap(memTracker *memory.Tracker, codec HandleMapValueCodec, valueSize HandleMapValueSize) *SortedHandleMap {
+	if valueSize == nil {
+		valueSize = defaultHandleMapValueSize
+	}
+	m := &SortedHandleMap{
+		memTracker: memTracker,
+		codec:      codec,
+		valueSize:  valueSize,
+		entries:    make(map[string]*sortedHandleEntry),
+	}
+	if codec != nil {
+		m.spillAction = &HandleMapSpillAction{m: m}
+	}
+	return m
+}
+
+// SpillAction returns the action to be set to the memory.Tracker to spill the map when
+// the quota is exceeded. It returns nil if the map can't be spilled.
+func (m *SortedHandleMap) SpillAction() *HandleMapSpillAction {
+	return m.spillAction
+}
+
+// Get gets a value by a Handle.
+func (m *SortedHandleMap) Get(h Handle) (v interface{}, ok bool) {
+	key := h.Encoded()
+	if e, exist := m.entries[string(key)]; exist {
+		if e.deleted {
+			return nil, false
+		}
+		return e.val, true
+	}
+	e, err := m.getFromRuns(key)
+	if err != nil {
+		m.setErr(err)
+		return nil, false
+	}
+	if e == nil || e.deleted {
+		return nil, false
+	}
+	return e.val, true
+}
+
+// Set sets a value with a Handle.
+func (m *SortedHandleMap) Set(h Handle, val interface{}) {
+	key := h.Encoded()
+	if e, ok := m.entries[string(key)]; ok {
+		if e.deleted {
+			m.length++
+		}
+		e.h, e.val, e.deleted = h, val, false
+		m.resizeEntry(key, e)
+		return
+	}
+	if !m.existsInRuns(key) {
+		m.length++
+	}
+	m.addEntry(key, &sortedHandleEntry{h: h, val: val})
+}
+
+// Delete deletes a entry from the map.
+func (m *SortedHandleMap) Delete(h Handle) {
+	key := h.Encoded()
+	if e, ok := m.entries[string(key)]; ok {
+		if !e.deleted {
+			m.length--
+			e.val, e.deleted = nil, true
+		}
+		if len(m.runs) == 0 {
+			// There are no spilled entries to be shadowed.
+			delete(m.entries, string(key))
+			m.entriesBytes -= e.size
+			m.consume(-e.size)
+			return
+		}
+		m.resizeEntry(key, e)
+		return
+	}
+	if m.existsInRuns(key) {
+		m.length--
+		m.addEntry(key, &sortedHandleEntry{h: h, deleted: true})
+	}
+}
+
+// Len returns the length of the map.
+func (m *SortedHandleMap) Len() int {
+	return m.length
+}
+
+// Range iterates the SortedHandleMap in the order of the encoded handles with fn,
+// the fn returns true to continue, returns false to stop.
+func (m *SortedHandleMap) Range(fn func(h Handle, val interface{}) bool) {
+	keys := make([]string, 0, len(m.entries))
+	for key := range m.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	readers := make([]*handleMapRunReader, 0, len(m.runs))
+	for i := len(m.runs) - 1; i >= 0; i-- {
+		r, err := m.runs[i].newReader(m.codec)
+		if err != nil {
+			m.setErr(err)
+			return
+		}
+		readers = append(readers, r)
+	}
+
+	for {
+		// The entries in memory have the highest priority, then the later runs.
+		var (
+			minKey []byte
+			winner *sortedHandleEntry
+		)
+		if len(keys) > 0 {
+			minKey = []byte(keys[0])
+			winner = m.entries[keys[0]]
+		}
+		for _, r := range readers {
+			if r.cur != nil && (minKey == nil || bytes.Compare(r.curKey, minKey) < 0) {
+				minKey, winner = r.curKey, r.cur
+			}
+		}
+		if winner == nil {
+			return
+		}
+		if len(keys) > 0 && keys[0] == string(minKey) {
+			keys = keys[1:]
+		}
+		for _, r := range readers {
+			if r.cur != nil && bytes.Equal(r.curKey, minKey) {
+				if err := r.next(); err != nil {
+					m.setErr(err)
+					return
+				}
+			}
+		}
+		if !winner.deleted && !fn(winner.h, winner.val) {
+			return
+		}
+	}
+}
+
+// Err returns the first error met when spilling or reading the spilled entries.
+func (m *SortedHandleMap) Err() error {
+	return m.err
+}
+
+// Close releases the memory and removes the spilled files.
+func (m *SortedHandleMap) Close() error {
+	m.consume(-m.consumed)
+	m.entries = make(map[string]*sortedHandleEntry)
+	m.entriesBytes = 0
+	var firstErr error
+	for _, r := range m.runs {
+		if err := r.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	m.runs = nil
+	m.length = 0
+	return firstErr
+}
+
+func (m *SortedHandleMap) addEntry(key []byte, e *sortedHandleEntry) {
+	m.entries[string(key)] = e
+	e.size = m.entryBytes(key, e)
+	m.entriesBytes += e.size
+	m.consume(e.size)
+	m.spillIfNeeded()
+}
+
+// resizeEntry updates the memory consumed by the entry e after its value is changed.
+func (m *SortedHandleMap) resizeEntry(key []byte, e *sortedHandleEntry) {
+	size := m.entryBytes(key, e)
+	delta := size - e.size
+	e.size = size
+	m.entriesBytes += delta
+	m.consume(delta)
+	m.spillIfNeeded()
+}
+
+func (m *SortedHandleMap) spillIfNeeded() {
+	if m.spillAction != nil && m.spillAction.needSpill() {
+		if err := m.spill(); err != nil {
+			m.setErr(err)
+		}
+		m.spillAction.reset()
+	}
+}
+
+// entryBytes returns the memory usage of the entry e, the key is held by both the map
+// and the handle of e.
+func (m *SortedHandleMap) entryBytes(key []byte, e *sortedHandleEntry) int64 {
+	size := int64(2*len(key) + sortedHandleEntryOverhead)
+	if !e.deleted {
+		size += m.valueSize(e.val)
+	}
+	return size
+}
+
+func defaultHandleMapValueSize(val interface{}) int64 {
+	switch v := val.(type) {
+	case []byte:
+		return int64(len(v))
+	case string:
+		return int64(len(v))
+	}
+	return 0
+}
+
+func (m *SortedHandleMap) consume(bytes int64) {
+	if bytes == 0 {
+		return
+	}
+	m.consumed += bytes
+	if m.memTracker != nil {
+		m.memTracker.Consume(bytes)
+	}
+}
+
+func (m *SortedHandleMap) setErr(err error) {
+	if m.err == nil {
+		m.err = err
+	}
+}
+
+func (m *SortedHandleMap) existsInRuns(key []byte) bool {
+	e, err := m.getFromRuns(key)
+	if err != nil {
+		m.setErr(err)
+		return false
+	}
+	return e != nil && !e.deleted
+}
+
+func (m *SortedHandleMap) getFromRuns(key []byte) (*sortedHandleEntry, error) {
+	for i := len(m.runs) - 1; i >= 0; i-- {
+		e, err := m.runs[i].get(key, m.codec)
+		if err != nil || e != nil {
+			return e, err
+		}
+	}
+	return nil, nil
+}
+
+// spill writes the entries in memory to a new run in the order of the keys.
+func (m *SortedHandleMap) spill() error {
+	if len(m.entries) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m.entries))
+	for key := range m.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	f, err := ioutil.TempFile("", "milevadb-handle-map")
+	if err != nil {
+		return errors.Trace(err)
+	}
+	run := &handleMapRun{f: f, offsets: make([]int64, 0, len(keys)), filter: newHandleMapRunFilter(len(keys))}
+	w := bufio.NewWriter(f)
+	var offset int64
+	for _, key := range keys {
+		run.offsets = append(run.offsets, offset)
+		run.filter.add([]byte(key))
+		n, err := writeHandleMapRecord(w, []byte(key), m.entries[key], m.codec)
+		if err != nil {
+			run.close()
+			return err
+		}
+		offset += n
+	}
+	if err = w.Flush(); err != nil {
+		run.close()
+		return errors.Trace(err)
+	}
+	run.size = offset
+	m.runs = append(m.runs, run)
+	m.consume(int64(len(run.offsets)*8+len(run.filter)*8) - m.entriesBytes)
+	m.entries = make(map[string]*sortedHandleEntry)
+	m.entriesBytes = 0
+	return nil
+}
+
+// handleMapRun is a file of entries sorted by keys, each record is
+// | kind (1 byte) | key length (uvarint) | key | value length (uvarint) | value |.
+type handleMapRun struct {
+	f       *os.File
+	size    int64
+	offsets []int64
+	// filter tells most of the keys which are not in the run without reading the file.
+	filter handleMapRunFilter
+}
+
+func writeHandleMapRecord(w *bufio.Writer, key []byte, e *sortedHandleEntry, valueCodec HandleMapValueCodec) (int64, error) {
+	kind := handleKindCommon
+	var val []byte
+	switch {
+	case e.deleted:
+		kind = handleKindDeleted
+	case e.h.IsInt():
+		kind = handleKindInt
+	}
+	if !e.deleted {
+		var err error
+		if val, err = valueCodec.EncodeValue(e.val); err != nil {
+			return 0, errors.Trace(err)
+		}
+	}
+	buf := make([]byte, 0, 1+2*binary.MaxVarintLen64+len(key)+len(val))
+	buf = append(buf, kind)
+	buf = codec.EncodeUvarint(buf, uint64(len(key)))
+	buf = append(buf, key...)
+	buf = codec.EncodeUvarint(buf, uint64(len(val)))
+	buf = append(buf, val...)
+	_, err := w.Write(buf)
+	return int64(len(buf)), errors.Trace(err)
+}
+
+func readHandleMapRecord(r *bufio.Reader, valueCodec HandleMapValueCodec, decodeValue bool) ([]byte, *sortedHandleEntry, error) {
+	kind, err := r.ReadByte()
+	if err != nil {
+		return nil, nil, err
+	}
+	readBytes := func() ([]byte, error) {
+		l, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, l)
+		_, err = io.ReadFull(r, b)
+		return b, err
+	}
+	key, err := readBytes()
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	val, err := readBytes()
+	if err != nil {
+		return nil, nil, errors.Trace(err)
+	}
+	e := &sortedHandleEntry{}
+	switch kind {
+	case handleKindDeleted:
+		e.deleted = true
+		return key, e, nil
+	case handleKindInt:
+		_, v, err := codec.DecodeInt(key)
+		if err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+		e.h = IntHandle(v)
+	default:
+		if e.h, err = NewCommonHandle(key); err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+	}
+	if decodeValue {
+		if e.val, err = valueCodec.DecodeValue(val); err != nil {
+			return nil, nil, errors.Trace(err)
+		}
+	}
+	return key, e, nil
+}
+
+func (r *handleMapRun) readAt(i int, valueCodec HandleMapValueCodec, decodeValue bool) ([]byte, *sortedHandleEntry, error) {
+	off := r.offsets[i]
+	br := bufio.NewReader(io.NewSectionReader(r.f, off, r.size-off))
+	return readHandleMapRecord(br, valueCodec, decodeValue)
+}
+
+func (r *handleMapRun) get(key []byte, valueCodec HandleMapValueCodec) (*sortedHandleEntry, error) {
+	if !r.filter.mayContain(key) {
+		return nil, nil
+	}
+	var err error
+	i := sort.Search(len(r.offsets), func(i int) bool {
+		if err != nil {
+			return true
+		}
+		var k []byte
+		k, _, err = r.readAt(i, valueCodec, false)
+		return bytes.Compare(k, key) >= 0
+	})
+	if err != nil || i == len(r.offsets) {
+		return nil, err
+	}
+	k, e, err := r.readAt(i, valueCodec, true)
+	if err != nil || !bytes.Equal(k, key) {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (r *handleMapRun) close() error {
+	name := r.f.Name()
+	err := r.f.Close()
+	if rmErr := os.Remove(name); err == nil {
+		err = rmErr
+	}
+	return errors.Trace(err)
+}
+
+// handleMapRunFilter is a bloom filter of the keys of a run.
+type handleMapRunFilter []uint64
+
+func newHandleMapRunFilter(keys int) handleMapRunFilter {
+	bits := keys * handleMapRunFilterBitsPerKey
+	return make(handleMapRunFilter, bits/64+1)
+}
+
+func handleMapRunFilterHash(key []byte) (uint32, uint32) {
+	h := fnv.New64a()
+	h.Write(key)
+	sum := h.Sum64()
+	return uint32(sum), uint32(sum >> 32)
+}
+
+func (f handleMapRunFilter) add(key []byte) {
+	h1, h2 := handleMapRunFilterHash(key)
+	bits := uint32(len(f) * 64)
+	for i := uint32(0); i < handleMapRunFilterHashes; i++ {
+		bit := (h1 + i*h2) % bits
+		f[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f handleMapRunFilter) mayContain(key []byte) bool {
+	h1, h2 := handleMapRunFilterHash(key)
+	bits := uint32(len(f) * 64)
+	for i := uint32(0); i < handleMapRunFilterHashes; i++ {
+		bit := (h1 + i*h2) % bits
+		if f[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+type handleMapRunReader struct {
+	r          *bufio.Reader
+	valueCodec HandleMapValueCodec
+	curKey     []byte
+	cur        *sortedHandleEntry
+}
+
+func (r *handleMapRun) newReader(valueCodec HandleMapValueCodec) (*handleMapRunReader, error) {
+	rd := &handleMapRunReader{
+		r:          bufio.NewReader(io.NewSectionReader(r.f, 0, r.size)),
+		valueCodec: valueCodec,
+	}
+	return rd, rd.next()
+}
+
+func (rd *handleMapRunReader) next() error {
+	key, e, err := readHandleMapRecord(rd.r, rd.valueCodec, true)
+	if err == io.EOF {
+		rd.curKey, rd.cur = nil, nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	rd.curKey, rd.cur = key, e
+	return nil
+}
+
+// HandleMapSpillAction is the memory.ActionOnExceed which makes a SortedHandleMap spill
+// its entries to disk. The spilling is done by the next write of the map, because the
+// action is called inside the memory.Tracker.
+type HandleMapSpillAction struct {
+	m        *SortedHandleMap
+	spilling uint32
+	mu       struct {
+		sync.Mutex
+		fallback memory.ActionOnExceed
+	}
+}
+
+// Action implements the memory.ActionOnExceed interface.
+func (a *HandleMapSpillAction) Action(t *memory.Tracker) {
+	if atomic.CompareAndSwapUint32(&a.spilling, 0, 1) {
+		return
+	}
+	a.mu.Lock()
+	fallback := a.mu.fallback
+	a.mu.Unlock()
+	if fallback != nil {
+		fallback.Action(t)
+	}
+}
+
+// SetFallback implements the memory.ActionOnExceed interface.
+func (a *HandleMapSpillAction) SetFallback(fallback memory.ActionOnExceed) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.mu.fallback = fallback
+}
+
+// SetLogHook implements the memory.ActionOnExceed interface.
+func (a *HandleMapSpillAction) SetLogHook(hook func(uint64)) {}
+
+func (a *HandleMapSpillAction) needSpill() bool {
+	return atomic.LoadUint32(&a.spilling) == 1
+}
+
+func (a *HandleMapSpillAction) reset() {
+	atomic.StoreUint32(&a.spilling, 0)
+}
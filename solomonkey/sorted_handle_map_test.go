@@ -0,0 +1,171 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package MilevaDB
+
+import (
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/codec"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/memory"
+	"github.com/whtcorpsinc/MilevaDB-Prod/soliton/stringutil"
+	. "github.com/whtcorpsinc/check"
+)
+
+var _ = Suite(&testSortedHandleMapSuite{})
+
+type testSortedHandleMapSuite struct {
+}
+
+type intValueCodec struct{}
+
+func (intValueCodec) EncodeValue(val interface{}) ([]byte, error) {
+	return codec.EncodeInt(nil, int64(val.(int))), nil
+}
+
+func (intValueCodec) DecodeValue(b []byte) (interface{}, error) {
+	_, v, err := codec.DecodeInt(b)
+	return int(v), err
+}
+
+func (s *testSortedHandleMapSuite) TestSortedHandleMap(c *C) {
+	m := NewSortedHandleMap(nil, intValueCodec{}, nil)
+	defer func() {
+		c.Assert(m.Close(), IsNil)
+	}()
+	for _, i := range []int{5, -3, 9, 1} {
+		m.Set(IntHandle(i), i)
+	}
+	// Spill the entries by the next write.
+	m.SpillAction().Action(nil)
+	m.Set(IntHandle(7), 7)
+	c.Assert(m.runs, HasLen, 1)
+	c.Assert(m.entries, HasLen, 0)
+
+	m.Set(IntHandle(9), 90)
+	m.Delete(IntHandle(1))
+	m.Set(IntHandle(3), 3)
+	c.Assert(m.Len(), Equals, 5)
+	v, ok := m.Get(IntHandle(9))
+	c.Assert(ok, IsTrue)
+	c.Assert(v, Equals, 90)
+	_, ok = m.Get(IntHandle(1))
+	c.Assert(ok, IsFalse)
+	v, ok = m.Get(IntHandle(-3))
+	c.Assert(ok, IsTrue)
+	c.Assert(v, Equals, -3)
+
+	m.SpillAction().Action(nil)
+	m.Set(IntHandle(2), 2)
+	c.Assert(m.runs, HasLen, 2)
+
+	var handles []int64
+	var vals []int
+	m.Range(func(h Handle, val interface{}) bool {
+		handles = append(handles, h.IntValue())
+		vals = append(vals, val.(int))
+		return true
+	})
+	c.Assert(m.Err(), IsNil)
+	c.Assert(handles, DeepEquals, []int64{-3, 2, 3, 5, 7, 9})
+	c.Assert(vals, DeepEquals, []int{-3, 2, 3, 5, 7, 90})
+	c.Assert(m.Len(), Equals, 6)
+
+	// Range stops when fn returns false.
+	cnt := 0
+	m.Range(func(h Handle, val interface{}) bool {
+		cnt++
+		return cnt < 2
+	})
+	c.Assert(cnt, Equals, 2)
+}
+
+type bytesValueCodec struct{}
+
+func (bytesValueCodec) EncodeValue(val interface{}) ([]byte, error) {
+	return val.([]byte), nil
+}
+
+func (bytesValueCodec) DecodeValue(b []byte) (interface{}, error) {
+	return b, nil
+}
+
+func (s *testSortedHandleMapSuite) TestSortedHandleMapCommonHandle(c *C) {
+	m := NewSortedHandleMap(nil, bytesValueCodec{}, nil)
+	defer func() {
+		c.Assert(m.Close(), IsNil)
+	}()
+	m.Set(mustNewCommonHandle(c, "b", 2), []byte("b2"))
+	m.Set(mustNewCommonHandle(c, "a", 10), []byte("a10"))
+	m.SpillAction().Action(nil)
+	m.Set(mustNewCommonHandle(c, "a", 2), []byte("a2"))
+	c.Assert(m.runs, HasLen, 1)
+	m.Set(mustNewCommonHandle(c, "b", 2), []byte("b2'"))
+	c.Assert(m.Len(), Equals, 3)
+
+	v, ok := m.Get(mustNewCommonHandle(c, "b", 2))
+	c.Assert(ok, IsTrue)
+	c.Assert(v, BytesEquals, []byte("b2'"))
+	v, ok = m.Get(mustNewCommonHandle(c, "a", 10))
+	c.Assert(ok, IsTrue)
+	c.Assert(v, BytesEquals, []byte("a10"))
+	_, ok = m.Get(mustNewCommonHandle(c, "a", 1))
+	c.Assert(ok, IsFalse)
+
+	var handles []string
+	m.Range(func(h Handle, val interface{}) bool {
+		c.Assert(h.IsInt(), IsFalse)
+		handles = append(handles, h.String())
+		return true
+	})
+	c.Assert(m.Err(), IsNil)
+	c.Assert(handles, DeepEquals, []string{
+		mustNewCommonHandle(c, "a", 2).String(),
+		mustNewCommonHandle(c, "a", 10).String(),
+		mustNewCommonHandle(c, "b", 2).String(),
+	})
+}
+
+func (s *testSortedHandleMapSuite) TestSortedHandleMapSpillByTracker(c *C) {
+	tracker := memory.NewTracker(stringutil.StringerStr("sorted handle map"), 4096)
+	m := NewSortedHandleMap(tracker, bytesValueCodec{}, nil)
+	defer func() {
+		c.Assert(m.Close(), IsNil)
+		c.Assert(tracker.BytesConsumed(), Equals, int64(0))
+	}()
+	tracker.SetActionOnExceed(m.SpillAction())
+
+	// The value is counted, a few entries with large values exceed the quota.
+	val := make([]byte, 1024)
+	for i := 0; i < 3; i++ {
+		m.Set(IntHandle(i), val)
+	}
+	c.Assert(m.runs, HasLen, 0)
+	c.Assert(tracker.BytesConsumed() > int64(3*len(val)), IsTrue)
+	m.Set(IntHandle(3), val)
+	c.Assert(m.runs, HasLen, 1)
+	c.Assert(m.entries, HasLen, 0)
+	c.Assert(tracker.BytesConsumed() < int64(len(val)), IsTrue)
+
+	// Replacing a value with a larger one is counted as well.
+	m.Set(IntHandle(4), []byte("v"))
+	m.Set(IntHandle(4), make([]byte, 4096))
+	c.Assert(m.runs, HasLen, 2)
+	c.Assert(m.Len(), Equals, 5)
+	cnt := 0
+	m.Range(func(h Handle, val interface{}) bool {
+		c.Assert(h.IntValue(), Equals, int64(cnt))
+		cnt++
+		return true
+	})
+	c.Assert(m.Err(), IsNil)
+	c.Assert(cnt, Equals, 5)
+}
@@ -0,0 +1,54 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package MilevaDB
+
+import (
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/oracle"
+)
+
+// StaleReadOption is the value of the StaleRead option of a Snapshot. A stale read is
+// served by the nearest replica whose safe ts covers the read ts, and it fails fast on
+// locks instead of resolving them.
+type StaleReadOption struct {
+	// ReadTS is the exact ts to read at.
+	ReadTS uint64
+	// MaxStaleness reads at the newest ts the replica can serve, which must not be older
+	// than MaxStaleness. It takes precedence over ReadTS if it's set.
+	MaxStaleness time.Duration
+}
+
+// ResolveTS returns the ts of the stale read. The safeTS is the safe ts of the replica
+// serving the read, an exact read after it or a max-staleness read older than the max
+// staleness is rejected.
+func (o StaleReadOption) ResolveTS(now time.Time, safeTS, gcSafePoint uint64) (uint64, error) {
+	ts := o.ReadTS
+	switch {
+	case o.MaxStaleness > 0:
+		oldest := oracle.ComposeTS(oracle.GetPhysical(now.Add(-o.MaxStaleness)), 0)
+		if safeTS < oldest {
+			return 0, ErrStaleReadUnavailable.GenWithStackByArgs(o.MaxStaleness, oracle.GetTimeFromTS(safeTS))
+		}
+		ts = safeTS
+	case ts == 0:
+		return 0, ErrInvalidStaleRead.GenWithStackByArgs()
+	case ts > safeTS:
+		return 0, ErrStaleReadTSTooNew.GenWithStackByArgs(oracle.GetTimeFromTS(ts), oracle.GetTimeFromTS(safeTS))
+	}
+	if ts < gcSafePoint {
+		return 0, ErrGCTooEarly.GenWithStackByArgs(oracle.GetTimeFromTS(ts), oracle.GetTimeFromTS(gcSafePoint))
+	}
+	return ts, nil
+}
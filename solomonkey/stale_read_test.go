@@ -0,0 +1,56 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package MilevaDB
+
+import (
+	"time"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetstore/einsteindb/oracle"
+	. "github.com/whtcorpsinc/check"
+)
+
+type testStaleReadSuite struct{}
+
+var _ = Suite(testStaleReadSuite{})
+
+func (s testStaleReadSuite) TestResolveTS(c *C) {
+	now := time.Now()
+	tsOf := func(t time.Time) uint64 {
+		return oracle.ComposeTS(oracle.GetPhysical(t), 0)
+	}
+	gcSafePoint := tsOf(now.Add(-10 * time.Minute))
+
+	exact := StaleReadOption{ReadTS: tsOf(now.Add(-time.Minute))}
+	ts, err := exact.ResolveTS(now, exact.ReadTS, gcSafePoint)
+	c.Assert(err, IsNil)
+	c.Assert(ts, Equals, exact.ReadTS)
+	_, err = exact.ResolveTS(now, exact.ReadTS-1, gcSafePoint)
+	c.Assert(ErrStaleReadTSTooNew.Equal(err), IsTrue)
+	c.Assert(ErrStaleReadUnavailable.Equal(err), IsFalse)
+	exact.ReadTS = tsOf(now.Add(-time.Hour))
+	_, err = exact.ResolveTS(now, tsOf(now), gcSafePoint)
+	c.Assert(ErrGCTooEarly.Equal(err), IsTrue)
+	_, err = StaleReadOption{}.ResolveTS(now, tsOf(now), gcSafePoint)
+	c.Assert(ErrInvalidStaleRead.Equal(err), IsTrue)
+	c.Assert(ErrInvalidTxn.Equal(err), IsFalse)
+
+	bounded := StaleReadOption{ReadTS: exact.ReadTS, MaxStaleness: 5 * time.Minute}
+	safeTS := tsOf(now.Add(-time.Second))
+	ts, err = bounded.ResolveTS(now, safeTS, gcSafePoint)
+	c.Assert(err, IsNil)
+	c.Assert(ts, Equals, safeTS)
+	_, err = bounded.ResolveTS(now, tsOf(now.Add(-6*time.Minute)), gcSafePoint)
+	c.Assert(ErrStaleReadUnavailable.Equal(err), IsTrue)
+	c.Assert(ErrStaleReadTSTooNew.Equal(err), IsFalse)
+}
@@ -33,6 +33,13 @@ type UnionIter struct {
 
 // NewUnionIter returns a union iterator for BufferStore.
 func NewUnionIter(dirtyIt Iterator, snapshotIt Iterator, reverse bool) (*UnionIter, error) {
+	// The snapshot iterator of MemBuffer hides the causetstore keys deleted by its range tombstones.
+	if rt, ok := dirtyIt.(interface{ snapshotRangeTombstones() []KeyRange }); ok {
+		var err error
+		if snapshotIt, err = newRangeTombstoneIter(snapshotIt, rt.snapshotRangeTombstones()); err != nil {
+			return nil, err
+		}
+	}
 	it := &UnionIter{
 		dirtyIt:       dirtyIt,
 		snapshotIt:    snapshotIt,
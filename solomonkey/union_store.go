@@ -95,6 +95,9 @@ func (us *unionStore) GetMemBuffer() MemBuffer {
 func (us *unionStore) Get(ctx context.Context, k Key) ([]byte, error) {
 	v, err := us.memBuffer.Get(ctx, k)
 	if IsErrNotFound(err) {
+		if us.memBuffer.isRangeDeleted(k) {
+			return nil, ErrNotExist
+		}
 		v, err = us.snapshot.Get(ctx, k)
 	}
 	if err != nil {
@@ -116,6 +119,10 @@ func (us *unionStore) Iter(k Key, upperBound Key) (Iterator, error) {
 	if err != nil {
 		return nil, err
 	}
+	retrieverIt, err = newRangeTombstoneIter(retrieverIt, us.memBuffer.rangeTombstones)
+	if err != nil {
+		return nil, err
+	}
 	return NewUnionIter(bufferIt, retrieverIt, false)
 }
 
@@ -129,6 +136,10 @@ func (us *unionStore) IterReverse(k Key) (Iterator, error) {
 	if err != nil {
 		return nil, err
 	}
+	retrieverIt, err = newRangeTombstoneIter(retrieverIt, us.memBuffer.rangeTombstones)
+	if err != nil {
+		return nil, err
+	}
 	return NewUnionIter(bufferIt, retrieverIt, true)
 }
 
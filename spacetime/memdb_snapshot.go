@@ -17,8 +17,9 @@ import "context"
 
 func (EDB *memdb) SnapshotGetter() Getter {
 	return &memdbSnapGetter{
-		EDB: EDB,
-		cp:  EDB.getSnapshot(),
+		EDB:             EDB,
+		cp:              EDB.getSnapshot(),
+		rangeTombstones: EDB.snapshotRangeTombstones(),
 	}
 }
 
@@ -29,12 +30,22 @@ func (EDB *memdb) SnapshotIter(start, end Key) Iterator {
 			start: start,
 			end:   end,
 		},
-		cp: EDB.getSnapshot(),
+		cp:              EDB.getSnapshot(),
+		rangeTombstones: EDB.snapshotRangeTombstones(),
 	}
 	it.init()
 	return it
 }
 
+// snapshotRangeTombstones returns the range tombstones recorded before the snapshot.
+func (EDB *memdb) snapshotRangeTombstones() []KeyRange {
+	n := len(EDB.rangeTombstones)
+	if len(EDB.stages) > 0 {
+		n = EDB.rangeTombstoneStages[0]
+	}
+	return EDB.rangeTombstones[:n:n]
+}
+
 func (EDB *memdb) getSnapshot() memdbCheckpoint {
 	if len(EDB.stages) > 0 {
 		return EDB.stages[0]
@@ -43,11 +54,21 @@ func (EDB *memdb) getSnapshot() memdbCheckpoint {
 }
 
 type memdbSnapGetter struct {
-	EDB *memdb
-	cp  memdbCheckpoint
+	EDB             *memdb
+	cp              memdbCheckpoint
+	rangeTombstones []KeyRange
 }
 
 func (snap *memdbSnapGetter) Get(_ context.Context, key Key) ([]byte, error) {
+	v, err := snap.get(key)
+	if IsErrNotFound(err) && keyInRanges(snap.rangeTombstones, key) {
+		// The key is deleted by a range tombstone, act as a deleted key.
+		return tombstone, nil
+	}
+	return v, err
+}
+
+func (snap *memdbSnapGetter) get(key Key) ([]byte, error) {
 	x := snap.EDB.traverse(key, false)
 	if x.isNull() {
 		return nil, ErrNotExist
@@ -67,6 +88,12 @@ type memdbSnapIter struct {
 	*memdbIterator
 	value []byte
 	cp    memdbCheckpoint
+	// rangeTombstones are applied to the causetstore iterator merged with it by NewUnionIter.
+	rangeTombstones []KeyRange
+}
+
+func (i *memdbSnapIter) snapshotRangeTombstones() []KeyRange {
+	return i.rangeTombstones
 }
 
 func (i *memdbSnapIter) Value() []byte {
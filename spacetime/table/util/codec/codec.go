@@ -24,6 +24,7 @@ import (
 	"io"
 	"time"
 
+	"github.com/cznic/mathutil"
 	"github.com/whtcorpsinc/errors"
 	"github.com/whtcorpsinc/BerolinaSQL/mysql"
 	"github.com/whtcorpsinc/BerolinaSQL/terror"
@@ -144,6 +145,7 @@ func encode(sc *stmtctx.StatementContext, b []byte, vals []types.CausetObjectQL,
 }
 
 // EstimateValueSize uses to estimate the value  size of the encoded values.
+// The JSON values, enums and sets get the larger size of EncodeValue and EncodeComparableKey.
 func EstimateValueSize(sc *stmtctx.StatementContext, val types.CausetObjectQL) (int, error) {
 	l := 0
 	switch val.Kind() {
@@ -158,15 +160,15 @@ func EstimateValueSize(sc *stmtctx.StatementContext, val types.CausetObjectQL) (
 	case types.KindMysqlDecimal:
 		l = valueSizeOfDecimal(val.GetMysqlDecimal(), val.Length(), val.Frac()) + 1
 	case types.KindMysqlEnum:
-		l = valueSizeOfUnsignedInt(uint64(val.GetMysqlEnum().ToNumber()))
+		l = mathutil.Max(valueSizeOfUnsignedInt(uint64(val.GetMysqlEnum().ToNumber())), comparableSizeOfName(val.GetMysqlEnum().Name))
 	case types.KindMysqlSet:
-		l = valueSizeOfUnsignedInt(uint64(val.GetMysqlSet().ToNumber()))
+		l = mathutil.Max(valueSizeOfUnsignedInt(uint64(val.GetMysqlSet().ToNumber())), comparableSizeOfName(val.GetMysqlSet().Name))
 	case types.KindMysqlBit, types.KindBinaryLiteral:
 		val, err := val.GetBinaryLiteral().ToInt(sc)
 		terror.Log(errors.Trace(err))
 		l = valueSizeOfUnsignedInt(val)
 	case types.KindMysqlJSON:
-		l = 2 + len(val.GetMysqlJSON().Value)
+		l = mathutil.Max(2+len(val.GetMysqlJSON().Value), comparableSizeOfJSON(val.GetMysqlJSON()))
 	case types.KindNull, types.KindMinNotNull, types.KindMaxValue:
 		l = 1
 	default:
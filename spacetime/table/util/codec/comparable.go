@@ -0,0 +1,316 @@
+// WHTCORPS INC INTERLOCKYRIGHT 2020 ALL RIGHTS RESERVED
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec
+
+import (
+	"math"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetnetctx/stmtctx"
+	"github.com/whtcorpsinc/MilevaDB-Prod/types"
+	"github.com/whtcorpsinc/MilevaDB-Prod/types/json"
+	"github.com/whtcorpsinc/MilevaDB-Prod/util/collate"
+	"github.com/whtcorpsinc/errors"
+)
+
+// The flags only written by EncodeComparableKey.
+const (
+	comparableJSONFlag byte = 11
+	enumNameFlag       byte = 12
+	setNameFlag        byte = 13
+)
+
+// The precedences of the JSON types in the comparable JSON encoding, they follow the
+// order of the JSON comparison, see https://dev.mysql.com/doc/refman/5.7/en/json.html.
+// Objects and opaque values are not comparable, such JSON values are encoded by jsonFlag.
+const (
+	jsonArrayEnd         byte = 0x00
+	jsonNullPrecedence   byte = 0x01
+	jsonNumberPrecedence byte = 0x02
+	jsonStringPrecedence byte = 0x03
+	jsonArrayPrecedence  byte = 0x05
+	jsonBoolPrecedence   byte = 0x06
+)
+
+// EncodeComparableKey is like EncodeKey, but the JSON scalars and arrays, the enums and
+// the sets are encoded so that the encoded bytes compare the way ALLEGROALLEGROSQL compares
+// the values: JSON values by the JSON comparison rules, enums and sets by their names in
+// their collations. The two encodings can't be mixed in one index, so an index must choose
+// one of them when it is created. The values encoded by EncodeKey are still readable.
+func EncodeComparableKey(sc *stmtctx.StatementContext, b []byte, vals ...types.CausetObjectQL) (_ []byte, err error) {
+	for i := range vals {
+		switch vals[i].Kind() {
+		case types.KindMysqlJSON:
+			b = encodeComparableJSON(b, vals[i].GetMysqlJSON())
+		case types.KindMysqlEnum:
+			enum := vals[i].GetMysqlEnum()
+			b = encodeNamedKey(b, enumNameFlag, enum.Name, enum.Value, vals[i].Collation())
+		case types.KindMysqlSet:
+			set := vals[i].GetMysqlSet()
+			b = encodeNamedKey(b, setNameFlag, set.Name, set.Value, vals[i].Collation())
+		default:
+			if b, err = encode(sc, b, vals[i:i+1], true); err != nil {
+				return b, errors.Trace(err)
+			}
+		}
+	}
+	return b, nil
+}
+
+// encodeNamedKey encodes the collation key of the name followed by the number, the
+// number makes the value decodable because the collation key is not reversible.
+func encodeNamedKey(b []byte, flag byte, name string, value uint64, collation string) []byte {
+	b = append(b, flag)
+	if collate.NewCollationEnabled() {
+		b = EncodeBytes(b, collate.GetCollator(collation).Key(name))
+	} else {
+		b = EncodeBytes(b, []byte(name))
+	}
+	return EncodeUint(b, value)
+}
+
+func encodeComparableJSON(b []byte, j json.BinaryJSON) []byte {
+	if !isComparableJSON(j) {
+		b = append(b, jsonFlag, j.TypeCode)
+		return append(b, j.Value...)
+	}
+	b = append(b, comparableJSONFlag)
+	return encodeJSONElem(b, j)
+}
+
+func isComparableJSON(j json.BinaryJSON) bool {
+	switch j.TypeCode {
+	case json.TypeCodeLiteral, json.TypeCodeInt64, json.TypeCodeUint64, json.TypeCodeFloat64, json.TypeCodeString:
+		return true
+	case json.TypeCodeArray:
+		for i := 0; i < j.GetElemCount(); i++ {
+			if !isComparableJSON(j.ArrayGetElem(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func encodeJSONElem(b []byte, j json.BinaryJSON) []byte {
+	switch j.TypeCode {
+	case json.TypeCodeLiteral:
+		switch j.Value[0] {
+		case json.LiteralNil:
+			b = append(b, jsonNullPrecedence)
+		case json.LiteralTrue:
+			b = append(b, jsonBoolPrecedence, 1)
+		default:
+			b = append(b, jsonBoolPrecedence, 0)
+		}
+	case json.TypeCodeInt64:
+		b = append(b, jsonNumberPrecedence)
+		b = encodeJSONNumber(b, float64(j.GetInt64()), int64Delta(j.GetInt64()))
+	case json.TypeCodeUint64:
+		b = append(b, jsonNumberPrecedence)
+		b = encodeJSONNumber(b, float64(j.GetUint64()), uint64Delta(j.GetUint64()))
+	case json.TypeCodeFloat64:
+		b = append(b, jsonNumberPrecedence)
+		b = encodeJSONNumber(b, j.GetFloat64(), 0)
+	case json.TypeCodeString:
+		b = append(b, jsonStringPrecedence)
+		b = EncodeBytes(b, j.GetString())
+	case json.TypeCodeArray:
+		b = append(b, jsonArrayPrecedence)
+		for i := 0; i < j.GetElemCount(); i++ {
+			b = encodeJSONElem(b, j.ArrayGetElem(i))
+		}
+		b = append(b, jsonArrayEnd)
+	}
+	return b
+}
+
+// A JSON number is encoded by its value only, so the equal numbers of different types
+// get the same key, JSON 1 and 1.0 for example. The value is the float64 nearest to it
+// plus the integer delta from the float64 to the exact value, the delta keeps the
+// integers which can't be represented by a float64 apart and ordered.
+func encodeJSONNumber(b []byte, f float64, delta int64) []byte {
+	b = EncodeFloat(b, f)
+	return EncodeInt(b, delta)
+}
+
+const (
+	twoPow63 = float64(1 << 63)
+	twoPow64 = twoPow63 * 2
+)
+
+// int64Delta returns v - float64(v) as an integer.
+func int64Delta(v int64) int64 {
+	f := float64(v)
+	if f >= twoPow63 {
+		// v is rounded up to 2^63, which is out of the range of int64.
+		return v - math.MaxInt64 - 1
+	}
+	return v - int64(f)
+}
+
+// uint64Delta returns v - float64(v) as an integer.
+func uint64Delta(v uint64) int64 {
+	f := float64(v)
+	if f >= twoPow64 {
+		// v is rounded up to 2^64, which is out of the range of uint64.
+		return -int64(math.MaxUint64-v) - 1
+	}
+	u := uint64(f)
+	if v >= u {
+		return int64(v - u)
+	}
+	return -int64(u - v)
+}
+
+// decodeJSONNumber decodes a number written by encodeJSONNumber. The integral values in
+// the range of int64 are decoded as int64, the ones beyond it as uint64, the others as
+// float64.
+func decodeJSONNumber(b []byte) ([]byte, interface{}, error) {
+	b, f, err := DecodeFloat(b)
+	if err != nil {
+		return b, nil, err
+	}
+	var delta int64
+	if b, delta, err = DecodeInt(b); err != nil {
+		return b, nil, err
+	}
+	if f != math.Trunc(f) || f < -twoPow63 || f > twoPow64 || (f == twoPow64 && delta >= 0) {
+		return b, f, nil
+	}
+	switch {
+	case f < twoPow63:
+		// The sum of an in-range float and its delta never overflows int64 here, since
+		// the values near 2^63 are rounded up to 2^63.
+		return b, int64(f) + delta, nil
+	case f < twoPow64:
+		return b, addUint64Delta(uint64(f), delta), nil
+	}
+	// f is 2^64, the delta is negative.
+	return b, math.MaxUint64 - uint64(-delta) + 1, nil
+}
+
+func addUint64Delta(u uint64, delta int64) interface{} {
+	if delta >= 0 {
+		return u + uint64(delta)
+	}
+	v := u - uint64(-delta)
+	if v <= math.MaxInt64 {
+		return int64(v)
+	}
+	return v
+}
+
+// DecodeComparableOne decodes one value written by EncodeComparableKey. The enums and
+// sets are decoded to their numbers like the ones written by EncodeKey, the other flags
+// are decoded by DecodeOne.
+func DecodeComparableOne(b []byte) (remain []byte, d types.CausetObjectQL, err error) {
+	if len(b) < 1 {
+		return nil, d, errors.New("invalid encoded key")
+	}
+	flag := b[0]
+	b = b[1:]
+	switch flag {
+	case comparableJSONFlag:
+		var v interface{}
+		if b, v, err = decodeJSONElem(b); err != nil {
+			return b, d, errors.Trace(err)
+		}
+		d.SetMysqlJSON(json.CreateBinary(v))
+	case enumNameFlag, setNameFlag:
+		if b, _, err = DecodeBytes(b, nil); err != nil {
+			return b, d, errors.Trace(err)
+		}
+		var v uint64
+		if b, v, err = DecodeUint(b); err != nil {
+			return b, d, errors.Trace(err)
+		}
+		d.SetUint64(v)
+	default:
+		return DecodeOne(append([]byte{flag}, b...))
+	}
+	return b, d, nil
+}
+
+func decodeJSONElem(b []byte) (_ []byte, v interface{}, err error) {
+	if len(b) < 1 {
+		return nil, nil, errors.New("invalid comparable JSON")
+	}
+	precedence := b[0]
+	b = b[1:]
+	switch precedence {
+	case jsonNullPrecedence:
+		return b, nil, nil
+	case jsonBoolPrecedence:
+		if len(b) < 1 {
+			return nil, nil, errors.New("invalid comparable JSON boolean")
+		}
+		return b[1:], b[0] == 1, nil
+	case jsonNumberPrecedence:
+		return decodeJSONNumber(b)
+	case jsonStringPrecedence:
+		var s []byte
+		if b, s, err = DecodeBytes(b, nil); err != nil {
+			return b, nil, err
+		}
+		return b, string(s), nil
+	case jsonArrayPrecedence:
+		arr := make([]interface{}, 0)
+		for len(b) > 0 && b[0] != jsonArrayEnd {
+			var elem interface{}
+			if b, elem, err = decodeJSONElem(b); err != nil {
+				return b, nil, err
+			}
+			arr = append(arr, elem)
+		}
+		if len(b) == 0 {
+			return nil, nil, errors.New("invalid comparable JSON array")
+		}
+		return b[1:], arr, nil
+	}
+	return nil, nil, errors.Errorf("invalid comparable JSON precedence %d", precedence)
+}
+
+// comparableSizeOfJSON estimates the size of a JSON value encoded by EncodeComparableKey.
+// The sizes of the comparable bytes are upper bounds because of the padding.
+func comparableSizeOfJSON(j json.BinaryJSON) int {
+	if !isComparableJSON(j) {
+		return 2 + len(j.Value)
+	}
+	return 1 + estimateJSONElemSize(j)
+}
+
+// comparableSizeOfName estimates the size of an enum or set encoded by EncodeComparableKey,
+// the collation key is assumed to be no longer than the name.
+func comparableSizeOfName(name string) int {
+	return 1 + sizeBytes([]byte(name), true) + 8
+}
+
+func estimateJSONElemSize(j json.BinaryJSON) int {
+	switch j.TypeCode {
+	case json.TypeCodeLiteral:
+		return 2
+	case json.TypeCodeInt64, json.TypeCodeUint64, json.TypeCodeFloat64:
+		return 1 + 8 + 8
+	case json.TypeCodeString:
+		return 1 + sizeBytes(j.GetString(), true)
+	case json.TypeCodeArray:
+		size := 2
+		for i := 0; i < j.GetElemCount(); i++ {
+			size += estimateJSONElemSize(j.ArrayGetElem(i))
+		}
+		return size
+	}
+	return 2 + len(j.Value)
+}
@@ -0,0 +1,130 @@
+//MilevaDB Copyright (c) 2022 MilevaDB Authors: Karl Whitford, Spencer Fogelman, Josh Leder
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a INTERLOCKy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/whtcorpsinc/MilevaDB-Prod/causetnetctx/stmtctx"
+	"github.com/whtcorpsinc/MilevaDB-Prod/types"
+	"github.com/whtcorpsinc/MilevaDB-Prod/types/json"
+	. "github.com/whtcorpsinc/check"
+)
+
+func TestT(t *testing.T) {
+	TestingT(t)
+}
+
+var _ = Suite(&testComparableSuite{})
+
+type testComparableSuite struct{}
+
+func (s *testComparableSuite) encodeJSON(c *C, v interface{}) []byte {
+	b, err := EncodeComparableKey(&stmtctx.StatementContext{}, nil, types.NewCauset(json.CreateBinary(v)))
+	c.Assert(err, IsNil)
+	return b
+}
+
+func (s *testComparableSuite) TestJSONRoundTrip(c *C) {
+	sc := &stmtctx.StatementContext{}
+	for _, v := range []interface{}{
+		nil, true, false, "abc", int64(-5), int64(math.MinInt64), int64(math.MaxInt64),
+		uint64(math.MaxUint64), uint64(1<<63 + 1), 1.5, -2.25, float64(1 << 70),
+		[]interface{}{int64(1), "a", []interface{}{nil, true}},
+		map[string]interface{}{"a": int64(1)},
+	} {
+		j := json.CreateBinary(v)
+		b, err := EncodeComparableKey(sc, nil, types.NewCauset(j))
+		c.Assert(err, IsNil)
+		size, err := EstimateValueSize(sc, types.NewCauset(j))
+		c.Assert(err, IsNil)
+		c.Assert(len(b) <= size, IsTrue, Commentf("%v", v))
+
+		remain, d, err := DecodeComparableOne(b)
+		c.Assert(err, IsNil)
+		c.Assert(remain, HasLen, 0)
+		c.Assert(json.CompareBinary(d.GetMysqlJSON(), j), Equals, 0, Commentf("%v", v))
+	}
+}
+
+func (s *testComparableSuite) TestJSONNumberByValue(c *C) {
+	// The equal numbers of different types get the same key.
+	c.Assert(s.encodeJSON(c, int64(1)), BytesEquals, s.encodeJSON(c, 1.0))
+	c.Assert(s.encodeJSON(c, uint64(1)), BytesEquals, s.encodeJSON(c, int64(1)))
+	c.Assert(s.encodeJSON(c, uint64(1<<62)), BytesEquals, s.encodeJSON(c, int64(1<<62)))
+}
+
+func (s *testComparableSuite) TestJSONOrder(c *C) {
+	// The values are in ascending order of the JSON comparison.
+	values := []interface{}{
+		nil,
+		float64(math.MinInt64) * 4,
+		int64(math.MinInt64),
+		int64(-5),
+		-2.25,
+		int64(1),
+		1.5,
+		int64(1<<53 + 1),
+		int64(math.MaxInt64 - 1),
+		int64(math.MaxInt64),
+		uint64(math.MaxInt64 + 1),
+		uint64(math.MaxUint64 - 1),
+		uint64(math.MaxUint64),
+		float64(1 << 70),
+		"",
+		"a",
+		"b",
+		[]interface{}{},
+		[]interface{}{int64(1)},
+		[]interface{}{int64(1), int64(2)},
+		[]interface{}{int64(2)},
+		false,
+		true,
+	}
+	for i := 1; i < len(values); i++ {
+		prev, cur := s.encodeJSON(c, values[i-1]), s.encodeJSON(c, values[i])
+		c.Assert(bytes.Compare(prev, cur), Equals, -1, Commentf("%v < %v", values[i-1], values[i]))
+		c.Assert(json.CompareBinary(json.CreateBinary(values[i-1]), json.CreateBinary(values[i])), Equals, -1)
+	}
+}
+
+func (s *testComparableSuite) TestEnumSetRoundTrip(c *C) {
+	sc := &stmtctx.StatementContext{}
+	a := types.NewCauset(types.Enum{Name: "a", Value: 2})
+	b := types.NewCauset(types.Enum{Name: "b", Value: 1})
+	ka, err := EncodeComparableKey(sc, nil, a)
+	c.Assert(err, IsNil)
+	kb, err := EncodeComparableKey(sc, nil, b)
+	c.Assert(err, IsNil)
+	// The enums are ordered by their names, not their numbers.
+	c.Assert(bytes.Compare(ka, kb), Equals, -1)
+	_, d, err := DecodeComparableOne(ka)
+	c.Assert(err, IsNil)
+	c.Assert(d.GetUint64(), Equals, uint64(2))
+
+	set := types.NewCauset(types.Set{Name: "x,y", Value: 3})
+	k, err := EncodeComparableKey(sc, nil, set, types.NewIntCauset(7))
+	c.Assert(err, IsNil)
+	size, err := EstimateValueSize(sc, set)
+	c.Assert(err, IsNil)
+	remain, d, err := DecodeComparableOne(k)
+	c.Assert(err, IsNil)
+	c.Assert(len(k)-len(remain) <= size, IsTrue)
+	c.Assert(d.GetUint64(), Equals, uint64(3))
+	_, d, err = DecodeComparableOne(remain)
+	c.Assert(err, IsNil)
+	c.Assert(d.GetInt64(), Equals, int64(7))
+}